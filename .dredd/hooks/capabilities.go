@@ -18,6 +18,10 @@ var userKey *db.AccessKey
 var task *db.Task
 var schedule *db.Schedule
 var view *db.View
+var notificationTarget *db.NotificationTarget
+var globalKey *db.AccessKey
+var templateVersion *db.TemplateVersion
+var pipeline *db.TemplatePipeline
 
 // Runtime created simple ID values for some items we need to reference in other objects
 var repoID int
@@ -33,8 +37,13 @@ var capabilities = map[string][]string{
 	"environment": {"repository"},
 	"template":    {"repository", "inventory", "environment", "view"},
 	"task":        {"template"},
+	"version":     {"template"},
 	"schedule":    {"template"},
+	"pipeline":    {"template"},
 	"view":        {},
+
+	"notification_target": {},
+	"global_key":          {},
 }
 
 func capabilityWrapper(cap string) func(t *trans.Transaction) {
@@ -70,6 +79,10 @@ func resolveCapability(caps []string, resolved []string, uid string) {
 			schedule = addSchedule()
 		case "view":
 			view = addView()
+		case "notification_target":
+			notificationTarget = addNotificationTarget()
+		case "pipeline":
+			pipeline = addPipeline()
 		case "user":
 			userPathTestUser = addUser()
 		case "project":
@@ -79,6 +92,8 @@ func resolveCapability(caps []string, resolved []string, uid string) {
 			addUserProjectRelation(userProject.ID, userPathTestUser.ID)
 		case "access_key":
 			userKey = addAccessKey(&userProject.ID)
+		case "global_key":
+			globalKey = addAccessKey(nil)
 		case "repository":
 			pRepo, err := store.CreateRepository(db.Repository{
 				ProjectID: userProject.ID,
@@ -116,7 +131,7 @@ func resolveCapability(caps []string, resolved []string, uid string) {
 			desc := "Hello, World!"
 			res, err := store.CreateTemplate(db.Template{
 				ProjectID:               userProject.ID,
-				InventoryID:             inventoryID,
+				InventoryID:             &inventoryID,
 				RepositoryID:            repoID,
 				EnvironmentID:           &environmentID,
 				Name:                    "Test-" + uid,
@@ -131,6 +146,8 @@ func resolveCapability(caps []string, resolved []string, uid string) {
 			templateID = res.ID
 		case "task":
 			task = addTask()
+		case "version":
+			templateVersion = addTemplateVersion()
 		default:
 			panic("unknown capability " + v)
 		}
@@ -157,6 +174,10 @@ var pathSubPatterns = []func() string{
 	func() string { return strconv.Itoa(task.ID) },
 	func() string { return strconv.Itoa(schedule.ID) },
 	func() string { return strconv.Itoa(view.ID) },
+	func() string { return strconv.Itoa(notificationTarget.ID) },
+	func() string { return strconv.Itoa(globalKey.ID) },
+	func() string { return strconv.Itoa(templateVersion.ID) },
+	func() string { return strconv.Itoa(pipeline.ID) },
 }
 
 // alterRequestPath with the above slice of functions
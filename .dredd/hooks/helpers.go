@@ -47,6 +47,7 @@ func truncateAll() {
 		"access_key",
 		"event",
 		"user__token",
+		"user__favorite_template",
 		"project",
 		"task__output",
 		"task",
@@ -59,6 +60,8 @@ func truncateAll() {
 		"project__user",
 		"user",
 		"project__view",
+		"project__notification_target",
+		"project__template_pipeline",
 	}
 
 	switch store.(type) {
@@ -190,6 +193,37 @@ func addView() *db.View {
 	return &view
 }
 
+func addNotificationTarget() *db.NotificationTarget {
+	target, err := store.CreateNotificationTarget(db.NotificationTarget{
+		ProjectID: userProject.ID,
+		Name:      "Test",
+		Type:      db.NotificationTargetWebhook,
+		URL:       "https://example.com/hook",
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return &target
+}
+
+func addPipeline() *db.TemplatePipeline {
+	pipeline, err := store.CreateTemplatePipeline(db.TemplatePipeline{
+		ProjectID: userProject.ID,
+		Name:      "Test",
+		Stages: []db.TemplatePipelineStage{
+			{TemplateID: templateID},
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return &pipeline
+}
+
 func addSchedule() *db.Schedule {
 	schedule, err := store.CreateSchedule(db.Schedule{
 		TemplateID: int(templateID),
@@ -225,6 +259,29 @@ func addTask() *db.Task {
 	return &t
 }
 
+// addTemplateVersion changes the template, so its previous state is saved as a version
+func addTemplateVersion() *db.TemplateVersion {
+	tpl, err := store.GetTemplate(userProject.ID, templateID)
+	if err != nil {
+		panic(err)
+	}
+
+	desc := "Changed description"
+	tpl.Description = &desc
+
+	err = store.UpdateTemplate(tpl)
+	if err != nil {
+		panic(err)
+	}
+
+	versions, err := store.GetTemplateVersions(userProject.ID, templateID)
+	if err != nil {
+		panic(err)
+	}
+
+	return &versions[0]
+}
+
 // Token Handling
 func addToken(tok string, user int) {
 	_, err := store.CreateAPIToken(db.APIToken{
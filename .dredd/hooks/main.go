@@ -98,6 +98,18 @@ func main() {
 	h.Before("project > /api/project/{project_id}/templates/{template_id} > Get template > 200 > application/json", capabilityWrapper("template"))
 	h.Before("project > /api/project/{project_id}/templates/{template_id} > Updates template > 204 > application/json", capabilityWrapper("template"))
 	h.Before("project > /api/project/{project_id}/templates/{template_id} > Removes template > 204 > application/json", capabilityWrapper("template"))
+	h.Before("project > /api/project/{project_id}/templates/{template_id}/archive > Archives the template > 204 > application/json", capabilityWrapper("template"))
+	h.Before("project > /api/project/{project_id}/templates/{template_id}/concurrency > Get limits of running tasks which apply to the template > 200 > application/json", capabilityWrapper("template"))
+	h.Before("project > /api/project/{project_id}/templates/{template_id}/variables > Get variables which tasks of the template expect > 200 > application/json", capabilityWrapper("template"))
+	h.Before("project > /api/project/{project_id}/templates/{template_id}/versions > Get previous states of the template > 200 > application/json", capabilityWrapper("version"))
+	h.Before("project > /api/project/{project_id}/templates/{template_id}/versions/{version_id}/rollback > Restores the template to the state saved in the version > 204 > application/json", capabilityWrapper("version"))
+	h.Before("project > /api/project/{project_id}/templates/{template_id}/favorite > Pins the template for the current user > 204 > application/json", capabilityWrapper("template"))
+	h.Before("project > /api/project/{project_id}/templates/{template_id}/favorite > Unpins the template for the current user > 204 > application/json", func(t *trans.Transaction) {
+		addCapabilities([]string{"template"})
+		dbConnect()
+		defer store.Close("")
+		printError(store.AddFavoriteTemplate(testRunnerUser.ID, userProject.ID, templateID))
+	})
 
 	h.Before("project > /api/project/{project_id}/tasks > Starts a job > 201 > application/json", capabilityWrapper("template"))
 	h.Before("project > /api/project/{project_id}/tasks/last > Get last 200 Tasks related to current project > 200 > application/json", capabilityWrapper("template"))
@@ -105,8 +117,11 @@ func main() {
 	h.Before("project > /api/project/{project_id}/tasks/{task_id} > Get a single task > 200 > application/json", capabilityWrapper("task"))
 	h.Before("project > /api/project/{project_id}/tasks/{task_id} > Deletes task (including output) > 204 > application/json", capabilityWrapper("task"))
 	h.Before("project > /api/project/{project_id}/tasks/{task_id}/output > Get task output > 200 > application/json", capabilityWrapper("task"))
+	h.Before("project > /api/project/{project_id}/tasks/{task_id}/output/ndjson > Get task output as newline-delimited JSON > 200 > application/x-ndjson", capabilityWrapper("task"))
+	h.Before("project > /api/project/{project_id}/tasks/{task_id}/events > Get events of the task lifecycle > 200 > application/json", capabilityWrapper("task"))
 	h.Before("project > /api/project/{project_id}/tasks/{task_id}/stop > Stop a job > 204 > application/json", capabilityWrapper("task"))
 
+	h.Before("schedule > /api/project/{project_id}/schedules > Get schedules of all templates of the project > 200 > application/json", capabilityWrapper("schedule"))
 	h.Before("schedule > /api/project/{project_id}/schedules/{schedule_id} > Get schedule > 200 > application/json", capabilityWrapper("schedule"))
 	h.Before("schedule > /api/project/{project_id}/schedules/{schedule_id} > Updates schedule > 204 > application/json", capabilityWrapper("schedule"))
 	h.Before("schedule > /api/project/{project_id}/schedules/{schedule_id} > Deletes schedule > 204 > application/json", capabilityWrapper("schedule"))
@@ -114,6 +129,19 @@ func main() {
 	h.Before("project > /api/project/{project_id}/views/{view_id} > Get view > 200 > application/json", capabilityWrapper("view"))
 	h.Before("project > /api/project/{project_id}/views/{view_id} > Updates view > 204 > application/json", capabilityWrapper("view"))
 	h.Before("project > /api/project/{project_id}/views/{view_id} > Removes view > 204 > application/json", capabilityWrapper("view"))
+	h.Before("project > /api/project/{project_id}/views/{view_id}/move > Moves view to the position > 204 > application/json", capabilityWrapper("view"))
+
+	h.Before("project > /api/project/{project_id}/notification_targets/{target_id} > Get notification target > 200 > application/json", capabilityWrapper("notification_target"))
+	h.Before("project > /api/project/{project_id}/notification_targets/{target_id} > Updates notification target > 204 > application/json", capabilityWrapper("notification_target"))
+	h.Before("project > /api/project/{project_id}/notification_targets/{target_id} > Removes notification target > 204 > application/json", capabilityWrapper("notification_target"))
+
+	h.Before("project > /api/project/{project_id}/pipelines/{pipeline_id} > Get template pipeline > 200 > application/json", capabilityWrapper("pipeline"))
+	h.Before("project > /api/project/{project_id}/pipelines/{pipeline_id} > Updates template pipeline > 204 > application/json", capabilityWrapper("pipeline"))
+	h.Before("project > /api/project/{project_id}/pipelines/{pipeline_id} > Removes template pipeline > 204 > application/json", capabilityWrapper("pipeline"))
+
+	h.Before("global_key > /api/keys/{key_id} > Get global access key > 200 > application/json", capabilityWrapper("global_key"))
+	h.Before("global_key > /api/keys/{key_id} > Updates global access key > 204 > application/json", capabilityWrapper("global_key"))
+	h.Before("global_key > /api/keys/{key_id} > Removes global access key > 204 > application/json", capabilityWrapper("global_key"))
 
 	//Add these last as they normalize the requests and path values after hook processing
 	h.BeforeAll(func(transactions []*trans.Transaction) {
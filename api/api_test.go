@@ -3,9 +3,17 @@ package api
 import (
 	//_ "github.com/snikch/goodman/hooks"
 	//_ "github.com/snikch/goodman/transaction"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/db/bolt"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
 )
 
 func TestApiPing(t *testing.T) {
@@ -20,3 +28,174 @@ func TestApiPing(t *testing.T) {
 		t.Errorf("Response code should be 200 %d", rr.Code)
 	}
 }
+
+// createTestProjectMember creates a project with the member of the role and returns
+// the router which uses the store and API token of the member.
+func createTestProjectMember(t *testing.T, role db.ProjectUserRole) (db.Store, db.Project, *mux.Router, string) {
+	store := bolt.CreateTestStore()
+
+	user, err := store.CreateUser(db.UserWithPwd{
+		Pwd:  "123456",
+		User: db.User{Username: "member", Name: "Member", Email: "member@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateProjectUser(db.ProjectUser{ProjectID: proj.ID, UserID: user.ID, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := store.CreateAPIToken(db.APIToken{ID: "membertoken", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Route()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			context.Set(r, "store", store)
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	return store, proj, r, token.ID
+}
+
+func TestGuestCanFavoriteTemplate(t *testing.T) {
+	store, proj, r, token := createTestProjectMember(t, db.ProjectGuest)
+
+	tpl, err := store.CreateTemplate(db.Template{ProjectID: proj.ID, Name: "Test", Playbook: "test.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := fmt.Sprintf("/api/project/%d/templates/%d/favorite", proj.ID, tpl.ID)
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("%s must be allowed for the project member, got %d", method, rr.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/project/%d/templates/%d", proj.ID, tpl.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("guest must not be able to update the template, got %d", rr.Code)
+	}
+}
+
+func TestTaskRunnerCannotMoveTaskInQueue(t *testing.T) {
+	store, proj, r, token := createTestProjectMember(t, db.ProjectTaskRunner)
+
+	task, err := store.CreateTask(db.Task{ProjectID: proj.ID, Status: db.TaskWaitingStatus})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := fmt.Sprintf("/api/project/%d/tasks/%d/queue_position", proj.ID, task.ID)
+	req, _ := http.NewRequest("POST", url, strings.NewReader(`{"position": 0}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("task runner must not be able to move tasks in the queue, got %d", rr.Code)
+	}
+}
+
+func TestNotificationTargetURLIsMaskedForGuest(t *testing.T) {
+	for _, c := range []struct {
+		role   db.ProjectUserRole
+		masked bool
+	}{
+		{db.ProjectGuest, true},
+		{db.ProjectManager, false},
+	} {
+		store, proj, r, token := createTestProjectMember(t, c.role)
+
+		target, err := store.CreateNotificationTarget(db.NotificationTarget{
+			ProjectID: proj.ID,
+			Name:      "Deploys",
+			Type:      db.NotificationTargetWebhook,
+			URL:       "https://hooks.example.com/secret-path",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, url := range []string{
+			fmt.Sprintf("/api/project/%d/notification_targets", proj.ID),
+			fmt.Sprintf("/api/project/%d/notification_targets/%d", proj.ID, target.ID),
+		} {
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s must be allowed for %s, got %d", url, c.role, rr.Code)
+			}
+
+			body := rr.Body.String()
+
+			if strings.Contains(body, target.Secret) {
+				t.Fatalf("%s must not return the secret", url)
+			}
+
+			if strings.Contains(body, target.URL) == c.masked {
+				t.Fatalf("unexpected URL for %s in %s: %s", c.role, url, body)
+			}
+		}
+	}
+}
+
+func TestGuestCanListTemplates(t *testing.T) {
+	store, proj, r, token := createTestProjectMember(t, db.ProjectGuest)
+
+	for _, tpl := range []db.Template{
+		{ProjectID: proj.ID, Name: "Build", Playbook: "build.yml"},
+		{ProjectID: proj.ID, Name: "Deploy", Playbook: "deploy.yml", AllowedRoles: []db.ProjectUserRole{db.ProjectManager}},
+	} {
+		if _, err := store.CreateTemplate(tpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/project/%d/templates", proj.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("guest must be able to list templates, got %d", rr.Code)
+	}
+
+	var templates []db.Template
+	if err := json.Unmarshal(rr.Body.Bytes(), &templates); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templates) != 2 {
+		t.Fatalf("allowed roles restrict running, not listing of templates, got %d templates", len(templates))
+	}
+}
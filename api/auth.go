@@ -120,3 +120,16 @@ func authenticationWithStore(next http.Handler) http.Handler {
 		}
 	})
 }
+
+// adminMiddleware allows requests of admins only.
+func adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.Get(r, "user").(*db.User)
+		if !user.Admin {
+			log.Warn(user.Username + " is not permitted to access " + r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
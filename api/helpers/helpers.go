@@ -94,6 +94,26 @@ func WriteError(w http.ResponseWriter, err error) {
 	}
 }
 
+// PageParams returns the page defined by limit and offset query parameters.
+// Invalid values are ignored.
+func PageParams(url *url.URL) db.RetrieveQueryParams {
+	limit, _ := strconv.Atoi(url.Query().Get("limit"))
+	offset, _ := strconv.Atoi(url.Query().Get("offset"))
+
+	if limit < 0 {
+		limit = 0
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	return db.RetrieveQueryParams{
+		Count:  limit,
+		Offset: offset,
+	}
+}
+
 func QueryParams(url *url.URL) db.RetrieveQueryParams {
 	return db.RetrieveQueryParams{
 		SortBy:       url.Query().Get("sort"),
@@ -0,0 +1,148 @@
+package api
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/ansible-semaphore/semaphore/api/helpers"
+	"github.com/ansible-semaphore/semaphore/db"
+	"net/http"
+
+	"github.com/gorilla/context"
+)
+
+// globalKeyMiddleware ensures a global key exists and loads it to the context
+func globalKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := helpers.GetIntParam("key_id", w, r)
+		if err != nil {
+			return
+		}
+
+		key, err := helpers.Store(r).GetGlobalAccessKey(keyID)
+
+		if err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+
+		key.Secret = nil
+
+		context.Set(r, "accessKey", key)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getGlobalKeys returns keys which can be used by all projects
+func getGlobalKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := helpers.Store(r).GetGlobalAccessKeys(helpers.QueryParams(r.URL))
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, keys)
+}
+
+func getGlobalKey(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteJSON(w, http.StatusOK, context.Get(r, "accessKey").(db.AccessKey))
+}
+
+func createGlobalKeyEvent(r *http.Request, key db.AccessKey, desc string) {
+	user := context.Get(r, "user").(*db.User)
+	objType := db.EventKey
+
+	_, err := helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ObjectType:  &objType,
+		ObjectID:    &key.ID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// addGlobalKey adds a key which doesn't belong to any project
+func addGlobalKey(w http.ResponseWriter, r *http.Request) {
+	var key db.AccessKey
+
+	if !helpers.Bind(w, r, &key) {
+		return
+	}
+
+	if key.ProjectID != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Global key can not belong to project",
+		})
+		return
+	}
+
+	if err := key.Validate(true); err != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	newKey, err := helpers.Store(r).CreateAccessKey(key)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	createGlobalKeyEvent(r, newKey, "Global Access Key "+newKey.Name+" created")
+
+	newKey.Secret = nil
+	helpers.WriteJSON(w, http.StatusCreated, newKey)
+}
+
+func updateGlobalKey(w http.ResponseWriter, r *http.Request) {
+	oldKey := context.Get(r, "accessKey").(db.AccessKey)
+
+	var key db.AccessKey
+
+	if !helpers.Bind(w, r, &key) {
+		return
+	}
+
+	if key.ID != oldKey.ID || key.ProjectID != nil {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Key ID in body and URL must be the same, global key can not be moved to project",
+		})
+		return
+	}
+
+	err := helpers.Store(r).UpdateAccessKey(key)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	createGlobalKeyEvent(r, oldKey, "Global Access Key "+key.Name+" updated")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func removeGlobalKey(w http.ResponseWriter, r *http.Request) {
+	key := context.Get(r, "accessKey").(db.AccessKey)
+
+	err := helpers.Store(r).DeleteGlobalAccessKey(key.ID)
+	if err == db.ErrInvalidOperation {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "Access Key is in use by one or more projects",
+			"inUse": true,
+		})
+		return
+	}
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	createGlobalKeyEvent(r, key, "Global Access Key "+key.Name+" deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
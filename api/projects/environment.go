@@ -39,7 +39,7 @@ func GetEnvironmentRefs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSON(w, http.StatusOK, refs)
+	helpers.WriteJSON(w, http.StatusOK, refs.Page(helpers.PageParams(r.URL)))
 }
 
 // GetEnvironment retrieves sorted environments from the database
@@ -93,6 +93,30 @@ func UpdateEnvironment(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RenameEnvironmentVariable renames the extra variable in all environments of the project
+func RenameEnvironmentVariable(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	var body struct {
+		OldKey string `json:"old_key"`
+		NewKey string `json:"new_key"`
+	}
+
+	if !helpers.Bind(w, r, &body) {
+		return
+	}
+
+	count, err := helpers.Store(r).UpdateEnvironmentVariableAcrossProject(project.ID, body.OldKey, body.NewKey)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, map[string]int{
+		"updated": count,
+	})
+}
+
 // AddEnvironment creates an environment in the database
 func AddEnvironment(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
@@ -140,7 +164,9 @@ func RemoveEnvironment(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
-	err = helpers.Store(r).DeleteEnvironment(env.ProjectID, env.ID)
+	cascade := r.URL.Query().Get("cascade") == "true"
+
+	err = db.DeleteEnvironmentWithRefs(helpers.Store(r), env.ProjectID, env.ID, cascade)
 	if err == db.ErrInvalidOperation {
 		helpers.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"error": "Environment is in use by one or more templates",
@@ -5,6 +5,7 @@ import (
 	"github.com/ansible-semaphore/semaphore/api/helpers"
 	"github.com/ansible-semaphore/semaphore/db"
 	"net/http"
+	"net/url"
 
 	"os"
 	"path/filepath"
@@ -42,13 +43,30 @@ func GetInventoryRefs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSON(w, http.StatusOK, refs)
+	helpers.WriteJSON(w, http.StatusOK, refs.Page(helpers.PageParams(r.URL)))
+}
+
+// GetInventoryGroups returns host groups declared in the static inventory
+func GetInventoryGroups(w http.ResponseWriter, r *http.Request) {
+	inventory := context.Get(r, "inventory").(db.Inventory)
+	groups, err := inventory.GetGroups()
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, groups)
 }
 
 // GetInventory returns an inventory from the database
 func GetInventory(w http.ResponseWriter, r *http.Request) {
 	if inventory := context.Get(r, "inventory"); inventory != nil {
-		helpers.WriteJSON(w, http.StatusOK, inventory.(db.Inventory))
+		inv := inventory.(db.Inventory)
+		if err := db.FillInventoryKeyNames(helpers.Store(r), &inv); err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+		helpers.WriteJSON(w, http.StatusOK, inv)
 		return
 	}
 
@@ -61,6 +79,13 @@ func GetInventory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for i := range inventories {
+		if err = db.FillInventoryKeyNames(helpers.Store(r), &inventories[i]); err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+	}
+
 	helpers.WriteJSON(w, http.StatusOK, inventories)
 }
 
@@ -84,6 +109,13 @@ func AddInventory(w http.ResponseWriter, r *http.Request) {
 	switch inventory.Type {
 	case db.InventoryStatic, db.InventoryStaticYaml, db.InventoryFile:
 		break
+	case db.InventoryURL:
+		if !IsValidInventoryURL(inventory.Inventory) {
+			helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "Inventory URL must be an absolute http or https URL",
+			})
+			return
+		}
 	default:
 		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
 			"error": "Not supported inventory type",
@@ -139,6 +171,16 @@ func IsValidInventoryPath(path string) bool {
 	return !strings.HasPrefix(relPath, "..")
 }
 
+// IsValidInventoryURL tests that the inventory can be fetched from the URL
+func IsValidInventoryURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 // UpdateInventory writes updated values to an existing inventory item in the database
 func UpdateInventory(w http.ResponseWriter, r *http.Request) {
 	oldInventory := context.Get(r, "inventory").(db.Inventory)
@@ -171,6 +213,11 @@ func UpdateInventory(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+	case db.InventoryURL:
+		if !IsValidInventoryURL(inventory.Inventory) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 	default:
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -191,7 +238,9 @@ func RemoveInventory(w http.ResponseWriter, r *http.Request) {
 	inventory := context.Get(r, "inventory").(db.Inventory)
 	var err error
 
-	err = helpers.Store(r).DeleteInventory(inventory.ProjectID, inventory.ID)
+	cascade := r.URL.Query().Get("cascade") == "true"
+
+	err = db.DeleteInventoryWithRefs(helpers.Store(r), inventory.ProjectID, inventory.ID, cascade)
 	if err == db.ErrInvalidOperation {
 		helpers.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"error": "Inventory is in use by one or more templates",
@@ -18,7 +18,7 @@ func KeyMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		key, err := helpers.Store(r).GetAccessKey(project.ID, keyID)
+		key, err := helpers.Store(r).GetAccessKeyMeta(project.ID, keyID)
 
 		if err != nil {
 			helpers.WriteError(w, err)
@@ -38,13 +38,38 @@ func GetKeyRefs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSON(w, http.StatusOK, refs)
+	helpers.WriteJSON(w, http.StatusOK, refs.Page(helpers.PageParams(r.URL)))
+}
+
+// keysViewerRole returns the role which limits information about keys visible for the current user.
+// Administrators see keys as owners of the project.
+func keysViewerRole(r *http.Request) db.ProjectUserRole {
+	user := context.Get(r, "user").(*db.User)
+	if user.Admin {
+		return db.ProjectOwner
+	}
+	return context.Get(r, "projectUserRole").(db.ProjectUserRole)
+}
+
+// writeKeysError writes the error of keys retrieving, guests are not allowed to see keys.
+func writeKeysError(w http.ResponseWriter, err error) {
+	if err == db.ErrInvalidOperation {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	helpers.WriteError(w, err)
 }
 
 // GetKeys retrieves sorted keys from the database
 func GetKeys(w http.ResponseWriter, r *http.Request) {
+	role := keysViewerRole(r)
+
 	if key := context.Get(r, "accessKey"); key != nil {
-		k := key.(db.AccessKey)
+		k, err := key.(db.AccessKey).ForRole(role)
+		if err != nil {
+			writeKeysError(w, err)
+			return
+		}
 		helpers.WriteJSON(w, http.StatusOK, k)
 		return
 	}
@@ -52,13 +77,27 @@ func GetKeys(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
 	var keys []db.AccessKey
 
-	keys, err := helpers.Store(r).GetAccessKeys(project.ID, helpers.QueryParams(r.URL))
+	keys, err := db.GetAccessKeysForRole(helpers.Store(r), project.ID, role, helpers.QueryParams(r.URL))
 
 	if err != nil {
-		helpers.WriteError(w, err)
+		writeKeysError(w, err)
 		return
 	}
 
+	// global keys can be referenced by objects of the project too
+	if r.URL.Query().Get("include_global") == "true" {
+		var globalKeys []db.AccessKey
+		globalKeys, err = helpers.Store(r).GetGlobalAccessKeys(helpers.QueryParams(r.URL))
+		if err == nil {
+			globalKeys, err = db.AccessKeysForRole(globalKeys, role)
+		}
+		if err != nil {
+			writeKeysError(w, err)
+			return
+		}
+		keys = append(keys, globalKeys...)
+	}
+
 	helpers.WriteJSON(w, http.StatusOK, keys)
 }
 
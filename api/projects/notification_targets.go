@@ -0,0 +1,237 @@
+package projects
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/ansible-semaphore/semaphore/api/helpers"
+	"github.com/ansible-semaphore/semaphore/db"
+	"net/http"
+
+	"github.com/gorilla/context"
+)
+
+// NotificationTargetMiddleware ensures a notification target exists and loads it to the context
+func NotificationTargetMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project := context.Get(r, "project").(db.Project)
+		targetID, err := helpers.GetIntParam("target_id", w, r)
+		if err != nil {
+			return
+		}
+
+		target, err := helpers.Store(r).GetNotificationTarget(project.ID, targetID)
+
+		if err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+
+		context.Set(r, "notificationTarget", target)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// notificationTargetWithSecret is the response to the request which creates or changes
+// the secret of the target. The secret is not returned by other requests.
+type notificationTargetWithSecret struct {
+	db.NotificationTarget
+	Secret string `json:"secret"`
+}
+
+// canViewNotificationTargetURLs checks if the current user can see URLs of notification targets.
+// URLs of Slack incoming webhooks and other targets work as credentials.
+func canViewNotificationTargetURLs(r *http.Request) bool {
+	user := context.Get(r, "user").(*db.User)
+	if user.Admin {
+		return true
+	}
+	projectUserRole := context.Get(r, "projectUserRole").(db.ProjectUserRole)
+	return projectUserRole.Can(db.CanManageProjectResources)
+}
+
+// GetNotificationTargets returns the notification target from the context or all targets of the project
+func GetNotificationTargets(w http.ResponseWriter, r *http.Request) {
+	canViewURLs := canViewNotificationTargetURLs(r)
+
+	if target := context.Get(r, "notificationTarget"); target != nil {
+		res := target.(db.NotificationTarget)
+		if !canViewURLs {
+			res.URL = db.MaskedValue
+		}
+		helpers.WriteJSON(w, http.StatusOK, res)
+		return
+	}
+
+	project := context.Get(r, "project").(db.Project)
+
+	targets, err := helpers.Store(r).GetNotificationTargets(project.ID)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	if !canViewURLs {
+		for i := range targets {
+			targets[i].URL = db.MaskedValue
+		}
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, targets)
+}
+
+// AddNotificationTarget adds a notification target to the database
+func AddNotificationTarget(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	var target db.NotificationTarget
+
+	if !helpers.Bind(w, r, &target) {
+		return
+	}
+
+	if target.ProjectID != project.ID {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Project ID in body and URL must be the same",
+		})
+		return
+	}
+
+	newTarget, err := helpers.Store(r).CreateNotificationTarget(target)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	objType := db.EventNotificationTarget
+	desc := "Notification target " + newTarget.Name + " created"
+
+	_, err = helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &newTarget.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &newTarget.ID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	helpers.WriteJSON(w, http.StatusCreated, notificationTargetWithSecret{
+		NotificationTarget: newTarget,
+		Secret:             newTarget.Secret,
+	})
+}
+
+// UpdateNotificationTarget updates the notification target in the database
+func UpdateNotificationTarget(w http.ResponseWriter, r *http.Request) {
+	oldTarget := context.Get(r, "notificationTarget").(db.NotificationTarget)
+	var target db.NotificationTarget
+
+	if !helpers.Bind(w, r, &target) {
+		return
+	}
+
+	if target.ID != oldTarget.ID {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Notification target ID in URL and in body must be the same",
+		})
+		return
+	}
+
+	if target.ProjectID != oldTarget.ProjectID {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Project ID in body and URL must be the same",
+		})
+		return
+	}
+
+	if err := helpers.Store(r).UpdateNotificationTarget(target); err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	objType := db.EventNotificationTarget
+	desc := "Notification target " + target.Name + " updated"
+
+	_, err := helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &oldTarget.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &oldTarget.ID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateNotificationTargetSecret replaces the secret of the webhook notification target
+// and returns the target with the new secret
+func RotateNotificationTargetSecret(w http.ResponseWriter, r *http.Request) {
+	target := context.Get(r, "notificationTarget").(db.NotificationTarget)
+
+	secret, err := helpers.Store(r).RotateWebhookSecret(target.ProjectID, target.ID)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	objType := db.EventNotificationTarget
+	desc := "Secret of notification target " + target.Name + " rotated"
+
+	_, err = helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &target.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &target.ID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, notificationTargetWithSecret{
+		NotificationTarget: target,
+		Secret:             secret,
+	})
+}
+
+// RemoveNotificationTarget deletes the notification target from the database
+func RemoveNotificationTarget(w http.ResponseWriter, r *http.Request) {
+	target := context.Get(r, "notificationTarget").(db.NotificationTarget)
+
+	err := helpers.Store(r).DeleteNotificationTarget(target.ProjectID, target.ID)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	desc := "Notification target " + target.Name + " deleted"
+
+	_, err = helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &target.ProjectID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
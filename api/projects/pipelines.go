@@ -0,0 +1,180 @@
+package projects
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/ansible-semaphore/semaphore/api/helpers"
+	"github.com/ansible-semaphore/semaphore/db"
+	"net/http"
+
+	"github.com/gorilla/context"
+)
+
+// PipelineMiddleware ensures a template pipeline exists and loads it to the context
+func PipelineMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project := context.Get(r, "project").(db.Project)
+		pipelineID, err := helpers.GetIntParam("pipeline_id", w, r)
+		if err != nil {
+			return
+		}
+
+		pipeline, err := helpers.Store(r).GetTemplatePipeline(project.ID, pipelineID)
+
+		if err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+
+		context.Set(r, "pipeline", pipeline)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetPipelines returns the pipeline from the context or all pipelines of the project
+func GetPipelines(w http.ResponseWriter, r *http.Request) {
+	if pipeline := context.Get(r, "pipeline"); pipeline != nil {
+		helpers.WriteJSON(w, http.StatusOK, pipeline.(db.TemplatePipeline))
+		return
+	}
+
+	project := context.Get(r, "project").(db.Project)
+
+	pipelines, err := helpers.Store(r).GetTemplatePipelines(project.ID)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, pipelines)
+}
+
+// AddPipeline adds a template pipeline to the database
+func AddPipeline(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	var pipeline db.TemplatePipeline
+
+	if !helpers.Bind(w, r, &pipeline) {
+		return
+	}
+
+	if pipeline.ProjectID != project.ID {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Project ID in body and URL must be the same",
+		})
+		return
+	}
+
+	if err := db.ValidateTemplatePipeline(helpers.Store(r), pipeline); err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	newPipeline, err := helpers.Store(r).CreateTemplatePipeline(pipeline)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	objType := db.EventPipeline
+	desc := "Pipeline " + newPipeline.Name + " created"
+
+	_, err = helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &newPipeline.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &newPipeline.ID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	helpers.WriteJSON(w, http.StatusCreated, newPipeline)
+}
+
+// UpdatePipeline updates the template pipeline in the database
+func UpdatePipeline(w http.ResponseWriter, r *http.Request) {
+	oldPipeline := context.Get(r, "pipeline").(db.TemplatePipeline)
+	var pipeline db.TemplatePipeline
+
+	if !helpers.Bind(w, r, &pipeline) {
+		return
+	}
+
+	if pipeline.ID != oldPipeline.ID {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Pipeline ID in URL and in body must be the same",
+		})
+		return
+	}
+
+	if pipeline.ProjectID != oldPipeline.ProjectID {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Project ID in body and URL must be the same",
+		})
+		return
+	}
+
+	if err := db.ValidateTemplatePipeline(helpers.Store(r), pipeline); err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	if err := helpers.Store(r).UpdateTemplatePipeline(pipeline); err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	objType := db.EventPipeline
+	desc := "Pipeline " + pipeline.Name + " updated"
+
+	_, err := helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &oldPipeline.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &oldPipeline.ID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemovePipeline deletes the template pipeline from the database.
+// Tasks of the pipeline which are already queued still run, but next stages are not started.
+func RemovePipeline(w http.ResponseWriter, r *http.Request) {
+	pipeline := context.Get(r, "pipeline").(db.TemplatePipeline)
+
+	err := helpers.Store(r).DeleteTemplatePipeline(pipeline.ProjectID, pipeline.ID)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	desc := "Pipeline " + pipeline.Name + " deleted"
+
+	_, err = helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &pipeline.ProjectID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -92,6 +92,20 @@ func UpdateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if body.TaskOutputRetentionDays < 0 {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Task output retention days must be 0 or greater",
+		})
+		return
+	}
+
+	if body.TaskRetentionDays < 0 {
+		helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Task retention days must be 0 or greater",
+		})
+		return
+	}
+
 	err := helpers.Store(r).UpdateProject(body)
 
 	if err != nil {
@@ -102,6 +116,28 @@ func UpdateProject(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// SetProjectArchived archives or restores the project
+func SetProjectArchived(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	var body struct {
+		Archived bool `json:"archived"`
+	}
+
+	if !helpers.Bind(w, r, &body) {
+		return
+	}
+
+	err := helpers.Store(r).SetProjectArchived(project.ID, body.Archived)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // DeleteProject removes a project from the database
 func DeleteProject(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
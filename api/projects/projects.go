@@ -14,7 +14,9 @@ import (
 func GetProjects(w http.ResponseWriter, r *http.Request) {
 	user := context.Get(r, "user").(*db.User)
 
-	projects, err := helpers.Store(r).GetProjects(user.ID)
+	projects, err := helpers.Store(r).GetProjectsWithRole(user.ID, db.ProjectFilter{
+		IncludeArchived: r.URL.Query().Get("archived") == "true",
+	})
 
 	if err != nil {
 		helpers.WriteError(w, err)
@@ -38,7 +38,7 @@ func GetRepositoryRefs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSON(w, http.StatusOK, refs)
+	helpers.WriteJSON(w, http.StatusOK, refs.Page(helpers.PageParams(r.URL)))
 }
 
 // GetRepositories returns all repositories in a project sorted by type
@@ -163,7 +163,9 @@ func RemoveRepository(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
-	err = helpers.Store(r).DeleteRepository(repository.ProjectID, repository.ID)
+	force := r.URL.Query().Get("force") == "true"
+
+	err = db.DeleteRepositoryWithRefs(helpers.Store(r), repository.ProjectID, repository.ID, force)
 	if err == db.ErrInvalidOperation {
 		helpers.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
 			"error": "Repository is in use by one or more templates",
@@ -42,6 +42,39 @@ func GetSchedule(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSON(w, http.StatusOK, schedule)
 }
 
+// GetScheduleDetail returns the schedule with its next run, last fire and active status
+func GetScheduleDetail(w http.ResponseWriter, r *http.Request) {
+	schedule := context.Get(r, "schedule").(db.Schedule)
+	pool := context.Get(r, "schedule_pool").(schedules.SchedulePool)
+
+	detail, err := pool.GetScheduleDetail(schedule.ProjectID, schedule.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, detail)
+}
+
+// GetScheduleHistory returns fires of the schedule starting from the most recent
+func GetScheduleHistory(w http.ResponseWriter, r *http.Request) {
+	schedule := context.Get(r, "schedule").(db.Schedule)
+
+	params := helpers.QueryParams(r.URL)
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err == nil && limit > 0 {
+		params.Count = limit
+	}
+
+	runs, err := helpers.Store(r).GetScheduleHistory(schedule.ProjectID, schedule.ID, params)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, runs)
+}
+
 func GetTemplateSchedules(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
 	templateID, err := helpers.GetIntParam("template_id", w, r)
@@ -61,6 +94,19 @@ func GetTemplateSchedules(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSON(w, http.StatusOK, tplSchedules)
 }
 
+// GetProjectSchedules returns schedules of all templates of the project
+func GetProjectSchedules(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	projSchedules, err := helpers.Store(r).GetProjectSchedules(project.ID, helpers.QueryParams(r.URL))
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, projSchedules)
+}
+
 func validateCronFormat(cronFormat string, w http.ResponseWriter) bool {
 	err := schedules.ValidateCronFormat(cronFormat)
 	if err == nil {
@@ -1,15 +1,24 @@
 package projects
 
 import (
+	stdcontext "context"
 	log "github.com/Sirupsen/logrus"
 	"github.com/ansible-semaphore/semaphore/api/helpers"
 	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/util"
 	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 )
 
+// tasksListTimeout limits time of reading the project tasks list.
+// If the database is too slow, tasks read before the timeout are returned
+// and the response has X-Truncated header.
+const tasksListTimeout = 10 * time.Second
+
 // AddTask inserts a task into the database and returns a header or returns error
 func AddTask(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
@@ -21,8 +30,26 @@ func AddTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !user.Admin {
+		tpl, err := helpers.Store(r).GetTemplate(project.ID, taskObj.TemplateID)
+		if err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+
+		if !tpl.CanRun(context.Get(r, "projectUserRole").(db.ProjectUserRole)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
 	newTask, err := helpers.TaskPool(r).AddTask(taskObj, &user.ID, project.ID)
 
+	if _, ok := err.(*db.ValidationError); ok || err == db.ErrInvalidOperation {
+		helpers.WriteError(w, err)
+		return
+	}
+
 	if err != nil {
 		util.LogErrorWithFields(err, log.Fields{"error": "Cannot write new event to database"})
 		w.WriteHeader(http.StatusInternalServerError)
@@ -45,9 +72,38 @@ func GetTasksList(w http.ResponseWriter, r *http.Request, limit uint64) {
 			Count: int(limit),
 		})
 	} else {
-		tasks, err = helpers.Store(r).GetProjectTasks(project.ID, db.RetrieveQueryParams{
-			Count: int(limit),
+		var filter db.TaskFilter
+		if userIDParam := r.URL.Query().Get("user_id"); userIDParam != "" {
+			userID, convErr := strconv.Atoi(userIDParam)
+			if convErr != nil {
+				helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+					"error": "Invalid user_id",
+				})
+				return
+			}
+			filter.UserID = &userID
+		}
+
+		filter.DisplayTags = r.URL.Query()["display_tag"]
+		if err = db.ValidateDisplayTags(filter.DisplayTags); err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+		ctx, cancel := stdcontext.WithTimeout(r.Context(), tasksListTimeout)
+		defer cancel()
+
+		var truncated bool
+		tasks, truncated, err = helpers.Store(r).GetProjectTasksContext(ctx, project.ID, filter, db.RetrieveQueryParams{
+			Count:  int(limit),
+			Offset: offset,
 		})
+
+		if truncated {
+			w.Header().Set("X-Truncated", "true")
+		}
 	}
 
 	if err != nil {
@@ -56,6 +112,12 @@ func GetTasksList(w http.ResponseWriter, r *http.Request, limit uint64) {
 		return
 	}
 
+	if !canViewTaskSecrets(r) {
+		for i := range tasks {
+			tasks[i].MaskEnvironment()
+		}
+	}
+
 	helpers.WriteJSON(w, http.StatusOK, tasks)
 }
 
@@ -64,6 +126,25 @@ func GetAllTasks(w http.ResponseWriter, r *http.Request) {
 	GetTasksList(w, r, 0)
 }
 
+// GetTaskByVersion returns the task of the build template which produced the version
+func GetTaskByVersion(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+	version := mux.Vars(r)["version"]
+
+	task, err := helpers.Store(r).GetTaskByVersion(tpl.ProjectID, tpl.ID, version)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	if !canViewTaskSecrets(r) {
+		task.MaskEnvironment()
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, task)
+}
+
 // GetLastTasks returns the hundred most recent tasks
 func GetLastTasks(w http.ResponseWriter, r *http.Request) {
 	str := r.URL.Query().Get("limit")
@@ -74,9 +155,25 @@ func GetLastTasks(w http.ResponseWriter, r *http.Request) {
 	GetTasksList(w, r, uint64(limit))
 }
 
+// canViewTaskSecrets checks if the current user can see secret values of task environment
+func canViewTaskSecrets(r *http.Request) bool {
+	user := context.Get(r, "user").(*db.User)
+	if user.Admin {
+		return true
+	}
+	projectUserRole := context.Get(r, "projectUserRole").(db.ProjectUserRole)
+	return projectUserRole.Can(db.CanManageProjectResources)
+}
+
 // GetTask returns a task based on its id
 func GetTask(w http.ResponseWriter, r *http.Request) {
 	task := context.Get(r, "task").(db.Task)
+	if activeTask := helpers.TaskPool(r).GetTask(task.ID); activeTask != nil {
+		task.Progress = activeTask.GetProgress()
+	}
+	if !canViewTaskSecrets(r) {
+		task.MaskEnvironment()
+	}
 	helpers.WriteJSON(w, http.StatusOK, task)
 }
 
@@ -107,13 +204,12 @@ func GetTaskMiddleware(next http.Handler) http.Handler {
 // GetTaskOutput returns the logged task output by id and writes it as json or returns error
 func GetTaskOutput(w http.ResponseWriter, r *http.Request) {
 	task := context.Get(r, "task").(db.Task)
-	project := context.Get(r, "project").(db.Project)
 
-	var output []db.TaskOutput
-	output, err := helpers.Store(r).GetTaskOutputs(project.ID, task.ID)
+	after, _ := strconv.Atoi(r.URL.Query().Get("after"))
 
+	output, err := helpers.TaskPool(r).GetTaskOutputs(task, after)
 	if err != nil {
-		util.LogErrorWithFields(err, log.Fields{"error": "Bad request. Cannot get task output from database"})
+		util.LogErrorWithFields(err, log.Fields{"error": "Bad request. Cannot get task output"})
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -121,6 +217,28 @@ func GetTaskOutput(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSON(w, http.StatusOK, output)
 }
 
+// GetTaskOutputNDJSON streams task output as newline-delimited JSON to simplify
+// ingestion into log systems.
+func GetTaskOutputNDJSON(w http.ResponseWriter, r *http.Request) {
+	task := context.Get(r, "task").(db.Task)
+	project := context.Get(r, "project").(db.Project)
+
+	stream, err := helpers.TaskPool(r).GetTaskOutputNDJSON(project.ID, task.ID)
+	if err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot get task output"})
+		helpers.WriteError(w, err)
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = io.Copy(w, stream); err != nil {
+		util.LogErrorWithFields(err, log.Fields{"error": "Cannot write task output"})
+	}
+}
+
 func StopTask(w http.ResponseWriter, r *http.Request) {
 	targetTask := context.Get(r, "task").(db.Task)
 	project := context.Get(r, "project").(db.Project)
@@ -147,6 +265,100 @@ func StopTask(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ClearTaskQueue cancels all waiting tasks of the project, running tasks continue
+func ClearTaskQueue(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	count, err := helpers.TaskPool(r).ClearQueue(project.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, map[string]int{
+		"cancelled": count,
+	})
+}
+
+// PauseTaskQueue pauses starting of the project tasks, they wait in the queue until resumed
+func PauseTaskQueue(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	helpers.TaskPool(r).PauseProject(project.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResumeTaskQueue resumes starting of the project tasks
+func ResumeTaskQueue(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+
+	helpers.TaskPool(r).ResumeProject(project.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveTaskInQueue moves the waiting task to the specified position in the queue
+func MoveTaskInQueue(w http.ResponseWriter, r *http.Request) {
+	targetTask := context.Get(r, "task").(db.Task)
+
+	var body struct {
+		Position int `json:"position"`
+	}
+
+	if !helpers.Bind(w, r, &body) {
+		return
+	}
+
+	err := helpers.TaskPool(r).MoveTaskInQueue(targetTask.ID, body.Position)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ApproveTask allows the task waiting for approval to run
+func ApproveTask(w http.ResponseWriter, r *http.Request) {
+	targetTask := context.Get(r, "task").(db.Task)
+	user := context.Get(r, "user").(*db.User)
+
+	err := helpers.TaskPool(r).ApproveTask(targetTask.ID, user.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTaskEnvironment returns effective variables of the task with secret values masked
+func GetTaskEnvironment(w http.ResponseWriter, r *http.Request) {
+	task := context.Get(r, "task").(db.Task)
+
+	env, err := helpers.TaskPool(r).ResolveTaskEnvironment(task)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, env)
+}
+
+// GetTaskEvents returns events of the task lifecycle from the oldest to the newest
+func GetTaskEvents(w http.ResponseWriter, r *http.Request) {
+	task := context.Get(r, "task").(db.Task)
+
+	events, err := helpers.Store(r).GetTaskEvents(task.ProjectID, task.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, events)
+}
+
 // RemoveTask removes a task from the database
 func RemoveTask(w http.ResponseWriter, r *http.Request) {
 	targetTask := context.Get(r, "task").(db.Task)
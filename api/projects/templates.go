@@ -44,14 +44,84 @@ func GetTemplateRefs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSON(w, http.StatusOK, refs)
+	helpers.WriteJSON(w, http.StatusOK, refs.Page(helpers.PageParams(r.URL)))
+}
+
+// GetTemplateVariableSchema returns variables which tasks of the template expect
+func GetTemplateVariableSchema(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+
+	schema, err := db.GetTemplateVariableSchema(helpers.Store(r), tpl.ProjectID, tpl.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, schema)
+}
+
+// GetTemplateConcurrency returns limits of running tasks which apply to the template
+func GetTemplateConcurrency(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+
+	limits, err := helpers.TaskPool(r).GetEffectiveConcurrency(tpl.ProjectID, tpl.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, limits)
+}
+
+// GetFavoriteTemplates returns templates of the project pinned by the current user
+func GetFavoriteTemplates(w http.ResponseWriter, r *http.Request) {
+	project := context.Get(r, "project").(db.Project)
+	user := context.Get(r, "user").(*db.User)
+
+	templates, err := helpers.Store(r).GetFavoriteTemplates(user.ID, project.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, templates)
+}
+
+// AddFavoriteTemplate pins the template for the current user
+func AddFavoriteTemplate(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+	user := context.Get(r, "user").(*db.User)
+
+	err := helpers.Store(r).AddFavoriteTemplate(user.ID, tpl.ProjectID, tpl.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveFavoriteTemplate unpins the template for the current user
+func RemoveFavoriteTemplate(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+	user := context.Get(r, "user").(*db.User)
+
+	err := helpers.Store(r).RemoveFavoriteTemplate(user.ID, tpl.ProjectID, tpl.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetTemplates returns all templates for a project in a sort order
 func GetTemplates(w http.ResponseWriter, r *http.Request) {
 	project := context.Get(r, "project").(db.Project)
 
-	templates, err := helpers.Store(r).GetTemplates(project.ID, db.TemplateFilter{}, helpers.QueryParams(r.URL))
+	templates, err := helpers.Store(r).GetTemplates(project.ID, db.TemplateFilter{
+		IncludeArchived: r.URL.Query().Get("archived") == "true",
+	}, helpers.QueryParams(r.URL))
 
 	if err != nil {
 		helpers.WriteError(w, err)
@@ -152,6 +222,54 @@ func UpdateTemplate(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetTemplateVersions returns previous states of the template starting from the most recent
+func GetTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+
+	versions, err := helpers.Store(r).GetTemplateVersions(tpl.ProjectID, tpl.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, versions)
+}
+
+// RollbackTemplate restores the template to the state saved in the version
+func RollbackTemplate(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+
+	versionID, err := helpers.GetIntParam("version_id", w, r)
+	if err != nil {
+		return
+	}
+
+	err = helpers.Store(r).RollbackTemplate(tpl.ProjectID, tpl.ID, versionID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+
+	desc := "Template ID " + strconv.Itoa(tpl.ID) + " rolled back to version " + strconv.Itoa(versionID)
+	objType := db.EventTemplate
+
+	_, err = helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &tpl.ProjectID,
+		Description: &desc,
+		ObjectID:    &tpl.ID,
+		ObjectType:  &objType,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // RemoveTemplate deletes a template from the database
 func RemoveTemplate(w http.ResponseWriter, r *http.Request) {
 	tpl := context.Get(r, "template").(db.Template)
@@ -176,3 +294,31 @@ func RemoveTemplate(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// ArchiveTemplate hides the template and keeps its tasks
+func ArchiveTemplate(w http.ResponseWriter, r *http.Request) {
+	tpl := context.Get(r, "template").(db.Template)
+
+	err := helpers.Store(r).ArchiveTemplate(tpl.ProjectID, tpl.ID)
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	user := context.Get(r, "user").(*db.User)
+	objType := db.EventTemplate
+	desc := "Template ID " + strconv.Itoa(tpl.ID) + " archived"
+	_, err = helpers.Store(r).CreateEvent(db.Event{
+		UserID:      &user.ID,
+		ProjectID:   &tpl.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &tpl.ID,
+		Description: &desc,
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
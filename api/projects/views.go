@@ -134,6 +134,28 @@ func SetViewPositions(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// MoveView moves the view to the position, other views of the project are shifted
+func MoveView(w http.ResponseWriter, r *http.Request) {
+	view := context.Get(r, "view").(db.View)
+
+	var body struct {
+		Position int `json:"position"`
+	}
+
+	if !helpers.Bind(w, r, &body) {
+		return
+	}
+
+	err := helpers.Store(r).MoveView(view.ProjectID, view.ID, body.Position)
+
+	if err != nil {
+		helpers.WriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // UpdateView updates key in database
 // nolint: gocyclo
 func UpdateView(w http.ResponseWriter, r *http.Request) {
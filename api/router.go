@@ -118,6 +118,17 @@ func Route() *mux.Router {
 	tokenAPI.Path("/tokens").HandlerFunc(createAPIToken).Methods("POST")
 	tokenAPI.HandleFunc("/tokens/{token_id}", expireAPIToken).Methods("DELETE")
 
+	globalKeysAPI := authenticatedAPI.Path("/keys").Subrouter()
+	globalKeysAPI.Use(adminMiddleware)
+	globalKeysAPI.Methods("GET", "HEAD").HandlerFunc(getGlobalKeys)
+	globalKeysAPI.Methods("POST").HandlerFunc(addGlobalKey)
+
+	globalKeyAPI := authenticatedAPI.Path("/keys/{key_id}").Subrouter()
+	globalKeyAPI.Use(adminMiddleware, globalKeyMiddleware)
+	globalKeyAPI.Methods("GET", "HEAD").HandlerFunc(getGlobalKey)
+	globalKeyAPI.Methods("PUT").HandlerFunc(updateGlobalKey)
+	globalKeyAPI.Methods("DELETE").HandlerFunc(removeGlobalKey)
+
 	userAPI := authenticatedAPI.Path("/users/{user_id}").Subrouter()
 	userAPI.Use(getUserMiddleware)
 
@@ -143,6 +154,18 @@ func Route() *mux.Router {
 	projectTaskStop.Use(projects.ProjectMiddleware, projects.GetTaskMiddleware, projects.GetMustCanMiddleware(db.CanRunProjectTasks))
 	projectTaskStop.HandleFunc("/tasks/{task_id}/stop", projects.StopTask).Methods("POST")
 
+	projectTaskApprove := authenticatedAPI.PathPrefix("/project/{project_id}").Subrouter()
+	projectTaskApprove.Use(projects.ProjectMiddleware, projects.GetTaskMiddleware, projects.GetMustCanMiddleware(db.CanManageProjectResources))
+	projectTaskApprove.HandleFunc("/tasks/{task_id}/approve", projects.ApproveTask).Methods("POST")
+	projectTaskApprove.HandleFunc("/tasks/{task_id}/queue_position", projects.MoveTaskInQueue).Methods("POST")
+
+	//
+	// Favorite templates of the project member
+	projectTmplFavorite := authenticatedAPI.PathPrefix("/project/{project_id}/templates").Subrouter()
+	projectTmplFavorite.Use(projects.ProjectMiddleware, projects.TemplatesMiddleware)
+	projectTmplFavorite.HandleFunc("/{template_id}/favorite", projects.AddFavoriteTemplate).Methods("PUT")
+	projectTmplFavorite.HandleFunc("/{template_id}/favorite", projects.RemoveFavoriteTemplate).Methods("DELETE")
+
 	//
 	// Project resources CRUD
 	projectUserAPI := authenticatedAPI.PathPrefix("/project/{project_id}").Subrouter()
@@ -166,13 +189,19 @@ func Route() *mux.Router {
 
 	projectUserAPI.Path("/environment").HandlerFunc(projects.GetEnvironment).Methods("GET", "HEAD")
 	projectUserAPI.Path("/environment").HandlerFunc(projects.AddEnvironment).Methods("POST")
+	projectUserAPI.Path("/environment/rename_variable").HandlerFunc(projects.RenameEnvironmentVariable).Methods("POST")
 
 	projectUserAPI.Path("/tasks").HandlerFunc(projects.GetAllTasks).Methods("GET", "HEAD")
 	projectUserAPI.HandleFunc("/tasks/last", projects.GetLastTasks).Methods("GET", "HEAD")
+	projectUserAPI.Path("/tasks/queue").HandlerFunc(projects.ClearTaskQueue).Methods("DELETE")
+	projectUserAPI.Path("/tasks/queue/pause").HandlerFunc(projects.PauseTaskQueue).Methods("POST")
+	projectUserAPI.Path("/tasks/queue/pause").HandlerFunc(projects.ResumeTaskQueue).Methods("DELETE")
 
 	projectUserAPI.Path("/templates").HandlerFunc(projects.GetTemplates).Methods("GET", "HEAD")
 	projectUserAPI.Path("/templates").HandlerFunc(projects.AddTemplate).Methods("POST")
+	projectUserAPI.Path("/templates/favorites").HandlerFunc(projects.GetFavoriteTemplates).Methods("GET", "HEAD")
 
+	projectUserAPI.Path("/schedules").HandlerFunc(projects.GetProjectSchedules).Methods("GET", "HEAD")
 	projectUserAPI.Path("/schedules").HandlerFunc(projects.AddSchedule).Methods("POST")
 	projectUserAPI.Path("/schedules/validate").HandlerFunc(projects.ValidateScheduleCronFormat).Methods("POST")
 
@@ -180,6 +209,12 @@ func Route() *mux.Router {
 	projectUserAPI.Path("/views").HandlerFunc(projects.AddView).Methods("POST")
 	projectUserAPI.Path("/views/positions").HandlerFunc(projects.SetViewPositions).Methods("POST")
 
+	projectUserAPI.Path("/notification_targets").HandlerFunc(projects.GetNotificationTargets).Methods("GET", "HEAD")
+	projectUserAPI.Path("/notification_targets").HandlerFunc(projects.AddNotificationTarget).Methods("POST")
+
+	projectUserAPI.Path("/pipelines").HandlerFunc(projects.GetPipelines).Methods("GET", "HEAD")
+	projectUserAPI.Path("/pipelines").HandlerFunc(projects.AddPipeline).Methods("POST")
+
 	//
 	// Updating and deleting project
 	projectAdminAPI := authenticatedAPI.Path("/project/{project_id}").Subrouter()
@@ -187,6 +222,10 @@ func Route() *mux.Router {
 	projectAdminAPI.Methods("PUT").HandlerFunc(projects.UpdateProject)
 	projectAdminAPI.Methods("DELETE").HandlerFunc(projects.DeleteProject)
 
+	projectArchiveAPI := authenticatedAPI.Path("/project/{project_id}/archived").Subrouter()
+	projectArchiveAPI.Use(projects.ProjectMiddleware, projects.GetMustCanMiddleware(db.CanUpdateProject))
+	projectArchiveAPI.Methods("PUT").HandlerFunc(projects.SetProjectArchived)
+
 	//
 	// Manage project users
 	projectAdminUsersAPI := authenticatedAPI.PathPrefix("/project/{project_id}").Subrouter()
@@ -223,6 +262,7 @@ func Route() *mux.Router {
 
 	projectInventoryManagement.HandleFunc("/{inventory_id}", projects.GetInventory).Methods("GET", "HEAD")
 	projectInventoryManagement.HandleFunc("/{inventory_id}/refs", projects.GetInventoryRefs).Methods("GET", "HEAD")
+	projectInventoryManagement.HandleFunc("/{inventory_id}/groups", projects.GetInventoryGroups).Methods("GET", "HEAD")
 	projectInventoryManagement.HandleFunc("/{inventory_id}", projects.UpdateInventory).Methods("PUT")
 	projectInventoryManagement.HandleFunc("/{inventory_id}", projects.RemoveInventory).Methods("DELETE")
 
@@ -241,14 +281,23 @@ func Route() *mux.Router {
 	projectTmplManagement.HandleFunc("/{template_id}", projects.RemoveTemplate).Methods("DELETE")
 	projectTmplManagement.HandleFunc("/{template_id}", projects.GetTemplate).Methods("GET")
 	projectTmplManagement.HandleFunc("/{template_id}/refs", projects.GetTemplateRefs).Methods("GET", "HEAD")
+	projectTmplManagement.HandleFunc("/{template_id}/archive", projects.ArchiveTemplate).Methods("POST")
+	projectTmplManagement.HandleFunc("/{template_id}/concurrency", projects.GetTemplateConcurrency).Methods("GET", "HEAD")
+	projectTmplManagement.HandleFunc("/{template_id}/variables", projects.GetTemplateVariableSchema).Methods("GET", "HEAD")
 	projectTmplManagement.HandleFunc("/{template_id}/tasks", projects.GetAllTasks).Methods("GET")
 	projectTmplManagement.HandleFunc("/{template_id}/tasks/last", projects.GetLastTasks).Methods("GET")
+	projectTmplManagement.HandleFunc("/{template_id}/tasks/version/{version}", projects.GetTaskByVersion).Methods("GET")
 	projectTmplManagement.HandleFunc("/{template_id}/schedules", projects.GetTemplateSchedules).Methods("GET")
+	projectTmplManagement.HandleFunc("/{template_id}/versions", projects.GetTemplateVersions).Methods("GET", "HEAD")
+	projectTmplManagement.HandleFunc("/{template_id}/versions/{version_id}/rollback", projects.RollbackTemplate).Methods("POST")
 
 	projectTaskManagement := projectUserAPI.PathPrefix("/tasks").Subrouter()
 	projectTaskManagement.Use(projects.GetTaskMiddleware)
 
 	projectTaskManagement.HandleFunc("/{task_id}/output", projects.GetTaskOutput).Methods("GET", "HEAD")
+	projectTaskManagement.HandleFunc("/{task_id}/output/ndjson", projects.GetTaskOutputNDJSON).Methods("GET", "HEAD")
+	projectTaskManagement.HandleFunc("/{task_id}/environment", projects.GetTaskEnvironment).Methods("GET", "HEAD")
+	projectTaskManagement.HandleFunc("/{task_id}/events", projects.GetTaskEvents).Methods("GET", "HEAD")
 	projectTaskManagement.HandleFunc("/{task_id}", projects.GetTask).Methods("GET", "HEAD")
 	projectTaskManagement.HandleFunc("/{task_id}", projects.RemoveTask).Methods("DELETE")
 
@@ -257,6 +306,8 @@ func Route() *mux.Router {
 	projectScheduleManagement.HandleFunc("/{schedule_id}", projects.GetSchedule).Methods("GET", "HEAD")
 	projectScheduleManagement.HandleFunc("/{schedule_id}", projects.UpdateSchedule).Methods("PUT")
 	projectScheduleManagement.HandleFunc("/{schedule_id}", projects.RemoveSchedule).Methods("DELETE")
+	projectScheduleManagement.HandleFunc("/{schedule_id}/history", projects.GetScheduleHistory).Methods("GET", "HEAD")
+	projectScheduleManagement.HandleFunc("/{schedule_id}/detail", projects.GetScheduleDetail).Methods("GET", "HEAD")
 
 	projectViewManagement := projectUserAPI.PathPrefix("/views").Subrouter()
 	projectViewManagement.Use(projects.ViewMiddleware)
@@ -264,6 +315,20 @@ func Route() *mux.Router {
 	projectViewManagement.HandleFunc("/{view_id}", projects.UpdateView).Methods("PUT")
 	projectViewManagement.HandleFunc("/{view_id}", projects.RemoveView).Methods("DELETE")
 	projectViewManagement.HandleFunc("/{view_id}/templates", projects.GetViewTemplates).Methods("GET", "HEAD")
+	projectViewManagement.HandleFunc("/{view_id}/move", projects.MoveView).Methods("POST")
+
+	projectNotificationTargetManagement := projectUserAPI.PathPrefix("/notification_targets").Subrouter()
+	projectNotificationTargetManagement.Use(projects.NotificationTargetMiddleware)
+	projectNotificationTargetManagement.HandleFunc("/{target_id}", projects.GetNotificationTargets).Methods("GET", "HEAD")
+	projectNotificationTargetManagement.HandleFunc("/{target_id}", projects.UpdateNotificationTarget).Methods("PUT")
+	projectNotificationTargetManagement.HandleFunc("/{target_id}", projects.RemoveNotificationTarget).Methods("DELETE")
+	projectNotificationTargetManagement.HandleFunc("/{target_id}/secret", projects.RotateNotificationTargetSecret).Methods("POST")
+
+	projectPipelineManagement := projectUserAPI.PathPrefix("/pipelines").Subrouter()
+	projectPipelineManagement.Use(projects.PipelineMiddleware)
+	projectPipelineManagement.HandleFunc("/{pipeline_id}", projects.GetPipelines).Methods("GET", "HEAD")
+	projectPipelineManagement.HandleFunc("/{pipeline_id}", projects.UpdatePipeline).Methods("PUT")
+	projectPipelineManagement.HandleFunc("/{pipeline_id}", projects.RemovePipeline).Methods("DELETE")
 
 	if os.Getenv("DEBUG") == "1" {
 		defer debugPrintRoutes(r)
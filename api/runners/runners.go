@@ -1,12 +1,14 @@
 package runners
 
 import (
+	log "github.com/Sirupsen/logrus"
 	"github.com/ansible-semaphore/semaphore/api/helpers"
 	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/services/runners"
 	"github.com/ansible-semaphore/semaphore/util"
 	"github.com/gorilla/context"
 	"net/http"
+	"strconv"
 )
 
 func RunnerMiddleware(next http.Handler) http.Handler {
@@ -32,6 +34,14 @@ func RunnerMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if err = runner.ValidateFingerprint(r.Header.Get(runners.FingerprintHeader)); err != nil {
+			log.Warn("Runner " + strconv.Itoa(runner.ID) + " rejected: " + err.Error())
+			helpers.WriteJSON(w, http.StatusForbidden, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
 		context.Set(r, "runner", runner)
 		next.ServeHTTP(w, r)
 	})
@@ -47,7 +57,7 @@ func GetRunner(w http.ResponseWriter, r *http.Request) {
 	tasks := helpers.TaskPool(r).GetRunningTasks()
 
 	for _, tsk := range tasks {
-		if tsk.RunnerID != runner.ID {
+		if tsk.GetRunnerID() != runner.ID {
 			continue
 		}
 
@@ -61,6 +71,12 @@ func GetRunner(w http.ResponseWriter, r *http.Request) {
 				Inventory:       tsk.Inventory,
 				Repository:      tsk.Repository,
 				Environment:     tsk.Environment,
+
+				AdditionalRepositories: tsk.AdditionalRepositories,
+
+				Project:  tsk.Project,
+				Schedule: tsk.Schedule,
+				User:     tsk.User,
 			})
 
 			if tsk.Inventory.SSHKeyID != nil {
@@ -79,6 +95,14 @@ func GetRunner(w http.ResponseWriter, r *http.Request) {
 				data.AccessKeys[*tsk.Inventory.BecomeKeyID] = tsk.Inventory.BecomeKey
 			}
 
+			if tsk.Inventory.AuthKeyID != nil {
+				err := tsk.Inventory.AuthKey.DeserializeSecret()
+				if err != nil {
+					// TODO: return error
+				}
+				data.AccessKeys[*tsk.Inventory.AuthKeyID] = tsk.Inventory.AuthKey
+			}
+
 			if tsk.Template.VaultKeyID != nil {
 				err := tsk.Template.VaultKey.DeserializeSecret()
 				if err != nil {
@@ -87,8 +111,20 @@ func GetRunner(w http.ResponseWriter, r *http.Request) {
 				data.AccessKeys[*tsk.Template.VaultKeyID] = tsk.Template.VaultKey
 			}
 
+			for _, vault := range tsk.Template.Vaults {
+				err := vault.VaultKey.DeserializeSecret()
+				if err != nil {
+					// TODO: return error
+				}
+				data.AccessKeys[vault.VaultKeyID] = vault.VaultKey
+			}
+
 			data.AccessKeys[tsk.Repository.SSHKeyID] = tsk.Repository.SSHKey
 
+			for _, repo := range tsk.AdditionalRepositories {
+				data.AccessKeys[repo.SSHKeyID] = repo.SSHKey
+			}
+
 		} else {
 			data.CurrentJobs = append(data.CurrentJobs, runners.JobState{
 				ID:     tsk.Task.ID,
@@ -129,6 +165,10 @@ func UpdateRunner(w http.ResponseWriter, r *http.Request) {
 			tsk.Log2(logRecord.Message, logRecord.Time)
 		}
 
+		if job.ExitCode != nil {
+			tsk.Task.ExitCode = job.ExitCode
+		}
+
 		tsk.SetStatus(job.Status)
 	}
 
@@ -154,6 +194,7 @@ func RegisterRunner(w http.ResponseWriter, r *http.Request) {
 
 	runner, err := helpers.Store(r).CreateRunner(db.Runner{
 		//State: db.RunnerActive,
+		Fingerprint: register.Fingerprint,
 	})
 
 	if err != nil {
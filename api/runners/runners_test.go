@@ -0,0 +1,82 @@
+package runners
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/db/bolt"
+	"github.com/ansible-semaphore/semaphore/services/runners"
+	"github.com/ansible-semaphore/semaphore/util"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+func TestRunnerFingerprint(t *testing.T) {
+	util.Config = &util.ConfigType{
+		RunnerRegistrationToken: "test",
+	}
+
+	store := bolt.CreateTestStore()
+
+	body, err := json.Marshal(runners.RunnerRegistration{
+		RegistrationToken: "test",
+		Fingerprint:       "host1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/runners", bytes.NewBuffer(body))
+	context.Set(req, "store", store)
+	rr := httptest.NewRecorder()
+
+	RegisterRunner(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("runner must be registered, got %d", rr.Code)
+	}
+
+	var config runners.RunnerConfig
+	if err = json.Unmarshal(rr.Body.Bytes(), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := store.GetGlobalRunner(config.RunnerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runner.Fingerprint != "host1" {
+		t.Fatal("registration must record the fingerprint")
+	}
+
+	poll := func(fingerprint string) int {
+		req := httptest.NewRequest("GET", "/api/internal/runners/"+strconv.Itoa(config.RunnerID), nil)
+		req = mux.SetURLVars(req, map[string]string{"runner_id": strconv.Itoa(config.RunnerID)})
+		req.Header.Set(runners.FingerprintHeader, fingerprint)
+		context.Set(req, "store", store)
+		rr := httptest.NewRecorder()
+
+		RunnerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if context.Get(r, "runner").(db.Runner).ID != config.RunnerID {
+				t.Fatal("unexpected runner")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	if code := poll("host1"); code != http.StatusNoContent {
+		t.Fatalf("poll with the registered fingerprint must be accepted, got %d", code)
+	}
+
+	if code := poll("host2"); code != http.StatusForbidden {
+		t.Fatalf("poll with a changed fingerprint must be rejected, got %d", code)
+	}
+}
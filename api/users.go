@@ -5,6 +5,7 @@ import (
 	"github.com/ansible-semaphore/semaphore/api/helpers"
 	"github.com/ansible-semaphore/semaphore/db"
 	"net/http"
+	"strconv"
 
 	"github.com/ansible-semaphore/semaphore/util"
 	"github.com/gorilla/context"
@@ -152,6 +153,33 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if reassignTo := r.URL.Query().Get("reassign_to"); reassignTo != "" {
+		reassignToUserID, err := strconv.Atoi(reassignTo)
+		if err != nil {
+			helpers.WriteJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "Invalid reassign_to",
+			})
+			return
+		}
+
+		reassignProjects := r.URL.Query().Get("reassign_projects") == "true"
+
+		if reassignProjects && !editor.Admin {
+			log.Warn(editor.Username + " is not permitted to reassign project memberships")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		err = helpers.Store(r).DeleteUserReassigning(user.ID, reassignToUserID, reassignProjects)
+		if err != nil {
+			helpers.WriteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	if err := helpers.Store(r).DeleteUser(user.ID); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -42,6 +42,7 @@ func Execute() {
 func runService() {
 	store := createStore("root")
 	taskPool := tasks.CreateTaskPool(store)
+	taskPool.SetOutputArchiver(tasks.CreateOutputArchiver(util.Config.OutputArchive))
 	schedulePool := schedules.CreateSchedulePool(store, &taskPool)
 
 	defer schedulePool.Destroy()
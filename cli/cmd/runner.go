@@ -4,6 +4,10 @@ import (
 	"github.com/ansible-semaphore/semaphore/services/runners"
 	"github.com/ansible-semaphore/semaphore/util"
 	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func init() {
@@ -13,9 +17,40 @@ func init() {
 func runRunner() {
 	util.ConfigInit(configPath)
 
-	taskPool := runners.JobPool{}
+	settings := util.Config.Runners
+	if len(settings) == 0 {
+		settings = []util.RunnerSettings{util.Config.Runner}
+	}
 
-	taskPool.Run()
+	var wg sync.WaitGroup
+	var pools []*runners.JobPool
+
+	for _, s := range settings {
+		taskPool := runners.NewJobPool(runners.RunnerConfig{}, s)
+		pools = append(pools, taskPool)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			taskPool.Run()
+		}()
+	}
+
+	// SIGTERM stops taking new jobs and exits after running jobs are completed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	go func() {
+		<-signals
+		var drained []<-chan struct{}
+		for _, p := range pools {
+			drained = append(drained, p.Drain())
+		}
+		for _, d := range drained {
+			<-d
+		}
+		os.Exit(0)
+	}()
+
+	wg.Wait()
 }
 
 var runnerCmd = &cobra.Command{
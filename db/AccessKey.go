@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -11,7 +12,10 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"os/exec"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ansible-semaphore/semaphore/util"
 )
@@ -22,13 +26,22 @@ const (
 	AccessKeySSH           AccessKeyType = "ssh"
 	AccessKeyNone          AccessKeyType = "none"
 	AccessKeyLoginPassword AccessKeyType = "login_password"
+	AccessKeyToken         AccessKeyType = "token"
+	AccessKeyCommand       AccessKeyType = "command"
 )
 
+// defaultSecretCommandTimeout is used if secret_command_timeout is not configured.
+const defaultSecretCommandTimeout = 30 * time.Second
+
+// AccessKeyTokenLogin is the user name sent along with a token over HTTPS.
+// Git hosts authenticate by the token only but require a non-empty user name.
+const AccessKeyTokenLogin = "oauth2"
+
 // AccessKey represents a key used to access a machine with ansible from semaphore
 type AccessKey struct {
 	ID   int    `db:"id" json:"id"`
 	Name string `db:"name" json:"name" binding:"required"`
-	// 'ssh/login_password/none'
+	// 'ssh/login_password/token/command/none'
 	Type AccessKeyType `db:"type" json:"type" binding:"required"`
 
 	ProjectID *int `db:"project_id" json:"project_id"`
@@ -39,6 +52,8 @@ type AccessKey struct {
 
 	LoginPassword  LoginPassword `db:"-" json:"login_password"`
 	SshKey         SshKey        `db:"-" json:"ssh"`
+	Token          string        `db:"-" json:"token"`
+	Command        SecretCommand `db:"-" json:"command"`
 	OverrideSecret bool          `db:"-" json:"override_secret"`
 
 	InstallationKey int64 `db:"-" json:"-"`
@@ -55,11 +70,111 @@ type SshKey struct {
 	PrivateKey string `json:"private_key"`
 }
 
+// SecretCommand is a command which prints the secret to stdout.
+// It is executed every time the key is installed, so the secret is never stored.
+type SecretCommand struct {
+	// Name is a name of the command line in the secret_commands config option.
+	Name string `json:"name"`
+}
+
+// secretCommandWaitDelay limits reading of the command output after the command exited.
+// Child processes of the killed command can keep the output open.
+const secretCommandWaitDelay = time.Second
+
+// getArgs returns the command line configured by the secret_commands config option.
+func (c SecretCommand) getArgs() ([]string, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("command can not be empty")
+	}
+
+	args := util.Config.SecretCommands[c.Name]
+	if len(args) == 0 || args[0] == "" {
+		return nil, fmt.Errorf("command %s is not allowed", c.Name)
+	}
+
+	return args, nil
+}
+
+// Validate checks that the command is allowed by the secret_commands config option.
+func (c SecretCommand) Validate() error {
+	_, err := c.getArgs()
+	return err
+}
+
+// Resolve executes the command and returns its output without the trailing newline.
+// Errors don't contain the command output, because it can contain the secret.
+func (c SecretCommand) Resolve() (string, error) {
+	args, err := c.getArgs()
+	if err != nil {
+		return "", err
+	}
+
+	timeout := defaultSecretCommandTimeout
+	if util.Config.SecretCommandTimeout > 0 {
+		timeout = time.Duration(util.Config.SecretCommandTimeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// the output is read from the pipe instead of the buffer set to cmd.Stdout,
+	// because Wait doesn't return while child processes keep such output open
+	// and cmd.WaitDelay is not available in Go 1.19.
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	defer stdout.Close() //nolint:errcheck
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = stdoutWriter
+
+	err = cmd.Start()
+	_ = stdoutWriter.Close()
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %v", c.Name, err)
+	}
+
+	output := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(stdout)
+		output <- data
+	}()
+
+	err = cmd.Wait()
+
+	var data []byte
+	select {
+	case data = <-output:
+	case <-time.After(secretCommandWaitDelay):
+		_ = stdout.Close()
+		<-output
+		return "", fmt.Errorf("output of command %s is not closed after it exited", c.Name)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command %s timed out after %v", c.Name, timeout)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %v", c.Name, err)
+	}
+
+	secret := strings.TrimRight(string(data), "\r\n")
+
+	if secret == "" {
+		return "", fmt.Errorf("command %s returned empty secret", c.Name)
+	}
+
+	return secret, nil
+}
+
 type AccessKeyRole int
 
 const (
 	AccessKeyRoleAnsibleUser = iota
 	AccessKeyRoleAnsibleBecomeUser
+	AccessKeyRoleAnsibleBecomePasswordFile
 	AccessKeyRoleAnsiblePasswordVault
 	AccessKeyRoleGit
 )
@@ -97,6 +212,8 @@ func (key *AccessKey) Install(usage AccessKeyRole) error {
 		switch key.Type {
 		case AccessKeyLoginPassword:
 			return ioutil.WriteFile(path, []byte(key.LoginPassword.Password), 0600)
+		case AccessKeyCommand:
+			return key.installCommandSecret(path)
 		}
 	case AccessKeyRoleAnsibleBecomeUser:
 		switch key.Type {
@@ -113,11 +230,22 @@ func (key *AccessKey) Install(usage AccessKeyRole) error {
 		default:
 			return fmt.Errorf("access key type not supported for ansible user")
 		}
+	case AccessKeyRoleAnsibleBecomePasswordFile:
+		switch key.Type {
+		case AccessKeyLoginPassword:
+			return ioutil.WriteFile(path, []byte(key.LoginPassword.Password), 0600)
+		case AccessKeyCommand:
+			return key.installCommandSecret(path)
+		default:
+			return fmt.Errorf("access key type not supported for ansible become password file")
+		}
 	case AccessKeyRoleAnsibleUser:
 		switch key.Type {
 		case AccessKeySSH:
 			if key.SshKey.Passphrase != "" {
-				return fmt.Errorf("ssh key with passphrase not supported")
+				// the key is unlocked in memory and passed to ansible by ssh agent of the task,
+				// so it is not written to disk
+				return nil
 			}
 			return ioutil.WriteFile(path, []byte(key.SshKey.PrivateKey+"\n"), 0600)
 		case AccessKeyLoginPassword:
@@ -139,6 +267,14 @@ func (key *AccessKey) Install(usage AccessKeyRole) error {
 	return nil
 }
 
+func (key *AccessKey) installCommandSecret(path string) error {
+	secret, err := key.Command.Resolve()
+	if err != nil {
+		return fmt.Errorf("cannot resolve secret of key '%s': %v", key.Name, err)
+	}
+	return ioutil.WriteFile(path, []byte(secret), 0600)
+}
+
 func (key AccessKey) Destroy() error {
 	path := key.GetPath()
 	_, err := os.Stat(path)
@@ -171,6 +307,12 @@ func (key AccessKey) Validate(validateSecretFields bool) error {
 		if key.LoginPassword.Password == "" {
 			return fmt.Errorf("password can not be empty")
 		}
+	case AccessKeyToken:
+		if key.Token == "" {
+			return fmt.Errorf("token can not be empty")
+		}
+	case AccessKeyCommand:
+		return key.Command.Validate()
 	}
 
 	return nil
@@ -191,6 +333,16 @@ func (key *AccessKey) SerializeSecret() error {
 		if err != nil {
 			return err
 		}
+	case AccessKeyToken:
+		plaintext, err = json.Marshal(key.Token)
+		if err != nil {
+			return err
+		}
+	case AccessKeyCommand:
+		plaintext, err = json.Marshal(key.Command)
+		if err != nil {
+			return err
+		}
 	case AccessKeyNone:
 		key.Secret = nil
 		return nil
@@ -247,6 +399,18 @@ func (key *AccessKey) unmarshalAppropriateField(secret []byte) (err error) {
 		if err == nil {
 			key.LoginPassword = loginPass
 		}
+	case AccessKeyToken:
+		token := ""
+		err = json.Unmarshal(secret, &token)
+		if err == nil {
+			key.Token = token
+		}
+	case AccessKeyCommand:
+		command := SecretCommand{}
+		err = json.Unmarshal(secret, &command)
+		if err == nil {
+			key.Command = command
+		}
 	}
 	return
 }
@@ -324,3 +488,60 @@ func (key *AccessKey) DeserializeSecret2(encryptionString string) error {
 
 	return key.unmarshalAppropriateField(ciphertext)
 }
+
+// ForRole returns the key with the information which the project member with the role
+// is allowed to see. Members who can manage project resources see the key without secret,
+// members who can only run tasks see the name and the type of the key.
+// Guests can't see keys at all, ErrInvalidOperation is returned for them.
+func (key AccessKey) ForRole(role ProjectUserRole) (AccessKey, error) {
+	if role.Can(CanManageProjectResources) {
+		key.Secret = nil
+		return key, nil
+	}
+
+	if role.GetPermissions() == 0 {
+		return AccessKey{}, ErrInvalidOperation
+	}
+
+	return AccessKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Type:      key.Type,
+		ProjectID: key.ProjectID,
+	}, nil
+}
+
+// GetAccessKeyForRole returns the key of the project limited by AccessKey.ForRole.
+func GetAccessKeyForRole(d Store, projectID int, accessKeyID int, role ProjectUserRole) (AccessKey, error) {
+	key, err := d.GetAccessKeyMeta(projectID, accessKeyID)
+	if err != nil {
+		return AccessKey{}, err
+	}
+
+	return key.ForRole(role)
+}
+
+// GetAccessKeysForRole returns keys of the project limited by AccessKey.ForRole.
+func GetAccessKeysForRole(d Store, projectID int, role ProjectUserRole, params RetrieveQueryParams) ([]AccessKey, error) {
+	keys, err := d.GetAccessKeys(projectID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return AccessKeysForRole(keys, role)
+}
+
+// AccessKeysForRole applies AccessKey.ForRole to every key of the list.
+func AccessKeysForRole(keys []AccessKey, role ProjectUserRole) ([]AccessKey, error) {
+	res := make([]AccessKey, 0, len(keys))
+
+	for _, key := range keys {
+		limited, err := key.ForRole(role)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, limited)
+	}
+
+	return res, nil
+}
@@ -3,7 +3,10 @@ package db
 import (
 	"encoding/base64"
 	"github.com/ansible-semaphore/semaphore/util"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSetSecret(t *testing.T) {
@@ -89,3 +92,133 @@ func TestSetGetSecretWithEncryption(t *testing.T) {
 		t.Error("invalid secret")
 	}
 }
+
+func TestTokenSecret(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	accessKey := AccessKey{
+		Type:  AccessKeyToken,
+		Token: "ghp_secret",
+	}
+
+	err := accessKey.SerializeSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := AccessKey{
+		Type:   AccessKeyToken,
+		Secret: accessKey.Secret,
+	}
+
+	err = restored.DeserializeSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Token != "ghp_secret" {
+		t.Fatal("invalid token")
+	}
+}
+
+func TestCommandSecret(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+		SecretCommands: map[string][]string{
+			"vault-password": {"echo", "s3cr3t"},
+		},
+	}
+
+	key := AccessKey{
+		Name: "Vault",
+		Type: AccessKeyCommand,
+		Command: SecretCommand{
+			Name: "vault-password",
+		},
+	}
+
+	err := key.SerializeSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := AccessKey{
+		Name:   key.Name,
+		Type:   key.Type,
+		Secret: key.Secret,
+	}
+
+	err = stored.Install(AccessKeyRoleAnsiblePasswordVault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stored.Destroy() //nolint:errcheck
+
+	content, err := os.ReadFile(stored.GetPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "s3cr3t" {
+		t.Fatalf("expected output of the command as the secret, got %q", string(content))
+	}
+}
+
+func TestCommandSecretNotAllowed(t *testing.T) {
+	util.Config = &util.ConfigType{
+		SecretCommands: map[string][]string{
+			"vault-password": {"echo", "s3cr3t"},
+		},
+	}
+
+	// the program of the allowed command line is not allowed by itself
+	key := AccessKey{
+		Name: "Vault",
+		Type: AccessKeyCommand,
+		Command: SecretCommand{
+			Name: "echo",
+		},
+	}
+
+	if err := key.Validate(true); err == nil {
+		t.Fatal("command which is not in the allowlist must be rejected")
+	}
+
+	if _, err := key.Command.Resolve(); err == nil {
+		t.Fatal("command which is not in the allowlist must not be executed")
+	}
+}
+
+func TestCommandSecretTimeout(t *testing.T) {
+	util.Config = &util.ConfigType{
+		SecretCommands: map[string][]string{
+			"slow":   {"sh", "-c", "echo s3cr3t; exec sleep 5"},
+			"failed": {"sh", "-c", "echo s3cr3t; exit 1"},
+			// the child process keeps the output open after the command is killed
+			"child": {"sh", "-c", "echo s3cr3t; sleep 10; echo done"},
+		},
+		SecretCommandTimeout: 1,
+	}
+
+	_, err := SecretCommand{Name: "slow"}.Resolve()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+
+	start := time.Now()
+
+	_, err = SecretCommand{Name: "child"}.Resolve()
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") {
+		t.Fatalf("expected error of the killed command, got %v", err)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("output of the killed command must not be waited for")
+	}
+
+	_, err = SecretCommand{Name: "failed"}.Resolve()
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") {
+		t.Fatalf("error of the failed command must not contain its output, got %v", err)
+	}
+}
@@ -1,9 +1,54 @@
 package db
 
-import (
-	"encoding/json"
+import "encoding/json"
+
+type EnvironmentSecretType string
+
+const (
+	EnvironmentSecretVar EnvironmentSecretType = "var"
+	EnvironmentSecretEnv EnvironmentSecretType = "env"
 )
 
+// EnvironmentFileSecret is a secret which value is read from the file
+// on the host running the task. The value is not stored in the database.
+type EnvironmentFileSecret struct {
+	// Name is a name of extra variable or environment variable.
+	Name string `json:"name"`
+	// Path is a path to the file with the secret value.
+	// Relative paths are relative to the file_secrets_path config option.
+	Path string                `json:"path"`
+	Type EnvironmentSecretType `json:"type"`
+}
+
+// EnvironmentCommandSecret is a secret which value is printed by the command
+// run on the host running the task. The value is not stored in the database.
+type EnvironmentCommandSecret struct {
+	// Name is a name of extra variable or environment variable.
+	Name string `json:"name"`
+	// Command is a name of the command line in the secret_commands config option.
+	Command string                `json:"command"`
+	Type    EnvironmentSecretType `json:"type"`
+}
+
+// DeleteEnvironmentWithRefs deletes the environment if no templates use it.
+// If cascade is true, the environment is cleared on the templates which use it.
+func DeleteEnvironmentWithRefs(d Store, projectID int, environmentID int, cascade bool) error {
+	if cascade {
+		return d.DeleteEnvironmentCascade(projectID, environmentID)
+	}
+
+	refs, err := d.GetEnvironmentRefs(projectID, environmentID)
+	if err != nil {
+		return err
+	}
+
+	if len(refs.Templates) > 0 {
+		return newInUseError("Environment", refs.Templates)
+	}
+
+	return d.DeleteEnvironment(projectID, environmentID)
+}
+
 // Environment is used to pass additional arguments, in json form to ansible
 type Environment struct {
 	ID        int     `db:"id" json:"id"`
@@ -12,6 +57,32 @@ type Environment struct {
 	Password  *string `db:"password" json:"password"`
 	JSON      string  `db:"json" json:"json" binding:"required"`
 	ENV       *string `db:"env" json:"env" binding:"required"`
+
+	// FileSecrets is JSON array of EnvironmentFileSecret.
+	FileSecrets *string `db:"file_secrets" json:"file_secrets"`
+
+	// CommandSecrets is JSON array of EnvironmentCommandSecret.
+	CommandSecrets *string `db:"command_secrets" json:"command_secrets"`
+}
+
+// GetFileSecrets returns list of secrets which should be read from files.
+func (env *Environment) GetFileSecrets() (secrets []EnvironmentFileSecret, err error) {
+	if env.FileSecrets == nil || *env.FileSecrets == "" {
+		return
+	}
+
+	err = json.Unmarshal([]byte(*env.FileSecrets), &secrets)
+	return
+}
+
+// GetCommandSecrets returns list of secrets which should be printed by commands.
+func (env *Environment) GetCommandSecrets() (secrets []EnvironmentCommandSecret, err error) {
+	if env.CommandSecrets == nil || *env.CommandSecrets == "" {
+		return
+	}
+
+	err = json.Unmarshal([]byte(*env.CommandSecrets), &secrets)
+	return
 }
 
 func (env *Environment) Validate() error {
@@ -27,5 +98,92 @@ func (env *Environment) Validate() error {
 		return &ValidationError{"Environment variables must be valid JSON"}
 	}
 
+	secrets, err := env.GetFileSecrets()
+	if err != nil {
+		return &ValidationError{"File secrets must be valid JSON"}
+	}
+
+	for _, secret := range secrets {
+		if secret.Name == "" {
+			return &ValidationError{"File secret name can not be empty"}
+		}
+
+		if secret.Path == "" {
+			return &ValidationError{"File secret path can not be empty"}
+		}
+
+		if secret.Type != EnvironmentSecretVar && secret.Type != EnvironmentSecretEnv {
+			return &ValidationError{"File secret type must be var or env"}
+		}
+	}
+
+	commandSecrets, err := env.GetCommandSecrets()
+	if err != nil {
+		return &ValidationError{"Command secrets must be valid JSON"}
+	}
+
+	for _, secret := range commandSecrets {
+		if secret.Name == "" {
+			return &ValidationError{"Command secret name can not be empty"}
+		}
+
+		if err = (SecretCommand{Name: secret.Command}).Validate(); err != nil {
+			return &ValidationError{"Command secret " + secret.Name + ": " + err.Error()}
+		}
+
+		if secret.Type != EnvironmentSecretVar && secret.Type != EnvironmentSecretEnv {
+			return &ValidationError{"Command secret type must be var or env"}
+		}
+	}
+
+	return nil
+}
+
+// RenameVariable renames the extra variable in the environment JSON.
+// Value of the variable is kept as is. It returns false if the environment has no such variable.
+func (env *Environment) RenameVariable(oldKey string, newKey string) (bool, error) {
+	if env.JSON == "" {
+		return false, nil
+	}
+
+	vars := make(map[string]json.RawMessage)
+
+	err := json.Unmarshal([]byte(env.JSON), &vars)
+	if err != nil {
+		return false, err
+	}
+
+	value, ok := vars[oldKey]
+	if !ok {
+		return false, nil
+	}
+
+	if _, exists := vars[newKey]; exists {
+		return false, &ValidationError{"Variable " + newKey + " already exists in environment " + env.Name}
+	}
+
+	delete(vars, oldKey)
+	vars[newKey] = value
+
+	res, err := json.Marshal(vars)
+	if err != nil {
+		return false, err
+	}
+
+	env.JSON = string(res)
+
+	return true, nil
+}
+
+// ValidateVariableRename checks that the variable can be renamed from oldKey to newKey.
+func ValidateVariableRename(oldKey string, newKey string) error {
+	if oldKey == "" || newKey == "" {
+		return &ValidationError{"Variable name can not be empty"}
+	}
+
+	if oldKey == newKey {
+		return &ValidationError{"New variable name must differ from the old one"}
+	}
+
 	return nil
 }
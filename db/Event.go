@@ -1,6 +1,7 @@
 package db
 
 import (
+	"strconv"
 	"time"
 )
 
@@ -14,6 +15,10 @@ type Event struct {
 	Description *string          `db:"description" json:"description"`
 	Created     time.Time        `db:"created" json:"created"`
 
+	// CorrelationID groups events which belong to the same lifecycle,
+	// for example all events of a task from queueing to finishing.
+	CorrelationID *string `db:"correlation_id" json:"correlation_id,omitempty"`
+
 	ObjectName  string  `db:"-" json:"object_name"`
 	ProjectName *string `db:"project_name" json:"project_name"`
 	Username    *string `db:"-" json:"username"`
@@ -22,18 +27,26 @@ type Event struct {
 type EventObjectType string
 
 const (
-	EventTask        EventObjectType = "task"
-	EventEnvironment EventObjectType = "environment"
-	EventInventory   EventObjectType = "inventory"
-	EventKey         EventObjectType = "key"
-	EventProject     EventObjectType = "project"
-	EventRepository  EventObjectType = "repository"
-	EventSchedule    EventObjectType = "schedule"
-	EventTemplate    EventObjectType = "template"
-	EventUser        EventObjectType = "user"
-	EventView        EventObjectType = "view"
+	EventTask               EventObjectType = "task"
+	EventEnvironment        EventObjectType = "environment"
+	EventInventory          EventObjectType = "inventory"
+	EventKey                EventObjectType = "key"
+	EventProject            EventObjectType = "project"
+	EventRepository         EventObjectType = "repository"
+	EventSchedule           EventObjectType = "schedule"
+	EventTemplate           EventObjectType = "template"
+	EventUser               EventObjectType = "user"
+	EventView               EventObjectType = "view"
+	EventNotificationTarget EventObjectType = "notification_target"
+	EventPipeline           EventObjectType = "pipeline"
 )
 
+// TaskCorrelationID returns the correlation ID of events generated during the task lifecycle.
+func TaskCorrelationID(taskID int) *string {
+	id := "task-" + strconv.Itoa(taskID)
+	return &id
+}
+
 func FillEvents(d Store, events []Event) (err error) {
 	usernames := make(map[int]string)
 
@@ -101,6 +114,11 @@ func getEventUsername(d Store, evt Event) (username string, err error) {
 
 	user, err := d.GetUser(*evt.UserID)
 
+	if err == ErrNotFound {
+		// User can be deleted, the event is shown without username
+		return "", nil
+	}
+
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,8 @@
+package db
+
+// FavoriteTemplate is a template pinned by the user. Every user has own favorites.
+type FavoriteTemplate struct {
+	UserID     int `db:"user_id" json:"user_id"`
+	ProjectID  int `db:"project_id" json:"project_id"`
+	TemplateID int `db:"template_id" json:"template_id"`
+}
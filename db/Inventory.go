@@ -1,11 +1,37 @@
 package db
 
+import (
+	"bufio"
+	"sort"
+	"strings"
+)
+
 const (
 	InventoryStatic     = "static"
 	InventoryStaticYaml = "static-yaml"
 	InventoryFile       = "file"
+	InventoryURL        = "url"
 )
 
+// DeleteInventoryWithRefs deletes the inventory if no templates use it.
+// If cascade is true, the inventory is cleared on the templates which use it.
+func DeleteInventoryWithRefs(d Store, projectID int, inventoryID int, cascade bool) error {
+	if cascade {
+		return d.DeleteInventoryCascade(projectID, inventoryID)
+	}
+
+	refs, err := d.GetInventoryRefs(projectID, inventoryID)
+	if err != nil {
+		return err
+	}
+
+	if len(refs.Templates) > 0 {
+		return newInUseError("Inventory", refs.Templates)
+	}
+
+	return d.DeleteInventory(projectID, inventoryID)
+}
+
 // Inventory is the model of an ansible inventory file
 type Inventory struct {
 	ID        int    `db:"id" json:"id"`
@@ -14,13 +40,25 @@ type Inventory struct {
 	Inventory string `db:"inventory" json:"inventory"`
 
 	// accesses hosts in inventory
-	SSHKeyID *int      `db:"ssh_key_id" json:"ssh_key_id"`
-	SSHKey   AccessKey `db:"-" json:"-"`
+	SSHKeyID   *int      `db:"ssh_key_id" json:"ssh_key_id"`
+	SSHKey     AccessKey `db:"-" json:"-"`
+	SSHKeyName *string   `db:"-" json:"ssh_key_name,omitempty"`
+
+	BecomeKeyID   *int      `db:"become_key_id" json:"become_key_id"`
+	BecomeKey     AccessKey `db:"-" json:"-"`
+	BecomeKeyName *string   `db:"-" json:"become_key_name,omitempty"`
+
+	// BecomePasswordFile enables passing of the become password
+	// via --become-password-file instead of extra vars.
+	BecomePasswordFile bool `db:"become_password_file" json:"become_password_file"`
 
-	BecomeKeyID *int      `db:"become_key_id" json:"become_key_id"`
-	BecomeKey   AccessKey `db:"-" json:"-"`
+	// AuthKeyID is the key used to authenticate when the inventory is fetched from URL.
+	// Login/password keys are sent as basic auth and tokens as bearer auth.
+	AuthKeyID   *int      `db:"auth_key_id" json:"auth_key_id"`
+	AuthKey     AccessKey `db:"-" json:"-"`
+	AuthKeyName *string   `db:"-" json:"auth_key_name,omitempty"`
 
-	// static/file
+	// static/static-yaml/file/url
 	Type string `db:"type" json:"type"`
 }
 
@@ -37,5 +75,147 @@ func FillInventory(d Store, inventory *Inventory) (err error) {
 		inventory.BecomeKey, err = d.GetAccessKey(inventory.ProjectID, *inventory.BecomeKeyID)
 	}
 
+	if err != nil {
+		return
+	}
+
+	if inventory.AuthKeyID != nil {
+		inventory.AuthKey, err = d.GetAccessKey(inventory.ProjectID, *inventory.AuthKeyID)
+	}
+
 	return
 }
+
+// FillInventoryKeyNames sets names of the access keys used by the inventory.
+// Secrets of the keys are not loaded to the inventory.
+func FillInventoryKeyNames(d Store, inventory *Inventory) error {
+	if inventory.SSHKeyID != nil {
+		key, err := d.GetAccessKeyMeta(inventory.ProjectID, *inventory.SSHKeyID)
+		if err != nil {
+			return err
+		}
+		inventory.SSHKeyName = &key.Name
+	}
+
+	if inventory.BecomeKeyID != nil {
+		key, err := d.GetAccessKeyMeta(inventory.ProjectID, *inventory.BecomeKeyID)
+		if err != nil {
+			return err
+		}
+		inventory.BecomeKeyName = &key.Name
+	}
+
+	if inventory.AuthKeyID != nil {
+		key, err := d.GetAccessKeyMeta(inventory.ProjectID, *inventory.AuthKeyID)
+		if err != nil {
+			return err
+		}
+		inventory.AuthKeyName = &key.Name
+	}
+
+	return nil
+}
+
+// GetGroups returns sorted names of the host groups declared in the static inventory.
+func (inv *Inventory) GetGroups() ([]string, error) {
+	var groups []string
+
+	switch inv.Type {
+	case InventoryStatic:
+		groups = parseIniInventoryGroups(inv.Inventory)
+	case InventoryStaticYaml:
+		groups = parseYamlInventoryGroups(inv.Inventory)
+	default:
+		return nil, &ValidationError{"groups are available only for static inventories"}
+	}
+
+	unique := make(map[string]bool)
+	res := make([]string, 0)
+
+	for _, g := range groups {
+		if g == "" || unique[g] {
+			continue
+		}
+		unique[g] = true
+		res = append(res, g)
+	}
+
+	sort.Strings(res)
+
+	return res, nil
+}
+
+// parseIniInventoryGroups returns names of sections of the INI inventory.
+// Sections like [group:vars] and [group:children] declare the group too.
+func parseIniInventoryGroups(inventory string) (groups []string) {
+	scanner := bufio.NewScanner(strings.NewReader(inventory))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+
+		name := strings.TrimSpace(line[1 : len(line)-1])
+		if i := strings.Index(name, ":"); i >= 0 {
+			name = name[:i]
+		}
+
+		groups = append(groups, name)
+	}
+
+	return
+}
+
+// parseYamlInventoryGroups returns names of the groups of the YAML inventory.
+// Top level keys and keys of the children sections are groups.
+func parseYamlInventoryGroups(inventory string) (groups []string) {
+	type yamlKey struct {
+		indent int
+		name   string
+	}
+
+	var parents []yamlKey
+
+	scanner := bufio.NewScanner(strings.NewReader(inventory))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+
+		i := strings.Index(trimmed, ":")
+		if i <= 0 {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		name := strings.Trim(strings.TrimSpace(trimmed[:i]), `"'`)
+
+		for len(parents) > 0 && parents[len(parents)-1].indent >= indent {
+			parents = parents[:len(parents)-1]
+		}
+
+		if len(parents) == 0 || parents[len(parents)-1].name == "children" {
+			groups = append(groups, name)
+		}
+
+		parents = append(parents, yamlKey{indent: indent, name: name})
+	}
+
+	return
+}
+
+// GetInventoryGroups returns names of the host groups of the static inventory.
+func GetInventoryGroups(d Store, projectID int, inventoryID int) ([]string, error) {
+	inventory, err := d.GetInventory(projectID, inventoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory.GetGroups()
+}
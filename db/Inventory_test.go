@@ -0,0 +1,135 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInventory_GetGroups_ini(t *testing.T) {
+	inv := Inventory{
+		Type: InventoryStatic,
+		Inventory: `
+mail.example.com
+
+[webservers]
+foo.example.com
+bar.example.com
+
+[dbservers]
+one.example.com
+
+[dbservers:vars]
+ntp_server=ntp.example.com
+
+[datacenter:children]
+webservers
+dbservers
+`,
+	}
+
+	groups, err := inv.GetGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(groups, ",") != "datacenter,dbservers,webservers" {
+		t.Fatal("invalid groups: " + strings.Join(groups, ","))
+	}
+}
+
+func TestInventory_GetGroups_yaml(t *testing.T) {
+	inv := Inventory{
+		Type: InventoryStaticYaml,
+		Inventory: `---
+all:
+  hosts:
+    mail.example.com:
+  children:
+    webservers:
+      hosts:
+        foo.example.com:
+          http_port: 80
+        bar.example.com:
+    dbservers:
+      vars:
+        ntp_server: ntp.example.com
+      hosts:
+        one.example.com:
+    datacenter:
+      children:
+        east:
+          hosts:
+            east.example.com:
+`,
+	}
+
+	groups, err := inv.GetGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(groups, ",") != "all,datacenter,dbservers,east,webservers" {
+		t.Fatal("invalid groups: " + strings.Join(groups, ","))
+	}
+}
+
+func TestInventory_GetGroups_file(t *testing.T) {
+	inv := Inventory{
+		Type:      InventoryFile,
+		Inventory: "inventories/prod",
+	}
+
+	_, err := inv.GetGroups()
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatal("file inventory groups must not be available")
+	}
+}
+
+// keyMetaStore returns access keys only without secrets.
+type keyMetaStore struct {
+	Store
+	keys map[int]AccessKey
+}
+
+func (d keyMetaStore) GetAccessKeyMeta(projectID int, accessKeyID int) (AccessKey, error) {
+	key, ok := d.keys[accessKeyID]
+	if !ok {
+		return AccessKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (d keyMetaStore) GetAccessKey(projectID int, accessKeyID int) (AccessKey, error) {
+	panic("secrets must not be loaded to fill key names")
+}
+
+func TestFillInventoryKeyNames(t *testing.T) {
+	sshKeyID := 1
+	becomeKeyID := 2
+
+	inv := Inventory{
+		ProjectID:   1,
+		SSHKeyID:    &sshKeyID,
+		BecomeKeyID: &becomeKeyID,
+	}
+
+	err := FillInventoryKeyNames(keyMetaStore{keys: map[int]AccessKey{
+		sshKeyID:    {ID: sshKeyID, Name: "Deploy"},
+		becomeKeyID: {ID: becomeKeyID, Name: "Sudo"},
+	}}, &inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inv.SSHKeyName == nil || *inv.SSHKeyName != "Deploy" {
+		t.Fatal("invalid ssh key name")
+	}
+
+	if inv.BecomeKeyName == nil || *inv.BecomeKeyName != "Sudo" {
+		t.Fatal("invalid become key name")
+	}
+
+	if inv.AuthKeyName != nil {
+		t.Fatal("inventory without auth key must not have its name")
+	}
+}
@@ -61,6 +61,49 @@ func GetMigrations() []Migration {
 		{Version: "2.8.58"},
 		{Version: "2.8.91"},
 		{Version: "2.9.6"},
+		{Version: "2.9.7"},
+		{Version: "2.9.8"},
+		{Version: "2.9.9"},
+		{Version: "2.9.10"},
+		{Version: "2.9.11"},
+		{Version: "2.9.12"},
+		{Version: "2.9.13"},
+		{Version: "2.9.14"},
+		{Version: "2.9.15"},
+		{Version: "2.9.16"},
+		{Version: "2.9.17"},
+		{Version: "2.9.18"},
+		{Version: "2.9.19"},
+		{Version: "2.9.20"},
+		{Version: "2.9.21"},
+		{Version: "2.9.22"},
+		{Version: "2.9.23"},
+		{Version: "2.9.24"},
+		{Version: "2.9.25"},
+		{Version: "2.9.26"},
+		{Version: "2.9.27"},
+		{Version: "2.9.28"},
+		{Version: "2.9.29"},
+		{Version: "2.9.30"},
+		{Version: "2.9.31"},
+		{Version: "2.9.32"},
+		{Version: "2.9.33"},
+		{Version: "2.9.34"},
+		{Version: "2.9.35"},
+		{Version: "2.9.36"},
+		{Version: "2.9.37"},
+		{Version: "2.9.38"},
+		{Version: "2.9.39"},
+		{Version: "2.9.40"},
+		{Version: "2.9.41"},
+		{Version: "2.9.42"},
+		{Version: "2.9.43"},
+		{Version: "2.9.44"},
+		{Version: "2.9.45"},
+		{Version: "2.9.46"},
+		{Version: "2.9.47"},
+		{Version: "2.9.48"},
+		{Version: "2.9.49"},
 	}
 }
 
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"encoding/hex"
+	"net/url"
+
+	"github.com/gorilla/securecookie"
+)
+
+type NotificationTargetType string
+
+const (
+	// NotificationTargetSlack receives Slack incoming webhook messages.
+	NotificationTargetSlack NotificationTargetType = "slack"
+	// NotificationTargetWebhook receives task details as JSON.
+	NotificationTargetWebhook NotificationTargetType = "webhook"
+)
+
+// NotificationTarget is a Slack channel or a webhook notified when tasks of the project finish.
+type NotificationTarget struct {
+	ID        int                    `db:"id" json:"id"`
+	ProjectID int                    `db:"project_id" json:"project_id"`
+	Name      string                 `db:"name" json:"name" binding:"required"`
+	Type      NotificationTargetType `db:"type" json:"type" binding:"required"`
+	URL       string                 `db:"url" json:"url" binding:"required"`
+
+	// ProjectDefault targets are notified about tasks of templates
+	// which have no notification targets of their own.
+	ProjectDefault bool `db:"project_default" json:"project_default"`
+
+	// Secret signs webhook deliveries, it is generated when the target is created.
+	// Targets created before signing was added have no secret, their deliveries are not signed.
+	Secret string `db:"secret" json:"-"`
+}
+
+// NewNotificationTargetSecret generates a random secret for signing webhook deliveries.
+func NewNotificationTargetSecret() string {
+	return hex.EncodeToString(securecookie.GenerateRandomKey(32))
+}
+
+func (target *NotificationTarget) Validate() error {
+	if target.Name == "" {
+		return &ValidationError{"notification target name can not be empty"}
+	}
+
+	switch target.Type {
+	case NotificationTargetSlack, NotificationTargetWebhook:
+	default:
+		return &ValidationError{"invalid notification target type"}
+	}
+
+	u, err := url.Parse(target.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ValidationError{"notification target URL must be an absolute http or https URL"}
+	}
+
+	return nil
+}
+
+// ValidateSecretRotation checks if the secret of the target can be rotated.
+// Only webhook deliveries are signed.
+func (target *NotificationTarget) ValidateSecretRotation() error {
+	if target.Type != NotificationTargetWebhook {
+		return &ValidationError{"only webhook notification targets have a secret"}
+	}
+
+	return nil
+}
+
+// GetTemplateNotificationTargets returns the targets notified about tasks of the template.
+// These are the targets selected in the template or the project default targets if none are selected.
+// Selected targets which were deleted are ignored.
+func GetTemplateNotificationTargets(d Store, tpl Template) (targets []NotificationTarget, err error) {
+	targets = make([]NotificationTarget, 0)
+
+	if len(tpl.NotificationTargetIDs) == 0 {
+		var all []NotificationTarget
+		all, err = d.GetNotificationTargets(tpl.ProjectID)
+		if err != nil {
+			return
+		}
+
+		for _, target := range all {
+			if target.ProjectDefault {
+				targets = append(targets, target)
+			}
+		}
+
+		return
+	}
+
+	for _, id := range tpl.NotificationTargetIDs {
+		var target NotificationTarget
+		target, err = d.GetNotificationTarget(tpl.ProjectID, id)
+		if err == ErrNotFound {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		targets = append(targets, target)
+	}
+
+	return
+}
@@ -12,4 +12,24 @@ type Project struct {
 	Alert            bool      `db:"alert" json:"alert"`
 	AlertChat        *string   `db:"alert_chat" json:"alert_chat"`
 	MaxParallelTasks int       `db:"max_parallel_tasks" json:"max_parallel_tasks"`
+	// Archived projects are read only, new tasks can not be run in them.
+	Archived bool `db:"archived" json:"archived"`
+	// TaskOutputRetentionDays is a number of days which output of the project tasks is kept.
+	// Older output is purged, the tasks are kept. 0 means keep forever.
+	TaskOutputRetentionDays int `db:"task_output_retention_days" json:"task_output_retention_days"`
+	// TaskRetentionDays is a number of days which finished tasks of the project are kept.
+	// Older tasks are deleted with their output. 0 means keep forever.
+	TaskRetentionDays int `db:"task_retention_days" json:"task_retention_days"`
+}
+
+type ProjectFilter struct {
+	IncludeArchived bool
+}
+
+// ProjectWithRole is a project as seen by the user: with the user's role and
+// the number of the project members.
+type ProjectWithRole struct {
+	Project
+	Role        ProjectUserRole `db:"role" json:"role"`
+	MemberCount int             `db:"member_count" json:"member_count"`
 }
@@ -2,6 +2,7 @@ package db
 
 import (
 	"github.com/ansible-semaphore/semaphore/util"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
@@ -19,6 +20,28 @@ const (
 	RepositoryLocal RepositoryType = "local"
 )
 
+// DeleteRepositoryWithRefs deletes the repository if no templates use it.
+// If force is true, templates which use the repository are deleted together with it.
+func DeleteRepositoryWithRefs(d Store, projectID int, repositoryID int, force bool) error {
+	refs, err := d.GetRepositoryRefs(projectID, repositoryID)
+	if err != nil {
+		return err
+	}
+
+	if len(refs.Templates) > 0 && !force {
+		return newInUseError("Repository", refs.Templates)
+	}
+
+	for _, tpl := range refs.Templates {
+		err = d.DeleteTemplate(projectID, tpl.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.DeleteRepository(projectID, repositoryID)
+}
+
 // Repository is the model for code stored in a git repository
 type Repository struct {
 	ID        int    `db:"id" json:"id"`
@@ -72,22 +95,57 @@ func (r Repository) GetFullPath(templateID int) string {
 	return path.Join(util.Config.TmpPath, r.GetDirName(templateID))
 }
 
+// getCredentials returns the user name and the password which are sent over HTTPS.
+// The token is sent as a password, git hosts ignore the user name of tokens.
+func (r Repository) getCredentials() (login string, password string, ok bool) {
+	switch r.SSHKey.Type {
+	case AccessKeyLoginPassword:
+		return r.SSHKey.LoginPassword.Login, r.SSHKey.LoginPassword.Password, true
+	case AccessKeyToken:
+		return AccessKeyTokenLogin, r.SSHKey.Token, true
+	}
+	return "", "", false
+}
+
+// GetGitURL returns the URL of HTTPS repository with the credentials of the access key.
+// The user name written in the repository URL is replaced by them.
 func (r Repository) GetGitURL() string {
-	url := r.GitURL
+	if r.GetType() != RepositoryHTTPS {
+		return r.GitURL
+	}
 
-	if r.GetType() == RepositoryHTTPS {
-		auth := ""
-		switch r.SSHKey.Type {
-		case AccessKeyLoginPassword:
-			auth = r.SSHKey.LoginPassword.Login + ":" + r.SSHKey.LoginPassword.Password
-		}
-		if auth != "" {
-			auth += "@"
-		}
-		url = "https://" + auth + r.GitURL[8:]
+	login, password, ok := r.getCredentials()
+	if !ok {
+		return r.GitURL
+	}
+
+	u, err := url.Parse(r.GitURL)
+	if err != nil {
+		return r.GitURL
+	}
+
+	u.User = url.UserPassword(login, password)
+
+	return u.String()
+}
+
+// GetSecrets returns the credentials which GetGitURL embeds into the URL.
+// They must be masked in everything written to the task log.
+// The escaped form is returned too if it differs, because git prints the URL as is.
+func (r Repository) GetSecrets() []string {
+	_, password, ok := r.getCredentials()
+	if !ok || password == "" {
+		return nil
+	}
+
+	secrets := []string{password}
+
+	escaped := strings.TrimPrefix(url.UserPassword("", password).String(), ":")
+	if escaped != password {
+		secrets = append(secrets, escaped)
 	}
 
-	return url
+	return secrets
 }
 
 func (r Repository) GetType() RepositoryType {
@@ -14,4 +14,15 @@ type Runner struct {
 	//State            RunnerState `db:"state" json:"state"`
 	Webhook          string `db:"webhook" json:"webhook"`
 	MaxParallelTasks int    `db:"max_parallel_tasks" json:"max_parallel_tasks"`
+	// Fingerprint of the host the runner is registered from.
+	// Empty fingerprint means that the runner isn't bound to a host.
+	Fingerprint string `db:"fingerprint" json:"-"`
+}
+
+// ValidateFingerprint checks that the request came from the host the runner is bound to.
+func (r Runner) ValidateFingerprint(fingerprint string) error {
+	if r.Fingerprint != "" && r.Fingerprint != fingerprint {
+		return &ValidationError{Message: "Runner fingerprint mismatch"}
+	}
+	return nil
 }
@@ -1,5 +1,25 @@
 package db
 
+import (
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduleConcurrencyMode defines what the schedule does when it fires
+// while the previous task of the template is still active.
+type ScheduleConcurrencyMode string
+
+const (
+	// ScheduleConcurrencyAllow creates the task regardless of active tasks of the template.
+	ScheduleConcurrencyAllow ScheduleConcurrencyMode = "allow"
+	// ScheduleConcurrencySkip doesn't create the task if the template has an active task.
+	ScheduleConcurrencySkip ScheduleConcurrencyMode = "skip"
+	// ScheduleConcurrencyQueue adds the task to the queue after active tasks of the template.
+	ScheduleConcurrencyQueue ScheduleConcurrencyMode = "queue"
+)
+
 type Schedule struct {
 	ID             int     `db:"id" json:"id"`
 	ProjectID      int     `db:"project_id" json:"project_id"`
@@ -7,4 +27,113 @@ type Schedule struct {
 	CronFormat     string  `db:"cron_format" json:"cron_format"`
 	RepositoryID   *int    `db:"repository_id" json:"repository_id"`
 	LastCommitHash *string `db:"last_commit_hash" json:"-"`
+
+	// ConcurrencyMode is checked when the schedule fires. Empty mode is the same as ScheduleConcurrencyAllow.
+	ConcurrencyMode ScheduleConcurrencyMode `db:"concurrency_mode" json:"concurrency_mode"`
+
+	// Force allows creating of schedule which duplicates existing one.
+	Force bool `db:"-" json:"force"`
+
+	// TemplateName is a name of the schedule's template, it is filled only by GetProjectSchedules.
+	TemplateName *string `db:"tpl_name" json:"tpl_name,omitempty"`
+	// NextRun is a time of the next fire. It is nil if it is not computed
+	// or the schedule never fires.
+	NextRun *time.Time `db:"-" json:"next_run"`
+}
+
+// FillNextRun sets NextRun to the first fire time of the schedule after the given time.
+func (s *Schedule) FillNextRun(after time.Time) {
+	s.NextRun = nil
+
+	if strings.TrimSpace(s.CronFormat) == "" {
+		return
+	}
+
+	cronSchedule, err := cron.ParseStandard(s.CronFormat)
+	if err != nil {
+		return
+	}
+
+	next := cronSchedule.Next(after)
+	s.NextRun = &next
+}
+
+// ValidateConcurrencyMode checks that the concurrency mode of the schedule is known.
+func (s Schedule) ValidateConcurrencyMode() error {
+	switch s.ConcurrencyMode {
+	case "", ScheduleConcurrencyAllow, ScheduleConcurrencySkip, ScheduleConcurrencyQueue:
+		return nil
+	default:
+		return &ValidationError{"invalid concurrency mode " + string(s.ConcurrencyMode)}
+	}
+}
+
+// ValidateNewSchedule checks the new schedule, see ValidateSchedule,
+// and that its template is not archived.
+func ValidateNewSchedule(d Store, schedule Schedule) error {
+	tpl, err := d.GetTemplate(schedule.ProjectID, schedule.TemplateID)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	if err == nil && tpl.Archived {
+		return ErrInvalidOperation
+	}
+
+	return ValidateSchedule(d, schedule)
+}
+
+// ValidateSchedule checks the concurrency mode and that the template has no other
+// schedule with the same cron expression. The cron check is skipped if Force is set.
+// It is used for both new and updated schedules.
+func ValidateSchedule(d Store, schedule Schedule) error {
+	if err := schedule.ValidateConcurrencyMode(); err != nil {
+		return err
+	}
+
+	cronFormat := strings.Join(strings.Fields(schedule.CronFormat), " ")
+
+	if schedule.Force || cronFormat == "" {
+		return nil
+	}
+
+	schedules, err := d.GetTemplateSchedules(schedule.ProjectID, schedule.TemplateID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range schedules {
+		if s.ID == schedule.ID {
+			continue
+		}
+
+		if strings.Join(strings.Fields(s.CronFormat), " ") == cronFormat {
+			return &ValidationError{"the template already has schedule with the same cron expression"}
+		}
+	}
+
+	return nil
+}
+
+// ScheduleRun is a record about single fire of the schedule.
+type ScheduleRun struct {
+	ID         int `db:"id" json:"id"`
+	ProjectID  int `db:"project_id" json:"project_id"`
+	ScheduleID int `db:"schedule_id" json:"schedule_id"`
+	// TaskID is an ID of the task created by the fire.
+	// It is nil if the task was not created, for example because of an error.
+	TaskID  *int      `db:"task_id" json:"task_id"`
+	Created time.Time `db:"created" json:"created"`
+}
+
+// ScheduleDetail is the schedule with its computed state.
+type ScheduleDetail struct {
+	Schedule
+	// LastRun is a time of the most recent fire. It is nil if the schedule never fired.
+	LastRun *time.Time `json:"last_run"`
+	// LastTaskID is an ID of the task created by the most recent fire.
+	LastTaskID *int `json:"last_task_id"`
+	// Active is false if the schedule will not fire, for example
+	// because the template is disabled or the project is archived.
+	Active bool `json:"active"`
 }
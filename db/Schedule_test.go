@@ -0,0 +1,16 @@
+package db
+
+import "testing"
+
+func TestScheduleValidateConcurrencyMode(t *testing.T) {
+	err := Schedule{ConcurrencyMode: "parallel"}.ValidateConcurrencyMode()
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatal("unknown concurrency mode must be invalid")
+	}
+
+	for _, mode := range []ScheduleConcurrencyMode{"", ScheduleConcurrencyAllow, ScheduleConcurrencySkip, ScheduleConcurrencyQueue} {
+		if err = (Schedule{ConcurrencyMode: mode}).ValidateConcurrencyMode(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 )
@@ -49,6 +51,74 @@ type ObjectReferrers struct {
 	Templates    []ObjectReferrer `json:"templates"`
 	Inventories  []ObjectReferrer `json:"inventories"`
 	Repositories []ObjectReferrer `json:"repositories"`
+	Schedules    []ObjectReferrer `json:"schedules"`
+}
+
+// ObjectReferrersPage is a page of the referrers of each kind with total numbers of the referrers.
+type ObjectReferrersPage struct {
+	ObjectReferrers
+	TemplatesCount    int `json:"templates_count"`
+	InventoriesCount  int `json:"inventories_count"`
+	RepositoriesCount int `json:"repositories_count"`
+	SchedulesCount    int `json:"schedules_count"`
+}
+
+// Page returns referrers of each kind ordered by ID from Offset, at most Count of them.
+// All referrers are returned if Count is 0.
+func (r ObjectReferrers) Page(params RetrieveQueryParams) ObjectReferrersPage {
+	return ObjectReferrersPage{
+		ObjectReferrers: ObjectReferrers{
+			Templates:    pageReferrers(r.Templates, params),
+			Inventories:  pageReferrers(r.Inventories, params),
+			Repositories: pageReferrers(r.Repositories, params),
+			Schedules:    pageReferrers(r.Schedules, params),
+		},
+		TemplatesCount:    len(r.Templates),
+		InventoriesCount:  len(r.Inventories),
+		RepositoriesCount: len(r.Repositories),
+		SchedulesCount:    len(r.Schedules),
+	}
+}
+
+func pageReferrers(referrers []ObjectReferrer, params RetrieveQueryParams) []ObjectReferrer {
+	sorted := make([]ObjectReferrer, len(referrers))
+	copy(sorted, referrers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	if params.Offset >= len(sorted) {
+		return []ObjectReferrer{}
+	}
+
+	end := len(sorted)
+	if params.Count > 0 && params.Offset+params.Count < end {
+		end = params.Offset + params.Count
+	}
+
+	return sorted[params.Offset:end]
+}
+
+// GetScheduleReferrers converts the schedules to referrers.
+// Schedules have no name, so their cron expression is used instead.
+func GetScheduleReferrers(schedules []Schedule) []ObjectReferrer {
+	referrers := make([]ObjectReferrer, 0, len(schedules))
+	for _, schedule := range schedules {
+		referrers = append(referrers, ObjectReferrer{
+			ID:   schedule.ID,
+			Name: schedule.CronFormat,
+		})
+	}
+	return referrers
+}
+
+// newInUseError returns error which lists names of the objects which refer to the deleted object.
+func newInUseError(objectName string, referrers []ObjectReferrer) *ValidationError {
+	names := make([]string, 0, len(referrers))
+	for _, r := range referrers {
+		names = append(names, r.Name)
+	}
+	return &ValidationError{objectName + " is in use by templates: " + strings.Join(names, ", ")}
 }
 
 // ObjectProps describe database entities.
@@ -60,11 +130,20 @@ type ObjectProps struct {
 	IsGlobal              bool         // doesn't belong to other table, for example to project or user.
 	ReferringColumnSuffix string
 	PrimaryColumnName     string
+	PrimaryColumnType     PrimaryColumnType // IntPrimaryColumn if not set.
 	SortableColumns       []string
 	DefaultSortingColumn  string
 	SortInverted          bool // sort from high to low object ID by default. It is useful for some NoSQL implementations.
 }
 
+// PrimaryColumnType is a type of values of the primary column of objects.
+type PrimaryColumnType int
+
+const (
+	IntPrimaryColumn PrimaryColumnType = iota
+	StringPrimaryColumn
+)
+
 var ErrNotFound = errors.New("no rows in result set")
 var ErrInvalidOperation = errors.New("invalid operation")
 
@@ -106,6 +185,12 @@ type Store interface {
 	UpdateEnvironment(env Environment) error
 	CreateEnvironment(env Environment) (Environment, error)
 	DeleteEnvironment(projectID int, templateID int) error
+	// DeleteEnvironmentCascade clears the environment of the templates which use it
+	// and deletes the environment in a single transaction.
+	DeleteEnvironmentCascade(projectID int, environmentID int) error
+	// UpdateEnvironmentVariableAcrossProject renames the extra variable in all environments
+	// of the project and returns number of changed environments.
+	UpdateEnvironmentVariableAcrossProject(projectID int, oldKey string, newKey string) (int, error)
 
 	GetInventory(projectID int, inventoryID int) (Inventory, error)
 	GetInventoryRefs(projectID int, inventoryID int) (ObjectReferrers, error)
@@ -113,6 +198,9 @@ type Store interface {
 	UpdateInventory(inventory Inventory) error
 	CreateInventory(inventory Inventory) (Inventory, error)
 	DeleteInventory(projectID int, inventoryID int) error
+	// DeleteInventoryCascade clears the inventory of the templates which use it
+	// and deletes the inventory in a single transaction.
+	DeleteInventoryCascade(projectID int, inventoryID int) error
 
 	GetRepository(projectID int, repositoryID int) (Repository, error)
 	GetRepositoryRefs(projectID int, repositoryID int) (ObjectReferrers, error)
@@ -121,7 +209,11 @@ type Store interface {
 	CreateRepository(repository Repository) (Repository, error)
 	DeleteRepository(projectID int, repositoryID int) error
 
+	// GetAccessKey returns the key of the project or the global key if the project has no key with the ID.
 	GetAccessKey(projectID int, accessKeyID int) (AccessKey, error)
+	// GetAccessKeyMeta returns the access key without secret.
+	// Use it if only name or type of the key is required.
+	GetAccessKeyMeta(projectID int, accessKeyID int) (AccessKey, error)
 	GetAccessKeyRefs(projectID int, accessKeyID int) (ObjectReferrers, error)
 	GetAccessKeys(projectID int, params RetrieveQueryParams) ([]AccessKey, error)
 	RekeyAccessKeys(oldKey string) error
@@ -130,11 +222,22 @@ type Store interface {
 	CreateAccessKey(accessKey AccessKey) (AccessKey, error)
 	DeleteAccessKey(projectID int, accessKeyID int) error
 
+	// GetGlobalAccessKey returns the key which doesn't belong to any project.
+	// Global keys can be used by objects of all projects.
+	GetGlobalAccessKey(accessKeyID int) (AccessKey, error)
+	GetGlobalAccessKeys(params RetrieveQueryParams) ([]AccessKey, error)
+	DeleteGlobalAccessKey(accessKeyID int) error
+
 	GetUsers(params RetrieveQueryParams) ([]User, error)
 	CreateUserWithoutPassword(user User) (User, error)
 	CreateUser(user UserWithPwd) (User, error)
 	DeleteUser(userID int) error
 
+	// DeleteUserReassigning deletes the user and makes reassignToUserID the owner
+	// of all tasks started by the deleted user. If reassignProjects is true
+	// reassignToUserID also takes the user's place in projects where it is not a member yet.
+	DeleteUserReassigning(userID int, reassignToUserID int, reassignProjects bool) error
+
 	// UpdateUser updates all fields of the entity except Pwd.
 	// Pwd should be present of you want update user password. Empty Pwd ignored.
 	UpdateUser(user UserWithPwd) error
@@ -143,25 +246,51 @@ type Store interface {
 	GetUserByLoginOrEmail(login string, email string) (User, error)
 
 	GetProject(projectID int) (Project, error)
-	GetProjects(userID int) ([]Project, error)
+	GetProjects(userID int, filter ProjectFilter) ([]Project, error)
+	// GetAllProjects returns projects of all users including archived ones.
+	GetAllProjects() ([]Project, error)
+	// GetProjectsWithRole returns projects of the user with the user's role and member count.
+	GetProjectsWithRole(userID int, filter ProjectFilter) ([]ProjectWithRole, error)
 	CreateProject(project Project) (Project, error)
 	DeleteProject(projectID int) error
 	UpdateProject(project Project) error
+	SetProjectArchived(projectID int, archived bool) error
 
 	GetTemplates(projectID int, filter TemplateFilter, params RetrieveQueryParams) ([]Template, error)
 	GetTemplateRefs(projectID int, templateID int) (ObjectReferrers, error)
 	CreateTemplate(template Template) (Template, error)
+	// UpdateTemplate updates the template and saves its previous state as a TemplateVersion.
 	UpdateTemplate(template Template) error
 	GetTemplate(projectID int, templateID int) (Template, error)
 	DeleteTemplate(projectID int, templateID int) error
+	// ArchiveTemplate hides the template instead of deleting, so its tasks stay associated with it.
+	ArchiveTemplate(projectID int, templateID int) error
+
+	// GetTemplateVersions returns saved states of the template starting from the most recent.
+	GetTemplateVersions(projectID int, templateID int) ([]TemplateVersion, error)
+	GetTemplateVersion(projectID int, templateID int, versionID int) (TemplateVersion, error)
+	// RollbackTemplate restores the template to the state saved in the version.
+	RollbackTemplate(projectID int, templateID int, versionID int) error
+
+	GetTemplatePipelines(projectID int) ([]TemplatePipeline, error)
+	GetTemplatePipeline(projectID int, pipelineID int) (TemplatePipeline, error)
+	CreateTemplatePipeline(pipeline TemplatePipeline) (TemplatePipeline, error)
+	UpdateTemplatePipeline(pipeline TemplatePipeline) error
+	DeleteTemplatePipeline(projectID int, pipelineID int) error
 
 	GetSchedules() ([]Schedule, error)
 	GetTemplateSchedules(projectID int, templateID int) ([]Schedule, error)
+	// GetProjectSchedules returns schedules of all templates of the project
+	// with names of their templates and next fire times.
+	GetProjectSchedules(projectID int, params RetrieveQueryParams) ([]Schedule, error)
 	CreateSchedule(schedule Schedule) (Schedule, error)
 	UpdateSchedule(schedule Schedule) error
 	SetScheduleCommitHash(projectID int, scheduleID int, hash string) error
 	GetSchedule(projectID int, scheduleID int) (Schedule, error)
 	DeleteSchedule(projectID int, scheduleID int) error
+	CreateScheduleRun(run ScheduleRun) (ScheduleRun, error)
+	// GetScheduleHistory returns fires of the schedule starting from the most recent.
+	GetScheduleHistory(projectID int, scheduleID int, params RetrieveQueryParams) ([]ScheduleRun, error)
 
 	GetProjectUsers(projectID int, params RetrieveQueryParams) ([]UserWithProjectRole, error)
 	CreateProjectUser(projectUser ProjectUser) (ProjectUser, error)
@@ -173,6 +302,15 @@ type Store interface {
 	GetUserEvents(userID int, params RetrieveQueryParams) ([]Event, error)
 	GetEvents(projectID int, params RetrieveQueryParams) ([]Event, error)
 
+	// GetTaskEvents returns all events of the task lifecycle ordered from the oldest to the newest.
+	GetTaskEvents(projectID int, taskID int) ([]Event, error)
+
+	// AddFavoriteTemplate pins the template for the user, adding a pinned template does nothing.
+	AddFavoriteTemplate(userID int, projectID int, templateID int) error
+	RemoveFavoriteTemplate(userID int, projectID int, templateID int) error
+	// GetFavoriteTemplates returns templates of the project pinned by the user.
+	GetFavoriteTemplates(userID int, projectID int) ([]Template, error)
+
 	GetAPITokens(userID int) ([]APIToken, error)
 	CreateAPIToken(token APIToken) (APIToken, error)
 	GetAPIToken(tokenID string) (APIToken, error)
@@ -185,13 +323,42 @@ type Store interface {
 	TouchSession(userID int, sessionID int) error
 
 	CreateTask(task Task) (Task, error)
+	// CreateBuildTask saves the task of the build template with the version following the most recent
+	// build of the template, see Task.SetBuildVersion. The version is reserved in the same transaction
+	// which saves the task, so builds created at the same time never get the same version.
+	CreateBuildTask(task Task, startVersion *string) (Task, error)
 	UpdateTask(task Task) error
 
 	GetTemplateTasks(projectID int, templateID int, params RetrieveQueryParams) ([]TaskWithTpl, error)
-	GetProjectTasks(projectID int, params RetrieveQueryParams) ([]TaskWithTpl, error)
+	GetProjectTasks(projectID int, filter TaskFilter, params RetrieveQueryParams) ([]TaskWithTpl, error)
+	// GetProjectTasksContext works like GetProjectTasks but stops reading when the context is done.
+	// In this case it returns tasks fetched so far and truncated is true.
+	GetProjectTasksContext(ctx context.Context, projectID int, filter TaskFilter, params RetrieveQueryParams) (tasks []TaskWithTpl, truncated bool, err error)
+	// GetProjectTasksFiltered returns tasks of the project selected by all fields of the filter,
+	// including the template, statuses and start time range.
+	GetProjectTasksFiltered(projectID int, filter TaskFilter, params RetrieveQueryParams) ([]TaskWithTpl, error)
 	GetTask(projectID int, taskID int) (Task, error)
+	// GetTasksByStatus returns tasks of all projects which have one of the statuses.
+	GetTasksByStatus(statuses []TaskStatus) ([]Task, error)
+	// GetTaskByVersion returns the most recent task of the build template which produced the version.
+	GetTaskByVersion(projectID int, templateID int, version string) (TaskWithTpl, error)
 	DeleteTaskWithOutputs(projectID int, taskID int) error
+	// DeleteTaskOutputs deletes output records of the task, the task itself is kept.
+	DeleteTaskOutputs(projectID int, taskID int) error
+	// DeleteTaskOutputsBefore deletes output records of the project tasks written before the time
+	// and returns their number. The tasks themselves are kept.
+	DeleteTaskOutputsBefore(projectID int, before time.Time) (int, error)
+	// PruneTaskOutputs deletes output records of the project tasks written before olderThan,
+	// see DeleteTaskOutputsBefore. With PruneFinishedTasks option finished tasks which ended
+	// before olderThan are deleted too. It returns the number of deleted output records and the number of deleted tasks.
+	PruneTaskOutputs(projectID int, olderThan time.Time, options ...TaskPruneOption) (outputs int, tasks int, err error)
 	GetTaskOutputs(projectID int, taskID int) ([]TaskOutput, error)
+	// GetTaskOutputsPaged returns the page of output records of the task ordered by Time and Seq,
+	// and the total number of the records. Offset and Count of the params define the page.
+	// BoltDB returns records in the order of Seq, which is the order they were written by the task.
+	GetTaskOutputsPaged(projectID int, taskID int, params RetrieveQueryParams) ([]TaskOutput, int, error)
+	// GetTaskOutputsSince returns output records of the task with ID greater than afterOutputID.
+	GetTaskOutputsSince(projectID int, taskID int, afterOutputID int) ([]TaskOutput, error)
 	CreateTaskOutput(output TaskOutput) (TaskOutput, error)
 
 	GetView(projectID int, viewID int) (View, error)
@@ -200,6 +367,18 @@ type Store interface {
 	CreateView(view View) (View, error)
 	DeleteView(projectID int, viewID int) error
 	SetViewPositions(projectID int, viewPositions map[int]int) error
+	// MoveView moves the view to the position and shifts other views of the project
+	// in a single transaction, see ReorderViews.
+	MoveView(projectID int, viewID int, position int) error
+
+	GetNotificationTarget(projectID int, targetID int) (NotificationTarget, error)
+	GetNotificationTargets(projectID int) ([]NotificationTarget, error)
+	UpdateNotificationTarget(target NotificationTarget) error
+	CreateNotificationTarget(target NotificationTarget) (NotificationTarget, error)
+	DeleteNotificationTarget(projectID int, targetID int) error
+	// RotateWebhookSecret replaces the secret of the webhook notification target
+	// with a new random secret and returns it. Deliveries sent after the rotation are signed with the new secret.
+	RotateWebhookSecret(projectID int, webhookID int) (string, error)
 
 	GetRunner(projectID int, runnerID int) (Runner, error)
 	GetRunners(projectID int) ([]Runner, error)
@@ -220,6 +399,20 @@ var AccessKeyProps = ObjectProps{
 	DefaultSortingColumn:  "name",
 }
 
+// GlobalAccessKeyProps describe access keys without project.
+// SortInverted makes BoltDB assign IDs from the top of the range,
+// so IDs of global keys don't intersect with IDs of project keys.
+var GlobalAccessKeyProps = ObjectProps{
+	TableName:             "access_key",
+	Type:                  reflect.TypeOf(AccessKey{}),
+	PrimaryColumnName:     "id",
+	ReferringColumnSuffix: "key_id",
+	SortableColumns:       []string{"name", "type"},
+	DefaultSortingColumn:  "name",
+	IsGlobal:              true,
+	SortInverted:          true,
+}
+
 var EnvironmentProps = ObjectProps{
 	TableName:             "project__environment",
 	Type:                  reflect.TypeOf(Environment{}),
@@ -261,6 +454,28 @@ var ScheduleProps = ObjectProps{
 	PrimaryColumnName: "id",
 }
 
+var TemplateVersionProps = ObjectProps{
+	TableName:         "project__template_version",
+	Type:              reflect.TypeOf(TemplateVersion{}),
+	PrimaryColumnName: "id",
+	SortInverted:      true,
+}
+
+var TemplatePipelineProps = ObjectProps{
+	TableName:            "project__template_pipeline",
+	Type:                 reflect.TypeOf(TemplatePipeline{}),
+	PrimaryColumnName:    "id",
+	SortableColumns:      []string{"name"},
+	DefaultSortingColumn: "name",
+}
+
+var ScheduleRunProps = ObjectProps{
+	TableName:         "project__schedule_run",
+	Type:              reflect.TypeOf(ScheduleRun{}),
+	PrimaryColumnName: "id",
+	SortInverted:      true,
+}
+
 var ProjectUserProps = ObjectProps{
 	TableName:         "project__user",
 	Type:              reflect.TypeOf(ProjectUser{}),
@@ -292,6 +507,13 @@ var TokenProps = ObjectProps{
 	TableName:         "user__token",
 	Type:              reflect.TypeOf(APIToken{}),
 	PrimaryColumnName: "id",
+	PrimaryColumnType: StringPrimaryColumn,
+}
+
+var FavoriteTemplateProps = ObjectProps{
+	TableName:         "user__favorite_template",
+	Type:              reflect.TypeOf(FavoriteTemplate{}),
+	PrimaryColumnName: "template_id",
 }
 
 var TaskProps = ObjectProps{
@@ -303,8 +525,9 @@ var TaskProps = ObjectProps{
 }
 
 var TaskOutputProps = ObjectProps{
-	TableName: "task__output",
-	Type:      reflect.TypeOf(TaskOutput{}),
+	TableName:         "task__output",
+	Type:              reflect.TypeOf(TaskOutput{}),
+	PrimaryColumnName: "id",
 }
 
 var ViewProps = ObjectProps{
@@ -314,6 +537,14 @@ var ViewProps = ObjectProps{
 	DefaultSortingColumn: "position",
 }
 
+var NotificationTargetProps = ObjectProps{
+	TableName:            "project__notification_target",
+	Type:                 reflect.TypeOf(NotificationTarget{}),
+	PrimaryColumnName:    "id",
+	SortableColumns:      []string{"name"},
+	DefaultSortingColumn: "name",
+}
+
 var GlobalRunnerProps = ObjectProps{
 	TableName:         "runner",
 	Type:              reflect.TypeOf(Runner{}),
@@ -321,12 +552,50 @@ var GlobalRunnerProps = ObjectProps{
 	IsGlobal:          true,
 }
 
+// IsPrimaryColumnKind checks if values of the kind can be stored in the primary column.
+// Pointers must be dereferenced by the caller.
+func (p ObjectProps) IsPrimaryColumnKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64,
+		reflect.Uint,
+		reflect.Uint8,
+		reflect.Uint16,
+		reflect.Uint32,
+		reflect.Uint64:
+		return p.PrimaryColumnType == IntPrimaryColumn
+	case reflect.String:
+		return p.PrimaryColumnType == StringPrimaryColumn
+	default:
+		return false
+	}
+}
+
+// GetReferringFieldsFrom returns columns of the type which refer to objects described by the props.
+// Only columns with ReferringColumnSuffix and the type of the primary column are returned.
 func (p ObjectProps) GetReferringFieldsFrom(t reflect.Type) (fields []string, err error) {
+	if p.ReferringColumnSuffix == "" {
+		return
+	}
+
 	n := t.NumField()
 	for i := 0; i < n; i++ {
 		if !strings.HasSuffix(t.Field(i).Tag.Get("db"), p.ReferringColumnSuffix) {
 			continue
 		}
+
+		fieldType := t.Field(i).Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if !p.IsPrimaryColumnKind(fieldType.Kind()) {
+			continue
+		}
+
 		fields = append(fields, t.Field(i).Tag.Get("db"))
 	}
 
@@ -1,6 +1,9 @@
 package db
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestObjectToJSON(t *testing.T) {
 	v := &SurveyVar{
@@ -31,3 +34,48 @@ func TestObjectToJSON3(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestGetReferringFieldsFrom_stringPrimaryColumn(t *testing.T) {
+	type tokenUsage struct {
+		ID            int     `db:"id"`
+		TokenID       string  `db:"token_id"`
+		BackupTokenID *string `db:"backup_token_id"`
+		LegacyTokenID int     `db:"legacy_token_id"`
+	}
+
+	props := ObjectProps{
+		ReferringColumnSuffix: "token_id",
+		PrimaryColumnType:     StringPrimaryColumn,
+	}
+
+	fields, err := props.GetReferringFieldsFrom(reflect.TypeOf(tokenUsage{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fields) != 2 || fields[0] != "token_id" || fields[1] != "backup_token_id" {
+		t.Fatalf("only string fields must refer to string keys, got %v", fields)
+	}
+
+	props.PrimaryColumnType = IntPrimaryColumn
+
+	fields, err = props.GetReferringFieldsFrom(reflect.TypeOf(tokenUsage{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fields) != 1 || fields[0] != "legacy_token_id" {
+		t.Fatalf("only int fields must refer to int keys, got %v", fields)
+	}
+
+	props.ReferringColumnSuffix = ""
+
+	fields, err = props.GetReferringFieldsFrom(reflect.TypeOf(tokenUsage{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fields) != 0 {
+		t.Fatal("objects without referring column suffix can't be referred")
+	}
+}
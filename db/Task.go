@@ -1,6 +1,10 @@
 package db
 
 import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,10 +18,56 @@ const (
 	TaskStoppedStatus  TaskStatus = "stopped"
 	TaskSuccessStatus  TaskStatus = "success"
 	TaskFailStatus     TaskStatus = "error"
+	// TaskCancelledStatus is set for tasks which were stopped before leaving the queue.
+	TaskCancelledStatus TaskStatus = "cancelled"
+	// TaskSkippedStatus is set for tasks which didn't run because no files
+	// matching the ChangedPathsFilter of the template changed.
+	TaskSkippedStatus TaskStatus = "skipped"
 )
 
+// TaskApprovalStatus shows whether the task waits for approval before running.
+// It is empty for tasks which don't require approval.
+type TaskApprovalStatus string
+
+const (
+	TaskApprovalPending  TaskApprovalStatus = "pending"
+	TaskApprovalApproved TaskApprovalStatus = "approved"
+)
+
+// TaskFailureReason explains why the task failed, so failures of different stages can be told apart.
+type TaskFailureReason string
+
+const (
+	// TaskFailureCheckout is set if the repository of the template could not be cloned, pulled or checked out.
+	TaskFailureCheckout TaskFailureReason = "checkout"
+	// TaskFailureGalaxy is set if ansible-galaxy failed to install requirements.
+	TaskFailureGalaxy TaskFailureReason = "galaxy"
+	// TaskFailurePlaybook is set if ansible-playbook exited with non-zero code.
+	TaskFailurePlaybook TaskFailureReason = "playbook"
+	// TaskFailureTimeout is set if the task was force stopped because it didn't stop in time.
+	TaskFailureTimeout TaskFailureReason = "timeout"
+	// TaskFailureKilled is set if the process of the task was killed or the task was interrupted by the server restart.
+	TaskFailureKilled TaskFailureReason = "killed"
+	// TaskFailureOther is set for all other failures, for example an inventory which could not be installed.
+	TaskFailureOther TaskFailureReason = "other"
+)
+
+// TaskFinishedStatuses are statuses of tasks which don't change anymore.
+var TaskFinishedStatuses = []TaskStatus{
+	TaskStoppedStatus,
+	TaskSuccessStatus,
+	TaskFailStatus,
+	TaskCancelledStatus,
+	TaskSkippedStatus,
+}
+
 func (s TaskStatus) IsFinished() bool {
-	return s == TaskStoppedStatus || s == TaskSuccessStatus || s == TaskFailStatus
+	for _, status := range TaskFinishedStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
 }
 
 // Task is a model of a task which will be executed by the runner
@@ -32,17 +82,32 @@ type Task struct {
 	DryRun bool `db:"dry_run" json:"dry_run"`
 	Diff   bool `db:"diff" json:"diff"`
 
+	// Verbosity is a number of -v flags passed to ansible-playbook, from 0 to MaxVerbosity.
+	// The verbosity of the template is used if it is 0.
+	Verbosity int `db:"verbosity" json:"verbosity"`
+
 	// override variables
 	Playbook    string `db:"playbook" json:"playbook"`
 	Environment string `db:"environment" json:"environment"`
 	Limit       string `db:"hosts_limit" json:"limit"`
 
+	// InventorySnapshot is a content of the static inventory which the task runs with
+	// instead of the template inventory, so the run is reproducible after the inventory changes.
+	// Access keys of the template inventory are still used.
+	InventorySnapshot *string `db:"inventory_snapshot" json:"inventory_snapshot"`
+	// InventorySnapshotType is a type of InventorySnapshot, static or static-yaml.
+	InventorySnapshotType string `db:"inventory_snapshot_type" json:"inventory_snapshot_type"`
+	// SnapshotInventory makes TaskPool store the content of the template inventory
+	// to InventorySnapshot when the task is created. It is not stored.
+	SnapshotInventory bool `db:"-" json:"snapshot_inventory,omitempty"`
+
 	UserID *int `db:"user_id" json:"user_id"`
 
 	Created time.Time  `db:"created" json:"created"`
 	Start   *time.Time `db:"start" json:"start"`
 	End     *time.Time `db:"end" json:"end"`
 
+	// Message is a user defined description of the task run, for example "hotfix for PR-123".
 	Message string `db:"message" json:"message"`
 
 	// CommitMessage is a git commit hash of playbook repository which
@@ -59,6 +124,277 @@ type Task struct {
 	Version *string `db:"version" json:"version"`
 
 	Arguments *string `db:"arguments" json:"arguments"`
+
+	// ExitCode is an exit code of ansible-playbook process.
+	// It is nil if the process was not finished normally, for example was killed.
+	ExitCode *int `db:"exit_code" json:"exit_code"`
+
+	// FailureReason is set when the task fails. It is also set for tasks force stopped by timeout,
+	// and it is empty for other tasks.
+	FailureReason TaskFailureReason `db:"failure_reason" json:"failure_reason"`
+
+	// ScheduledAt is a time when the task should be started.
+	// Task is started immediately if it is nil.
+	ScheduledAt *time.Time `db:"scheduled_at" json:"scheduled_at"`
+
+	// ApprovalStatus is pending for tasks of templates with ApprovalRequired
+	// until another user approves the task. Pending tasks stay in the queue.
+	ApprovalStatus TaskApprovalStatus `db:"approval_status" json:"approval_status"`
+	// ApprovedBy is an ID of the user who approved the task.
+	ApprovedBy *int `db:"approved_by" json:"approved_by"`
+
+	// ScheduleID is an ID of the schedule which created the task.
+	// It is nil for tasks started by users or other tasks.
+	ScheduleID *int `db:"schedule_id" json:"schedule_id"`
+
+	// RunnerID is an ID of the remote runner which executed the task.
+	// It is nil for tasks executed by the server itself.
+	RunnerID *int `db:"runner_id" json:"runner_id"`
+
+	// OutputArchived is set when the output of the finished task is uploaded to the archive
+	// storage, so the output can be read from the archive after it is pruned from the database.
+	OutputArchived bool `db:"output_archived" json:"output_archived"`
+
+	// DisplayTagsJSON contains DisplayTags serialized to JSON, it is used for storing in the database.
+	DisplayTagsJSON *string `db:"display_tags" json:"-"`
+	// DisplayTags are user defined labels of the task used for filtering in the UI.
+	// They are not related to ansible tags.
+	DisplayTags []string `db:"-" json:"display_tags"`
+
+	// Priority defines the order of starting queued tasks, tasks with higher priority are started first.
+	// It is 0 for normal tasks.
+	Priority int `db:"priority" json:"priority"`
+
+	// PipelineID is an ID of the TemplatePipeline which the task belongs to.
+	PipelineID *int `db:"pipeline_id" json:"pipeline_id"`
+	// PipelineStage is an index of the pipeline stage which the task runs.
+	// It is 0 for the task which starts the pipeline.
+	PipelineStage *int `db:"pipeline_stage" json:"pipeline_stage"`
+
+	// Progress is an estimated progress of the running task in percents.
+	// It is nil if the task is not running or the progress is unknown.
+	Progress *int `db:"-" json:"progress,omitempty"`
+}
+
+// TaskFilter restricts tasks returned by GetProjectTasks.
+type TaskFilter struct {
+	// UserID selects tasks started by the user.
+	UserID *int
+	// DisplayTags selects tasks which have all the display tags.
+	DisplayTags []string
+	// Status selects tasks which have one of the statuses.
+	Status []TaskStatus
+	// StartedAfter selects tasks started at or after the time. Tasks which never started are not selected.
+	StartedAfter *time.Time
+	// StartedBefore selects tasks started before the time. Tasks which never started are not selected.
+	StartedBefore *time.Time
+	// TemplateID selects tasks of the template. It is used only by GetProjectTasksFiltered.
+	TemplateID *int
+}
+
+// MatchesStatusAndStart checks the task against Status, StartedAfter and StartedBefore of the filter.
+func (f TaskFilter) MatchesStatusAndStart(task Task) bool {
+	if len(f.Status) > 0 {
+		found := false
+		for _, status := range f.Status {
+			if task.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.StartedAfter != nil && (task.Start == nil || task.Start.Before(*f.StartedAfter)) {
+		return false
+	}
+
+	if f.StartedBefore != nil && (task.Start == nil || !task.Start.Before(*f.StartedBefore)) {
+		return false
+	}
+
+	return true
+}
+
+// MaxVerbosity is the verbosity of ansible -vvvv flag.
+const MaxVerbosity = 4
+
+// IsValidVerbosity checks that the verbosity can be passed to ansible-playbook.
+func IsValidVerbosity(verbosity int) bool {
+	return verbosity >= 0 && verbosity <= MaxVerbosity
+}
+
+// MaxTaskMessageLength is a max length of the task message, it is limited by the database column size.
+const MaxTaskMessageLength = 250
+
+// MaxTaskPriority is a max priority of the task, 0 is the priority of normal tasks.
+const MaxTaskPriority = 10
+
+const (
+	// MaxTaskDisplayTags is a max number of display tags of the task.
+	MaxTaskDisplayTags = 10
+	// MaxTaskDisplayTagLength is a max length of a display tag.
+	MaxTaskDisplayTagLength = 50
+)
+
+// displayTagRegexp restricts characters of display tags, so tags can be searched
+// in their JSON representation stored in the database.
+var displayTagRegexp = regexp.MustCompile(`^[\p{L}\p{N} _.:/@#+-]+$`)
+
+// ValidateDisplayTags checks number, length and characters of the display tags.
+func ValidateDisplayTags(tags []string) error {
+	if len(tags) > MaxTaskDisplayTags {
+		return &ValidationError{"Task can not have more than " + strconv.Itoa(MaxTaskDisplayTags) + " display tags"}
+	}
+
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return &ValidationError{"Display tag can not be empty"}
+		}
+
+		if len([]rune(tag)) > MaxTaskDisplayTagLength {
+			return &ValidationError{"Display tag is too long"}
+		}
+
+		if !displayTagRegexp.MatchString(tag) {
+			return &ValidationError{"Display tag can contain only letters, digits, spaces and _.:/@#+- characters"}
+		}
+	}
+
+	return nil
+}
+
+// FillDisplayTags restores DisplayTags from DisplayTagsJSON.
+func (task *Task) FillDisplayTags() error {
+	task.DisplayTags = nil
+
+	if task.DisplayTagsJSON == nil {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(*task.DisplayTagsJSON), &task.DisplayTags)
+}
+
+// HasDisplayTags checks if the task has all the display tags.
+func (task *Task) HasDisplayTags(tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range task.DisplayTags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// MaskedValue replaces values of secret fields in responses for users
+// which have no permission to see them.
+const MaskedValue = "**********"
+
+// secretKeyPatterns contains substrings of variable names which values are treated as secrets.
+var secretKeyPatterns = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"private_key",
+	"api_key",
+	"apikey",
+	"credential",
+}
+
+// IsSecretKey checks if the variable with the name can contain a secret value.
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range secretKeyPatterns {
+		if strings.Contains(key, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskSecretValues replaces values of secret keys in the parsed JSON value.
+// Maps are modified in place.
+func MaskSecretValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if IsSecretKey(key) {
+				v[key] = MaskedValue
+			} else {
+				v[key] = MaskSecretValues(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = MaskSecretValues(val)
+		}
+	}
+	return value
+}
+
+// MaskEnvironment replaces values of secret variables in the environment override of the task.
+// The whole environment is masked if it can not be parsed.
+func (task *Task) MaskEnvironment() {
+	if task.Environment == "" {
+		return
+	}
+
+	var env interface{}
+
+	err := json.Unmarshal([]byte(task.Environment), &env)
+	if err != nil {
+		task.Environment = MaskedValue
+		return
+	}
+
+	masked, err := json.Marshal(MaskSecretValues(env))
+	if err != nil {
+		task.Environment = MaskedValue
+		return
+	}
+
+	task.Environment = string(masked)
+}
+
+// TaskPruneOption changes what Store.PruneTaskOutputs deletes besides output records.
+type TaskPruneOption int
+
+const (
+	// PruneFinishedTasks makes PruneTaskOutputs delete finished tasks together with their output.
+	PruneFinishedTasks TaskPruneOption = iota + 1
+)
+
+// HasTaskPruneOption checks that the option is in the list of options passed to PruneTaskOutputs.
+func HasTaskPruneOption(options []TaskPruneOption, option TaskPruneOption) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// EndedBefore checks that the task is finished before the time.
+// Creation time is used for finished tasks without end time, for example cancelled ones.
+func (task *Task) EndedBefore(before time.Time) bool {
+	if !task.Status.IsFinished() {
+		return false
+	}
+
+	if task.End != nil {
+		return task.End.Before(before)
+	}
+
+	return task.Created.Before(before)
 }
 
 func (task *Task) GetIncomingVersion(d Store) *string {
@@ -84,7 +420,48 @@ func (task *Task) GetIncomingVersion(d Store) *string {
 	return buildTask.GetIncomingVersion(d)
 }
 
+// SetInventorySnapshot stores the content of the static inventory with the task.
+func (task *Task) SetInventorySnapshot(inventory Inventory) error {
+	if inventory.Type != InventoryStatic && inventory.Type != InventoryStaticYaml {
+		return &ValidationError{"Only static inventories can be saved with the task"}
+	}
+
+	content := inventory.Inventory
+	task.InventorySnapshot = &content
+	task.InventorySnapshotType = inventory.Type
+
+	return nil
+}
+
 func (task *Task) ValidateNewTask(template Template) error {
+	if template.Disabled {
+		return &ValidationError{"Template is disabled"}
+	}
+
+	if len([]rune(task.Message)) > MaxTaskMessageLength {
+		return &ValidationError{"Task message is too long"}
+	}
+
+	if task.Priority < 0 || task.Priority > MaxTaskPriority {
+		return &ValidationError{"Task priority must be between 0 and " + strconv.Itoa(MaxTaskPriority)}
+	}
+
+	if !IsValidVerbosity(task.Verbosity) {
+		return &ValidationError{"Task verbosity must be between 0 and 4"}
+	}
+
+	if err := ValidateDisplayTags(task.DisplayTags); err != nil {
+		return err
+	}
+
+	if task.InventorySnapshot != nil {
+		switch task.InventorySnapshotType {
+		case "", InventoryStatic, InventoryStaticYaml:
+		default:
+			return &ValidationError{"Inventory snapshot type must be static or static-yaml"}
+		}
+	}
+
 	switch template.Type {
 	case TemplateBuild:
 	case TemplateDeploy:
@@ -94,6 +471,10 @@ func (task *Task) ValidateNewTask(template Template) error {
 }
 
 func (task *TaskWithTpl) Fill(d Store) error {
+	if err := task.FillDisplayTags(); err != nil {
+		return err
+	}
+
 	if task.BuildTaskID != nil {
 		build, err := d.GetTask(task.ProjectID, *task.BuildTaskID)
 		if err == ErrNotFound {
@@ -107,6 +488,14 @@ func (task *TaskWithTpl) Fill(d Store) error {
 	return nil
 }
 
+// MaskEnvironment replaces values of secret variables of the task and its build task.
+func (task *TaskWithTpl) MaskEnvironment() {
+	task.Task.MaskEnvironment()
+	if task.BuildTask != nil {
+		task.BuildTask.MaskEnvironment()
+	}
+}
+
 // TaskWithTpl is the task data with additional fields
 type TaskWithTpl struct {
 	Task
@@ -118,9 +507,103 @@ type TaskWithTpl struct {
 }
 
 // TaskOutput is the ansible log output from the task
+// TaskOutputLevel is a severity of the task output line.
+type TaskOutputLevel string
+
+const (
+	TaskOutputInfo    TaskOutputLevel = "info"
+	TaskOutputWarning TaskOutputLevel = "warning"
+	TaskOutputError   TaskOutputLevel = "error"
+)
+
+// Severity returns a number which allows to compare levels, higher is more severe.
+func (l TaskOutputLevel) Severity() int {
+	switch l {
+	case TaskOutputWarning:
+		return 1
+	case TaskOutputError:
+		return 2
+	default:
+		return 0
+	}
+}
+
 type TaskOutput struct {
-	TaskID int       `db:"task_id" json:"task_id"`
+	ID     int `db:"id" json:"id"`
+	TaskID int `db:"task_id" json:"task_id"`
+	// Seq is assigned on insert and increases monotonically within the task.
+	// It defines the order of records which have the same Time.
+	Seq    int       `db:"seq" json:"seq"`
 	Task   string    `db:"task" json:"task"`
 	Time   time.Time `db:"time" json:"time"`
 	Output string    `db:"output" json:"output"`
+	// Level is info if it is not set on creation.
+	Level TaskOutputLevel `db:"level" json:"level"`
+}
+
+func getNextBuildVersion(startVersion string, currentVersion string) string {
+	re := regexp.MustCompile(`^(.*[^\d])?(\d+)([^\d].*)?$`)
+	m := re.FindStringSubmatch(startVersion)
+
+	if m == nil {
+		return startVersion
+	}
+
+	var prefix, suffix, body string
+
+	switch len(m) - 1 {
+	case 3:
+		prefix = m[1]
+		body = m[2]
+		suffix = m[3]
+	case 2:
+		if _, err := strconv.Atoi(m[1]); err == nil {
+			body = m[1]
+			suffix = m[2]
+		} else {
+			prefix = m[1]
+			body = m[2]
+		}
+	case 1:
+		body = m[1]
+	default:
+		return startVersion
+	}
+
+	if !strings.HasPrefix(currentVersion, prefix) ||
+		!strings.HasSuffix(currentVersion, suffix) {
+		return startVersion
+	}
+
+	curr, err := strconv.Atoi(currentVersion[len(prefix) : len(currentVersion)-len(suffix)])
+	if err != nil {
+		return startVersion
+	}
+
+	start, err := strconv.Atoi(body)
+	if err != nil {
+		panic(err)
+	}
+
+	var newVer int
+	if start > curr {
+		newVer = start
+	} else {
+		newVer = curr + 1
+	}
+
+	return prefix + strconv.Itoa(newVer) + suffix
+}
+
+// SetBuildVersion sets the version of the new task of the build template.
+// The first build gets startVersion, next builds increment the number of lastVersion,
+// which is the version of the most recent build of the template.
+func (task *Task) SetBuildVersion(startVersion *string, lastVersion *string) {
+	if startVersion == nil || lastVersion == nil {
+		task.Version = startVersion
+		return
+	}
+
+	v := getNextBuildVersion(*startVersion, *lastVersion)
+	task.Version = &v
 }
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTask_MaskEnvironment(t *testing.T) {
+	task := Task{
+		Environment: `{"db_password": "qwerty", "host": "example.com", "nested": {"API_TOKEN": "abc", "port": 22}}`,
+	}
+
+	task.MaskEnvironment()
+
+	if task.Environment != `{"db_password":"**********","host":"example.com","nested":{"API_TOKEN":"**********","port":22}}` {
+		t.Fatal("invalid masked environment: " + task.Environment)
+	}
+}
+
+func TestTask_MaskEnvironment_invalidJSON(t *testing.T) {
+	task := Task{
+		Environment: `password=qwerty`,
+	}
+
+	task.MaskEnvironment()
+
+	if task.Environment != MaskedValue {
+		t.Fatal("unparsable environment must be masked completely")
+	}
+}
+
+func TestTask_ValidateNewTask_message(t *testing.T) {
+	task := Task{
+		Message: strings.Repeat("a", MaxTaskMessageLength),
+	}
+
+	if err := task.ValidateNewTask(Template{}); err != nil {
+		t.Fatal(err)
+	}
+
+	task.Message += "a"
+
+	if _, ok := task.ValidateNewTask(Template{}).(*ValidationError); !ok {
+		t.Fatal("too long message must be rejected")
+	}
+}
+
+func TestTask_ValidateNewTask_displayTags(t *testing.T) {
+	task := Task{
+		DisplayTags: []string{"hotfix", "PR-123", "release 1.2", "team:ops"},
+	}
+
+	if err := task.ValidateNewTask(Template{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tags := range [][]string{
+		{""},
+		{strings.Repeat("a", MaxTaskDisplayTagLength+1)},
+		{`quoted"tag`},
+		{"percent%"},
+		strings.Split(strings.Repeat("a", MaxTaskDisplayTags+1), ""),
+	} {
+		task.DisplayTags = tags
+		if _, ok := task.ValidateNewTask(Template{}).(*ValidationError); !ok {
+			t.Fatalf("display tags %v must be invalid", tags)
+		}
+	}
+}
+
+func TestTask_ValidateNewTask_priority(t *testing.T) {
+	for _, priority := range []int{0, MaxTaskPriority} {
+		task := Task{Priority: priority}
+		if err := task.ValidateNewTask(Template{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, priority := range []int{-1, MaxTaskPriority + 1} {
+		task := Task{Priority: priority}
+		if _, ok := task.ValidateNewTask(Template{}).(*ValidationError); !ok {
+			t.Fatalf("priority %d must be invalid", priority)
+		}
+	}
+}
+
+func TestGetNextBuildVersion(t *testing.T) {
+	s := getNextBuildVersion("new-1.4-patch", "new-1.5-patch")
+	if s != "new-1.6-patch" {
+		t.Fatal()
+	}
+
+	s = getNextBuildVersion("new-1.4", "new-1.5")
+	if s != "new-1.6" {
+		t.Fatal()
+	}
+
+	s = getNextBuildVersion("1.4-patch", "1.5-patch")
+	if s != "1.6-patch" {
+		t.Fatal()
+	}
+
+	s = getNextBuildVersion("1.4.8", "1.4.9")
+	if s != "1.4.10" {
+		t.Fatal()
+	}
+
+	s = getNextBuildVersion("0", "7")
+	if s != "8" {
+		t.Fatal()
+	}
+}
+
+func TestTask_SetBuildVersion(t *testing.T) {
+	start := "1.0"
+	last := "1.3"
+
+	task := Task{}
+
+	task.SetBuildVersion(&start, nil)
+	if task.Version == nil || *task.Version != "1.0" {
+		t.Fatal("first build must get the start version")
+	}
+
+	task.SetBuildVersion(&start, &last)
+	if task.Version == nil || *task.Version != "1.4" {
+		t.Fatal("next build must increment the last version")
+	}
+
+	task.SetBuildVersion(nil, &last)
+	if task.Version != nil {
+		t.Fatal("build without start version must not get a version")
+	}
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"encoding/json"
+	"path"
+	"strings"
 )
 
 type TemplateType string
@@ -27,10 +29,19 @@ type SurveyVar struct {
 	Description string        `json:"description"`
 }
 
+// TemplateVault is a vault password passed to ansible with the vault-id label.
+type TemplateVault struct {
+	Label      string    `json:"label"`
+	VaultKeyID int       `json:"vault_key_id"`
+	VaultKey   AccessKey `json:"-"`
+}
+
 type TemplateFilter struct {
 	ViewID          *int
 	BuildTemplateID *int
 	AutorunOnly     bool
+	// IncludeArchived selects archived templates too, they are excluded by default.
+	IncludeArchived bool
 }
 
 // Template is a user defined model that is used to run a task
@@ -38,7 +49,7 @@ type Template struct {
 	ID int `db:"id" json:"id"`
 
 	ProjectID     int  `db:"project_id" json:"project_id"`
-	InventoryID   int  `db:"inventory_id" json:"inventory_id"`
+	InventoryID   *int `db:"inventory_id" json:"inventory_id"`
 	RepositoryID  int  `db:"repository_id" json:"repository_id"`
 	EnvironmentID *int `db:"environment_id" json:"environment_id"`
 
@@ -73,6 +84,158 @@ type Template struct {
 	SurveyVars     []SurveyVar `db:"-" json:"survey_vars"`
 
 	SuppressSuccessAlerts bool `db:"suppress_success_alerts" json:"suppress_success_alerts"`
+
+	// JSONEvents runs ansible with the JSON callback to produce structured events.
+	JSONEvents bool `db:"json_events" json:"json_events"`
+
+	// Disabled templates can not be used to create new tasks.
+	Disabled bool `db:"disabled" json:"disabled"`
+
+	// Archived templates are hidden from listings and can not run tasks, but keep their task history.
+	// The flag is changed by ArchiveTemplate only.
+	Archived bool `db:"archived" json:"archived"`
+
+	// VaultsJSON used internally for read from database.
+	// Do not use it in your code. Use Vaults instead.
+	VaultsJSON *string         `db:"vaults" json:"-"`
+	Vaults     []TemplateVault `db:"-" json:"vaults"`
+
+	// PreHook is a shell command which runs in the repository directory before the playbook.
+	// The task fails if the command fails.
+	PreHook *string `db:"pre_hook" json:"pre_hook"`
+	// PostHook is a shell command which runs after the playbook, even if the playbook failed.
+	PostHook *string `db:"post_hook" json:"post_hook"`
+
+	// ApprovalRequired tasks of the template run only after another user approves them.
+	ApprovalRequired bool `db:"approval_required" json:"approval_required"`
+
+	// RunnerTag groups templates which share the concurrency limit
+	// configured for the tag in runner_tag_max_parallel_tasks.
+	RunnerTag *string `db:"runner_tag" json:"runner_tag"`
+
+	// ChangedPathsFilterJSON used internally for read from database.
+	// Do not use it in your code. Use ChangedPathsFilter instead.
+	ChangedPathsFilterJSON *string `db:"changed_paths_filter" json:"-"`
+	// ChangedPathsFilter contains glob patterns of repository files.
+	// The task is skipped if none of the files changed since the last successful task of the template.
+	ChangedPathsFilter []string `db:"-" json:"changed_paths_filter"`
+
+	// AllowedRolesJSON used internally for read from database.
+	// Do not use it in your code. Use AllowedRoles instead.
+	AllowedRolesJSON *string `db:"allowed_roles" json:"-"`
+	// AllowedRoles restricts running of the template to project users with these roles.
+	// Owners can always run the template. Empty list means no restriction.
+	AllowedRoles []ProjectUserRole `db:"-" json:"allowed_roles"`
+
+	// Verbosity is the default verbosity of tasks of the template, see Task.Verbosity.
+	Verbosity int `db:"verbosity" json:"verbosity"`
+
+	// NotificationTargetIDsJSON used internally for read from database.
+	// Do not use it in your code. Use NotificationTargetIDs instead.
+	NotificationTargetIDsJSON *string `db:"notification_target_ids" json:"-"`
+	// NotificationTargetIDs are IDs of the notification targets notified about finished tasks of the template.
+	// The project default targets are notified if it is empty.
+	NotificationTargetIDs []int `db:"-" json:"notification_target_ids"`
+
+	// AdditionalRepositoryIDsJSON used internally for read from database.
+	// Do not use it in your code. Use AdditionalRepositoryIDs instead.
+	AdditionalRepositoryIDsJSON *string `db:"additional_repository_ids" json:"-"`
+	// AdditionalRepositoryIDs are IDs of the repositories which are checked out
+	// before the run in addition to the template repository. Each repository is
+	// checked out into a sibling directory of the template repository.
+	AdditionalRepositoryIDs []int `db:"-" json:"additional_repository_ids"`
+
+	// GalaxyRequirements is a path of the requirements file relative to the repository.
+	// If it is set, roles and collections listed in it are installed by ansible-galaxy
+	// before the run instead of roles/requirements.yml and collections/requirements.yml.
+	GalaxyRequirements *string `db:"galaxy_requirements" json:"galaxy_requirements"`
+
+	// WorkingDir is a directory relative to the repository root which tasks run in.
+	// The playbook path is relative to it. Tasks run in the repository root if it is empty.
+	WorkingDir *string `db:"working_dir" json:"working_dir"`
+
+	// AllowedWindowJSON used internally for read from database.
+	// Do not use it in your code. Use AllowedWindow instead.
+	AllowedWindowJSON *string `db:"allowed_window" json:"-"`
+	// AllowedWindow restricts running of tasks of the template to the time window.
+	// Tasks can run at any time if it is nil.
+	AllowedWindow *TimeWindow `db:"-" json:"allowed_window"`
+
+	// SyntaxCheck makes tasks run ansible-playbook --syntax-check before the run
+	// and fail without running the playbook if the check fails.
+	SyntaxCheck bool `db:"syntax_check" json:"syntax_check"`
+}
+
+// GetWorkingDir returns the working directory relative to the repository root.
+func (tpl *Template) GetWorkingDir() string {
+	if tpl.WorkingDir == nil {
+		return ""
+	}
+	return strings.Trim(*tpl.WorkingDir, "/")
+}
+
+// CanRun checks whether the project user with the role can run tasks of the template.
+func (tpl *Template) CanRun(role ProjectUserRole) bool {
+	if !role.Can(CanRunProjectTasks) {
+		return false
+	}
+
+	if len(tpl.AllowedRoles) == 0 || role == ProjectOwner {
+		return true
+	}
+
+	for _, r := range tpl.AllowedRoles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetAccessibleTemplates returns templates of the project which the user can run.
+// Admins can run all templates.
+func GetAccessibleTemplates(d Store, userID int, projectID int) (templates []Template, err error) {
+	user, err := d.GetUser(userID)
+	if err != nil {
+		return
+	}
+
+	all, err := d.GetTemplates(projectID, TemplateFilter{}, RetrieveQueryParams{})
+	if err != nil {
+		return
+	}
+
+	if user.Admin {
+		templates = all
+		return
+	}
+
+	projectUser, err := d.GetProjectUser(projectID, userID)
+	if err == ErrNotFound {
+		templates, err = make([]Template, 0), nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	templates = make([]Template, 0)
+	for _, tpl := range all {
+		if tpl.CanRun(projectUser.Role) {
+			templates = append(templates, tpl)
+		}
+	}
+
+	return
+}
+
+// IsValidPlaybookPath checks that the playbook path stays inside the repository
+// after joining with the repository root. Leading slash is allowed because
+// the path is always relative to the repository.
+func IsValidPlaybookPath(playbook string) bool {
+	playbookPath := path.Clean(strings.TrimLeft(playbook, "/"))
+	return playbookPath != ".." && !strings.HasPrefix(playbookPath, "../")
 }
 
 func (tpl *Template) Validate() error {
@@ -84,12 +247,69 @@ func (tpl *Template) Validate() error {
 		return &ValidationError{"template playbook can not be empty"}
 	}
 
+	if !IsValidVerbosity(tpl.Verbosity) {
+		return &ValidationError{"template verbosity must be between 0 and 4"}
+	}
+
+	if !IsValidPlaybookPath(tpl.Playbook) {
+		return &ValidationError{"template playbook must be inside the repository"}
+	}
+
+	if !IsValidPlaybookPath(tpl.GetWorkingDir()) {
+		return &ValidationError{"template working directory must be inside the repository"}
+	}
+
+	if tpl.GalaxyRequirements != nil && *tpl.GalaxyRequirements != "" && !IsValidPlaybookPath(*tpl.GalaxyRequirements) {
+		return &ValidationError{"template galaxy requirements must be inside the repository"}
+	}
+
 	if tpl.Arguments != nil {
 		if !json.Valid([]byte(*tpl.Arguments)) {
 			return &ValidationError{"template arguments must be valid JSON"}
 		}
 	}
 
+	for _, pattern := range tpl.ChangedPathsFilter {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return &ValidationError{"changed paths filter must contain valid glob patterns"}
+		}
+	}
+
+	for _, role := range tpl.AllowedRoles {
+		if !role.IsValid() {
+			return &ValidationError{"allowed roles must contain valid project roles"}
+		}
+	}
+
+	if tpl.AllowedWindow != nil {
+		if err := tpl.AllowedWindow.Validate(); err != nil {
+			return err
+		}
+	}
+
+	repositories := map[int]bool{tpl.RepositoryID: true}
+
+	for _, id := range tpl.AdditionalRepositoryIDs {
+		if repositories[id] {
+			return &ValidationError{"additional repositories must be unique and differ from the template repository"}
+		}
+		repositories[id] = true
+	}
+
+	labels := make(map[string]bool)
+
+	for _, vault := range tpl.Vaults {
+		if vault.Label == "" || strings.Contains(vault.Label, "@") {
+			return &ValidationError{"vault label can not be empty or contain @"}
+		}
+
+		if labels[vault.Label] {
+			return &ValidationError{"vault labels must be unique"}
+		}
+
+		labels[vault.Label] = true
+	}
+
 	return nil
 }
 
@@ -104,6 +324,12 @@ func FillTemplates(d Store, templates []Template) (err error) {
 		if len(tasks) > 0 {
 			tpl.LastTask = &tasks[0]
 		}
+		if tpl.AllowedRolesJSON != nil {
+			err = json.Unmarshal([]byte(*tpl.AllowedRolesJSON), &tpl.AllowedRoles)
+			if err != nil {
+				return
+			}
+		}
 	}
 
 	return
@@ -135,6 +361,59 @@ func FillTemplate(d Store, template *Template) (err error) {
 
 	if template.SurveyVarsJSON != nil {
 		err = json.Unmarshal([]byte(*template.SurveyVarsJSON), &template.SurveyVars)
+		if err != nil {
+			return
+		}
+	}
+
+	if template.VaultsJSON != nil {
+		err = json.Unmarshal([]byte(*template.VaultsJSON), &template.Vaults)
+		if err != nil {
+			return
+		}
+	}
+
+	if template.ChangedPathsFilterJSON != nil {
+		err = json.Unmarshal([]byte(*template.ChangedPathsFilterJSON), &template.ChangedPathsFilter)
+		if err != nil {
+			return
+		}
+	}
+
+	if template.AllowedRolesJSON != nil {
+		err = json.Unmarshal([]byte(*template.AllowedRolesJSON), &template.AllowedRoles)
+		if err != nil {
+			return
+		}
+	}
+
+	if template.NotificationTargetIDsJSON != nil {
+		err = json.Unmarshal([]byte(*template.NotificationTargetIDsJSON), &template.NotificationTargetIDs)
+		if err != nil {
+			return
+		}
+	}
+
+	if template.AdditionalRepositoryIDsJSON != nil {
+		err = json.Unmarshal([]byte(*template.AdditionalRepositoryIDsJSON), &template.AdditionalRepositoryIDs)
+		if err != nil {
+			return
+		}
+	}
+
+	if template.AllowedWindowJSON != nil {
+		err = json.Unmarshal([]byte(*template.AllowedWindowJSON), &template.AllowedWindow)
+		if err != nil {
+			return
+		}
+	}
+
+	for i := range template.Vaults {
+		vault := &template.Vaults[i]
+		vault.VaultKey, err = d.GetAccessKey(template.ProjectID, vault.VaultKeyID)
+		if err != nil {
+			return
+		}
 	}
 
 	return
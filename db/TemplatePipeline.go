@@ -0,0 +1,154 @@
+package db
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// TemplatePipelineStage is a template run by the pipeline. Transitions refer
+// to other stages of the pipeline by index, the pipeline stops if the transition is not set.
+type TemplatePipelineStage struct {
+	TemplateID int `json:"template_id"`
+	// OnSuccess is an index of the stage started after the task of this stage succeeded.
+	OnSuccess *int `json:"on_success"`
+	// OnFailure is an index of the stage started after the task of this stage failed.
+	OnFailure *int `json:"on_failure"`
+}
+
+// TemplatePipeline links templates of the project into a chain, for example build and deploy.
+// The pipeline starts from the first stage, next stages are queued by TaskPool when tasks of
+// previous stages finish. Stopped and cancelled tasks stop the pipeline.
+type TemplatePipeline struct {
+	ID        int    `db:"id" json:"id"`
+	ProjectID int    `db:"project_id" json:"project_id"`
+	Name      string `db:"name" json:"name" binding:"required"`
+
+	StagesJSON string                  `db:"stages" json:"-"`
+	Stages     []TemplatePipelineStage `db:"-" json:"stages"`
+}
+
+// SerializeStages saves Stages to StagesJSON which is stored to the database.
+func (p *TemplatePipeline) SerializeStages() error {
+	data, err := json.Marshal(p.Stages)
+	if err != nil {
+		return err
+	}
+	p.StagesJSON = string(data)
+	return nil
+}
+
+// FillStages restores Stages of the pipeline from StagesJSON.
+func (p *TemplatePipeline) FillStages() error {
+	p.Stages = nil
+	if p.StagesJSON == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(p.StagesJSON), &p.Stages)
+}
+
+// FillTemplatePipelines restores stages of the pipelines.
+func FillTemplatePipelines(pipelines []TemplatePipeline) error {
+	for i := range pipelines {
+		if err := pipelines[i].FillStages(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that the pipeline has stages and transitions refer to existing stages.
+// Templates of the stages are checked by ValidateTemplatePipeline.
+func (p TemplatePipeline) Validate() error {
+	if p.Name == "" {
+		return &ValidationError{"Pipeline name can not be empty"}
+	}
+
+	if len(p.Stages) == 0 {
+		return &ValidationError{"Pipeline must have at least one stage"}
+	}
+
+	for i, stage := range p.Stages {
+		for _, next := range []*int{stage.OnSuccess, stage.OnFailure} {
+			if next != nil && (*next < 0 || *next >= len(p.Stages)) {
+				return &ValidationError{"Stage " + strconv.Itoa(i) + " refers to invalid stage"}
+			}
+		}
+	}
+
+	// a task can start any stage, so transitions of all stages are checked
+	visited := make(map[int]bool)
+	for i := range p.Stages {
+		if p.hasCycle(i, visited, make(map[int]bool)) {
+			return &ValidationError{"Stage " + strconv.Itoa(i) + " starts a cycle of stages"}
+		}
+	}
+
+	return nil
+}
+
+// hasCycle checks if transitions from the stage lead back to a stage of the current path.
+// Stages in visited are already checked and don't lead to cycles.
+func (p TemplatePipeline) hasCycle(stage int, visited map[int]bool, path map[int]bool) bool {
+	if path[stage] {
+		return true
+	}
+
+	if visited[stage] {
+		return false
+	}
+
+	path[stage] = true
+
+	for _, next := range []*int{p.Stages[stage].OnSuccess, p.Stages[stage].OnFailure} {
+		if next != nil && p.hasCycle(*next, visited, path) {
+			return true
+		}
+	}
+
+	delete(path, stage)
+	visited[stage] = true
+
+	return false
+}
+
+// NextStage returns the index of the stage which must be started after the task of the stage
+// finished with the status. False is returned if the pipeline stops.
+func (p TemplatePipeline) NextStage(stage int, status TaskStatus) (int, bool) {
+	if stage < 0 || stage >= len(p.Stages) {
+		return 0, false
+	}
+
+	var next *int
+
+	switch status {
+	case TaskSuccessStatus:
+		next = p.Stages[stage].OnSuccess
+	case TaskFailStatus:
+		next = p.Stages[stage].OnFailure
+	}
+
+	if next == nil || *next < 0 || *next >= len(p.Stages) {
+		return 0, false
+	}
+
+	return *next, true
+}
+
+// ValidateTemplatePipeline checks the pipeline and templates of its stages which must belong to the project.
+func ValidateTemplatePipeline(d Store, pipeline TemplatePipeline) error {
+	if err := pipeline.Validate(); err != nil {
+		return err
+	}
+
+	for i, stage := range pipeline.Stages {
+		_, err := d.GetTemplate(pipeline.ProjectID, stage.TemplateID)
+		if err == ErrNotFound {
+			return &ValidationError{"Template of stage " + strconv.Itoa(i) + " not found"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
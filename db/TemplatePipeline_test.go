@@ -0,0 +1,32 @@
+package db
+
+import "testing"
+
+func TestTemplatePipelineValidateCycles(t *testing.T) {
+	stage := func(i int) *int {
+		return &i
+	}
+
+	for _, c := range []struct {
+		name   string
+		stages []TemplatePipelineStage
+		valid  bool
+	}{
+		{"chain", []TemplatePipelineStage{{OnSuccess: stage(1)}, {OnFailure: stage(2)}, {}}, true},
+		{"shared stage", []TemplatePipelineStage{{OnSuccess: stage(1), OnFailure: stage(2)}, {OnSuccess: stage(2)}, {}}, true},
+		{"self", []TemplatePipelineStage{{OnSuccess: stage(0)}}, false},
+		{"0-1-0", []TemplatePipelineStage{{OnSuccess: stage(1)}, {OnSuccess: stage(0)}}, false},
+		{"failure back", []TemplatePipelineStage{{OnSuccess: stage(1)}, {OnFailure: stage(2)}, {OnFailure: stage(1)}}, false},
+		{"out of range", []TemplatePipelineStage{{OnSuccess: stage(1)}}, false},
+	} {
+		err := TemplatePipeline{Name: "Test", Stages: c.stages}.Validate()
+
+		if c.valid && err != nil {
+			t.Fatalf("%s: pipeline must be valid, got %s", c.name, err)
+		}
+
+		if _, ok := err.(*ValidationError); !c.valid && !ok {
+			t.Fatalf("%s: pipeline must be invalid", c.name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+type VarSchemaType string
+
+const (
+	VarSchemaString VarSchemaType = "string"
+	VarSchemaInt    VarSchemaType = "int"
+	VarSchemaNumber VarSchemaType = "number"
+	VarSchemaBool   VarSchemaType = "bool"
+	VarSchemaArray  VarSchemaType = "array"
+	VarSchemaObject VarSchemaType = "object"
+)
+
+type VarSchemaSource string
+
+const (
+	VarSchemaSourceSurvey      VarSchemaSource = "survey"
+	VarSchemaSourceEnvironment VarSchemaSource = "environment"
+)
+
+// VarSchemaItem describes a variable which tasks of the template use.
+type VarSchemaItem struct {
+	Name        string        `json:"name"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Type        VarSchemaType `json:"type"`
+	Required    bool          `json:"required"`
+	// Default is a value from the environment of the template, nil if the environment doesn't set it.
+	Default interface{}     `json:"default"`
+	Source  VarSchemaSource `json:"source"`
+}
+
+// VarSchema lists variables of the template, it is used to render forms and generate docs.
+type VarSchema struct {
+	TemplateID int `json:"template_id"`
+	// Variables are extra variables passed to ansible. Survey variables go first
+	// in the declared order, then variables of the environment sorted by name.
+	Variables []VarSchemaItem `json:"variables"`
+	// EnvironmentVariables are environment variables of the task process sorted by name.
+	EnvironmentVariables []VarSchemaItem `json:"environment_variables"`
+}
+
+func getVarSchemaType(value interface{}) VarSchemaType {
+	switch v := value.(type) {
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return VarSchemaInt
+		}
+		return VarSchemaNumber
+	case bool:
+		return VarSchemaBool
+	case []interface{}:
+		return VarSchemaArray
+	case map[string]interface{}:
+		return VarSchemaObject
+	default:
+		return VarSchemaString
+	}
+}
+
+func getSurveyVarSchemaType(varType SurveyVarType) VarSchemaType {
+	if varType == SurveyVarType(SurveyVarInt) {
+		return VarSchemaInt
+	}
+	return VarSchemaString
+}
+
+func unmarshalEnvironmentVars(data string) (vars map[string]interface{}, err error) {
+	vars = make(map[string]interface{})
+
+	if strings.TrimSpace(data) == "" {
+		return
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&vars)
+	return
+}
+
+func sortedVarNames(vars map[string]interface{}) []string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetTemplateVariableSchema returns variables declared by the survey of the template
+// and by its environment. Values of the environment are returned as defaults.
+func GetTemplateVariableSchema(d Store, projectID int, templateID int) (schema VarSchema, err error) {
+	tpl, err := d.GetTemplate(projectID, templateID)
+	if err != nil {
+		return
+	}
+
+	extraVars := make(map[string]interface{})
+	envVars := make(map[string]interface{})
+
+	if tpl.EnvironmentID != nil {
+		var env Environment
+		env, err = d.GetEnvironment(projectID, *tpl.EnvironmentID)
+		if err != nil {
+			return
+		}
+
+		extraVars, err = unmarshalEnvironmentVars(env.JSON)
+		if err != nil {
+			return
+		}
+
+		if env.ENV != nil {
+			envVars, err = unmarshalEnvironmentVars(*env.ENV)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	schema = VarSchema{
+		TemplateID:           tpl.ID,
+		Variables:            make([]VarSchemaItem, 0),
+		EnvironmentVariables: make([]VarSchemaItem, 0),
+	}
+
+	declared := make(map[string]bool)
+
+	for _, v := range tpl.SurveyVars {
+		declared[v.Name] = true
+		schema.Variables = append(schema.Variables, VarSchemaItem{
+			Name:        v.Name,
+			Title:       v.Title,
+			Description: v.Description,
+			Type:        getSurveyVarSchemaType(v.Type),
+			Required:    v.Required,
+			Default:     extraVars[v.Name],
+			Source:      VarSchemaSourceSurvey,
+		})
+	}
+
+	for _, name := range sortedVarNames(extraVars) {
+		if declared[name] {
+			continue
+		}
+		schema.Variables = append(schema.Variables, VarSchemaItem{
+			Name:    name,
+			Type:    getVarSchemaType(extraVars[name]),
+			Default: extraVars[name],
+			Source:  VarSchemaSourceEnvironment,
+		})
+	}
+
+	for _, name := range sortedVarNames(envVars) {
+		schema.EnvironmentVariables = append(schema.EnvironmentVariables, VarSchemaItem{
+			Name:    name,
+			Type:    getVarSchemaType(envVars[name]),
+			Default: envVars[name],
+			Source:  VarSchemaSourceEnvironment,
+		})
+	}
+
+	return
+}
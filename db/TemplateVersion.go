@@ -0,0 +1,70 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TemplateVersion is a state of the template saved before the template was changed.
+// Versions allow to see the history of the template and to roll back changes.
+type TemplateVersion struct {
+	ID         int       `db:"id" json:"id"`
+	ProjectID  int       `db:"project_id" json:"project_id"`
+	TemplateID int       `db:"template_id" json:"template_id"`
+	Created    time.Time `db:"created" json:"created"`
+
+	// TemplateJSON is the template serialized in the same format as it is returned by API.
+	TemplateJSON string   `db:"template" json:"-"`
+	Template     Template `db:"-" json:"template"`
+}
+
+// NewTemplateVersion creates a version which keeps the current state of the template.
+func NewTemplateVersion(tpl Template) (version TemplateVersion, err error) {
+	tpl.LastTask = nil
+
+	data, err := json.Marshal(tpl)
+	if err != nil {
+		return
+	}
+
+	version = TemplateVersion{
+		ProjectID:    tpl.ProjectID,
+		TemplateID:   tpl.ID,
+		Created:      time.Now(),
+		TemplateJSON: string(data),
+		Template:     tpl,
+	}
+
+	return
+}
+
+// FillTemplate restores Template of the version from TemplateJSON.
+func (v *TemplateVersion) FillTemplate() error {
+	v.Template = Template{}
+	return json.Unmarshal([]byte(v.TemplateJSON), &v.Template)
+}
+
+// FillTemplateVersions restores templates of the versions.
+func FillTemplateVersions(versions []TemplateVersion) error {
+	for i := range versions {
+		if err := versions[i].FillTemplate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackTemplate restores the template to the state saved in the version.
+// The current state of the template is saved as a new version, so the rollback can be undone.
+func RollbackTemplate(d Store, projectID int, templateID int, versionID int) error {
+	version, err := d.GetTemplateVersion(projectID, templateID, versionID)
+	if err != nil {
+		return err
+	}
+
+	tpl := version.Template
+	tpl.ID = templateID
+	tpl.ProjectID = projectID
+
+	return d.UpdateTemplate(tpl)
+}
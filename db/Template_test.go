@@ -0,0 +1,110 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestTemplate_Validate_playbookTraversal(t *testing.T) {
+	tpl := Template{
+		Name:     "Test",
+		Playbook: "../../etc/passwd",
+	}
+
+	err := tpl.Validate()
+
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatal("playbook outside of the repository must be rejected")
+	}
+
+	tpl.Playbook = "/deploy/../../../etc/passwd"
+
+	err = tpl.Validate()
+
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatal("playbook outside of the repository must be rejected")
+	}
+}
+
+func TestTemplate_Validate_nestedPlaybook(t *testing.T) {
+	for _, playbook := range []string{
+		"deploy/test.yml",
+		"/deploy/test.yml",
+		"deploy/../playbooks/test.yml",
+	} {
+		tpl := Template{
+			Name:     "Test",
+			Playbook: playbook,
+		}
+
+		err := tpl.Validate()
+		if err != nil {
+			t.Fatal("playbook " + playbook + " must be valid: " + err.Error())
+		}
+	}
+}
+
+func TestTemplate_Validate_vaultLabels(t *testing.T) {
+	tpl := Template{
+		Name:     "Test",
+		Playbook: "test.yml",
+		Vaults: []TemplateVault{
+			{Label: "dev", VaultKeyID: 1},
+			{Label: "prod", VaultKeyID: 2},
+		},
+	}
+
+	if err := tpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tpl.Vaults = append(tpl.Vaults, TemplateVault{Label: "dev", VaultKeyID: 3})
+
+	if _, ok := tpl.Validate().(*ValidationError); !ok {
+		t.Fatal("duplicate vault labels must be rejected")
+	}
+}
+
+func TestTemplate_Validate_changedPathsFilter(t *testing.T) {
+	tpl := Template{
+		Name:               "Test",
+		Playbook:           "deploy.yml",
+		ChangedPathsFilter: []string{"roles/**", "*.yml"},
+	}
+
+	if err := tpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tpl.ChangedPathsFilter = []string{"roles/[web"}
+
+	if _, ok := tpl.Validate().(*ValidationError); !ok {
+		t.Fatal("invalid glob pattern must be rejected")
+	}
+}
+
+func TestTemplate_Validate_workingDir(t *testing.T) {
+	for dir, valid := range map[string]bool{
+		"services/web":    true,
+		"/services/web/":  true,
+		"":                true,
+		"../other":        false,
+		"/services/../..": false,
+	} {
+		workingDir := dir
+		tpl := Template{
+			Name:       "Test",
+			Playbook:   "site.yml",
+			WorkingDir: &workingDir,
+		}
+
+		err := tpl.Validate()
+
+		if valid && err != nil {
+			t.Fatal("working dir " + dir + " must be valid: " + err.Error())
+		}
+
+		if _, ok := err.(*ValidationError); !valid && !ok {
+			t.Fatal("working dir " + dir + " outside of the repository must be rejected")
+		}
+	}
+}
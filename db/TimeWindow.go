@@ -0,0 +1,120 @@
+package db
+
+import (
+	"time"
+)
+
+const timeWindowLayout = "15:04"
+
+// TimeWindow is a period of the day in which tasks of the template are allowed to run,
+// for example a maintenance window.
+type TimeWindow struct {
+	// Days are week days of the window, 0 is Sunday. Empty list means every day.
+	Days []time.Weekday `json:"days"`
+	// From and To are times of the day in format HH:MM. If To is not after From,
+	// the window ends at To of the next day. Equal From and To mean the whole day.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Timezone is an IANA time zone name of the window, UTC is used if it is empty.
+	Timezone string `json:"timezone"`
+	// Hold makes tasks submitted outside the window wait until it opens.
+	// Otherwise they are rejected.
+	Hold bool `json:"hold"`
+}
+
+func (w *TimeWindow) Validate() error {
+	for _, day := range w.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return &ValidationError{"window days must be between 0 and 6"}
+		}
+	}
+
+	if _, err := time.Parse(timeWindowLayout, w.From); err != nil {
+		return &ValidationError{"window start must be in format HH:MM"}
+	}
+
+	if _, err := time.Parse(timeWindowLayout, w.To); err != nil {
+		return &ValidationError{"window end must be in format HH:MM"}
+	}
+
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return &ValidationError{"window timezone is unknown"}
+	}
+
+	return nil
+}
+
+func (w *TimeWindow) location() *time.Location {
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// minutes returns the time of the day in format HH:MM as number of minutes since midnight.
+func minutes(hhmm string) int {
+	t, err := time.Parse(timeWindowLayout, hhmm)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+func (w *TimeWindow) hasDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Contains checks whether the time is inside the window.
+func (w *TimeWindow) Contains(t time.Time) bool {
+	local := t.In(w.location())
+	now := local.Hour()*60 + local.Minute()
+	from := minutes(w.From)
+	to := minutes(w.To)
+
+	if from == to {
+		return w.hasDay(local.Weekday())
+	}
+
+	if from < to {
+		return now >= from && now < to && w.hasDay(local.Weekday())
+	}
+
+	// the window continues after midnight, the day of the window is the day it starts
+	if now >= from {
+		return w.hasDay(local.Weekday())
+	}
+
+	return now < to && w.hasDay((local.Weekday()+6)%7)
+}
+
+// NextOpen returns the time when the window opens next time or t if it is inside the window.
+func (w *TimeWindow) NextOpen(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+
+	local := t.In(w.location())
+	from := minutes(w.From)
+
+	for i := 0; i <= 7; i++ {
+		day := local.AddDate(0, 0, i)
+		start := time.Date(day.Year(), day.Month(), day.Day(), from/60, from%60, 0, 0, local.Location())
+
+		if w.hasDay(start.Weekday()) && start.After(t) {
+			return start
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindow_Contains(t *testing.T) {
+	// Monday
+	monday := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	window := TimeWindow{
+		Days: []time.Weekday{time.Monday},
+		From: "22:00",
+		To:   "02:00",
+	}
+
+	for _, test := range []struct {
+		time     time.Time
+		contains bool
+	}{
+		{monday.Add(21 * time.Hour), false},
+		{monday.Add(22 * time.Hour), true},
+		{monday.Add(25 * time.Hour), true}, // Tuesday 01:00, window of Monday
+		{monday.Add(26 * time.Hour), false},
+		{monday.Add(-time.Hour), false}, // Sunday 23:00
+	} {
+		if window.Contains(test.time) != test.contains {
+			t.Fatalf("window must contain %s: %v", test.time, test.contains)
+		}
+	}
+}
+
+func TestTimeWindow_NextOpen(t *testing.T) {
+	// Monday 10:00
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	window := TimeWindow{
+		Days: []time.Weekday{time.Wednesday},
+		From: "02:00",
+		To:   "04:00",
+	}
+
+	if next := window.NextOpen(now); !next.Equal(time.Date(2024, 1, 3, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("window must open on Wednesday, got %s", next)
+	}
+
+	inside := time.Date(2024, 1, 3, 3, 0, 0, 0, time.UTC)
+	if next := window.NextOpen(inside); !next.Equal(inside) {
+		t.Fatalf("window is open, got %s", next)
+	}
+}
+
+func TestTimeWindow_Validate(t *testing.T) {
+	for _, window := range []TimeWindow{
+		{From: "25:00", To: "02:00"},
+		{From: "01:00", To: "2"},
+		{From: "01:00", To: "02:00", Days: []time.Weekday{7}},
+		{From: "01:00", To: "02:00", Timezone: "Nowhere/Unknown"},
+	} {
+		if _, ok := window.Validate().(*ValidationError); !ok {
+			t.Fatalf("window %+v must be invalid", window)
+		}
+	}
+
+	window := TimeWindow{From: "01:00", To: "02:00", Timezone: "UTC"}
+	if err := window.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -40,3 +40,12 @@ func ValidateUser(user User) error {
 	}
 	return nil
 }
+
+// ValidateUserReassignment checks that the tasks of a deleted user can be
+// reassigned to another user.
+func ValidateUserReassignment(userID int, reassignToUserID int) error {
+	if userID == reassignToUserID {
+		return &ValidationError{Message: "Tasks cannot be reassigned to the deleted user"}
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package db
 
+import "sort"
+
 type View struct {
 	ID        int    `db:"id" json:"id"`
 	ProjectID int    `db:"project_id" json:"project_id"`
@@ -12,4 +14,48 @@ func (view *View) Validate() error {
 		return &ValidationError{"title can not be empty"}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// ReorderViews moves the view to the position and returns views which positions changed.
+// All views of the project are renumbered from 0 in the order of their positions,
+// so positions stay contiguous and unique even if they were not before.
+func ReorderViews(views []View, viewID int, position int) (changed []View, err error) {
+	if position < 0 || position >= len(views) {
+		err = &ValidationError{"position must be between 0 and number of views minus 1"}
+		return
+	}
+
+	ordered := make([]View, 0, len(views))
+	var moved *View
+
+	for i := range views {
+		if views[i].ID == viewID {
+			moved = &views[i]
+			continue
+		}
+		ordered = append(ordered, views[i])
+	}
+
+	if moved == nil {
+		err = ErrNotFound
+		return
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Position != ordered[j].Position {
+			return ordered[i].Position < ordered[j].Position
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	ordered = append(ordered[:position], append([]View{*moved}, ordered[position:]...)...)
+
+	for i, view := range ordered {
+		if view.Position != i {
+			view.Position = i
+			changed = append(changed, view)
+		}
+	}
+
+	return
+}
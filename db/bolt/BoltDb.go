@@ -33,11 +33,23 @@ func (d emptyEnumerable) Next() (key []byte, value []byte) {
 	return nil, nil
 }
 
+// DefaultIdleTimeout is the time the database file stays open after the last connection is closed.
+const DefaultIdleTimeout = 5 * time.Second
+
 type BoltDb struct {
-	Filename    string
+	Filename string
+
+	// IdleTimeout is the time the database file stays open after the last connection is closed.
+	// Connections opened during this time reuse the open database instead of reopening the file.
+	// BoltDB allows many concurrent readers and a single writer on the open database,
+	// so reused connections don't serialize requests.
+	// Zero closes the file immediately.
+	IdleTimeout time.Duration
+
 	db          *bbolt.DB
 	connections map[string]bool
 	mu          sync.Mutex
+	idleTimer   *time.Timer
 }
 
 type objectID interface {
@@ -55,6 +67,32 @@ func (d strObjectID) ToBytes() []byte {
 	return []byte(d)
 }
 
+// makeObjectID converts the value of the primary column of the object to its key.
+// Values which don't match PrimaryColumnType of the props are rejected,
+// so an int ID never matches a string ID with the same bytes.
+func makeObjectID(props db.ObjectProps, value reflect.Value) (objectID, error) {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, fmt.Errorf("object ID can not be nil")
+		}
+		value = value.Elem()
+	}
+
+	if !props.IsPrimaryColumnKind(value.Kind()) {
+		return nil, fmt.Errorf("unsupported ID type")
+	}
+
+	if props.PrimaryColumnType == db.StringPrimaryColumn {
+		return strObjectID(value.String()), nil
+	}
+
+	if value.CanUint() {
+		return intObjectID(value.Uint()), nil
+	}
+
+	return intObjectID(value.Int()), nil
+}
+
 func makeBucketId(props db.ObjectProps, ids ...int) []byte {
 	n := len(ids)
 
@@ -86,7 +124,12 @@ func (d *BoltDb) Connect(token string) {
 		panic(fmt.Errorf("Connection " + token + " already exists"))
 	}
 
-	if len(d.connections) > 0 {
+	if d.idleTimer != nil {
+		d.idleTimer.Stop()
+		d.idleTimer = nil
+	}
+
+	if len(d.connections) > 0 || d.db != nil {
 		d.connections[token] = true
 		return
 	}
@@ -125,18 +168,40 @@ func (d *BoltDb) Close(token string) {
 		panic(fmt.Errorf("can not close closed connection " + token))
 	}
 
-	if len(d.connections) > 1 {
-		delete(d.connections, token)
+	delete(d.connections, token)
+
+	if len(d.connections) > 0 {
+		return
+	}
+
+	if d.IdleTimeout > 0 {
+		d.idleTimer = time.AfterFunc(d.IdleTimeout, d.closeIdle)
+		return
+	}
+
+	d.closeDB()
+}
+
+// closeIdle closes the database file if no connections were opened during the idle timeout.
+func (d *BoltDb) closeIdle() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.connections) > 0 || d.db == nil {
 		return
 	}
 
+	d.idleTimer = nil
+	d.closeDB()
+}
+
+func (d *BoltDb) closeDB() {
 	err := d.db.Close()
 	if err != nil {
 		panic(err)
 	}
 
 	d.db = nil
-	delete(d.connections, token)
 }
 
 func (d *BoltDb) PermanentConnection() bool {
@@ -339,7 +404,7 @@ func unmarshalObjects(rawData enumerable, props db.ObjectProps, params db.Retrie
 
 		n++
 
-		if params.Count > 0 && n > params.Count {
+		if params.Count > 0 && n >= params.Count {
 			break
 		}
 	}
@@ -405,6 +470,36 @@ func (d *BoltDb) deleteObject(bucketID int, props db.ObjectProps, objectID objec
 	return d.db.Update(fn)
 }
 
+// detachAndDeleteObject calls detach for every template of the project, saves
+// the templates which were changed by it and deletes the object in a single transaction.
+func (d *BoltDb) detachAndDeleteObject(projectID int, props db.ObjectProps, objectID int, detach func(tpl *db.Template) bool) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		var templates []db.Template
+		err := d.getObjectsTx(tx, projectID, db.TemplateProps, db.RetrieveQueryParams{}, nil, &templates)
+		if err != nil {
+			return err
+		}
+
+		for _, tpl := range templates {
+			if !detach(&tpl) {
+				continue
+			}
+
+			err = d.updateObjectTx(tx, projectID, db.TemplateProps, tpl)
+			if err != nil {
+				return err
+			}
+		}
+
+		b := tx.Bucket(makeBucketId(props, projectID))
+		if b == nil || b.Get(intObjectID(objectID).ToBytes()) == nil {
+			return db.ErrNotFound
+		}
+
+		return b.Delete(intObjectID(objectID).ToBytes())
+	})
+}
+
 func (d *BoltDb) updateObjectTx(tx *bbolt.Tx, bucketID int, props db.ObjectProps, object interface{}) error {
 	b := tx.Bucket(makeBucketId(props, bucketID))
 	if b == nil {
@@ -419,26 +514,9 @@ func (d *BoltDb) updateObjectTx(tx *bbolt.Tx, bucketID int, props db.ObjectProps
 
 	idValue := reflect.ValueOf(object).FieldByName(idFieldName)
 
-	var objID objectID
-
-	switch idValue.Kind() {
-	case reflect.Int,
-		reflect.Int8,
-		reflect.Int16,
-		reflect.Int32,
-		reflect.Int64,
-		reflect.Uint,
-		reflect.Uint8,
-		reflect.Uint16,
-		reflect.Uint32,
-		reflect.Uint64:
-		objID = intObjectID(idValue.Int())
-	case reflect.String:
-		objID = strObjectID(idValue.String())
-	}
-
-	if objID == nil {
-		return fmt.Errorf("unsupported ID type")
+	objID, err := makeObjectID(props, idValue)
+	if err != nil {
+		return err
 	}
 
 	if b.Get(objID.ToBytes()) == nil {
@@ -460,95 +538,109 @@ func (d *BoltDb) updateObject(bucketID int, props db.ObjectProps, object interfa
 	})
 }
 
-func (d *BoltDb) createObject(bucketID int, props db.ObjectProps, object interface{}) (interface{}, error) {
-	err := d.db.Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(makeBucketId(props, bucketID))
+func (d *BoltDb) createObject(bucketID int, props db.ObjectProps, object interface{}) (res interface{}, err error) {
+	res = object
+	err = d.db.Update(func(tx *bbolt.Tx) error {
+		var err2 error
+		res, err2 = d.createObjectTx(tx, bucketID, props, object)
+		return err2
+	})
+	return
+}
 
-		if err != nil {
-			return err
-		}
+// createObjectTx saves the new object in the transaction. The object is returned with
+// the generated ID, it is returned even on error.
+func (d *BoltDb) createObjectTx(tx *bbolt.Tx, bucketID int, props db.ObjectProps, object interface{}) (interface{}, error) {
+	b, err := tx.CreateBucketIfNotExists(makeBucketId(props, bucketID))
 
-		objPtr := reflect.ValueOf(&object).Elem()
+	if err != nil {
+		return object, err
+	}
 
-		tmpObj := reflect.New(objPtr.Elem().Type()).Elem()
-		tmpObj.Set(objPtr.Elem())
+	objPtr := reflect.ValueOf(&object).Elem()
 
-		var objID objectID
+	tmpObj := reflect.New(objPtr.Elem().Type()).Elem()
+	tmpObj.Set(objPtr.Elem())
 
-		if props.PrimaryColumnName != "" {
-			idFieldName, err2 := getFieldNameByTagSuffix(reflect.TypeOf(object), "db", props.PrimaryColumnName)
+	var objID objectID
 
-			if err2 != nil {
-				return err2
-			}
+	if props.PrimaryColumnName != "" {
+		idFieldName, err2 := getFieldNameByTagSuffix(reflect.TypeOf(object), "db", props.PrimaryColumnName)
 
-			idValue := tmpObj.FieldByName(idFieldName)
-
-			switch idValue.Kind() {
-			case reflect.Int,
-				reflect.Int8,
-				reflect.Int16,
-				reflect.Int32,
-				reflect.Int64,
-				reflect.Uint,
-				reflect.Uint8,
-				reflect.Uint16,
-				reflect.Uint32,
-				reflect.Uint64:
-				if idValue.Int() == 0 {
-					id, err3 := b.NextSequence()
-					if err3 != nil {
-						return err3
-					}
-					if props.SortInverted {
-						id = MaxID - id
-					}
-					idValue.SetInt(int64(id))
-				}
+		if err2 != nil {
+			return object, err2
+		}
 
-				objID = intObjectID(idValue.Int())
-			case reflect.String:
-				if idValue.String() == "" {
-					return fmt.Errorf("object ID can not be empty string")
-				}
-				objID = strObjectID(idValue.String())
-			case reflect.Invalid:
+		idValue := tmpObj.FieldByName(idFieldName)
+
+		if idValue.IsValid() && !props.IsPrimaryColumnKind(idValue.Kind()) {
+			return object, fmt.Errorf("unsupported ID type")
+		}
+
+		switch idValue.Kind() {
+		case reflect.Int,
+			reflect.Int8,
+			reflect.Int16,
+			reflect.Int32,
+			reflect.Int64,
+			reflect.Uint,
+			reflect.Uint8,
+			reflect.Uint16,
+			reflect.Uint32,
+			reflect.Uint64:
+			if idValue.Int() == 0 {
 				id, err3 := b.NextSequence()
 				if err3 != nil {
-					return err3
+					return object, err3
+				}
+				if props.SortInverted {
+					id = MaxID - id
 				}
-				objID = intObjectID(id)
-			default:
-				return fmt.Errorf("unsupported ID type")
+				idValue.SetInt(int64(id))
 			}
-		} else {
-			id, err2 := b.NextSequence()
-			if err2 != nil {
-				return err2
+
+			objID = intObjectID(idValue.Int())
+		case reflect.String:
+			if idValue.String() == "" {
+				return object, fmt.Errorf("object ID can not be empty string")
 			}
-			if props.SortInverted {
-				id = MaxID - id
+			objID = strObjectID(idValue.String())
+		case reflect.Invalid:
+			id, err3 := b.NextSequence()
+			if err3 != nil {
+				return object, err3
 			}
 			objID = intObjectID(id)
+		default:
+			return object, fmt.Errorf("unsupported ID type")
 		}
-
-		if objID == nil {
-			return fmt.Errorf("object ID can not be nil")
+	} else {
+		id, err2 := b.NextSequence()
+		if err2 != nil {
+			return object, err2
 		}
-
-		objPtr.Set(tmpObj)
-		str, err := marshalObject(object)
-		if err != nil {
-			return err
+		if props.SortInverted {
+			id = MaxID - id
 		}
+		objID = intObjectID(id)
+	}
 
-		return b.Put(objID.ToBytes(), str)
-	})
+	if objID == nil {
+		return object, fmt.Errorf("object ID can not be nil")
+	}
 
-	return object, err
+	objPtr.Set(tmpObj)
+	str, err := marshalObject(object)
+	if err != nil {
+		return object, err
+	}
+
+	return object, b.Put(objID.ToBytes(), str)
 }
 
 func (d *BoltDb) getObjectRefs(projectID int, objectProps db.ObjectProps, objectID int) (refs db.ObjectReferrers, err error) {
+	refs.Schedules = make([]db.ObjectReferrer, 0)
+
 	refs.Templates, err = d.getObjectRefsFrom(projectID, objectProps, intObjectID(objectID), db.TemplateProps)
 	if err != nil {
 		return
@@ -634,53 +726,45 @@ func (d *BoltDb) getObjectRefsFrom(projectID int, objProps db.ObjectProps, objID
 	return
 }
 
+// isObjectReferredBy checks if any field of referringObj with ReferringColumnSuffix of the props
+// refers to objID. Fields with a type different from the primary column type are ignored.
 func isObjectReferredBy(props db.ObjectProps, objID objectID, referringObj interface{}) bool {
 	if props.ReferringColumnSuffix == "" {
 		return false
 	}
 
-	fieldName, err := getFieldNameByTagSuffix(reflect.TypeOf(referringObj), "db", props.ReferringColumnSuffix)
+	t := reflect.TypeOf(referringObj)
+	v := reflect.ValueOf(referringObj)
 
-	if err != nil {
-		return false
-	}
-
-	f := reflect.ValueOf(referringObj).FieldByName(fieldName)
+	for i := 0; i < t.NumField(); i++ {
+		if !strings.HasSuffix(t.Field(i).Tag.Get("db"), props.ReferringColumnSuffix) {
+			continue
+		}
 
-	if f.IsZero() {
-		return false
-	}
+		f := v.Field(i)
 
-	if f.Kind() == reflect.Ptr {
-		if f.IsNil() {
-			return false
+		if f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				continue
+			}
+			f = f.Elem()
 		}
 
-		f = f.Elem()
-	}
+		if f.IsZero() {
+			continue
+		}
 
-	var fVal objectID
-	switch f.Kind() {
-	case reflect.Int,
-		reflect.Int8,
-		reflect.Int16,
-		reflect.Int32,
-		reflect.Int64,
-		reflect.Uint,
-		reflect.Uint8,
-		reflect.Uint16,
-		reflect.Uint32,
-		reflect.Uint64:
-		fVal = intObjectID(f.Int())
-	case reflect.String:
-		fVal = strObjectID(f.String())
-	}
+		fVal, err := makeObjectID(props, f)
+		if err != nil {
+			continue
+		}
 
-	if fVal == nil {
-		return false
+		if bytes.Equal(fVal.ToBytes(), objID.ToBytes()) {
+			return true
+		}
 	}
 
-	return bytes.Equal(fVal.ToBytes(), objID.ToBytes())
+	return false
 }
 
 // isObjectInUse checks if objID associated with any object in foreignTableProps.
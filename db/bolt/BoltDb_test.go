@@ -3,8 +3,12 @@ package bolt
 import (
 	"fmt"
 	"github.com/ansible-semaphore/semaphore/db"
+	"math/rand"
 	"reflect"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type test1 struct {
@@ -167,6 +171,55 @@ func TestSortObjects(t *testing.T) {
 	}
 }
 
+func TestGetObjectsPageSize(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{
+		Name: "Test1",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err = store.CreateEnvironment(db.Environment{
+			ProjectID: proj.ID,
+			Name:      "Env" + fmt.Sprint(i),
+			JSON:      "{}",
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	for _, page := range []struct {
+		offset int
+		count  int
+		size   int
+	}{
+		{offset: 0, count: 2, size: 2},
+		{offset: 2, count: 2, size: 2},
+		{offset: 4, count: 2, size: 1},
+		{offset: 0, count: 1, size: 1},
+		{offset: 0, count: 0, size: 5},
+		{offset: 5, count: 2, size: 0},
+	} {
+		var envs []db.Environment
+		err = store.getObjects(proj.ID, db.EnvironmentProps, db.RetrieveQueryParams{
+			Offset: page.offset,
+			Count:  page.count,
+		}, nil, &envs)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		if len(envs) != page.size {
+			t.Fatal(fmt.Errorf("page with offset %d and count %d must contain %d objects, got %d",
+				page.offset, page.count, page.size, len(envs)))
+		}
+	}
+}
+
 func TestGetFieldNameByTag(t *testing.T) {
 	f, err := getFieldNameByTagSuffix(reflect.TypeOf(test1{}), "db", "first_name")
 	if err != nil {
@@ -199,11 +252,13 @@ func TestIsObjectInUse(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
+	inventoryID := 10
+
 	_, err = store.CreateTemplate(db.Template{
 		Name:        "Test",
 		Playbook:    "test.yml",
 		ProjectID:   proj.ID,
-		InventoryID: 10,
+		InventoryID: &inventoryID,
 	})
 
 	if err != nil {
@@ -396,7 +451,7 @@ func TestBoltDb_GetRepositoryRefs(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	_, err = store.CreateSchedule(db.Schedule{
+	schedule, err := store.CreateSchedule(db.Schedule{
 		CronFormat:   "* * * * *",
 		TemplateID:   tpl2.ID,
 		ProjectID:    1,
@@ -407,6 +462,16 @@ func TestBoltDb_GetRepositoryRefs(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	_, err = store.CreateSchedule(db.Schedule{
+		CronFormat: "0 * * * *",
+		TemplateID: tpl2.ID,
+		ProjectID:  1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	refs, err := store.GetRepositoryRefs(1, repo1.ID)
 	if err != nil {
 		t.Fatal(err)
@@ -415,4 +480,198 @@ func TestBoltDb_GetRepositoryRefs(t *testing.T) {
 	if len(refs.Templates) != 2 {
 		t.Fatal()
 	}
+
+	if len(refs.Schedules) != 1 || refs.Schedules[0].ID != schedule.ID || refs.Schedules[0].Name != "* * * * *" {
+		t.Fatal("repository must report schedules which poll it for commits")
+	}
+}
+
+func TestBoltDb_GetTemplateRefs(t *testing.T) {
+	store := CreateTestStore()
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Type:      db.TemplateBuild,
+		Name:      "tpl1",
+		Playbook:  "build.yml",
+		ProjectID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cronFormat := range []string{"* * * * *", "0 * * * *"} {
+		_, err = store.CreateSchedule(db.Schedule{
+			CronFormat: cronFormat,
+			TemplateID: tpl.ID,
+			ProjectID:  1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refs, err := store.GetTemplateRefs(1, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(refs.Schedules) != 2 {
+		t.Fatal("template must report its schedules")
+	}
+
+	if refs.Schedules[0].Name != "* * * * *" || refs.Schedules[1].Name != "0 * * * *" {
+		t.Fatal("schedule referrers must be named by cron expression")
+	}
+
+	if len(refs.Templates) != 0 {
+		t.Fatal("template must not refer to itself")
+	}
+}
+
+func createIdleTestStore(idleTimeout time.Duration) (*BoltDb, db.Project) {
+	store := &BoltDb{
+		Filename:    "/tmp/test_semaphore_db_" + strconv.Itoa(rand.Int()),
+		IdleTimeout: idleTimeout,
+	}
+
+	store.Connect("init")
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		panic(err)
+	}
+	store.Close("init")
+
+	return store, proj
+}
+
+// tokenUsage refers to an API token which has a string ID.
+type tokenUsage struct {
+	ID            int    `db:"id"`
+	ProjectID     int    `db:"project_id"`
+	Name          string `db:"name"`
+	TokenID       string `db:"token_id"`
+	LegacyTokenID int    `db:"legacy_token_id"`
+}
+
+var tokenUsageProps = db.ObjectProps{
+	TableName:         "token_usage",
+	Type:              reflect.TypeOf(tokenUsage{}),
+	PrimaryColumnName: "id",
+}
+
+func TestBoltDb_GetObjectRefsFrom_stringID(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenProps := db.TokenProps
+	tokenProps.ReferringColumnSuffix = "token_id"
+
+	// the int field has the same key bytes as the token ID, but it must not be treated as a reference
+	for _, usage := range []tokenUsage{
+		{ProjectID: proj.ID, Name: "Deploy", TokenID: "0000000010"},
+		{ProjectID: proj.ID, Name: "Legacy", LegacyTokenID: 10},
+		{ProjectID: proj.ID, Name: "Other", TokenID: "other"},
+	} {
+		_, err = store.createObject(proj.ID, tokenUsageProps, usage)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refs, err := store.getObjectRefsFrom(proj.ID, tokenProps, strObjectID("0000000010"), tokenUsageProps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(refs) != 1 || refs[0].Name != "Deploy" {
+		t.Fatalf("only objects referring to the string ID must be found, got %v", refs)
+	}
+
+	_, err = store.CreateInventory(db.Inventory{ProjectID: proj.ID, Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.updateObject(proj.ID, db.InventoryProps, struct {
+		ID string `db:"id"`
+	}{ID: "0000000001"})
+	if err == nil || err == db.ErrNotFound {
+		t.Fatalf("string ID of the object with int primary column must be rejected, got %v", err)
+	}
+}
+
+func TestBoltDb_IdleTimeout(t *testing.T) {
+	store, proj := createIdleTestStore(100 * time.Millisecond)
+
+	store.Connect("first")
+	conn := store.db
+	store.Close("first")
+
+	store.Connect("second")
+	if store.db != conn {
+		t.Fatal("connection must be reused during idle timeout")
+	}
+
+	if _, err := store.GetProject(proj.ID); err != nil {
+		t.Fatal(err)
+	}
+	store.Close("second")
+
+	time.Sleep(300 * time.Millisecond)
+
+	store.mu.Lock()
+	closed := store.db == nil
+	store.mu.Unlock()
+
+	if !closed {
+		t.Fatal("database must be closed after idle timeout")
+	}
+
+	store.Connect("third")
+	defer store.Close("third")
+
+	if _, err := store.GetProject(proj.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltDb_NoIdleTimeout(t *testing.T) {
+	store, _ := createIdleTestStore(0)
+
+	if store.db != nil {
+		t.Fatal("database must be closed with the last connection")
+	}
+}
+
+// benchmarkSessions simulates API requests: every request opens own connection,
+// reads the project and closes the connection.
+func benchmarkSessions(b *testing.B, idleTimeout time.Duration) {
+	store, proj := createIdleTestStore(idleTimeout)
+
+	var counter int64
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			token := strconv.FormatInt(atomic.AddInt64(&counter, 1), 10)
+			db.StoreSession(store, token, func() {
+				if _, err := store.GetProject(proj.ID); err != nil {
+					b.Error(err)
+				}
+			})
+		}
+	})
+}
+
+func BenchmarkStoreSession_ConnectPerRequest(b *testing.B) {
+	benchmarkSessions(b, 0)
+}
+
+func BenchmarkStoreSession_IdleTimeout(b *testing.B) {
+	benchmarkSessions(b, DefaultIdleTimeout)
 }
@@ -1,8 +1,13 @@
 package bolt
 
 import (
+	"context"
 	"github.com/ansible-semaphore/semaphore/db"
+	"go.etcd.io/bbolt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestTask_GetVersion(t *testing.T) {
@@ -89,3 +94,651 @@ func TestTask_GetVersion(t *testing.T) {
 		return
 	}
 }
+
+func TestGetTaskOutputsSince(t *testing.T) {
+	store := CreateTestStore()
+
+	task, err := store.CreateTask(db.Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first", "second", "third"} {
+		_, err = store.CreateTaskOutput(db.TaskOutput{
+			TaskID: task.ID,
+			Output: line,
+			Time:   time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputs, err := store.GetTaskOutputs(0, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(outputs))
+	}
+
+	lastID := outputs[1].ID
+
+	_, err = store.CreateTaskOutput(db.TaskOutput{
+		TaskID: task.ID,
+		Output: "fourth",
+		Time:   time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newer, err := store.GetTaskOutputsSince(0, task.ID, lastID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(newer) != 2 || newer[0].Output != "third" || newer[1].Output != "fourth" {
+		t.Fatalf("unexpected records: %+v", newer)
+	}
+
+	newer, err = store.GetTaskOutputsSince(0, task.ID, newer[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(newer) != 0 {
+		t.Fatal("no records expected after the last one")
+	}
+}
+
+func TestGetTaskOutputsPaged(t *testing.T) {
+	store := CreateTestStore()
+
+	task, err := store.CreateTask(db.Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	// records with the same time must keep the insertion order
+	for _, output := range []db.TaskOutput{
+		{Output: "first", Time: now.Add(-time.Minute)},
+		{Output: "a", Time: now},
+		{Output: "b", Time: now},
+		{Output: "c", Time: now},
+		{Output: "d", Time: now},
+	} {
+		output.TaskID = task.ID
+		if _, err = store.CreateTaskOutput(output); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lines []string
+
+	for offset := 0; offset < 6; offset += 2 {
+		page, total, err2 := store.GetTaskOutputsPaged(0, task.ID, db.RetrieveQueryParams{Offset: offset, Count: 2})
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		if total != 5 {
+			t.Fatalf("expected total 5, got %d", total)
+		}
+
+		for _, output := range page {
+			lines = append(lines, output.Output)
+		}
+	}
+
+	if strings.Join(lines, ",") != "first,a,b,c,d" {
+		t.Fatalf("unexpected order of records: %v", lines)
+	}
+
+	page, _, err := store.GetTaskOutputsPaged(0, task.ID, db.RetrieveQueryParams{Offset: 10, Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 0 {
+		t.Fatal("no records expected after the last page")
+	}
+
+	all, err := store.GetTaskOutputs(0, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 5 || all[0].Output != "first" || all[4].Output != "d" {
+		t.Fatalf("unexpected records: %+v", all)
+	}
+}
+
+func TestPruneTaskOutputs(t *testing.T) {
+	store := CreateTestStore()
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -30)
+	recent := now.AddDate(0, 0, -1)
+
+	var tasks []db.Task
+
+	for _, task := range []db.Task{
+		{ProjectID: 1, Status: db.TaskSuccessStatus, End: &old},
+		{ProjectID: 1, Status: db.TaskFailStatus, End: &recent},
+		{ProjectID: 1, Status: db.TaskRunningStatus},
+		{ProjectID: 2, Status: db.TaskSuccessStatus, End: &old},
+	} {
+		newTask, err := store.CreateTask(task)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, outputTime := range []time.Time{old, recent} {
+			_, err = store.CreateTaskOutput(db.TaskOutput{TaskID: newTask.ID, Time: outputTime, Output: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tasks = append(tasks, newTask)
+	}
+
+	olderThan := now.AddDate(0, 0, -7)
+
+	count, tasksCount, err := store.PruneTaskOutputs(1, olderThan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 3 || tasksCount != 0 {
+		t.Fatalf("old output of 3 project tasks must be deleted, %d records deleted", count)
+	}
+
+	for _, task := range tasks {
+		outputs, err2 := store.GetTaskOutputs(task.ProjectID, task.ID)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		expected := 1
+		if task.ProjectID == 2 {
+			expected = 2
+		}
+
+		if len(outputs) != expected {
+			t.Fatalf("task %d must have %d output records, got %d", task.ID, expected, len(outputs))
+		}
+	}
+
+	count, tasksCount, err = store.PruneTaskOutputs(1, olderThan, db.PruneFinishedTasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 || tasksCount != 1 {
+		t.Fatal("only the old finished task must be deleted")
+	}
+
+	if _, err = store.GetTask(1, tasks[0].ID); err != db.ErrNotFound {
+		t.Fatal("old finished task must be deleted")
+	}
+
+	err = store.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(makeBucketId(db.TaskOutputProps, tasks[0].ID)) != nil {
+			t.Fatal("output of the deleted task must be deleted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range tasks[1:] {
+		if _, err = store.GetTask(task.ProjectID, task.ID); err != nil {
+			t.Fatal("recent, unfinished and other project tasks must be kept")
+		}
+	}
+}
+
+func TestTaskMessage(t *testing.T) {
+	store := CreateTestStore()
+
+	task, err := store.CreateTask(db.Task{
+		Message: "hotfix for PR-123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := store.GetTask(0, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.Message != "hotfix for PR-123" {
+		t.Fatal("task message must be persisted")
+	}
+
+	tasks, err := store.GetProjectTasks(0, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 || tasks[0].Message != "hotfix for PR-123" {
+		t.Fatal("task message must be returned in the list")
+	}
+}
+
+func TestGetTaskByVersion(t *testing.T) {
+	store := CreateTestStore()
+
+	build, err := store.CreateTemplate(db.Template{
+		ProjectID: 0,
+		Type:      db.TemplateBuild,
+		Name:      "Build",
+		Playbook:  "build.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks []db.Task
+
+	for _, version := range []string{"1.2.2", "1.2.3", "1.2.4"} {
+		v := version
+		var task db.Task
+		task, err = store.CreateTask(db.Task{
+			ProjectID:  0,
+			TemplateID: build.ID,
+			Version:    &v,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	found, err := store.GetTaskByVersion(0, build.ID, "1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ID != tasks[1].ID || found.TemplateAlias != "Build" {
+		t.Fatal("invalid task found")
+	}
+
+	_, err = store.GetTaskByVersion(0, build.ID, "2.0.0")
+	if err != db.ErrNotFound {
+		t.Fatal("ErrNotFound expected for unknown version")
+	}
+}
+
+func TestCreateTaskOutputSeq(t *testing.T) {
+	store := CreateTestStore()
+
+	task, err := store.CreateTask(db.Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherTask, err := store.CreateTask(db.Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+
+	for i := 0; i < 20; i++ {
+		for _, taskID := range []int{task.ID, otherTask.ID} {
+			wg.Add(1)
+			go func(taskID int) {
+				defer wg.Done()
+				_, err2 := store.CreateTaskOutput(db.TaskOutput{
+					TaskID: taskID,
+					Output: "line",
+					Time:   now,
+				})
+				errs <- err2
+			}(taskID)
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err2 := range errs {
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+	}
+
+	for _, taskID := range []int{task.ID, otherTask.ID} {
+		outputs, err2 := store.GetTaskOutputs(0, taskID)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		if len(outputs) != 20 {
+			t.Fatalf("expected 20 records, got %d", len(outputs))
+		}
+
+		for i, output := range outputs {
+			if output.Seq != i+1 {
+				t.Fatalf("expected sequence %d, got %d", i+1, output.Seq)
+			}
+		}
+	}
+}
+
+// countdownContext is done after Err was called the given number of times.
+type countdownContext struct {
+	context.Context
+	calls int
+}
+
+func (c *countdownContext) Err() error {
+	if c.calls <= 0 {
+		return context.DeadlineExceeded
+	}
+	c.calls--
+	return nil
+}
+
+func TestGetProjectTasksFiltered(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var templates []db.Template
+
+	for _, name := range []string{"Build", "Deploy"} {
+		var tpl db.Template
+		tpl, err = store.CreateTemplate(db.Template{
+			Name:      name,
+			Playbook:  "test.yml",
+			ProjectID: proj.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates = append(templates, tpl)
+	}
+
+	now := time.Now()
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	monthAgo := now.Add(-30 * 24 * time.Hour)
+
+	type taskInfo struct {
+		tpl    db.Template
+		status db.TaskStatus
+		start  *time.Time
+	}
+
+	var created []db.Task
+
+	for _, info := range []taskInfo{
+		{templates[0], db.TaskFailStatus, &now},
+		{templates[0], db.TaskSuccessStatus, &now},
+		{templates[0], db.TaskFailStatus, &monthAgo},
+		{templates[1], db.TaskFailStatus, &now},
+		{templates[0], db.TaskWaitingStatus, nil},
+	} {
+		var task db.Task
+		task, err = store.CreateTask(db.Task{
+			ProjectID:  proj.ID,
+			TemplateID: info.tpl.ID,
+			Status:     info.status,
+			Start:      info.start,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, task)
+	}
+
+	tasks, err := store.GetProjectTasksFiltered(proj.ID, db.TaskFilter{
+		Status:     []db.TaskStatus{db.TaskFailStatus},
+		TemplateID: &templates[0].ID,
+	}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 2 {
+		t.Fatalf("expected 2 failed tasks of the template, got %d", len(tasks))
+	}
+
+	tasks, err = store.GetProjectTasksFiltered(proj.ID, db.TaskFilter{
+		Status:       []db.TaskStatus{db.TaskFailStatus},
+		TemplateID:   &templates[0].ID,
+		StartedAfter: &weekAgo,
+	}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 || tasks[0].ID != created[0].ID || tasks[0].TemplateAlias != "Build" {
+		t.Fatalf("expected the recent failed task of the template, got %+v", tasks)
+	}
+
+	tasks, err = store.GetProjectTasksFiltered(proj.ID, db.TaskFilter{
+		Status:        []db.TaskStatus{db.TaskFailStatus, db.TaskSuccessStatus},
+		StartedBefore: &weekAgo,
+	}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 || tasks[0].ID != created[2].ID {
+		t.Fatalf("expected the old failed task, got %+v", tasks)
+	}
+
+	tasks, err = store.GetProjectTasksFiltered(proj.ID, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != len(created) {
+		t.Fatalf("empty filter must select all tasks, got %d", len(tasks))
+	}
+}
+
+func TestGetProjectTasksContext(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:      "Test",
+		Playbook:  "test.yml",
+		ProjectID: proj.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err = store.CreateTask(db.Task{
+			ProjectID:  proj.ID,
+			TemplateID: tpl.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tasks, truncated, err := store.GetProjectTasksContext(context.Background(), proj.ID, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if truncated || len(tasks) != 5 {
+		t.Fatalf("expected 5 tasks without truncation, got %d", len(tasks))
+	}
+
+	// the deadline hits after 3 tasks are read
+	ctx := &countdownContext{Context: context.Background(), calls: 3}
+
+	tasks, truncated, err = store.GetProjectTasksContext(ctx, proj.ID, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !truncated {
+		t.Fatal("result must be truncated")
+	}
+
+	if len(tasks) == 0 || len(tasks) >= 5 {
+		t.Fatalf("expected partial result, got %d tasks", len(tasks))
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	tasks, truncated, err = store.GetProjectTasksContext(expired, proj.ID, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !truncated || len(tasks) != 0 {
+		t.Fatal("expired context must return empty truncated result")
+	}
+}
+
+func TestGetProjectTasksByUser(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:      "Test",
+		Playbook:  "test.yml",
+		ProjectID: proj.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := 1
+	bob := 2
+
+	for _, userID := range []*int{&alice, &bob, &alice, nil, &bob, &alice} {
+		_, err = store.CreateTask(db.Task{
+			ProjectID:  proj.ID,
+			TemplateID: tpl.ID,
+			UserID:     userID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tasks, err := store.GetProjectTasks(proj.ID, db.TaskFilter{UserID: &alice}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 3 {
+		t.Fatalf("expected 3 tasks of the user, got %d", len(tasks))
+	}
+
+	for _, task := range tasks {
+		if task.UserID == nil || *task.UserID != alice {
+			t.Fatal("tasks of other users must be filtered out")
+		}
+	}
+
+	page, err := store.GetProjectTasks(proj.ID, db.TaskFilter{UserID: &alice}, db.RetrieveQueryParams{Offset: 1, Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 1 || page[0].ID != tasks[1].ID {
+		t.Fatal("pagination must be applied to the filtered tasks")
+	}
+
+	tasks, err = store.GetProjectTasks(proj.ID, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 6 {
+		t.Fatal("all tasks must be returned without filter")
+	}
+}
+
+func TestTaskDisplayTags(t *testing.T) {
+	store := CreateTestStore()
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: 1,
+		Name:      "Deploy",
+		Playbook:  "deploy.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tags := range [][]string{
+		{"hotfix", "PR-123"},
+		{"hotfix"},
+		nil,
+	} {
+		_, err = store.CreateTask(db.Task{
+			ProjectID:   1,
+			TemplateID:  tpl.ID,
+			DisplayTags: tags,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tasks, err := store.GetProjectTasks(1, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 {
+		t.Fatal("all tasks must be returned without filter")
+	}
+
+	task, err := store.GetTask(1, tasks[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(task.DisplayTags) != 2 || task.DisplayTags[1] != "PR-123" {
+		t.Fatal("display tags must be stored with the task")
+	}
+
+	tasks, err = store.GetProjectTasks(1, db.TaskFilter{DisplayTags: []string{"hotfix"}}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("expected 2 tasks with the tag, got %d", len(tasks))
+	}
+
+	tasks, err = store.GetProjectTasks(1, db.TaskFilter{DisplayTags: []string{"hotfix", "PR-123"}}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || len(tasks[0].DisplayTags) != 2 {
+		t.Fatal("tasks must have all the tags of the filter")
+	}
+}
@@ -5,15 +5,40 @@ import (
 	"go.etcd.io/bbolt"
 )
 
+// getAccessKeyBucket returns the bucket which stores the key, project and global keys are stored separately.
+func getAccessKeyBucket(key db.AccessKey) (int, db.ObjectProps) {
+	if key.ProjectID == nil {
+		return 0, db.GlobalAccessKeyProps
+	}
+	return *key.ProjectID, db.AccessKeyProps
+}
+
 func (d *BoltDb) GetAccessKey(projectID int, accessKeyID int) (key db.AccessKey, err error) {
 	err = d.getObject(projectID, db.AccessKeyProps, intObjectID(accessKeyID), &key)
-	if err != nil {
-		return
+	if err == db.ErrNotFound {
+		return d.GetGlobalAccessKey(accessKeyID)
 	}
 
 	return
 }
 
+func (d *BoltDb) GetGlobalAccessKey(accessKeyID int) (key db.AccessKey, err error) {
+	err = d.getObject(0, db.GlobalAccessKeyProps, intObjectID(accessKeyID), &key)
+	return
+}
+
+func (d *BoltDb) GetGlobalAccessKeys(params db.RetrieveQueryParams) ([]db.AccessKey, error) {
+	var keys []db.AccessKey
+	err := d.getObjects(0, db.GlobalAccessKeyProps, params, nil, &keys)
+	return keys, err
+}
+
+func (d *BoltDb) GetAccessKeyMeta(projectID int, accessKeyID int) (key db.AccessKey, err error) {
+	err = d.getObject(projectID, db.AccessKeyProps, intObjectID(accessKeyID), &key)
+	key.Secret = nil
+	return
+}
+
 func (d *BoltDb) GetAccessKeyRefs(projectID int, accessKeyID int) (db.ObjectReferrers, error) {
 	return d.getObjectRefs(projectID, db.AccessKeyProps, accessKeyID)
 }
@@ -37,7 +62,13 @@ func (d *BoltDb) UpdateAccessKey(key db.AccessKey) error {
 			return err
 		}
 	} else { // accept only new name, ignore other changes
-		oldKey, err2 := d.GetAccessKey(*key.ProjectID, key.ID)
+		var oldKey db.AccessKey
+		var err2 error
+		if key.ProjectID == nil {
+			oldKey, err2 = d.GetGlobalAccessKey(key.ID)
+		} else {
+			err2 = d.getObject(*key.ProjectID, db.AccessKeyProps, intObjectID(key.ID), &oldKey)
+		}
 		if err2 != nil {
 			return err2
 		}
@@ -45,7 +76,8 @@ func (d *BoltDb) UpdateAccessKey(key db.AccessKey) error {
 		key = oldKey
 	}
 
-	return d.updateObject(*key.ProjectID, db.AccessKeyProps, key)
+	bucketID, props := getAccessKeyBucket(key)
+	return d.updateObject(bucketID, props, key)
 }
 
 func (d *BoltDb) CreateAccessKey(key db.AccessKey) (db.AccessKey, error) {
@@ -53,14 +85,70 @@ func (d *BoltDb) CreateAccessKey(key db.AccessKey) (db.AccessKey, error) {
 	if err != nil {
 		return db.AccessKey{}, err
 	}
-	newKey, err := d.createObject(*key.ProjectID, db.AccessKeyProps, key)
-	return newKey.(db.AccessKey), err
+	bucketID, props := getAccessKeyBucket(key)
+	newKey, err := d.createObject(bucketID, props, key)
+	if err != nil {
+		return db.AccessKey{}, err
+	}
+	return newKey.(db.AccessKey), nil
 }
 
 func (d *BoltDb) DeleteAccessKey(projectID int, accessKeyID int) error {
 	return d.deleteObject(projectID, db.AccessKeyProps, intObjectID(accessKeyID), nil)
 }
 
+// DeleteGlobalAccessKey deletes the global key if no object of any project uses it.
+func (d *BoltDb) DeleteGlobalAccessKey(accessKeyID int) error {
+	var allProjects []db.Project
+
+	err := d.getObjects(0, db.ProjectProps, db.RetrieveQueryParams{}, nil, &allProjects)
+	if err != nil {
+		return err
+	}
+
+	for _, project := range allProjects {
+		for _, u := range []db.ObjectProps{db.TemplateProps, db.EnvironmentProps, db.InventoryProps, db.RepositoryProps} {
+			inUse, err := d.isObjectInUse(project.ID, db.GlobalAccessKeyProps, intObjectID(accessKeyID), u)
+			if err != nil {
+				return err
+			}
+			if inUse {
+				return db.ErrInvalidOperation
+			}
+		}
+	}
+
+	return d.deleteObject(0, db.GlobalAccessKeyProps, intObjectID(accessKeyID), nil)
+}
+
+func (d *BoltDb) rekeyAccessKeysTx(tx *bbolt.Tx, bucketID int, props db.ObjectProps, oldKey string) error {
+	var keys []db.AccessKey
+	err := d.getObjectsTx(tx, bucketID, props, db.RetrieveQueryParams{}, nil, &keys)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err = key.DeserializeSecret2(oldKey)
+
+		if err != nil {
+			return err
+		}
+
+		err = key.SerializeSecret()
+		if err != nil {
+			return err
+		}
+
+		err = d.updateObjectTx(tx, bucketID, props, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (d *BoltDb) RekeyAccessKeys(oldKey string) error {
 	return d.db.Update(func(tx *bbolt.Tx) error {
 		var allProjects []db.Project
@@ -72,31 +160,12 @@ func (d *BoltDb) RekeyAccessKeys(oldKey string) error {
 		}
 
 		for _, project := range allProjects {
-			var keys []db.AccessKey
-			err = d.getObjectsTx(tx, project.ID, db.AccessKeyProps, db.RetrieveQueryParams{}, nil, &keys)
+			err = d.rekeyAccessKeysTx(tx, project.ID, db.AccessKeyProps, oldKey)
 			if err != nil {
 				return err
 			}
-
-			for _, key := range keys {
-				err = key.DeserializeSecret2(oldKey)
-
-				if err != nil {
-					return err
-				}
-
-				err = key.SerializeSecret()
-				if err != nil {
-					return err
-				}
-
-				err = d.updateObjectTx(tx, *key.ProjectID, db.AccessKeyProps, key)
-				if err != nil {
-					return err
-				}
-			}
 		}
 
-		return nil
+		return d.rekeyAccessKeysTx(tx, 0, db.GlobalAccessKeyProps, oldKey)
 	})
 }
@@ -0,0 +1,235 @@
+package bolt
+
+import (
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+func TestGetAccessKeyMeta(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		Name:      "Deploy",
+		Type:      db.AccessKeyLoginPassword,
+		ProjectID: &proj.ID,
+		LoginPassword: db.LoginPassword{
+			Login:    "root",
+			Password: "123456",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := store.GetAccessKeyMeta(proj.ID, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.ID != key.ID || meta.Name != "Deploy" || meta.Type != db.AccessKeyLoginPassword {
+		t.Fatal("invalid key meta")
+	}
+
+	if meta.Secret != nil || meta.LoginPassword.Password != "" || meta.SshKey.PrivateKey != "" {
+		t.Fatal("meta must not contain secret")
+	}
+
+	full, err := store.GetAccessKey(proj.ID, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = full.DeserializeSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if full.LoginPassword.Password != "123456" {
+		t.Fatal("full key must contain secret")
+	}
+}
+
+func TestGlobalAccessKey(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateTestStore()
+
+	var projects []db.Project
+
+	for _, name := range []string{"Test1", "Test2"} {
+		proj, err := store.CreateProject(db.Project{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		projects = append(projects, proj)
+	}
+
+	// project key must not shadow the global key
+	_, err := store.CreateAccessKey(db.AccessKey{
+		Name:      "Project key",
+		Type:      db.AccessKeyNone,
+		ProjectID: &projects[0].ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globalKey, err := store.CreateAccessKey(db.AccessKey{
+		Name: "Shared",
+		Type: db.AccessKeyLoginPassword,
+		LoginPassword: db.LoginPassword{
+			Login:    "deploy",
+			Password: "123456",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.GetGlobalAccessKeys(db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0].ID != globalKey.ID {
+		t.Fatal("global key must be listed")
+	}
+
+	for _, proj := range projects {
+		var repo db.Repository
+		repo, err = store.CreateRepository(db.Repository{
+			ProjectID: proj.ID,
+			Name:      "Test",
+			GitURL:    "git@example.com:test/test",
+			GitBranch: "master",
+			SSHKeyID:  globalKey.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		repo, err = store.GetRepository(proj.ID, repo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repo.SSHKey.DeserializeSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if repo.SSHKey.ID != globalKey.ID || repo.SSHKey.LoginPassword.Password != "123456" {
+			t.Fatal("repository of the project must use the global key")
+		}
+
+		_, err = store.GetAccessKeyMeta(proj.ID, globalKey.ID)
+		if err != db.ErrNotFound {
+			t.Fatal("global key must not be managed as key of the project")
+		}
+	}
+
+	err = store.DeleteGlobalAccessKey(globalKey.ID)
+	if err != db.ErrInvalidOperation {
+		t.Fatal("global key used by projects must not be deleted")
+	}
+
+	globalKey.Name = "Renamed"
+	err = store.UpdateAccessKey(globalKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// encrypt secrets which were stored without encryption
+	util.Config.AccessKeyEncryption = "hHYgPrhQTZYm7UFTvcdNfKJMB3wtAXtJENUButH+DmM="
+
+	err = store.RekeyAccessKeys("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.GetGlobalAccessKey(globalKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.Name != "Renamed" {
+		t.Fatal("global key must be renamed")
+	}
+
+	err = key.DeserializeSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.LoginPassword.Password != "123456" {
+		t.Fatal("secret of the global key must be encrypted by the new key")
+	}
+}
+
+func TestGetAccessKeysForRole(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		Name:      "Deploy",
+		Type:      db.AccessKeyLoginPassword,
+		ProjectID: &proj.ID,
+		LoginPassword: db.LoginPassword{
+			Login:    "root",
+			Password: "123456",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []db.ProjectUserRole{db.ProjectOwner, db.ProjectTaskRunner} {
+		var keys []db.AccessKey
+		keys, err = db.GetAccessKeysForRole(store, proj.ID, role, db.RetrieveQueryParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Name != "Deploy" {
+			t.Fatalf("%s must see keys of the project", role)
+		}
+
+		if keys[0].Secret != nil {
+			t.Fatalf("%s must not see secret of the key", role)
+		}
+	}
+
+	_, err = db.GetAccessKeysForRole(store, proj.ID, db.ProjectGuest, db.RetrieveQueryParams{})
+	if err != db.ErrInvalidOperation {
+		t.Fatal("guest must not see keys of the project")
+	}
+
+	_, err = db.GetAccessKeyForRole(store, proj.ID, key.ID, db.ProjectGuest)
+	if err != db.ErrInvalidOperation {
+		t.Fatal("guest must not see the key")
+	}
+
+	ownerKey, err := db.GetAccessKeyForRole(store, proj.ID, key.ID, db.ProjectOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ownerKey.ID != key.ID || ownerKey.Secret != nil {
+		t.Fatal("owner must see the key without secret")
+	}
+}
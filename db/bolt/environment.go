@@ -1,6 +1,9 @@
 package bolt
 
-import "github.com/ansible-semaphore/semaphore/db"
+import (
+	"github.com/ansible-semaphore/semaphore/db"
+	"go.etcd.io/bbolt"
+)
 
 func (d *BoltDb) GetEnvironment(projectID int, environmentID int) (environment db.Environment, err error) {
 	err = d.getObject(projectID, db.EnvironmentProps, intObjectID(environmentID), &environment)
@@ -40,3 +43,57 @@ func (d *BoltDb) CreateEnvironment(env db.Environment) (db.Environment, error) {
 func (d *BoltDb) DeleteEnvironment(projectID int, environmentID int) error {
 	return d.deleteObject(projectID, db.EnvironmentProps, intObjectID(environmentID), nil)
 }
+
+func (d *BoltDb) DeleteEnvironmentCascade(projectID int, environmentID int) error {
+	return d.detachAndDeleteObject(projectID, db.EnvironmentProps, environmentID, func(tpl *db.Template) bool {
+		if tpl.EnvironmentID == nil || *tpl.EnvironmentID != environmentID {
+			return false
+		}
+		tpl.EnvironmentID = nil
+		return true
+	})
+}
+
+func (d *BoltDb) UpdateEnvironmentVariableAcrossProject(projectID int, oldKey string, newKey string) (count int, err error) {
+	err = db.ValidateVariableRename(oldKey, newKey)
+	if err != nil {
+		return
+	}
+
+	err = d.db.Update(func(tx *bbolt.Tx) error {
+		count = 0
+
+		var environments []db.Environment
+		err2 := d.getObjectsTx(tx, projectID, db.EnvironmentProps, db.RetrieveQueryParams{}, nil, &environments)
+		if err2 != nil {
+			return err2
+		}
+
+		for _, env := range environments {
+			var changed bool
+			changed, err2 = env.RenameVariable(oldKey, newKey)
+			if err2 != nil {
+				return err2
+			}
+
+			if !changed {
+				continue
+			}
+
+			err2 = d.updateObjectTx(tx, projectID, db.EnvironmentProps, env)
+			if err2 != nil {
+				return err2
+			}
+
+			count++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		count = 0
+	}
+
+	return
+}
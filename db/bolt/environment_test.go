@@ -0,0 +1,183 @@
+package bolt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+func TestUpdateEnvironmentVariableAcrossProject(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherProj, err := store.CreateProject(db.Project{Name: "Other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env1, err := store.CreateEnvironment(db.Environment{
+		ProjectID: proj.ID,
+		Name:      "Dev",
+		JSON:      `{"db_host": "dev.example.com", "port": 12345678901234567890}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env2, err := store.CreateEnvironment(db.Environment{
+		ProjectID: proj.ID,
+		Name:      "Prod",
+		JSON:      `{"db_host": {"name": "prod.example.com"}, "debug": false}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env3, err := store.CreateEnvironment(db.Environment{
+		ProjectID: proj.ID,
+		Name:      "Empty",
+		JSON:      `{"other": 1}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherEnv, err := store.CreateEnvironment(db.Environment{
+		ProjectID: otherProj.ID,
+		Name:      "Dev",
+		JSON:      `{"db_host": "dev.example.com"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := store.UpdateEnvironmentVariableAcrossProject(proj.ID, "db_host", "database_host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Fatal("expected 2 changed environments, got", count)
+	}
+
+	for _, c := range []struct {
+		projectID int
+		envID     int
+		json      string
+	}{
+		{proj.ID, env1.ID, `{"database_host":"dev.example.com","port":12345678901234567890}`},
+		{proj.ID, env2.ID, `{"database_host":{"name":"prod.example.com"},"debug":false}`},
+		{proj.ID, env3.ID, `{"other": 1}`},
+		{otherProj.ID, otherEnv.ID, `{"db_host": "dev.example.com"}`},
+	} {
+		env, err := store.GetEnvironment(c.projectID, c.envID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.JSON != c.json {
+			t.Fatal("invalid environment JSON: " + env.JSON)
+		}
+	}
+}
+
+func TestUpdateEnvironmentVariableAcrossProject_conflict(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env1, err := store.CreateEnvironment(db.Environment{
+		ProjectID: proj.ID,
+		Name:      "Dev",
+		JSON:      `{"db_host": "dev.example.com"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateEnvironment(db.Environment{
+		ProjectID: proj.ID,
+		Name:      "Prod",
+		JSON:      `{"db_host": "prod.example.com", "database_host": "prod2.example.com"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.UpdateEnvironmentVariableAcrossProject(proj.ID, "db_host", "database_host")
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("rename to existing variable must fail")
+	}
+
+	env, err := store.GetEnvironment(proj.ID, env1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if env.JSON != `{"db_host": "dev.example.com"}` {
+		t.Fatal("environments must not be changed if rename failed")
+	}
+}
+
+func TestDeleteEnvironmentWithRefs(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := store.CreateEnvironment(db.Environment{
+		ProjectID: proj.ID,
+		Name:      "Dev",
+		JSON:      "{}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:          "Deploy",
+		Playbook:      "deploy.yml",
+		ProjectID:     proj.ID,
+		EnvironmentID: &env.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteEnvironmentWithRefs(store, proj.ID, env.ID, false)
+	var validationErr *db.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("expected validation error, got", err)
+	}
+
+	if _, err = store.GetEnvironment(proj.ID, env.ID); err != nil {
+		t.Fatal("environment must not be deleted:", err)
+	}
+
+	err = db.DeleteEnvironmentWithRefs(store, proj.ID, env.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.GetEnvironment(proj.ID, env.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatal("environment must be deleted")
+	}
+
+	tpl, err = store.GetTemplate(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tpl.EnvironmentID != nil {
+		t.Fatal("template environment must be cleared")
+	}
+}
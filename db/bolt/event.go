@@ -31,6 +31,9 @@ func (d *BoltDb) getEvents(c enumerable, params db.RetrieveQueryParams, filter f
 
 	events = []db.Event{}
 
+	// events of one project usually go in a row, so names are cached
+	projectNames := make(map[int]*string)
+
 	for k, v := c.First(); k != nil; k, v = c.Next() {
 		if params.Offset > 0 && i < params.Offset {
 			i++
@@ -49,28 +52,51 @@ func (d *BoltDb) getEvents(c enumerable, params db.RetrieveQueryParams, filter f
 		}
 
 		if evt.ProjectID != nil {
-			var proj db.Project
-			proj, err = d.GetProject(*evt.ProjectID)
+			evt.ProjectName, err = d.getEventProjectName(*evt.ProjectID, projectNames)
 			if err != nil {
 				break
 			}
-			evt.ProjectName = &proj.Name
 		}
 
 		events = append(events, evt)
 
 		n++
 
-		if n > params.Count {
+		if params.Count > 0 && n >= params.Count {
 			break
 		}
 	}
 
+	if err != nil {
+		return
+	}
+
 	err = db.FillEvents(d, events)
 
 	return
 }
 
+// getEventProjectName returns name of the project or nil if the project is deleted.
+func (d *BoltDb) getEventProjectName(projectID int, cache map[int]*string) (*string, error) {
+	if name, ok := cache[projectID]; ok {
+		return name, nil
+	}
+
+	proj, err := d.GetProject(projectID)
+
+	if err == db.ErrNotFound {
+		cache[projectID] = nil
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cache[projectID] = &proj.Name
+	return &proj.Name, nil
+}
+
 func (d *BoltDb) CreateEvent(evt db.Event) (newEvent db.Event, err error) {
 	newEvent = evt
 	newEvent.Created = time.Now()
@@ -111,11 +137,15 @@ func (d *BoltDb) GetUserEvents(userID int, params db.RetrieveQueryParams) (event
 			if evt.ProjectID == nil {
 				return false
 			}
+			// events of deleted projects are not shown, as the SQL database deletes them with the project
+			if _, err2 := d.GetProject(*evt.ProjectID); err2 != nil {
+				return false
+			}
 			_, err2 := d.GetProjectUser(*evt.ProjectID, userID)
 			return err2 == nil
 		})
 
-		return nil
+		return err
 	})
 
 	return
@@ -136,8 +166,40 @@ func (d *BoltDb) GetEvents(projectID int, params db.RetrieveQueryParams) (events
 			return *evt.ProjectID == projectID
 		})
 
-		return nil
+		return err
 	})
 
 	return
 }
+
+func (d *BoltDb) GetTaskEvents(projectID int, taskID int) (events []db.Event, err error) {
+	correlationID := db.TaskCorrelationID(taskID)
+
+	err = d.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("events"))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		events, err = d.getEvents(c, db.RetrieveQueryParams{}, func(evt db.Event) bool {
+			if evt.ProjectID == nil || evt.CorrelationID == nil {
+				return false
+			}
+			return *evt.ProjectID == projectID && *evt.CorrelationID == *correlationID
+		})
+
+		return err
+	})
+
+	if err != nil {
+		return
+	}
+
+	// events are stored from the newest to the oldest
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	return
+}
@@ -0,0 +1,101 @@
+package bolt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+func TestGetUserEvents(t *testing.T) {
+	store := CreateTestStore()
+
+	usr, err := store.CreateUser(db.UserWithPwd{
+		Pwd: "123456",
+		User: db.User{
+			Email:    "denguk@example.com",
+			Name:     "Denis Gukov",
+			Username: "fiftin",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"Frontend", "Backend", "Deleted"}
+	var projects []db.Project
+
+	for _, name := range names {
+		var proj db.Project
+		proj, err = store.CreateProject(db.Project{
+			Created: time.Now(),
+			Name:    name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.CreateProjectUser(db.ProjectUser{
+			ProjectID: proj.ID,
+			UserID:    usr.ID,
+			Role:      db.ProjectOwner,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		desc := "Event of " + name
+		_, err = store.CreateEvent(db.Event{
+			UserID:      &usr.ID,
+			ProjectID:   &proj.ID,
+			Description: &desc,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		projects = append(projects, proj)
+	}
+
+	err = store.DeleteProject(projects[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := store.GetUserEvents(usr.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected events of 2 existing projects, got %d", len(events))
+	}
+
+	for _, evt := range events {
+		if evt.ProjectName == nil {
+			t.Fatal("event must have project name")
+		}
+
+		if *evt.Description != "Event of "+*evt.ProjectName {
+			t.Fatalf("event %s has wrong project name %s", *evt.Description, *evt.ProjectName)
+		}
+	}
+
+	events, err = store.GetEvents(projects[2].ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].ProjectName != nil {
+		t.Fatal("event of deleted project must have no project name")
+	}
+
+	events, err = store.GetUserEvents(usr.ID, db.RetrieveQueryParams{Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("count must limit events, got %d", len(events))
+	}
+}
@@ -0,0 +1,69 @@
+package bolt
+
+import "github.com/ansible-semaphore/semaphore/db"
+
+// Favorites are stored in the bucket of the user, the template ID is the key.
+
+func (d *BoltDb) AddFavoriteTemplate(userID int, projectID int, templateID int) error {
+	_, err := d.GetTemplate(projectID, templateID)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.createObject(userID, db.FavoriteTemplateProps, db.FavoriteTemplate{
+		UserID:     userID,
+		ProjectID:  projectID,
+		TemplateID: templateID,
+	})
+
+	return err
+}
+
+func (d *BoltDb) RemoveFavoriteTemplate(userID int, projectID int, templateID int) error {
+	var favorite db.FavoriteTemplate
+
+	err := d.getObject(userID, db.FavoriteTemplateProps, intObjectID(templateID), &favorite)
+	if err != nil {
+		return err
+	}
+
+	if favorite.ProjectID != projectID {
+		return db.ErrNotFound
+	}
+
+	return d.deleteObject(userID, db.FavoriteTemplateProps, intObjectID(templateID), nil)
+}
+
+func (d *BoltDb) GetFavoriteTemplates(userID int, projectID int) (templates []db.Template, err error) {
+	var favorites []db.FavoriteTemplate
+
+	err = d.getObjects(userID, db.FavoriteTemplateProps, db.RetrieveQueryParams{}, func(i interface{}) bool {
+		return i.(db.FavoriteTemplate).ProjectID == projectID
+	}, &favorites)
+
+	if err != nil {
+		return
+	}
+
+	templates = make([]db.Template, 0)
+
+	for _, favorite := range favorites {
+		var tpl db.Template
+
+		tpl, err = d.GetTemplate(projectID, favorite.TemplateID)
+
+		if err == db.ErrNotFound {
+			// template was deleted
+			err = nil
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		templates = append(templates, tpl)
+	}
+
+	return
+}
@@ -28,6 +28,16 @@ func (d *BoltDb) DeleteInventory(projectID int, inventoryID int) error {
 	return d.deleteObject(projectID, db.InventoryProps, intObjectID(inventoryID), nil)
 }
 
+func (d *BoltDb) DeleteInventoryCascade(projectID int, inventoryID int) error {
+	return d.detachAndDeleteObject(projectID, db.InventoryProps, inventoryID, func(tpl *db.Template) bool {
+		if tpl.InventoryID == nil || *tpl.InventoryID != inventoryID {
+			return false
+		}
+		tpl.InventoryID = nil
+		return true
+	})
+}
+
 func (d *BoltDb) UpdateInventory(inventory db.Inventory) error {
 	return d.updateObject(inventory.ProjectID, db.InventoryProps, inventory)
 }
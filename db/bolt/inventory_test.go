@@ -0,0 +1,227 @@
+package bolt
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+func TestFillInventoryKeyNames(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sshKey := db.AccessKey{
+		Name:      "Deploy key",
+		Type:      db.AccessKeySSH,
+		ProjectID: &proj.ID,
+		SshKey: db.SshKey{
+			PrivateKey: "very-secret-private-key",
+		},
+	}
+	err = sshKey.SerializeSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey, err = store.CreateAccessKey(sshKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	becomeKey := db.AccessKey{
+		Name:      "Sudo",
+		Type:      db.AccessKeyLoginPassword,
+		ProjectID: &proj.ID,
+		LoginPassword: db.LoginPassword{
+			Login:    "root",
+			Password: "very-secret-password",
+		},
+	}
+	err = becomeKey.SerializeSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	becomeKey, err = store.CreateAccessKey(becomeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID:   proj.ID,
+		Name:        "Test",
+		SSHKeyID:    &sshKey.ID,
+		BecomeKeyID: &becomeKey.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err = store.GetInventory(proj.ID, inv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.FillInventoryKeyNames(store, &inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inv.SSHKeyName == nil || *inv.SSHKeyName != "Deploy key" {
+		t.Fatal("ssh key name must be filled")
+	}
+
+	if inv.BecomeKeyName == nil || *inv.BecomeKeyName != "Sudo" {
+		t.Fatal("become key name must be filled")
+	}
+
+	res, err := json.Marshal(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	str := string(res)
+
+	if strings.Contains(str, "very-secret") || strings.Contains(str, *sshKey.Secret) {
+		t.Fatal("inventory must not contain secrets of the keys: " + str)
+	}
+}
+
+func TestDeleteInventoryWithRefs(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+		Name:      "Hosts",
+		Type:      db.InventoryStatic,
+		Inventory: "localhost",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:        "Deploy",
+		Playbook:    "deploy.yml",
+		ProjectID:   proj.ID,
+		InventoryID: &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteInventoryWithRefs(store, proj.ID, inv.ID, false)
+	var validationErr *db.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("expected validation error, got", err)
+	}
+
+	if !strings.Contains(validationErr.Error(), "Deploy") {
+		t.Fatal("error must list referring templates:", validationErr.Error())
+	}
+
+	if _, err = store.GetInventory(proj.ID, inv.ID); err != nil {
+		t.Fatal("inventory must not be deleted:", err)
+	}
+
+	err = db.DeleteInventoryWithRefs(store, proj.ID, inv.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.GetInventory(proj.ID, inv.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatal("inventory must be deleted")
+	}
+
+	tpl, err = store.GetTemplate(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tpl.InventoryID != nil {
+		t.Fatal("template inventory must be cleared")
+	}
+}
+
+func TestGetInventoryRefsPage(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+		Name:      "Hosts",
+		Type:      db.InventoryStatic,
+		Inventory: "localhost",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err = store.CreateTemplate(db.Template{
+			Name:        "Deploy " + strconv.Itoa(i),
+			Playbook:    "deploy.yml",
+			ProjectID:   proj.ID,
+			InventoryID: &inv.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refs, err := store.GetInventoryRefs(proj.ID, inv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int]bool)
+
+	for offset := 0; offset < 6; offset += 2 {
+		page := refs.Page(db.RetrieveQueryParams{Offset: offset, Count: 2})
+
+		if page.TemplatesCount != 5 {
+			t.Fatalf("expected 5 templates, got %d", page.TemplatesCount)
+		}
+
+		if len(page.Templates) > 2 {
+			t.Fatal("page must not be longer than count")
+		}
+
+		for _, tpl := range page.Templates {
+			if seen[tpl.ID] {
+				t.Fatal("pages must not overlap")
+			}
+			seen[tpl.ID] = true
+		}
+	}
+
+	if len(seen) != 5 {
+		t.Fatalf("pages must contain all referrers, got %d", len(seen))
+	}
+
+	if page := refs.Page(db.RetrieveQueryParams{}); len(page.Templates) != 5 || len(page.Schedules) != 0 {
+		t.Fatal("all referrers must be returned without count")
+	}
+}
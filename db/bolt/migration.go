@@ -2,6 +2,7 @@ package bolt
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/ansible-semaphore/semaphore/db"
 	"go.etcd.io/bbolt"
 )
@@ -33,21 +34,39 @@ func (d *BoltDb) IsMigrationApplied(migration db.Migration) (bool, error) {
 	return false, err
 }
 
-func (d *BoltDb) ApplyMigration(m db.Migration) (err error) {
-	switch m.Version {
-	case "2.8.26":
-		err = migration_2_8_28{migration{d.db}}.Apply()
-	case "2.8.40":
-		err = migration_2_8_40{migration{d.db}}.Apply()
-	case "2.8.91":
-		err = migration_2_8_91{migration{d.db}}.Apply()
-	}
+// ApplyMigration runs the migration and marks it as applied inside a single
+// transaction, so a migration which fails or panics midway leaves no changes.
+func (d *BoltDb) ApplyMigration(m db.Migration) error {
+	return d.applyMigration(m, func(tx *bbolt.Tx) error {
+		switch m.Version {
+		case "2.8.26":
+			return migration_2_8_28{migration{tx}}.Apply()
+		case "2.8.40":
+			return migration_2_8_40{migration{tx}}.Apply()
+		case "2.8.91":
+			return migration_2_8_91{migration{tx}}.Apply()
+		case "2.9.17":
+			return migration_2_9_17{migration{tx}}.Apply()
+		}
+		return nil
+	})
+}
 
-	if err != nil {
-		return
-	}
+func (d *BoltDb) applyMigration(m db.Migration, apply func(tx *bbolt.Tx) error) (err error) {
+	defer func() {
+		// bbolt rolls the transaction back before the panic reaches this point.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("migration %s panicked: %v", m.Version, r)
+		}
+	}()
 
 	return d.db.Update(func(tx *bbolt.Tx) error {
+		err := apply(tx)
+
+		if err != nil {
+			return err
+		}
+
 		b, err := tx.CreateBucketIfNotExists([]byte("migrations"))
 
 		if err != nil {
@@ -70,20 +89,19 @@ func (d *BoltDb) TryRollbackMigration(m db.Migration) {
 	}
 }
 
+// migration gives the migrations access to the transaction they are applied in.
 type migration struct {
-	db *bbolt.DB
+	tx *bbolt.Tx
 }
 
 func (d migration) getProjectIDs() (projectIDs []string, err error) {
-	err = d.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("project"))
-		if b == nil {
-			return nil
-		}
-		return b.ForEach(func(id, _ []byte) error {
-			projectIDs = append(projectIDs, string(id))
-			return nil
-		})
+	b := d.tx.Bucket([]byte("project"))
+	if b == nil {
+		return
+	}
+	err = b.ForEach(func(id, _ []byte) error {
+		projectIDs = append(projectIDs, string(id))
+		return nil
 	})
 	return
 }
@@ -92,31 +110,28 @@ func (d migration) getProjectIDs() (projectIDs []string, err error) {
 func (d migration) getObjects(projectID string, objectPrefix string) (map[string]map[string]interface{}, error) {
 	repos := make(map[string]map[string]interface{}) // ???
 
-	err := d.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("project__" + objectPrefix + "_" + projectID))
-		if b == nil {
-			return nil
-		}
-		return b.ForEach(func(id, body []byte) error {
-			r := make(map[string]interface{})
-			repos[string(id)] = r
-			return json.Unmarshal(body, &r)
-		})
+	b := d.tx.Bucket([]byte("project__" + objectPrefix + "_" + projectID))
+	if b == nil {
+		return repos, nil
+	}
+
+	err := b.ForEach(func(id, body []byte) error {
+		r := make(map[string]interface{})
+		repos[string(id)] = r
+		return json.Unmarshal(body, &r)
 	})
 
 	return repos, err
 }
 
 func (d migration) setObject(projectID string, objectPrefix string, objectID string, object map[string]interface{}) error {
-	return d.db.Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("project__" + objectPrefix + "_" + projectID))
-		if err != nil {
-			return err
-		}
-		j, err := json.Marshal(object)
-		if err != nil {
-			return err
-		}
-		return b.Put([]byte(objectID), j)
-	})
+	b, err := d.tx.CreateBucketIfNotExists([]byte("project__" + objectPrefix + "_" + projectID))
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(objectID), j)
 }
@@ -35,7 +35,9 @@ func TestMigration_2_8_91_Apply(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = migration_2_8_91{migration{store.db}}.Apply()
+	err = store.db.Update(func(tx *bbolt.Tx) error {
+		return migration_2_8_91{migration{tx}}.Apply()
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -78,7 +80,9 @@ func TestMigration_2_8_91_Apply2(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = migration_2_8_28{migration{store.db}}.Apply()
+	err = store.db.Update(func(tx *bbolt.Tx) error {
+		return migration_2_8_28{migration{tx}}.Apply()
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,59 @@
+package bolt
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// migration_2_9_17 fills sequence numbers of the existing task output records.
+// Records of the task are stored in the order of insertion, so their keys are used as sequence numbers.
+type migration_2_9_17 struct {
+	migration
+}
+
+func (d migration_2_9_17) Apply() error {
+	return d.tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		if !strings.HasPrefix(string(name), "task__output_") {
+			return nil
+		}
+
+		records := make(map[string]map[string]interface{})
+
+		err := b.ForEach(func(id, body []byte) error {
+			r := make(map[string]interface{})
+			records[string(id)] = r
+			return json.Unmarshal(body, &r)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for id, r := range records {
+			seq, err := strconv.Atoi(id)
+			if err != nil {
+				return err
+			}
+
+			r["seq"] = seq
+			if _, ok := r["id"]; !ok {
+				r["id"] = seq
+			}
+
+			j, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+
+			err = b.Put([]byte(id), j)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+package bolt
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"testing"
+)
+
+func TestMigration_2_9_17_Apply(t *testing.T) {
+	store := CreateTestStore()
+
+	err := store.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("task__output_0000000001"))
+		if err != nil {
+			return err
+		}
+
+		err = b.Put([]byte("0000000001"), []byte("{\"task_id\":1,\"output\":\"first\"}"))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte("0000000002"), []byte("{\"id\":2,\"task_id\":1,\"output\":\"second\"}"))
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.db.Update(func(tx *bbolt.Tx) error {
+		return migration_2_9_17{migration{tx}}.Apply()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var first, second map[string]interface{}
+	err = store.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("task__output_0000000001"))
+		err2 := json.Unmarshal(b.Get([]byte("0000000001")), &first)
+		if err2 != nil {
+			return err2
+		}
+		return json.Unmarshal(b.Get([]byte("0000000002")), &second)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first["seq"].(float64) != 1 || first["id"].(float64) != 1 {
+		t.Fatal("invalid sequence of the first record")
+	}
+
+	if second["seq"].(float64) != 2 || second["output"].(string) != "second" {
+		t.Fatal("invalid sequence of the second record")
+	}
+}
@@ -0,0 +1,72 @@
+package bolt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"go.etcd.io/bbolt"
+)
+
+func TestBoltDb_ApplyMigrationRollsBackOnFailure(t *testing.T) {
+	store := CreateTestStore()
+
+	err := store.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("project"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("0000000001"), []byte("{}"))
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures := map[string]func(){
+		"error": func() {},
+		"panic": func() { panic("unexpected repository format") },
+	}
+
+	for name, fail := range failures {
+		m := db.Migration{Version: "0.0.1-" + name}
+
+		err = store.applyMigration(m, func(tx *bbolt.Tx) error {
+			mig := migration{tx}
+
+			err := mig.setObject("0000000001", "repository", "0000000001", map[string]interface{}{
+				"git_url": "git@example.com:test/test",
+			})
+			if err != nil {
+				return err
+			}
+
+			fail()
+
+			return errors.New("unexpected repository format")
+		})
+
+		if err == nil {
+			t.Fatalf("%s: migration must fail", name)
+		}
+
+		applied, err := store.IsMigrationApplied(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied {
+			t.Fatalf("%s: failed migration must not be marked as applied", name)
+		}
+
+		err = store.db.View(func(tx *bbolt.Tx) error {
+			if tx.Bucket([]byte("project__repository_0000000001")) != nil {
+				return errors.New("changes of the failed migration must be rolled back")
+			}
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
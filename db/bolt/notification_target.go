@@ -0,0 +1,70 @@
+package bolt
+
+import "github.com/ansible-semaphore/semaphore/db"
+
+func (d *BoltDb) GetNotificationTarget(projectID int, targetID int) (target db.NotificationTarget, err error) {
+	err = d.getObject(projectID, db.NotificationTargetProps, intObjectID(targetID), &target)
+	return
+}
+
+func (d *BoltDb) GetNotificationTargets(projectID int) (targets []db.NotificationTarget, err error) {
+	err = d.getObjects(projectID, db.NotificationTargetProps, db.RetrieveQueryParams{}, nil, &targets)
+	return
+}
+
+func (d *BoltDb) UpdateNotificationTarget(target db.NotificationTarget) error {
+	err := target.Validate()
+	if err != nil {
+		return err
+	}
+
+	// the secret is changed only by rotation
+	oldTarget, err := d.GetNotificationTarget(target.ProjectID, target.ID)
+	if err != nil {
+		return err
+	}
+	target.Secret = oldTarget.Secret
+
+	return d.updateObject(target.ProjectID, db.NotificationTargetProps, target)
+}
+
+func (d *BoltDb) CreateNotificationTarget(target db.NotificationTarget) (db.NotificationTarget, error) {
+	err := target.Validate()
+	if err != nil {
+		return db.NotificationTarget{}, err
+	}
+
+	target.Secret = db.NewNotificationTargetSecret()
+
+	newTarget, err := d.createObject(target.ProjectID, db.NotificationTargetProps, target)
+	if err != nil {
+		return db.NotificationTarget{}, err
+	}
+
+	return newTarget.(db.NotificationTarget), nil
+}
+
+func (d *BoltDb) DeleteNotificationTarget(projectID int, targetID int) error {
+	return d.deleteObject(projectID, db.NotificationTargetProps, intObjectID(targetID), nil)
+}
+
+func (d *BoltDb) RotateWebhookSecret(projectID int, webhookID int) (string, error) {
+	target, err := d.GetNotificationTarget(projectID, webhookID)
+	if err != nil {
+		return "", err
+	}
+
+	err = target.ValidateSecretRotation()
+	if err != nil {
+		return "", err
+	}
+
+	target.Secret = db.NewNotificationTargetSecret()
+
+	err = d.updateObject(projectID, db.NotificationTargetProps, target)
+	if err != nil {
+		return "", err
+	}
+
+	return target.Secret, nil
+}
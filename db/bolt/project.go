@@ -17,7 +17,7 @@ func (d *BoltDb) CreateProject(project db.Project) (db.Project, error) {
 	return newProject.(db.Project), nil
 }
 
-func (d *BoltDb) GetProjects(userID int) (projects []db.Project, err error) {
+func (d *BoltDb) GetProjects(userID int, filter db.ProjectFilter) (projects []db.Project, err error) {
 	projects = make([]db.Project, 0)
 
 	var allProjects []db.Project
@@ -29,6 +29,10 @@ func (d *BoltDb) GetProjects(userID int) (projects []db.Project, err error) {
 	}
 
 	for _, v := range allProjects {
+		if v.Archived && !filter.IncludeArchived {
+			continue
+		}
+
 		_, err2 := d.GetProjectUser(v.ID, userID)
 		if err2 == nil {
 			projects = append(projects, v)
@@ -41,6 +45,53 @@ func (d *BoltDb) GetProjects(userID int) (projects []db.Project, err error) {
 	return
 }
 
+func (d *BoltDb) GetAllProjects() (projects []db.Project, err error) {
+	projects = make([]db.Project, 0)
+	err = d.getObjects(0, db.ProjectProps, db.RetrieveQueryParams{}, nil, &projects)
+	return
+}
+
+func (d *BoltDb) GetProjectsWithRole(userID int, filter db.ProjectFilter) (projects []db.ProjectWithRole, err error) {
+	projects = make([]db.ProjectWithRole, 0)
+
+	var allProjects []db.Project
+
+	err = d.getObjects(0, db.ProjectProps, db.RetrieveQueryParams{}, nil, &allProjects)
+
+	if err != nil {
+		return
+	}
+
+	for _, v := range allProjects {
+		if v.Archived && !filter.IncludeArchived {
+			continue
+		}
+
+		var members []db.ProjectUser
+
+		err = d.getObjects(v.ID, db.ProjectUserProps, db.RetrieveQueryParams{}, nil, &members)
+
+		if err != nil {
+			return
+		}
+
+		for _, member := range members {
+			if member.UserID != userID {
+				continue
+			}
+
+			projects = append(projects, db.ProjectWithRole{
+				Project:     v,
+				Role:        member.Role,
+				MemberCount: len(members),
+			})
+			break
+		}
+	}
+
+	return
+}
+
 func (d *BoltDb) GetProject(projectID int) (project db.Project, err error) {
 	err = d.getObject(0, db.ProjectProps, intObjectID(projectID), &project)
 	return
@@ -51,5 +102,24 @@ func (d *BoltDb) DeleteProject(projectID int) error {
 }
 
 func (d *BoltDb) UpdateProject(project db.Project) error {
+	// archived flag can be changed by SetProjectArchived only
+	oldProject, err := d.GetProject(project.ID)
+	if err != nil {
+		return err
+	}
+
+	project.Archived = oldProject.Archived
+
+	return d.updateObject(0, db.ProjectProps, project)
+}
+
+func (d *BoltDb) SetProjectArchived(projectID int, archived bool) error {
+	project, err := d.GetProject(projectID)
+	if err != nil {
+		return err
+	}
+
+	project.Archived = archived
+
 	return d.updateObject(0, db.ProjectProps, project)
 }
@@ -41,7 +41,7 @@ func TestGetProjects(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	found, err := store.GetProjects(usr.ID)
+	found, err := store.GetProjects(usr.ID, db.ProjectFilter{})
 
 	if err != nil {
 		t.Fatal(err.Error())
@@ -53,6 +53,150 @@ func TestGetProjects(t *testing.T) {
 
 }
 
+func TestGetProjectsWithRole(t *testing.T) {
+	store := CreateTestStore()
+
+	var users []db.User
+
+	for _, username := range []string{"owner", "guest", "outsider"} {
+		usr, err := store.CreateUser(db.UserWithPwd{
+			Pwd: "123456",
+			User: db.User{
+				Email:    username + "@example.com",
+				Name:     username,
+				Username: username,
+			},
+		})
+
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		users = append(users, usr)
+	}
+
+	proj1, err := store.CreateProject(db.Project{Name: "Test1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	proj2, err := store.CreateProject(db.Project{Name: "Test2"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	members := []db.ProjectUser{
+		{ProjectID: proj1.ID, UserID: users[0].ID, Role: db.ProjectOwner},
+		{ProjectID: proj1.ID, UserID: users[1].ID, Role: db.ProjectGuest},
+		{ProjectID: proj2.ID, UserID: users[2].ID, Role: db.ProjectOwner},
+	}
+
+	for _, member := range members {
+		_, err = store.CreateProjectUser(member)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	found, err := store.GetProjectsWithRole(users[1].ID, db.ProjectFilter{})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(found) != 1 {
+		t.Fatalf("expected 1 project, got %d", len(found))
+	}
+
+	if found[0].ID != proj1.ID || found[0].Name != "Test1" {
+		t.Fatal("unexpected project")
+	}
+
+	if found[0].Role != db.ProjectGuest {
+		t.Fatalf("expected role %s, got %s", db.ProjectGuest, found[0].Role)
+	}
+
+	if found[0].MemberCount != 2 {
+		t.Fatalf("expected 2 members, got %d", found[0].MemberCount)
+	}
+}
+
+func TestSetProjectArchived(t *testing.T) {
+	store := CreateTestStore()
+
+	usr, err := store.CreateUser(db.UserWithPwd{
+		Pwd: "123456",
+		User: db.User{
+			Email:    "denguk@example.com",
+			Name:     "Denis Gukov",
+			Username: "fiftin",
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = store.CreateProjectUser(db.ProjectUser{
+		ProjectID: proj.ID,
+		UserID:    usr.ID,
+		Role:      db.ProjectOwner,
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = store.SetProjectArchived(proj.ID, true)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	found, err := store.GetProjects(usr.ID, db.ProjectFilter{})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(found) != 0 {
+		t.Fatal("archived project must be hidden")
+	}
+
+	found, err = store.GetProjects(usr.ID, db.ProjectFilter{IncludeArchived: true})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(found) != 1 || !found[0].Archived {
+		t.Fatal("archived project must be returned if requested")
+	}
+
+	proj.Name = "Renamed"
+	err = store.UpdateProject(proj)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	proj, err = store.GetProject(proj.ID)
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !proj.Archived {
+		t.Fatal("update must not restore archived project")
+	}
+}
+
 func TestGetProject(t *testing.T) {
 	store := CreateTestStore()
 
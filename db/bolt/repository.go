@@ -13,8 +13,27 @@ func (d *BoltDb) GetRepository(projectID int, repositoryID int) (repository db.R
 	return
 }
 
-func (d *BoltDb) GetRepositoryRefs(projectID int, repositoryID int) (db.ObjectReferrers, error) {
-	return d.getObjectRefs(projectID, db.RepositoryProps, repositoryID)
+func (d *BoltDb) GetRepositoryRefs(projectID int, repositoryID int) (refs db.ObjectReferrers, err error) {
+	refs, err = d.getObjectRefs(projectID, db.RepositoryProps, repositoryID)
+	if err != nil {
+		return
+	}
+
+	projSchedules, err := d.getProjectSchedules(projectID)
+	if err != nil {
+		return
+	}
+
+	// schedules which poll the repository for new commits
+	schedules := make([]db.Schedule, 0)
+	for _, s := range projSchedules {
+		if s.RepositoryID != nil && *s.RepositoryID == repositoryID {
+			schedules = append(schedules, s)
+		}
+	}
+
+	refs.Schedules = db.GetScheduleReferrers(schedules)
+	return
 }
 
 func (d *BoltDb) GetRepositories(projectID int, params db.RetrieveQueryParams) (repositories []db.Repository, err error) {
@@ -0,0 +1,88 @@
+package bolt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+func TestDeleteRepositoryWithRefs(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		Name:      "None",
+		Type:      db.AccessKeyNone,
+		ProjectID: &proj.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createRepo := func(name string) db.Repository {
+		repo, err2 := store.CreateRepository(db.Repository{
+			Name:      name,
+			ProjectID: proj.ID,
+			GitURL:    "git@example.com:test/" + name,
+			GitBranch: "master",
+			SSHKeyID:  key.ID,
+		})
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		return repo
+	}
+
+	usedRepo := createRepo("used")
+	freeRepo := createRepo("free")
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:         "Deploy",
+		Playbook:     "deploy.yml",
+		ProjectID:    proj.ID,
+		RepositoryID: usedRepo.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteRepositoryWithRefs(store, proj.ID, usedRepo.ID, false)
+	var validationErr *db.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("expected validation error, got", err)
+	}
+	if !strings.Contains(validationErr.Error(), "Deploy") {
+		t.Fatal("error must list referring templates:", validationErr.Error())
+	}
+
+	if _, err = store.GetRepository(proj.ID, usedRepo.ID); err != nil {
+		t.Fatal("repository must not be deleted:", err)
+	}
+
+	err = db.DeleteRepositoryWithRefs(store, proj.ID, freeRepo.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.GetRepository(proj.ID, freeRepo.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatal("repository must be deleted")
+	}
+
+	err = db.DeleteRepositoryWithRefs(store, proj.ID, usedRepo.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.GetTemplate(proj.ID, tpl.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatal("template must be deleted together with repository")
+	}
+}
@@ -3,6 +3,7 @@ package bolt
 import (
 	"github.com/ansible-semaphore/semaphore/db"
 	"go.etcd.io/bbolt"
+	"time"
 )
 
 func (d *BoltDb) GetSchedules() (schedules []db.Schedule, err error) {
@@ -16,7 +17,7 @@ func (d *BoltDb) GetSchedules() (schedules []db.Schedule, err error) {
 
 	for _, proj := range allProjects {
 		var projSchedules []db.Schedule
-		projSchedules, err = d.GetProjectSchedules(proj.ID)
+		projSchedules, err = d.getProjectSchedules(proj.ID)
 		if err != nil {
 			return
 		}
@@ -26,15 +27,51 @@ func (d *BoltDb) GetSchedules() (schedules []db.Schedule, err error) {
 	return
 }
 
-func (d *BoltDb) GetProjectSchedules(projectID int) (schedules []db.Schedule, err error) {
+func (d *BoltDb) getProjectSchedules(projectID int) (schedules []db.Schedule, err error) {
 	err = d.getObjects(projectID, db.ScheduleProps, db.RetrieveQueryParams{}, nil, &schedules)
 	return
 }
 
+func (d *BoltDb) GetProjectSchedules(projectID int, params db.RetrieveQueryParams) (schedules []db.Schedule, err error) {
+	err = d.getObjects(projectID, db.ScheduleProps, params, nil, &schedules)
+	if err != nil {
+		return
+	}
+
+	templateNames := make(map[int]*string)
+	now := time.Now()
+
+	for i := range schedules {
+		s := &schedules[i]
+
+		name, ok := templateNames[s.TemplateID]
+		if !ok {
+			var tpl db.Template
+			tpl, err = d.GetTemplate(projectID, s.TemplateID)
+
+			switch err {
+			case nil:
+				name = &tpl.Name
+			case db.ErrNotFound:
+				err = nil
+			default:
+				return
+			}
+
+			templateNames[s.TemplateID] = name
+		}
+
+		s.TemplateName = name
+		s.FillNextRun(now)
+	}
+
+	return
+}
+
 func (d *BoltDb) GetTemplateSchedules(projectID int, templateID int) (schedules []db.Schedule, err error) {
 	schedules = make([]db.Schedule, 0)
 
-	projSchedules, err := d.GetProjectSchedules(projectID)
+	projSchedules, err := d.getProjectSchedules(projectID)
 	if err != nil {
 		return
 	}
@@ -49,6 +86,11 @@ func (d *BoltDb) GetTemplateSchedules(projectID int, templateID int) (schedules
 }
 
 func (d *BoltDb) CreateSchedule(schedule db.Schedule) (newSchedule db.Schedule, err error) {
+	err = db.ValidateNewSchedule(d, schedule)
+	if err != nil {
+		return
+	}
+
 	newTpl, err := d.createObject(schedule.ProjectID, db.ScheduleProps, schedule)
 	if err != nil {
 		return
@@ -58,6 +100,9 @@ func (d *BoltDb) CreateSchedule(schedule db.Schedule) (newSchedule db.Schedule,
 }
 
 func (d *BoltDb) UpdateSchedule(schedule db.Schedule) error {
+	if err := db.ValidateSchedule(d, schedule); err != nil {
+		return err
+	}
 	return d.updateObject(schedule.ProjectID, db.ScheduleProps, schedule)
 }
 
@@ -67,9 +112,44 @@ func (d *BoltDb) GetSchedule(projectID int, scheduleID int) (schedule db.Schedul
 }
 
 func (d *BoltDb) deleteSchedule(projectID int, scheduleID int, tx *bbolt.Tx) error {
+	err := d.deleteScheduleRuns(projectID, scheduleID, tx)
+	if err != nil {
+		return err
+	}
 	return d.deleteObject(projectID, db.ScheduleProps, intObjectID(scheduleID), tx)
 }
 
+// deleteScheduleRuns removes history of the schedule.
+func (d *BoltDb) deleteScheduleRuns(projectID int, scheduleID int, tx *bbolt.Tx) error {
+	b := tx.Bucket(makeBucketId(db.ScheduleRunProps, projectID))
+	if b == nil {
+		return nil
+	}
+
+	var keys [][]byte
+
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var run db.ScheduleRun
+		err := unmarshalObject(v, &run)
+		if err != nil {
+			return err
+		}
+		if run.ScheduleID == scheduleID {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		err := b.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (d *BoltDb) DeleteSchedule(projectID int, scheduleID int) error {
 	return d.db.Update(func(tx *bbolt.Tx) error {
 		return d.deleteSchedule(projectID, scheduleID, tx)
@@ -84,3 +164,23 @@ func (d *BoltDb) SetScheduleCommitHash(projectID int, scheduleID int, hash strin
 	schedule.LastCommitHash = &hash
 	return d.updateObject(projectID, db.ScheduleProps, schedule)
 }
+
+func (d *BoltDb) CreateScheduleRun(run db.ScheduleRun) (newRun db.ScheduleRun, err error) {
+	if run.Created.IsZero() {
+		run.Created = time.Now()
+	}
+
+	res, err := d.createObject(run.ProjectID, db.ScheduleRunProps, run)
+	if err != nil {
+		return
+	}
+	newRun = res.(db.ScheduleRun)
+	return
+}
+
+func (d *BoltDb) GetScheduleHistory(projectID int, scheduleID int, params db.RetrieveQueryParams) (runs []db.ScheduleRun, err error) {
+	err = d.getObjects(projectID, db.ScheduleRunProps, params, func(i interface{}) bool {
+		return i.(db.ScheduleRun).ScheduleID == scheduleID
+	}, &runs)
+	return
+}
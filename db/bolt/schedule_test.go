@@ -0,0 +1,312 @@
+package bolt
+
+import (
+	"github.com/ansible-semaphore/semaphore/db"
+	"testing"
+	"time"
+)
+
+func TestGetScheduleHistory(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test1",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	schedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		CronFormat: "* * * * *",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	otherSchedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		CronFormat: "0 * * * *",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	taskID := 5
+
+	for _, run := range []db.ScheduleRun{
+		{ProjectID: proj.ID, ScheduleID: schedule.ID},
+		{ProjectID: proj.ID, ScheduleID: otherSchedule.ID},
+		{ProjectID: proj.ID, ScheduleID: schedule.ID, TaskID: &taskID},
+	} {
+		_, err = store.CreateScheduleRun(run)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	runs, err := store.GetScheduleHistory(proj.ID, schedule.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(runs) != 2 {
+		t.Fatal("expected 2 runs, got", len(runs))
+	}
+
+	if runs[0].TaskID == nil || *runs[0].TaskID != taskID {
+		t.Fatal("most recent run must be first")
+	}
+
+	if runs[1].TaskID != nil {
+		t.Fatal("run without task must have nil task ID")
+	}
+
+	err = store.DeleteSchedule(proj.ID, schedule.ID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	runs, err = store.GetScheduleHistory(proj.ID, schedule.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(runs) != 0 {
+		t.Fatal("history must be removed with the schedule")
+	}
+}
+
+func TestCreateSchedule_duplicate(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test1",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: 1,
+		CronFormat: "0 2 * * *",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: 1,
+		CronFormat: "0  2 * * * ",
+	})
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("duplicate schedule must be rejected")
+	}
+
+	_, err = store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: 2,
+		CronFormat: "0 2 * * *",
+	})
+	if err != nil {
+		t.Fatal("same cron expression must be allowed for other template")
+	}
+}
+
+func TestUpdateSchedule_duplicate(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test1",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: 1,
+		CronFormat: "0 2 * * *",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	schedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: 1,
+		CronFormat: "0 3 * * *",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = store.UpdateSchedule(schedule)
+	if err != nil {
+		t.Fatal("schedule must not be duplicate of itself")
+	}
+
+	schedule.CronFormat = "0 2  * * *"
+	err = store.UpdateSchedule(schedule)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("update to duplicate schedule must be rejected")
+	}
+
+	schedule.Force = true
+	err = store.UpdateSchedule(schedule)
+	if err != nil {
+		t.Fatal("forced update to duplicate schedule must be allowed")
+	}
+}
+
+func TestCreateSchedule_forcedDuplicate(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test1",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: 1,
+		CronFormat: "0 2 * * *",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: 1,
+		CronFormat: "0 2 * * *",
+		Force:      true,
+	})
+	if err != nil {
+		t.Fatal("forced duplicate schedule must be allowed")
+	}
+
+	schedules, err := store.GetTemplateSchedules(proj.ID, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(schedules) != 2 {
+		t.Fatal("both schedules must be created")
+	}
+}
+
+func TestGetProjectSchedules(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test1",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	otherProj, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test2",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var templates []db.Template
+
+	for _, name := range []string{"Build", "Deploy"} {
+		var tpl db.Template
+		tpl, err = store.CreateTemplate(db.Template{
+			ProjectID: proj.ID,
+			Name:      name,
+			Playbook:  "test.yml",
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		templates = append(templates, tpl)
+	}
+
+	for _, schedule := range []db.Schedule{
+		{ProjectID: proj.ID, TemplateID: templates[0].ID, CronFormat: "0 2 * * *"},
+		{ProjectID: proj.ID, TemplateID: templates[1].ID, CronFormat: "0 3 * * *"},
+		{ProjectID: proj.ID, TemplateID: templates[1].ID, CronFormat: ""},
+		{ProjectID: otherProj.ID, TemplateID: templates[0].ID, CronFormat: "0 4 * * *"},
+	} {
+		_, err = store.CreateSchedule(schedule)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	schedules, err := store.GetProjectSchedules(proj.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(schedules) != 3 {
+		t.Fatal("expected 3 schedules, got", len(schedules))
+	}
+
+	for i, name := range []string{"Build", "Deploy", "Deploy"} {
+		if schedules[i].TemplateName == nil || *schedules[i].TemplateName != name {
+			t.Fatal("schedule must have name of its template", name)
+		}
+	}
+
+	if schedules[0].NextRun == nil || !schedules[0].NextRun.After(time.Now()) || schedules[0].NextRun.Hour() != 2 {
+		t.Fatal("invalid next run", schedules[0].NextRun)
+	}
+
+	if schedules[2].NextRun != nil {
+		t.Fatal("schedule without cron expression must not have next run")
+	}
+}
+
+func TestUpdateSchedule_invalidConcurrencyMode(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test1",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	schedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:       proj.ID,
+		TemplateID:      1,
+		CronFormat:      "0 2 * * *",
+		ConcurrencyMode: db.ScheduleConcurrencySkip,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	schedule.ConcurrencyMode = "parallel"
+	err = store.UpdateSchedule(schedule)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("unknown concurrency mode must be rejected on update")
+	}
+
+	schedule, err = store.GetSchedule(proj.ID, schedule.ID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if schedule.ConcurrencyMode != db.ScheduleConcurrencySkip {
+		t.Fatal("rejected update must not change the concurrency mode")
+	}
+}
@@ -14,6 +14,7 @@ type globalToken struct {
 var globalTokenObject = db.ObjectProps{
 	TableName:         "token",
 	PrimaryColumnName: "id",
+	PrimaryColumnType: db.StringPrimaryColumn,
 	Type:              reflect.TypeOf(globalToken{}),
 	IsGlobal:          true,
 }
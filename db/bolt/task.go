@@ -1,6 +1,7 @@
 package bolt
 
 import (
+	"context"
 	"github.com/ansible-semaphore/semaphore/db"
 	"go.etcd.io/bbolt"
 	"time"
@@ -8,6 +9,9 @@ import (
 
 func (d *BoltDb) CreateTask(task db.Task) (newTask db.Task, err error) {
 	task.Created = time.Now()
+	if len(task.DisplayTags) > 0 {
+		task.DisplayTagsJSON = db.ObjectToJSON(task.DisplayTags)
+	}
 	res, err := d.createObject(0, db.TaskProps, task)
 	if err != nil {
 		return
@@ -16,22 +20,99 @@ func (d *BoltDb) CreateTask(task db.Task) (newTask db.Task, err error) {
 	return
 }
 
+func (d *BoltDb) CreateBuildTask(task db.Task, startVersion *string) (newTask db.Task, err error) {
+	task.Created = time.Now()
+	if len(task.DisplayTags) > 0 {
+		task.DisplayTagsJSON = db.ObjectToJSON(task.DisplayTags)
+	}
+
+	// write transactions of BoltDB are serialized,
+	// so the most recent build can't change until the task is saved.
+	err = d.db.Update(func(tx *bbolt.Tx) error {
+		// tasks are iterated from the newest to the oldest
+		var builds []db.Task
+		err2 := d.getObjectsTx(tx, 0, db.TaskProps, db.RetrieveQueryParams{Count: 1}, func(i interface{}) bool {
+			build := i.(db.Task)
+			return build.ProjectID == task.ProjectID && build.TemplateID == task.TemplateID && build.Version != nil
+		}, &builds)
+		if err2 != nil {
+			return err2
+		}
+
+		var lastVersion *string
+		if len(builds) > 0 {
+			lastVersion = builds[0].Version
+		}
+
+		task.SetBuildVersion(startVersion, lastVersion)
+
+		res, err2 := d.createObjectTx(tx, 0, db.TaskProps, task)
+		if err2 != nil {
+			return err2
+		}
+
+		newTask = res.(db.Task)
+		return nil
+	})
+
+	return
+}
+
 func (d *BoltDb) UpdateTask(task db.Task) error {
 	return d.updateObject(0, db.TaskProps, task)
 }
 
 func (d *BoltDb) CreateTaskOutput(output db.TaskOutput) (db.TaskOutput, error) {
-	newOutput, err := d.createObject(output.TaskID, db.TaskOutputProps, output)
+	if output.Level == "" {
+		output.Level = db.TaskOutputInfo
+	}
+
+	err := d.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(makeBucketId(db.TaskOutputProps, output.TaskID))
+		if err != nil {
+			return err
+		}
+
+		// every task has its own output bucket, so the bucket sequence
+		// is used both as record ID and as sequence number within the task.
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		output.ID = int(seq)
+		output.Seq = int(seq)
+
+		str, err := marshalObject(output)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(intObjectID(output.ID).ToBytes(), str)
+	})
+
 	if err != nil {
 		return db.TaskOutput{}, err
 	}
-	return newOutput.(db.TaskOutput), nil
+
+	return output, nil
 }
 
-func (d *BoltDb) getTasks(projectID int, templateID *int, params db.RetrieveQueryParams) (tasksWithTpl []db.TaskWithTpl, err error) {
+func (d *BoltDb) getTasks(projectID int, templateID *int, version *string, filter db.TaskFilter, params db.RetrieveQueryParams) (tasksWithTpl []db.TaskWithTpl, err error) {
+	tasksWithTpl, _, err = d.getTasksContext(context.Background(), projectID, templateID, version, filter, params)
+	return
+}
+
+// getTasksContext stops reading tasks when the context is done and returns tasks read so far.
+func (d *BoltDb) getTasksContext(ctx context.Context, projectID int, templateID *int, version *string, filter db.TaskFilter, params db.RetrieveQueryParams) (tasksWithTpl []db.TaskWithTpl, truncated bool, err error) {
 	var tasks []db.Task
 
 	err = d.getObjects(0, db.TaskProps, params, func(tsk interface{}) bool {
+		if truncated || ctx.Err() != nil {
+			truncated = true
+			return false
+		}
+
 		task := tsk.(db.Task)
 
 		if task.ProjectID != projectID {
@@ -42,7 +123,21 @@ func (d *BoltDb) getTasks(projectID int, templateID *int, params db.RetrieveQuer
 			return false
 		}
 
-		return true
+		if version != nil && (task.Version == nil || *task.Version != *version) {
+			return false
+		}
+
+		if filter.UserID != nil && (task.UserID == nil || *task.UserID != *filter.UserID) {
+			return false
+		}
+
+		if len(filter.DisplayTags) > 0 {
+			if task.FillDisplayTags() != nil || !task.HasDisplayTags(filter.DisplayTags) {
+				return false
+			}
+		}
+
+		return filter.MatchesStatusAndStart(task)
 	}, &tasks)
 
 	if err != nil {
@@ -87,6 +182,32 @@ func (d *BoltDb) getTasks(projectID int, templateID *int, params db.RetrieveQuer
 	return
 }
 
+func (d *BoltDb) GetTasksByStatus(statuses []db.TaskStatus) (tasks []db.Task, err error) {
+	tasks = make([]db.Task, 0)
+	err = d.getObjects(0, db.TaskProps, db.RetrieveQueryParams{}, func(tsk interface{}) bool {
+		status := tsk.(db.Task).Status
+		for _, s := range statuses {
+			if status == s {
+				return true
+			}
+		}
+		return false
+	}, &tasks)
+
+	if err != nil {
+		return
+	}
+
+	for i := range tasks {
+		err = tasks[i].FillDisplayTags()
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
 func (d *BoltDb) GetTask(projectID int, taskID int) (task db.Task, err error) {
 	err = d.getObject(0, db.TaskProps, intObjectID(taskID), &task)
 	if err != nil {
@@ -99,15 +220,39 @@ func (d *BoltDb) GetTask(projectID int, taskID int) (task db.Task, err error) {
 		return
 	}
 
+	err = task.FillDisplayTags()
 	return
 }
 
 func (d *BoltDb) GetTemplateTasks(projectID int, templateID int, params db.RetrieveQueryParams) ([]db.TaskWithTpl, error) {
-	return d.getTasks(projectID, &templateID, params)
+	return d.getTasks(projectID, &templateID, nil, db.TaskFilter{}, params)
+}
+
+func (d *BoltDb) GetTaskByVersion(projectID int, templateID int, version string) (task db.TaskWithTpl, err error) {
+	tasks, err := d.getTasks(projectID, &templateID, &version, db.TaskFilter{}, db.RetrieveQueryParams{Count: 1})
+	if err != nil {
+		return
+	}
+
+	if len(tasks) == 0 {
+		err = db.ErrNotFound
+		return
+	}
+
+	task = tasks[0]
+	return
+}
+
+func (d *BoltDb) GetProjectTasks(projectID int, filter db.TaskFilter, params db.RetrieveQueryParams) ([]db.TaskWithTpl, error) {
+	return d.getTasks(projectID, nil, nil, filter, params)
+}
+
+func (d *BoltDb) GetProjectTasksFiltered(projectID int, filter db.TaskFilter, params db.RetrieveQueryParams) ([]db.TaskWithTpl, error) {
+	return d.getTasks(projectID, filter.TemplateID, nil, filter, params)
 }
 
-func (d *BoltDb) GetProjectTasks(projectID int, params db.RetrieveQueryParams) ([]db.TaskWithTpl, error) {
-	return d.getTasks(projectID, nil, params)
+func (d *BoltDb) GetProjectTasksContext(ctx context.Context, projectID int, filter db.TaskFilter, params db.RetrieveQueryParams) ([]db.TaskWithTpl, bool, error) {
+	return d.getTasksContext(ctx, projectID, nil, nil, filter, params)
 }
 
 func (d *BoltDb) deleteTaskWithOutputs(projectID int, taskID int, tx *bbolt.Tx) (err error) {
@@ -136,7 +281,169 @@ func (d *BoltDb) DeleteTaskWithOutputs(projectID int, taskID int) error {
 	})
 }
 
+func (d *BoltDb) DeleteTaskOutputs(projectID int, taskID int) error {
+	// check if task exists in the project
+	_, err := d.GetTask(projectID, taskID)
+	if err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		err := tx.DeleteBucket(makeBucketId(db.TaskOutputProps, taskID))
+		if err == bbolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (d *BoltDb) DeleteTaskOutputsBefore(projectID int, before time.Time) (count int, err error) {
+	var tasks []db.Task
+
+	err = d.getObjects(0, db.TaskProps, db.RetrieveQueryParams{}, func(tsk interface{}) bool {
+		return tsk.(db.Task).ProjectID == projectID
+	}, &tasks)
+
+	if err != nil {
+		return
+	}
+
+	err = d.db.Update(func(tx *bbolt.Tx) error {
+		for _, task := range tasks {
+			b := tx.Bucket(makeBucketId(db.TaskOutputProps, task.ID))
+			if b == nil {
+				continue
+			}
+
+			var keys [][]byte
+
+			err := b.ForEach(func(k, v []byte) error {
+				var output db.TaskOutput
+				if err := unmarshalObject(v, &output); err != nil {
+					return err
+				}
+				if output.Time.Before(before) {
+					keys = append(keys, append([]byte{}, k...))
+				}
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+
+			for _, k := range keys {
+				if err = b.Delete(k); err != nil {
+					return err
+				}
+			}
+
+			count += len(keys)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (d *BoltDb) PruneTaskOutputs(projectID int, olderThan time.Time, options ...db.TaskPruneOption) (outputs int, tasks int, err error) {
+	outputs, err = d.DeleteTaskOutputsBefore(projectID, olderThan)
+	if err != nil || !db.HasTaskPruneOption(options, db.PruneFinishedTasks) {
+		return
+	}
+
+	tasks, err = d.deleteTasksBefore(projectID, olderThan)
+	return
+}
+
+// deleteTasksBefore deletes finished tasks of the project which ended before the time
+// together with their output. It returns number of deleted tasks.
+func (d *BoltDb) deleteTasksBefore(projectID int, before time.Time) (count int, err error) {
+	var tasks []db.Task
+
+	err = d.getObjects(0, db.TaskProps, db.RetrieveQueryParams{}, func(tsk interface{}) bool {
+		task := tsk.(db.Task)
+		return task.ProjectID == projectID && task.EndedBefore(before)
+	}, &tasks)
+
+	if err != nil {
+		return
+	}
+
+	err = d.db.Update(func(tx *bbolt.Tx) error {
+		for _, task := range tasks {
+			if err := d.deleteObject(0, db.TaskProps, intObjectID(task.ID), tx); err != nil {
+				return err
+			}
+
+			err := tx.DeleteBucket(makeBucketId(db.TaskOutputProps, task.ID))
+			if err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err == nil {
+		count = len(tasks)
+	}
+
+	return
+}
+
 func (d *BoltDb) GetTaskOutputs(projectID int, taskID int) (outputs []db.TaskOutput, err error) {
+	outputs, _, err = d.GetTaskOutputsPaged(projectID, taskID, db.RetrieveQueryParams{})
+	return
+}
+
+func (d *BoltDb) GetTaskOutputsPaged(projectID int, taskID int, params db.RetrieveQueryParams) (outputs []db.TaskOutput, total int, err error) {
+	// check if task exists in the project
+	_, err = d.GetTask(projectID, taskID)
+
+	if err != nil {
+		return
+	}
+
+	outputs = []db.TaskOutput{}
+
+	err = d.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(makeBucketId(db.TaskOutputProps, taskID))
+		if b == nil {
+			return nil
+		}
+
+		total = b.Stats().KeyN
+
+		// keys of the bucket are sequence numbers, so records are read in insertion order.
+		// Records before the page are skipped without unmarshalling.
+		c := b.Cursor()
+		i := 0
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if i < params.Offset {
+				i++
+				continue
+			}
+
+			if params.Count > 0 && len(outputs) >= params.Count {
+				break
+			}
+
+			var output db.TaskOutput
+			if err := unmarshalObject(v, &output); err != nil {
+				return err
+			}
+			outputs = append(outputs, output)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (d *BoltDb) GetTaskOutputsSince(projectID int, taskID int, afterOutputID int) (outputs []db.TaskOutput, err error) {
 	// check if task exists in the project
 	_, err = d.GetTask(projectID, taskID)
 
@@ -144,7 +451,9 @@ func (d *BoltDb) GetTaskOutputs(projectID int, taskID int) (outputs []db.TaskOut
 		return
 	}
 
-	err = d.getObjects(taskID, db.TaskOutputProps, db.RetrieveQueryParams{}, nil, &outputs)
+	err = d.getObjects(taskID, db.TaskOutputProps, db.RetrieveQueryParams{}, func(i interface{}) bool {
+		return i.(db.TaskOutput).ID > afterOutputID
+	}, &outputs)
 
 	return
 }
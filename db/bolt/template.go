@@ -13,6 +13,13 @@ func (d *BoltDb) CreateTemplate(template db.Template) (newTemplate db.Template,
 	}
 
 	template.SurveyVarsJSON = db.ObjectToJSON(template.SurveyVars)
+	template.VaultsJSON = db.ObjectToJSON(template.Vaults)
+	template.ChangedPathsFilterJSON = db.ObjectToJSON(template.ChangedPathsFilter)
+	template.AllowedRolesJSON = db.ObjectToJSON(template.AllowedRoles)
+	template.NotificationTargetIDsJSON = db.ObjectToJSON(template.NotificationTargetIDs)
+	template.AdditionalRepositoryIDsJSON = db.ObjectToJSON(template.AdditionalRepositoryIDs)
+	template.AllowedWindowJSON = db.ObjectToJSON(template.AllowedWindow)
+	template.Archived = false
 	newTpl, err := d.createObject(template.ProjectID, db.TemplateProps, template)
 	if err != nil {
 		return
@@ -29,8 +36,31 @@ func (d *BoltDb) UpdateTemplate(template db.Template) error {
 		return err
 	}
 
+	oldTemplate, err := d.GetTemplate(template.ProjectID, template.ID)
+	if err != nil {
+		return err
+	}
+
 	template.SurveyVarsJSON = db.ObjectToJSON(template.SurveyVars)
-	return d.updateObject(template.ProjectID, db.TemplateProps, template)
+	template.VaultsJSON = db.ObjectToJSON(template.Vaults)
+	template.ChangedPathsFilterJSON = db.ObjectToJSON(template.ChangedPathsFilter)
+	template.AllowedRolesJSON = db.ObjectToJSON(template.AllowedRoles)
+	template.NotificationTargetIDsJSON = db.ObjectToJSON(template.NotificationTargetIDs)
+	template.AdditionalRepositoryIDsJSON = db.ObjectToJSON(template.AdditionalRepositoryIDs)
+	template.AllowedWindowJSON = db.ObjectToJSON(template.AllowedWindow)
+	template.Archived = oldTemplate.Archived
+	err = d.updateObject(template.ProjectID, db.TemplateProps, template)
+	if err != nil {
+		return err
+	}
+
+	version, err := db.NewTemplateVersion(oldTemplate)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.createObject(template.ProjectID, db.TemplateVersionProps, version)
+	return err
 }
 
 func (d *BoltDb) GetTemplates(projectID int, filter db.TemplateFilter, params db.RetrieveQueryParams) (templates []db.Template, err error) {
@@ -46,6 +76,9 @@ func (d *BoltDb) GetTemplates(projectID int, filter db.TemplateFilter, params db
 				res = res && template.Autorun
 			}
 		}
+		if !filter.IncludeArchived {
+			res = res && !template.Archived
+		}
 		return res
 	}
 
@@ -60,6 +93,17 @@ func (d *BoltDb) GetTemplates(projectID int, filter db.TemplateFilter, params db
 	return
 }
 
+func (d *BoltDb) ArchiveTemplate(projectID int, templateID int) error {
+	template, err := d.getRawTemplate(projectID, templateID)
+	if err != nil {
+		return err
+	}
+
+	template.Archived = true
+
+	return d.updateObject(projectID, db.TemplateProps, template)
+}
+
 func (d *BoltDb) getRawTemplate(projectID int, templateID int) (template db.Template, err error) {
 	err = d.getObject(projectID, db.TemplateProps, intObjectID(templateID), &template)
 	return
@@ -107,15 +151,103 @@ func (d *BoltDb) deleteTemplate(projectID int, templateID int, tx *bbolt.Tx) (er
 		}
 	}
 
+	err = d.deleteTemplateVersions(projectID, templateID, tx)
+	if err != nil {
+		return
+	}
+
 	return d.deleteObject(projectID, db.TemplateProps, intObjectID(templateID), tx)
 }
 
+// deleteTemplateVersions removes history of the template.
+func (d *BoltDb) deleteTemplateVersions(projectID int, templateID int, tx *bbolt.Tx) error {
+	b := tx.Bucket(makeBucketId(db.TemplateVersionProps, projectID))
+	if b == nil {
+		return nil
+	}
+
+	var keys [][]byte
+
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var version db.TemplateVersion
+		err := unmarshalObject(v, &version)
+		if err != nil {
+			return err
+		}
+		if version.TemplateID == templateID {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		err := b.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *BoltDb) GetTemplateVersions(projectID int, templateID int) (versions []db.TemplateVersion, err error) {
+	err = d.getObjects(projectID, db.TemplateVersionProps, db.RetrieveQueryParams{}, func(i interface{}) bool {
+		return i.(db.TemplateVersion).TemplateID == templateID
+	}, &versions)
+
+	if err != nil {
+		return
+	}
+
+	err = db.FillTemplateVersions(versions)
+	return
+}
+
+func (d *BoltDb) GetTemplateVersion(projectID int, templateID int, versionID int) (version db.TemplateVersion, err error) {
+	err = d.getObject(projectID, db.TemplateVersionProps, intObjectID(versionID), &version)
+	if err != nil {
+		return
+	}
+
+	if version.TemplateID != templateID {
+		err = db.ErrNotFound
+		return
+	}
+
+	err = version.FillTemplate()
+	return
+}
+
+func (d *BoltDb) RollbackTemplate(projectID int, templateID int, versionID int) error {
+	return db.RollbackTemplate(d, projectID, templateID, versionID)
+}
+
 func (d *BoltDb) DeleteTemplate(projectID int, templateID int) error {
 	return d.db.Update(func(tx *bbolt.Tx) error {
 		return d.deleteTemplate(projectID, templateID, tx)
 	})
 }
 
-func (d *BoltDb) GetTemplateRefs(projectID int, templateID int) (db.ObjectReferrers, error) {
-	return d.getObjectRefs(projectID, db.TemplateProps, templateID)
+func (d *BoltDb) GetTemplateRefs(projectID int, templateID int) (refs db.ObjectReferrers, err error) {
+	refs, err = d.getObjectRefs(projectID, db.TemplateProps, templateID)
+	if err != nil {
+		return
+	}
+
+	// schedules refer to the template itself, they are reported separately
+	templates := make([]db.ObjectReferrer, 0, len(refs.Templates))
+	for _, tpl := range refs.Templates {
+		if tpl.ID != templateID {
+			templates = append(templates, tpl)
+		}
+	}
+	refs.Templates = templates
+
+	schedules, err := d.GetTemplateSchedules(projectID, templateID)
+	if err != nil {
+		return
+	}
+
+	refs.Schedules = db.GetScheduleReferrers(schedules)
+	return
 }
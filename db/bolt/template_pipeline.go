@@ -0,0 +1,50 @@
+package bolt
+
+import "github.com/ansible-semaphore/semaphore/db"
+
+func (d *BoltDb) GetTemplatePipelines(projectID int) (pipelines []db.TemplatePipeline, err error) {
+	err = d.getObjects(projectID, db.TemplatePipelineProps, db.RetrieveQueryParams{}, nil, &pipelines)
+	if err != nil {
+		return
+	}
+
+	err = db.FillTemplatePipelines(pipelines)
+	return
+}
+
+func (d *BoltDb) GetTemplatePipeline(projectID int, pipelineID int) (pipeline db.TemplatePipeline, err error) {
+	err = d.getObject(projectID, db.TemplatePipelineProps, intObjectID(pipelineID), &pipeline)
+	if err != nil {
+		return
+	}
+
+	err = pipeline.FillStages()
+	return
+}
+
+func (d *BoltDb) CreateTemplatePipeline(pipeline db.TemplatePipeline) (db.TemplatePipeline, error) {
+	err := pipeline.SerializeStages()
+	if err != nil {
+		return db.TemplatePipeline{}, err
+	}
+
+	newPipeline, err := d.createObject(pipeline.ProjectID, db.TemplatePipelineProps, pipeline)
+	if err != nil {
+		return db.TemplatePipeline{}, err
+	}
+
+	return newPipeline.(db.TemplatePipeline), nil
+}
+
+func (d *BoltDb) UpdateTemplatePipeline(pipeline db.TemplatePipeline) error {
+	err := pipeline.SerializeStages()
+	if err != nil {
+		return err
+	}
+
+	return d.updateObject(pipeline.ProjectID, db.TemplatePipelineProps, pipeline)
+}
+
+func (d *BoltDb) DeleteTemplatePipeline(projectID int, pipelineID int) error {
+	return d.deleteObject(projectID, db.TemplatePipelineProps, intObjectID(pipelineID), nil)
+}
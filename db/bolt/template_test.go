@@ -0,0 +1,430 @@
+package bolt
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+func TestGetAccessibleTemplates(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := store.CreateUser(db.UserWithPwd{
+		Pwd: "123456",
+		User: db.User{
+			Email:    "runner@example.com",
+			Name:     "Runner",
+			Username: "runner",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := store.CreateUser(db.UserWithPwd{
+		Pwd: "123456",
+		User: db.User{
+			Email:    "manager@example.com",
+			Name:     "Manager",
+			Username: "manager",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pu := range []db.ProjectUser{
+		{ProjectID: proj.ID, UserID: runner.ID, Role: db.ProjectTaskRunner},
+		{ProjectID: proj.ID, UserID: manager.ID, Role: db.ProjectManager},
+	} {
+		_, err = store.CreateProjectUser(pu)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Build",
+		Playbook:  "build.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateTemplate(db.Template{
+		ProjectID:    proj.ID,
+		Name:         "Deploy",
+		Playbook:     "deploy.yml",
+		AllowedRoles: []db.ProjectUserRole{db.ProjectManager},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := db.GetAccessibleTemplates(store, runner.ID, proj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templates) != 1 || templates[0].Name != "Build" {
+		t.Fatal("user without access must not get the restricted template")
+	}
+
+	templates, err = db.GetAccessibleTemplates(store, manager.ID, proj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templates) != 2 {
+		t.Fatal("user with access must get all templates")
+	}
+
+	for _, tpl := range templates {
+		if tpl.Name == "Deploy" && (len(tpl.AllowedRoles) != 1 || tpl.AllowedRoles[0] != db.ProjectManager) {
+			t.Fatal("allowed roles must be stored")
+		}
+	}
+}
+
+func TestFavoriteTemplates(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var templates []db.Template
+
+	for _, name := range []string{"Build", "Deploy"} {
+		var tpl db.Template
+		tpl, err = store.CreateTemplate(db.Template{
+			ProjectID: proj.ID,
+			Name:      name,
+			Playbook:  "test.yml",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates = append(templates, tpl)
+	}
+
+	alice, bob := 1, 2
+
+	err = store.AddFavoriteTemplate(alice, proj.ID, templates[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// adding twice does nothing
+	err = store.AddFavoriteTemplate(alice, proj.ID, templates[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.AddFavoriteTemplate(bob, proj.ID, templates[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	favorites, err := store.GetFavoriteTemplates(alice, proj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(favorites) != 1 || favorites[0].ID != templates[0].ID {
+		t.Fatal("user must get only own favorites")
+	}
+
+	err = store.RemoveFavoriteTemplate(alice, proj.ID, templates[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	favorites, err = store.GetFavoriteTemplates(alice, proj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(favorites) != 0 {
+		t.Fatal("removed favorite must not be returned")
+	}
+
+	favorites, err = store.GetFavoriteTemplates(bob, proj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(favorites) != 1 || favorites[0].ID != templates[1].ID {
+		t.Fatal("favorites of other user must not be affected")
+	}
+
+	if err = store.RemoveFavoriteTemplate(bob, proj.ID, templates[0].ID); err != db.ErrNotFound {
+		t.Fatal("removing template which is not favorite must fail")
+	}
+
+	if err = store.AddFavoriteTemplate(bob, proj.ID+1, templates[0].ID); err == nil {
+		t.Fatal("template of other project can not be favorite")
+	}
+}
+
+func TestRollbackTemplate(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID:          proj.ID,
+		Name:               "Deploy",
+		Playbook:           "deploy.yml",
+		ChangedPathsFilter: []string{"roles/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := store.GetTemplateVersions(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Fatal("new template must not have versions")
+	}
+
+	changed := tpl
+	changed.Name = "Deploy to production"
+	changed.Playbook = "production.yml"
+	changed.ChangedPathsFilter = nil
+
+	err = store.UpdateTemplate(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err = store.GetTemplateVersions(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Template.Name != "Deploy" {
+		t.Fatal("update must save the previous state of the template")
+	}
+
+	err = store.RollbackTemplate(proj.ID, tpl.ID, versions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := store.GetTemplate(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Name != "Deploy" || restored.Playbook != "deploy.yml" {
+		t.Fatal("rollback must restore previous field values")
+	}
+
+	if len(restored.ChangedPathsFilter) != 1 || restored.ChangedPathsFilter[0] != "roles/" {
+		t.Fatal("rollback must restore serialized fields")
+	}
+
+	versions, err = store.GetTemplateVersions(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Template.Name != "Deploy to production" {
+		t.Fatal("rollback must save the state before the rollback as the most recent version")
+	}
+
+	other, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Other",
+		Playbook:  "other.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.RollbackTemplate(proj.ID, other.ID, versions[0].ID); err != db.ErrNotFound {
+		t.Fatal("version of another template must not be applied")
+	}
+
+	err = store.DeleteTemplate(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err = store.GetTemplateVersions(proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Fatal("versions must be deleted with the template")
+	}
+}
+
+func TestArchiveTemplate(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var templates []db.Template
+
+	for _, name := range []string{"Build", "Deploy"} {
+		var tpl db.Template
+		tpl, err = store.CreateTemplate(db.Template{
+			ProjectID: proj.ID,
+			Name:      name,
+			Playbook:  "test.yml",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		templates = append(templates, tpl)
+	}
+
+	archived := templates[1]
+
+	if err = store.ArchiveTemplate(proj.ID, archived.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := store.GetTemplates(proj.ID, db.TemplateFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 1 || listed[0].ID != templates[0].ID {
+		t.Fatal("archived template must not be listed by default")
+	}
+
+	listed, err = store.GetTemplates(proj.ID, db.TemplateFilter{IncludeArchived: true}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 2 {
+		t.Fatal("archived template must be listed if it is requested")
+	}
+
+	// the flag is kept by updates of other fields
+	archived.Name = "Deploy to production"
+	if err = store.UpdateTemplate(archived); err != nil {
+		t.Fatal(err)
+	}
+
+	archived, err = store.GetTemplate(proj.ID, archived.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !archived.Archived || archived.Name != "Deploy to production" {
+		t.Fatal("template must stay archived after update")
+	}
+
+	_, err = store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: archived.ID,
+		CronFormat: "* * * * *",
+	})
+	if err != db.ErrInvalidOperation {
+		t.Fatalf("archived template must not be schedulable, got %v", err)
+	}
+
+	if err = store.ArchiveTemplate(proj.ID, 1000); err != db.ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestGetTemplateVariableSchema(t *testing.T) {
+	store := CreateTestStore()
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envVars := `{"APP_ENV": "prod"}`
+
+	env, err := store.CreateEnvironment(db.Environment{
+		ProjectID: proj.ID,
+		Name:      "Prod",
+		JSON:      `{"replicas": 3, "version": "1.2", "debug": false}`,
+		ENV:       &envVars,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID:     proj.ID,
+		Name:          "Deploy",
+		Playbook:      "deploy.yml",
+		EnvironmentID: &env.ID,
+		SurveyVars: []db.SurveyVar{
+			{Name: "version", Title: "Version", Required: true},
+			{Name: "timeout", Title: "Timeout", Type: db.SurveyVarType(db.SurveyVarInt)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := db.GetTemplateVariableSchema(store, proj.ID, tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name     string
+		varType  db.VarSchemaType
+		required bool
+		source   db.VarSchemaSource
+	}{
+		{"version", db.VarSchemaString, true, db.VarSchemaSourceSurvey},
+		{"timeout", db.VarSchemaInt, false, db.VarSchemaSourceSurvey},
+		{"debug", db.VarSchemaBool, false, db.VarSchemaSourceEnvironment},
+		{"replicas", db.VarSchemaInt, false, db.VarSchemaSourceEnvironment},
+	}
+
+	if len(schema.Variables) != len(expected) {
+		t.Fatal("schema must contain survey and environment variables without duplicates")
+	}
+
+	for i, e := range expected {
+		v := schema.Variables[i]
+		if v.Name != e.name || v.Type != e.varType || v.Required != e.required || v.Source != e.source {
+			t.Fatal("invalid variable " + v.Name + " at position " + strconv.Itoa(i))
+		}
+	}
+
+	if schema.Variables[0].Title != "Version" || schema.Variables[0].Default != "1.2" {
+		t.Fatal("survey variable must keep its title and take the default from the environment")
+	}
+
+	if schema.Variables[1].Default != nil {
+		t.Fatal("survey variable which the environment doesn't set must not have a default")
+	}
+
+	if len(schema.EnvironmentVariables) != 1 || schema.EnvironmentVariables[0].Name != "APP_ENV" ||
+		schema.EnvironmentVariables[0].Default != "prod" {
+		t.Fatal("schema must contain environment variables of the task process")
+	}
+
+	_, err = db.GetTemplateVariableSchema(store, proj.ID, tpl.ID+1)
+	if err != db.ErrNotFound {
+		t.Fatal("schema of missing template must not be found")
+	}
+}
@@ -3,6 +3,7 @@ package bolt
 import (
 	"fmt"
 	"github.com/ansible-semaphore/semaphore/db"
+	"go.etcd.io/bbolt"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
@@ -76,7 +77,7 @@ func (d *BoltDb) CreateUser(user db.UserWithPwd) (newUser db.User, err error) {
 }
 
 func (d *BoltDb) DeleteUser(userID int) error {
-	projects, err := d.GetProjects(userID)
+	projects, err := d.GetProjects(userID, db.ProjectFilter{IncludeArchived: true})
 	if err != nil {
 		return err
 	}
@@ -90,6 +91,85 @@ func (d *BoltDb) DeleteUser(userID int) error {
 	return d.deleteObject(0, db.UserProps, intObjectID(userID), nil)
 }
 
+func (d *BoltDb) DeleteUserReassigning(userID int, reassignToUserID int, reassignProjects bool) error {
+	err := db.ValidateUserReassignment(userID, reassignToUserID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = d.GetUser(userID); err != nil {
+		return err
+	}
+
+	if _, err = d.GetUser(reassignToUserID); err != nil {
+		return err
+	}
+
+	projects, err := d.GetProjects(userID, db.ProjectFilter{IncludeArchived: true})
+	if err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		var tasks []db.Task
+		err := d.getObjectsTx(tx, 0, db.TaskProps, db.RetrieveQueryParams{}, func(tsk interface{}) bool {
+			task := tsk.(db.Task)
+			return task.UserID != nil && *task.UserID == userID
+		}, &tasks)
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			task.UserID = &reassignToUserID
+			if err = d.updateObjectTx(tx, 0, db.TaskProps, task); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range projects {
+			b := tx.Bucket(makeBucketId(db.ProjectUserProps, p.ID))
+			if b == nil {
+				continue
+			}
+
+			data := b.Get(intObjectID(userID).ToBytes())
+			if data == nil {
+				continue
+			}
+
+			if reassignProjects && b.Get(intObjectID(reassignToUserID).ToBytes()) == nil {
+				var projectUser db.ProjectUser
+				if err = unmarshalObject(data, &projectUser); err != nil {
+					return err
+				}
+
+				projectUser.UserID = reassignToUserID
+
+				str, err := marshalObject(projectUser)
+				if err != nil {
+					return err
+				}
+
+				if err = b.Put(intObjectID(reassignToUserID).ToBytes(), str); err != nil {
+					return err
+				}
+			}
+
+			if err = b.Delete(intObjectID(userID).ToBytes()); err != nil {
+				return err
+			}
+		}
+
+		b := tx.Bucket(makeBucketId(db.UserProps, 0))
+		if b == nil {
+			return db.ErrNotFound
+		}
+
+		return b.Delete(intObjectID(userID).ToBytes())
+	})
+}
+
 func (d *BoltDb) UpdateUser(user db.UserWithPwd) error {
 	var password string
 
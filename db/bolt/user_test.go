@@ -109,3 +109,107 @@ func TestGetUser(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 }
+
+func TestDeleteUserReassigning(t *testing.T) {
+	store := CreateTestStore()
+
+	usr1, err := store.CreateUser(db.UserWithPwd{
+		Pwd: "123456",
+		User: db.User{
+			Email:    "user1@example.com",
+			Name:     "User 1",
+			Username: "user1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	usr2, err := store.CreateUser(db.UserWithPwd{
+		Pwd: "123456",
+		User: db.User{
+			Email:    "user2@example.com",
+			Name:     "User 2",
+			Username: "user2",
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	proj1, err := store.CreateProject(db.Project{Created: time.Now(), Name: "Test1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	proj2, err := store.CreateProject(db.Project{Created: time.Now(), Name: "Test2"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, pu := range []db.ProjectUser{
+		{ProjectID: proj1.ID, UserID: usr1.ID, Role: db.ProjectOwner},
+		{ProjectID: proj2.ID, UserID: usr1.ID, Role: db.ProjectManager},
+		{ProjectID: proj2.ID, UserID: usr2.ID, Role: db.ProjectGuest},
+	} {
+		if _, err = store.CreateProjectUser(pu); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	task1, err := store.CreateTask(db.Task{ProjectID: proj1.ID, UserID: &usr1.ID})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	task2, err := store.CreateTask(db.Task{ProjectID: proj2.ID, UserID: &usr1.ID})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err = store.DeleteUserReassigning(usr1.ID, usr1.ID, true); err == nil {
+		t.Fatal("tasks must not be reassigned to the deleted user")
+	}
+
+	if err = store.DeleteUserReassigning(usr1.ID, usr2.ID+100, true); err != db.ErrNotFound {
+		t.Fatal("reassignment target must exist")
+	}
+
+	if err = store.DeleteUserReassigning(usr1.ID, usr2.ID, true); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err = store.GetUser(usr1.ID); err != db.ErrNotFound {
+		t.Fatal("user must be deleted")
+	}
+
+	for _, tsk := range []db.Task{task1, task2} {
+		task, err := store.GetTask(tsk.ProjectID, tsk.ID)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if task.UserID == nil || *task.UserID != usr2.ID {
+			t.Fatal("task must be reassigned")
+		}
+	}
+
+	pu, err := store.GetProjectUser(proj1.ID, usr2.ID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if pu.Role != db.ProjectOwner {
+		t.Fatal("membership must be reassigned with the deleted user's role")
+	}
+
+	pu, err = store.GetProjectUser(proj2.ID, usr2.ID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if pu.Role != db.ProjectGuest {
+		t.Fatal("existing membership must be kept")
+	}
+
+	if _, err = store.GetProjectUser(proj1.ID, usr1.ID); err != db.ErrNotFound {
+		t.Fatal("membership of the deleted user must be removed")
+	}
+}
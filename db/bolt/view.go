@@ -1,6 +1,9 @@
 package bolt
 
-import "github.com/ansible-semaphore/semaphore/db"
+import (
+	"github.com/ansible-semaphore/semaphore/db"
+	"go.etcd.io/bbolt"
+)
 
 func (d *BoltDb) GetView(projectID int, viewID int) (view db.View, err error) {
 	err = d.getObject(projectID, db.ViewProps, intObjectID(viewID), &view)
@@ -39,3 +42,26 @@ func (d *BoltDb) SetViewPositions(projectID int, positions map[int]int) error {
 	}
 	return nil
 }
+
+func (d *BoltDb) MoveView(projectID int, viewID int, position int) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		var views []db.View
+		err := d.getObjectsTx(tx, projectID, db.ViewProps, db.RetrieveQueryParams{}, nil, &views)
+		if err != nil {
+			return err
+		}
+
+		changed, err := db.ReorderViews(views, viewID, position)
+		if err != nil {
+			return err
+		}
+
+		for _, view := range changed {
+			if err = d.updateObjectTx(tx, projectID, db.ViewProps, view); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
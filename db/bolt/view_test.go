@@ -127,3 +127,82 @@ func TestSetViewPositions(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestMoveView(t *testing.T) {
+	store := CreateTestStore()
+
+	proj1, err := store.CreateProject(db.Project{
+		Created: time.Now(),
+		Name:    "Test1",
+	})
+
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var views []db.View
+
+	// positions with gaps are renumbered by the first move
+	for i, title := range []string{"A", "B", "C", "D"} {
+		var view db.View
+		view, err = store.CreateView(db.View{
+			ProjectID: proj1.ID,
+			Title:     title,
+			Position:  i * 2,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		views = append(views, view)
+	}
+
+	getOrder := func() string {
+		found, err2 := store.GetViews(proj1.ID)
+		if err2 != nil {
+			t.Fatal(err2.Error())
+		}
+
+		sort.Slice(found, func(i, j int) bool {
+			return found[i].Position < found[j].Position
+		})
+
+		order := ""
+		for i, view := range found {
+			if view.Position != i {
+				t.Fatal("positions must be contiguous and unique")
+			}
+			order += view.Title
+		}
+		return order
+	}
+
+	// move up
+	if err = store.MoveView(proj1.ID, views[3].ID, 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if order := getOrder(); order != "ADBC" {
+		t.Fatal("invalid order after moving view up: " + order)
+	}
+
+	// move down
+	if err = store.MoveView(proj1.ID, views[0].ID, 3); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if order := getOrder(); order != "DBCA" {
+		t.Fatal("invalid order after moving view down: " + order)
+	}
+
+	if _, ok := store.MoveView(proj1.ID, views[0].ID, 4).(*db.ValidationError); !ok {
+		t.Fatal("position out of range must be rejected")
+	}
+
+	if err = store.MoveView(proj1.ID, views[0].ID+10, 0); err != db.ErrNotFound {
+		t.Fatal("moving missing view must fail")
+	}
+
+	if order := getOrder(); order != "DBCA" {
+		t.Fatal("failed moves must not change positions")
+	}
+}
@@ -16,7 +16,9 @@ func CreateStore() db.Store {
 	case util.DbDriverMySQL:
 		return &sql.SqlDb{}
 	case util.DbDriverBolt:
-		return &bolt.BoltDb{}
+		return &bolt.BoltDb{
+			IdleTimeout: bolt.DefaultIdleTimeout,
+		}
 	case util.DbDriverPostgres:
 		return &sql.SqlDb{}
 	default:
@@ -15,10 +15,15 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type SqlDb struct {
 	sql *gorp.DbMap
+
+	// taskOutputLock serializes inserts of task output records
+	// to keep their sequence numbers unique.
+	taskOutputLock sync.Mutex
 }
 
 var initialSQL = `
@@ -259,6 +264,36 @@ func (d *SqlDb) deleteObject(projectID int, props db.ObjectProps, objectID int)
 	}
 }
 
+// detachAndDeleteObject clears references to the object in project templates
+// and deletes the object in a single transaction.
+func (d *SqlDb) detachAndDeleteObject(projectID int, props db.ObjectProps, objectID int) error {
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		d.PrepareQuery("update project__template set "+props.ReferringColumnSuffix+"=null where project_id=? and "+props.ReferringColumnSuffix+"=?"),
+		projectID,
+		objectID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return err
+	}
+
+	res, err := tx.Exec(
+		d.PrepareQuery("delete from "+props.TableName+" where project_id=? and id=?"),
+		projectID,
+		objectID)
+	err = validateMutationResult(res, err)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (d *SqlDb) Close(token string) {
 	err := d.sql.Db.Close()
 	if err != nil {
@@ -349,6 +384,8 @@ func getSqlForTable(tableName string, p db.RetrieveQueryParams) (string, []inter
 }
 
 func (d *SqlDb) getObjectRefs(projectID int, objectProps db.ObjectProps, objectID int) (refs db.ObjectReferrers, err error) {
+	refs.Schedules = make([]db.ObjectReferrer, 0)
+
 	refs.Templates, err = d.getObjectRefsFrom(projectID, objectProps, objectID, db.TemplateProps)
 	if err != nil {
 		return
@@ -3,10 +3,45 @@ package sql
 import (
 	"database/sql"
 	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/masterminds/squirrel"
 )
 
 func (d *SqlDb) GetAccessKey(projectID int, accessKeyID int) (key db.AccessKey, err error) {
 	err = d.getObject(projectID, db.AccessKeyProps, accessKeyID, &key)
+	if err == db.ErrNotFound {
+		return d.GetGlobalAccessKey(accessKeyID)
+	}
+
+	return
+}
+
+func (d *SqlDb) GetGlobalAccessKey(accessKeyID int) (key db.AccessKey, err error) {
+	err = d.getObject(0, db.GlobalAccessKeyProps, accessKeyID, &key)
+	return
+}
+
+func (d *SqlDb) GetGlobalAccessKeys(params db.RetrieveQueryParams) ([]db.AccessKey, error) {
+	var keys []db.AccessKey
+	err := d.getObjects(0, db.GlobalAccessKeyProps, params, &keys)
+	return keys, err
+}
+
+func (d *SqlDb) GetAccessKeyMeta(projectID int, accessKeyID int) (key db.AccessKey, err error) {
+	query, args, err := squirrel.Select("id, name, type, project_id").
+		From("access_key").
+		Where("id=?", accessKeyID).
+		Where("project_id=?", projectID).
+		ToSql()
+
+	if err != nil {
+		return
+	}
+
+	err = d.selectOne(&key, query, args...)
+
+	if err == sql.ErrNoRows {
+		err = db.ErrNotFound
+	}
 
 	return
 }
@@ -49,8 +84,12 @@ func (d *SqlDb) UpdateAccessKey(key db.AccessKey) error {
 	query += " where id=?"
 	args = append(args, key.ID)
 
-	query += " and project_id=?"
-	args = append(args, key.ProjectID)
+	if key.ProjectID == nil {
+		query += " and project_id is null"
+	} else {
+		query += " and project_id=?"
+		args = append(args, key.ProjectID)
+	}
 
 	res, err = d.exec(query, args...)
 
@@ -84,7 +123,45 @@ func (d *SqlDb) DeleteAccessKey(projectID int, accessKeyID int) error {
 	return d.deleteObject(projectID, db.AccessKeyProps, accessKeyID)
 }
 
+func (d *SqlDb) DeleteGlobalAccessKey(accessKeyID int) error {
+	return validateMutationResult(
+		d.exec("delete from access_key where id=? and project_id is null", accessKeyID))
+}
+
+// RekeyAccessKeys encrypts secrets of project and global keys by the current encryption key.
 func (d *SqlDb) RekeyAccessKeys(oldKey string) error {
+	var keys []db.AccessKey
+	_, err := d.selectAll(&keys, "select * from access_key")
+	if err != nil {
+		return err
+	}
+
+	for i := range keys {
+		key := &keys[i]
+
+		err = key.DeserializeSecret2(oldKey)
+		if err != nil {
+			return err
+		}
+
+		err = key.SerializeSecret()
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		_, err = tx.Exec(d.PrepareQuery("update access_key set secret=? where id=?"), key.Secret, key.ID)
+		if err != nil {
+			handleRollbackError(tx.Rollback())
+			return err
+		}
+	}
 
-	return nil
+	return tx.Commit()
 }
@@ -28,10 +28,12 @@ func (d *SqlDb) UpdateEnvironment(env db.Environment) error {
 	}
 
 	_, err = d.exec(
-		"update project__environment set name=?, json=?, env=? where id=?",
+		"update project__environment set name=?, json=?, env=?, file_secrets=?, command_secrets=? where id=?",
 		env.Name,
 		env.JSON,
 		env.ENV,
+		env.FileSecrets,
+		env.CommandSecrets,
 		env.ID)
 	return err
 }
@@ -45,12 +47,14 @@ func (d *SqlDb) CreateEnvironment(env db.Environment) (newEnv db.Environment, er
 
 	insertID, err := d.insert(
 		"id",
-		"insert into project__environment (project_id, name, json, env, password) values (?, ?, ?, ?, ?)",
+		"insert into project__environment (project_id, name, json, env, password, file_secrets, command_secrets) values (?, ?, ?, ?, ?, ?, ?)",
 		env.ProjectID,
 		env.Name,
 		env.JSON,
 		env.ENV,
-		env.Password)
+		env.Password,
+		env.FileSecrets,
+		env.CommandSecrets)
 
 	if err != nil {
 		return
@@ -64,3 +68,54 @@ func (d *SqlDb) CreateEnvironment(env db.Environment) (newEnv db.Environment, er
 func (d *SqlDb) DeleteEnvironment(projectID int, environmentID int) error {
 	return d.deleteObject(projectID, db.EnvironmentProps, environmentID)
 }
+
+func (d *SqlDb) DeleteEnvironmentCascade(projectID int, environmentID int) error {
+	return d.detachAndDeleteObject(projectID, db.EnvironmentProps, environmentID)
+}
+
+func (d *SqlDb) UpdateEnvironmentVariableAcrossProject(projectID int, oldKey string, newKey string) (count int, err error) {
+	err = db.ValidateVariableRename(oldKey, newKey)
+	if err != nil {
+		return
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return
+	}
+
+	var environments []db.Environment
+	_, err = tx.Select(&environments, d.PrepareQuery("select * from project__environment where project_id=?"), projectID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return
+	}
+
+	for _, env := range environments {
+		var changed bool
+		changed, err = env.RenameVariable(oldKey, newKey)
+		if err != nil {
+			handleRollbackError(tx.Rollback())
+			return 0, err
+		}
+
+		if !changed {
+			continue
+		}
+
+		_, err = tx.Exec(d.PrepareQuery("update project__environment set json=? where id=?"), env.JSON, env.ID)
+		if err != nil {
+			handleRollbackError(tx.Rollback())
+			return 0, err
+		}
+
+		count++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		count = 0
+	}
+
+	return
+}
@@ -33,13 +33,14 @@ func (d *SqlDb) CreateEvent(evt db.Event) (newEvent db.Event, err error) {
 	var created = time.Now()
 
 	_, err = d.exec(
-		"insert into event(user_id, project_id, object_id, object_type, description, created) values (?, ?, ?, ?, ?, ?)",
+		"insert into event(user_id, project_id, object_id, object_type, description, created, correlation_id) values (?, ?, ?, ?, ?, ?, ?)",
 		evt.UserID,
 		evt.ProjectID,
 		evt.ObjectID,
 		evt.ObjectType,
 		evt.Description,
-		created)
+		created,
+		evt.CorrelationID)
 
 	if err != nil {
 		return
@@ -70,3 +71,13 @@ func (d *SqlDb) GetEvents(projectID int, params db.RetrieveQueryParams) ([]db.Ev
 
 	return d.getEvents(q, params)
 }
+
+func (d *SqlDb) GetTaskEvents(projectID int, taskID int) ([]db.Event, error) {
+	q := squirrel.Select("event.*, p.name as project_name").
+		From("event").
+		LeftJoin("project as p on event.project_id=p.id").
+		OrderBy("created asc", "id asc").
+		Where("event.project_id=? and event.correlation_id=?", projectID, *db.TaskCorrelationID(taskID))
+
+	return d.getEvents(q, db.RetrieveQueryParams{})
+}
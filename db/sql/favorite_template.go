@@ -0,0 +1,72 @@
+package sql
+
+import "github.com/ansible-semaphore/semaphore/db"
+
+func (d *SqlDb) AddFavoriteTemplate(userID int, projectID int, templateID int) error {
+	_, err := d.GetTemplate(projectID, templateID)
+	if err != nil {
+		return err
+	}
+
+	exists, err := d.sql.SelectInt(
+		d.PrepareQuery("select count(1) from user__favorite_template where user_id=? and template_id=?"),
+		userID,
+		templateID)
+
+	if err != nil || exists > 0 {
+		return err
+	}
+
+	_, err = d.exec(
+		"insert into user__favorite_template (user_id, project_id, template_id) values (?, ?, ?)",
+		userID,
+		projectID,
+		templateID)
+
+	return err
+}
+
+func (d *SqlDb) RemoveFavoriteTemplate(userID int, projectID int, templateID int) error {
+	res, err := d.exec(
+		"delete from user__favorite_template where user_id=? and project_id=? and template_id=?",
+		userID,
+		projectID,
+		templateID)
+
+	return validateMutationResult(res, err)
+}
+
+func (d *SqlDb) GetFavoriteTemplates(userID int, projectID int) (templates []db.Template, err error) {
+	var favorites []db.FavoriteTemplate
+
+	_, err = d.selectAll(&favorites,
+		"select * from user__favorite_template where user_id=? and project_id=?",
+		userID,
+		projectID)
+
+	if err != nil {
+		return
+	}
+
+	templates = make([]db.Template, 0)
+
+	for _, favorite := range favorites {
+		var tpl db.Template
+
+		tpl, err = d.GetTemplate(projectID, favorite.TemplateID)
+
+		if err == db.ErrNotFound {
+			// template was deleted
+			err = nil
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		templates = append(templates, tpl)
+	}
+
+	return
+}
@@ -26,14 +26,20 @@ func (d *SqlDb) DeleteInventory(projectID int, inventoryID int) error {
 	return d.deleteObject(projectID, db.InventoryProps, inventoryID)
 }
 
+func (d *SqlDb) DeleteInventoryCascade(projectID int, inventoryID int) error {
+	return d.detachAndDeleteObject(projectID, db.InventoryProps, inventoryID)
+}
+
 func (d *SqlDb) UpdateInventory(inventory db.Inventory) error {
 	_, err := d.exec(
-		"update project__inventory set name=?, type=?, ssh_key_id=?, inventory=?, become_key_id=? where id=?",
+		"update project__inventory set name=?, type=?, ssh_key_id=?, inventory=?, become_key_id=?, become_password_file=?, auth_key_id=? where id=?",
 		inventory.Name,
 		inventory.Type,
 		inventory.SSHKeyID,
 		inventory.Inventory,
 		inventory.BecomeKeyID,
+		inventory.BecomePasswordFile,
+		inventory.AuthKeyID,
 		inventory.ID)
 
 	return err
@@ -42,13 +48,15 @@ func (d *SqlDb) UpdateInventory(inventory db.Inventory) error {
 func (d *SqlDb) CreateInventory(inventory db.Inventory) (newInventory db.Inventory, err error) {
 	insertID, err := d.insert(
 		"id",
-		"insert into project__inventory (project_id, name, type, ssh_key_id, inventory, become_key_id) values (?, ?, ?, ?, ?, ?)",
+		"insert into project__inventory (project_id, name, type, ssh_key_id, inventory, become_key_id, become_password_file, auth_key_id) values (?, ?, ?, ?, ?, ?, ?, ?)",
 		inventory.ProjectID,
 		inventory.Name,
 		inventory.Type,
 		inventory.SSHKeyID,
 		inventory.Inventory,
-		inventory.BecomeKeyID)
+		inventory.BecomeKeyID,
+		inventory.BecomePasswordFile,
+		inventory.AuthKeyID)
 
 	if err != nil {
 		return
@@ -0,0 +1 @@
+alter table `task` add `scheduled_at` datetime null;
@@ -0,0 +1 @@
+alter table `project__environment` add `file_secrets` text null;
@@ -0,0 +1 @@
+alter table `project__template` add `json_events` boolean not null default false;
@@ -0,0 +1 @@
+alter table `project__template` add `disabled` boolean not null default false;
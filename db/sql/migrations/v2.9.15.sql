@@ -0,0 +1 @@
+alter table `project` add `archived` boolean not null default false;
@@ -0,0 +1 @@
+alter table `project__template` change `inventory_id` `inventory_id` int;
@@ -0,0 +1,3 @@
+alter table `task__output` add `seq` int not null default 0;
+
+update `task__output` set `seq` = `id`;
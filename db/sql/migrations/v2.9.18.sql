@@ -0,0 +1,3 @@
+alter table `project__template` add `pre_hook` text;
+
+alter table `project__template` add `post_hook` text;
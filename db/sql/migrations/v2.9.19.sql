@@ -0,0 +1,5 @@
+alter table `project__template` add `approval_required` boolean not null default false;
+
+alter table `task` add `approval_status` varchar(20) not null default '';
+
+alter table `task` add `approved_by` int null;
@@ -0,0 +1 @@
+alter table `project__template` add `runner_tag` varchar(50) null;
@@ -0,0 +1 @@
+alter table `project__template` add `changed_paths_filter` text null;
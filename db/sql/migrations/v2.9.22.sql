@@ -0,0 +1 @@
+alter table `task__output` add `level` varchar(20) not null default 'info';
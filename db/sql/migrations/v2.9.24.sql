@@ -0,0 +1 @@
+alter table `project__inventory` add `auth_key_id` int references access_key(`id`);
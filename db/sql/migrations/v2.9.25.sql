@@ -0,0 +1,2 @@
+alter table `task` add `verbosity` int not null default 0;
+alter table `project__template` add `verbosity` int not null default 0;
@@ -0,0 +1,11 @@
+create table `project__notification_target` (
+    `id` integer primary key autoincrement,
+    `project_id` int not null,
+    `name` varchar(100) not null,
+    `type` varchar(20) not null,
+    `url` text not null,
+    `project_default` boolean not null default false,
+    foreign key (`project_id`) references project(`id`) on delete cascade
+);
+
+alter table `project__template` add `notification_target_ids` text null;
@@ -0,0 +1 @@
+alter table `project__template` add `additional_repository_ids` text null;
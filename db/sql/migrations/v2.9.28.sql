@@ -0,0 +1 @@
+alter table `project__template` add `galaxy_requirements` varchar(255) null;
@@ -0,0 +1 @@
+alter table `project__template` add `working_dir` varchar(255) null;
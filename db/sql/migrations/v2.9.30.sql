@@ -0,0 +1 @@
+alter table `project` add `task_output_retention_days` int not null default 0;
@@ -0,0 +1,9 @@
+create table `user__favorite_template` (
+    `user_id` int not null,
+    `project_id` int not null,
+    `template_id` int not null,
+    primary key (`user_id`, `template_id`),
+    foreign key (`user_id`) references `user`(`id`) on delete cascade,
+    foreign key (`project_id`) references project(`id`) on delete cascade,
+    foreign key (`template_id`) references project__template(`id`) on delete cascade
+);
@@ -0,0 +1 @@
+alter table `project__template` add `allowed_window` text null;
@@ -0,0 +1 @@
+alter table `project__template` add `syntax_check` boolean not null default false;
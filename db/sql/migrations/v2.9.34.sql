@@ -0,0 +1 @@
+alter table `task` add `schedule_id` int null;
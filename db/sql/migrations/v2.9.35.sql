@@ -0,0 +1 @@
+alter table `event` add `correlation_id` varchar(255) null;
@@ -0,0 +1 @@
+alter table runner add fingerprint varchar(255) not null default '';
@@ -0,0 +1,11 @@
+create table project__template_version
+(
+    id           integer primary key autoincrement,
+    project_id   int not null,
+    template_id  int not null,
+    created      datetime not null,
+    template     text not null,
+
+    foreign key (`project_id`) references project(`id`) on delete cascade,
+    foreign key (`template_id`) references project__template(`id`) on delete cascade
+);
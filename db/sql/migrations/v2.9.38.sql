@@ -0,0 +1 @@
+alter table `task` add `display_tags` text null;
@@ -0,0 +1,12 @@
+create table project__template_pipeline
+(
+    id           integer primary key autoincrement,
+    project_id   int not null,
+    name         varchar(100) not null,
+    stages       text not null,
+
+    foreign key (`project_id`) references project(`id`) on delete cascade
+);
+
+alter table `task` add `pipeline_id` int null;
+alter table `task` add `pipeline_stage` int null;
@@ -0,0 +1 @@
+alter table `task` add `priority` int not null default 0;
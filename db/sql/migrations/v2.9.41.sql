@@ -0,0 +1 @@
+alter table `project__schedule` add `concurrency_mode` varchar(10) not null default '';
@@ -0,0 +1 @@
+alter table `task` add `failure_reason` varchar(20) not null default '';
@@ -0,0 +1 @@
+alter table `project__template` add `archived` boolean not null default false;
@@ -0,0 +1,2 @@
+alter table `task` add `inventory_snapshot` longtext;
+alter table `task` add `inventory_snapshot_type` varchar(20) not null default '';
@@ -0,0 +1 @@
+alter table `task` add `runner_id` int null;
@@ -0,0 +1 @@
+alter table `task` add `output_archived` boolean not null default false;
@@ -0,0 +1 @@
+alter table `project__notification_target` add `secret` varchar(255) not null default '';
@@ -0,0 +1 @@
+alter table `project__environment` add `command_secrets` text null;
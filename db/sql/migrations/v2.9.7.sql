@@ -0,0 +1,12 @@
+create table project__schedule_run
+(
+    id           integer primary key autoincrement,
+    project_id   int not null,
+    schedule_id  int not null,
+    task_id      int,
+    created      datetime not null,
+
+    foreign key (`project_id`) references project(`id`) on delete cascade,
+    foreign key (`schedule_id`) references project__schedule(`id`) on delete cascade,
+    foreign key (`task_id`) references task(`id`) on delete set null
+);
@@ -0,0 +1 @@
+alter table `project__inventory` add `become_password_file` boolean not null default false;
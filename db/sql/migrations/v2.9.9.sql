@@ -0,0 +1 @@
+alter table `task` add `exit_code` int;
@@ -0,0 +1,84 @@
+package sql
+
+import "github.com/ansible-semaphore/semaphore/db"
+
+func (d *SqlDb) GetNotificationTarget(projectID int, targetID int) (target db.NotificationTarget, err error) {
+	err = d.getObject(projectID, db.NotificationTargetProps, targetID, &target)
+	return
+}
+
+func (d *SqlDb) GetNotificationTargets(projectID int) (targets []db.NotificationTarget, err error) {
+	err = d.getObjects(projectID, db.NotificationTargetProps, db.RetrieveQueryParams{}, &targets)
+	return
+}
+
+func (d *SqlDb) UpdateNotificationTarget(target db.NotificationTarget) error {
+	err := target.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec(
+		"update project__notification_target set name=?, type=?, url=?, project_default=? where id=? and project_id=?",
+		target.Name,
+		target.Type,
+		target.URL,
+		target.ProjectDefault,
+		target.ID,
+		target.ProjectID)
+
+	return err
+}
+
+func (d *SqlDb) CreateNotificationTarget(target db.NotificationTarget) (newTarget db.NotificationTarget, err error) {
+	err = target.Validate()
+	if err != nil {
+		return
+	}
+
+	target.Secret = db.NewNotificationTargetSecret()
+
+	insertID, err := d.insert(
+		"id",
+		"insert into project__notification_target (project_id, name, type, url, project_default, secret) values (?, ?, ?, ?, ?, ?)",
+		target.ProjectID,
+		target.Name,
+		target.Type,
+		target.URL,
+		target.ProjectDefault,
+		target.Secret)
+
+	if err != nil {
+		return
+	}
+
+	newTarget = target
+	newTarget.ID = insertID
+	return
+}
+
+func (d *SqlDb) DeleteNotificationTarget(projectID int, targetID int) error {
+	return d.deleteObject(projectID, db.NotificationTargetProps, targetID)
+}
+
+func (d *SqlDb) RotateWebhookSecret(projectID int, webhookID int) (secret string, err error) {
+	target, err := d.GetNotificationTarget(projectID, webhookID)
+	if err != nil {
+		return
+	}
+
+	err = target.ValidateSecretRotation()
+	if err != nil {
+		return
+	}
+
+	secret = db.NewNotificationTargetSecret()
+
+	_, err = d.exec(
+		"update project__notification_target set secret=? where id=? and project_id=?",
+		secret,
+		webhookID,
+		projectID)
+
+	return
+}
@@ -23,13 +23,45 @@ func (d *SqlDb) CreateProject(project db.Project) (newProject db.Project, err er
 	return
 }
 
-func (d *SqlDb) GetProjects(userID int) (projects []db.Project, err error) {
-	query, args, err := squirrel.Select("p.*").
+func (d *SqlDb) GetProjects(userID int, filter db.ProjectFilter) (projects []db.Project, err error) {
+	q := squirrel.Select("p.*").
 		From("project as p").
 		Join("project__user as pu on pu.project_id=p.id").
-		Where("pu.user_id=?", userID).
-		OrderBy("p.name").
-		ToSql()
+		Where("pu.user_id=?", userID)
+
+	if !filter.IncludeArchived {
+		q = q.Where(squirrel.Eq{"p.archived": false})
+	}
+
+	query, args, err := q.OrderBy("p.name").ToSql()
+
+	if err != nil {
+		return
+	}
+
+	_, err = d.selectAll(&projects, query, args...)
+
+	return
+}
+
+func (d *SqlDb) GetAllProjects() (projects []db.Project, err error) {
+	_, err = d.selectAll(&projects, "select * from project order by name")
+	return
+}
+
+func (d *SqlDb) GetProjectsWithRole(userID int, filter db.ProjectFilter) (projects []db.ProjectWithRole, err error) {
+	q := squirrel.Select("p.*").
+		Column("pu.role").
+		Column("(select count(*) from project__user as m where m.project_id=p.id) as member_count").
+		From("project as p").
+		Join("project__user as pu on pu.project_id=p.id").
+		Where("pu.user_id=?", userID)
+
+	if !filter.IncludeArchived {
+		q = q.Where(squirrel.Eq{"p.archived": false})
+	}
+
+	query, args, err := q.OrderBy("p.name").ToSql()
 
 	if err != nil {
 		return
@@ -85,11 +117,18 @@ func (d *SqlDb) DeleteProject(projectID int) error {
 
 func (d *SqlDb) UpdateProject(project db.Project) error {
 	_, err := d.exec(
-		"update project set name=?, alert=?, alert_chat=?, max_parallel_tasks=? where id=?",
+		"update project set name=?, alert=?, alert_chat=?, max_parallel_tasks=?, task_output_retention_days=?, task_retention_days=? where id=?",
 		project.Name,
 		project.Alert,
 		project.AlertChat,
 		project.MaxParallelTasks,
+		project.TaskOutputRetentionDays,
+		project.TaskRetentionDays,
 		project.ID)
 	return err
 }
+
+func (d *SqlDb) SetProjectArchived(projectID int, archived bool) error {
+	_, err := d.exec("update project set archived=? where id=?", archived, projectID)
+	return err
+}
@@ -18,8 +18,24 @@ func (d *SqlDb) GetRepository(projectID int, repositoryID int) (db.Repository, e
 	return repository, err
 }
 
-func (d *SqlDb) GetRepositoryRefs(projectID int, repositoryID int) (db.ObjectReferrers, error) {
-	return d.getObjectRefs(projectID, db.RepositoryProps, repositoryID)
+func (d *SqlDb) GetRepositoryRefs(projectID int, repositoryID int) (refs db.ObjectReferrers, err error) {
+	refs, err = d.getObjectRefs(projectID, db.RepositoryProps, repositoryID)
+	if err != nil {
+		return
+	}
+
+	// schedules which poll the repository for new commits
+	var schedules []db.Schedule
+	_, err = d.selectAll(&schedules,
+		"select * from project__schedule where project_id=? and repository_id=? order by id",
+		projectID,
+		repositoryID)
+	if err != nil {
+		return
+	}
+
+	refs.Schedules = db.GetScheduleReferrers(schedules)
+	return
 }
 
 func (d *SqlDb) GetRepositories(projectID int, params db.RetrieveQueryParams) (repositories []db.Repository, err error) {
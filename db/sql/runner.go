@@ -48,11 +48,12 @@ func (d *SqlDb) CreateRunner(runner db.Runner) (newRunner db.Runner, err error)
 
 	insertID, err := d.insert(
 		"id",
-		"insert into runner (project_id, token, webhook, max_parallel_tasks) values (?, ?, ?, ?)",
+		"insert into runner (project_id, token, webhook, max_parallel_tasks, fingerprint) values (?, ?, ?, ?, ?)",
 		runner.ProjectID,
 		token,
 		runner.Webhook,
-		runner.MaxParallelTasks)
+		runner.MaxParallelTasks,
+		runner.Fingerprint)
 
 	if err != nil {
 		return
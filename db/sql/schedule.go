@@ -3,17 +3,25 @@ package sql
 import (
 	"database/sql"
 	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/masterminds/squirrel"
+	"time"
 )
 
 func (d *SqlDb) CreateSchedule(schedule db.Schedule) (newSchedule db.Schedule, err error) {
+	err = db.ValidateNewSchedule(d, schedule)
+	if err != nil {
+		return
+	}
+
 	insertID, err := d.insert(
 		"id",
-		"insert into project__schedule (project_id, template_id, cron_format, repository_id)"+
-			"values (?, ?, ?, ?)",
+		"insert into project__schedule (project_id, template_id, cron_format, repository_id, concurrency_mode)"+
+			"values (?, ?, ?, ?, ?)",
 		schedule.ProjectID,
 		schedule.TemplateID,
 		schedule.CronFormat,
-		schedule.RepositoryID)
+		schedule.RepositoryID,
+		schedule.ConcurrencyMode)
 
 	if err != nil {
 		return
@@ -36,13 +44,19 @@ func (d *SqlDb) SetScheduleLastCommitHash(projectID int, scheduleID int, lastCom
 }
 
 func (d *SqlDb) UpdateSchedule(schedule db.Schedule) error {
+	if err := db.ValidateSchedule(d, schedule); err != nil {
+		return err
+	}
+
 	_, err := d.exec("update project__schedule set "+
 		"cron_format=?, "+
 		"repository_id=?, "+
+		"concurrency_mode=?, "+
 		"last_commit_hash = NULL "+
 		"where project_id=? and id=?",
 		schedule.CronFormat,
 		schedule.RepositoryID,
+		schedule.ConcurrencyMode,
 		schedule.ProjectID,
 		schedule.ID)
 	return err
@@ -80,6 +94,40 @@ func (d *SqlDb) GetTemplateSchedules(projectID int, templateID int) (schedules [
 	return
 }
 
+func (d *SqlDb) GetProjectSchedules(projectID int, params db.RetrieveQueryParams) (schedules []db.Schedule, err error) {
+	q := squirrel.Select("ps.*, pt.name as tpl_name").
+		From("project__schedule ps").
+		LeftJoin("project__template pt ON (ps.template_id = pt.id)").
+		Where("ps.project_id=?", projectID).
+		OrderBy("ps.id")
+
+	if params.Count > 0 {
+		q = q.Limit(uint64(params.Count))
+	}
+
+	if params.Offset > 0 {
+		q = q.Offset(uint64(params.Offset))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return
+	}
+
+	schedules = make([]db.Schedule, 0)
+	_, err = d.selectAll(&schedules, query, args...)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for i := range schedules {
+		schedules[i].FillNextRun(now)
+	}
+
+	return
+}
+
 func (d *SqlDb) SetScheduleCommitHash(projectID int, scheduleID int, hash string) error {
 	_, err := d.exec("update project__schedule set last_commit_hash=? where project_id=? and id=?",
 		hash,
@@ -87,3 +135,49 @@ func (d *SqlDb) SetScheduleCommitHash(projectID int, scheduleID int, hash string
 		scheduleID)
 	return err
 }
+
+func (d *SqlDb) CreateScheduleRun(run db.ScheduleRun) (newRun db.ScheduleRun, err error) {
+	if run.Created.IsZero() {
+		run.Created = time.Now()
+	}
+
+	insertID, err := d.insert(
+		"id",
+		"insert into project__schedule_run (project_id, schedule_id, task_id, created) values (?, ?, ?, ?)",
+		run.ProjectID,
+		run.ScheduleID,
+		run.TaskID,
+		run.Created)
+
+	if err != nil {
+		return
+	}
+
+	newRun = run
+	newRun.ID = insertID
+	return
+}
+
+func (d *SqlDb) GetScheduleHistory(projectID int, scheduleID int, params db.RetrieveQueryParams) (runs []db.ScheduleRun, err error) {
+	q := squirrel.Select("*").
+		From("project__schedule_run").
+		Where("project_id=? and schedule_id=?", projectID, scheduleID).
+		OrderBy("created desc", "id desc")
+
+	if params.Count > 0 {
+		q = q.Limit(uint64(params.Count))
+	}
+
+	if params.Offset > 0 {
+		q = q.Offset(uint64(params.Offset))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return
+	}
+
+	runs = make([]db.ScheduleRun, 0)
+	_, err = d.selectAll(&runs, query, args...)
+	return
+}
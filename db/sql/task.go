@@ -1,37 +1,129 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/masterminds/squirrel"
+	"strings"
+	"time"
 )
 
 func (d *SqlDb) CreateTask(task db.Task) (db.Task, error) {
+	if len(task.DisplayTags) > 0 {
+		task.DisplayTagsJSON = db.ObjectToJSON(task.DisplayTags)
+	}
 	err := d.sql.Insert(&task)
 	return task, err
 }
 
+func (d *SqlDb) CreateBuildTask(task db.Task, startVersion *string) (db.Task, error) {
+	if len(task.DisplayTags) > 0 {
+		task.DisplayTagsJSON = db.ObjectToJSON(task.DisplayTags)
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return task, err
+	}
+
+	// the template row is locked until the transaction ends, so builds of the template
+	// are saved one by one and each of them reads the build saved by the previous one.
+	_, err = tx.SelectInt(d.PrepareQuery("select id from project__template where project_id=? and id=? for update"),
+		task.ProjectID,
+		task.TemplateID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return task, err
+	}
+
+	// builds are ordered by ID because versions are reserved in the order the tasks are inserted
+	lastVersion, err := tx.SelectNullStr(d.PrepareQuery("select version from task "+
+		"where template_id=? and version is not null order by id desc limit 1"),
+		task.TemplateID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return task, err
+	}
+
+	if lastVersion.Valid {
+		task.SetBuildVersion(startVersion, &lastVersion.String)
+	} else {
+		task.SetBuildVersion(startVersion, nil)
+	}
+
+	err = tx.Insert(&task)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return task, err
+	}
+
+	return task, tx.Commit()
+}
+
+// likeEscaper escapes special characters of LIKE patterns, '!' is used as the escape character.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// displayTagPattern returns LIKE pattern which matches JSON array of display tags containing the tag.
+func displayTagPattern(tag string) string {
+	tagJSON, _ := json.Marshal(tag)
+	return "%" + likeEscaper.Replace(string(tagJSON)) + "%"
+}
+
 func (d *SqlDb) UpdateTask(task db.Task) error {
 	_, err := d.exec(
-		"update task set status=?, start=?, `end`=? where id=?",
+		"update task set status=?, start=?, `end`=?, exit_code=?, failure_reason=?, approval_status=?, approved_by=?, commit_hash=?, runner_id=?, output_archived=? where id=?",
 		task.Status,
 		task.Start,
 		task.End,
+		task.ExitCode,
+		task.FailureReason,
+		task.ApprovalStatus,
+		task.ApprovedBy,
+		task.CommitHash,
+		task.RunnerID,
+		task.OutputArchived,
 		task.ID)
 
 	return err
 }
 
 func (d *SqlDb) CreateTaskOutput(output db.TaskOutput) (db.TaskOutput, error) {
-	_, err := d.exec(
-		"insert into task__output (task_id, task, output, time) VALUES (?, '', ?, ?)",
+	d.taskOutputLock.Lock()
+	defer d.taskOutputLock.Unlock()
+
+	seq, err := d.sql.SelectInt(
+		d.PrepareQuery("select coalesce(max(seq), 0) + 1 from task__output where task_id=?"),
+		output.TaskID)
+
+	if err != nil {
+		return output, err
+	}
+
+	if output.Level == "" {
+		output.Level = db.TaskOutputInfo
+	}
+
+	insertID, err := d.insert(
+		"id",
+		"insert into task__output (task_id, task, output, time, seq, level) VALUES (?, '', ?, ?, ?, ?)",
 		output.TaskID,
 		output.Output,
-		output.Time)
-	return output, err
+		output.Time,
+		seq,
+		output.Level)
+
+	if err != nil {
+		return output, err
+	}
+
+	output.ID = insertID
+	output.Seq = int(seq)
+	return output, nil
 }
 
-func (d *SqlDb) getTasks(projectID int, templateID *int, params db.RetrieveQueryParams, tasks *[]db.TaskWithTpl) (err error) {
+func (d *SqlDb) getTasksQuery(projectID int, templateID *int, version *string, filter db.TaskFilter) squirrel.SelectBuilder {
 	fields := "task.*"
 	fields += ", tpl.playbook as tpl_playbook" +
 		", `user`.name as user_name" +
@@ -50,10 +142,44 @@ func (d *SqlDb) getTasks(projectID int, templateID *int, params db.RetrieveQuery
 		q = q.Where("tpl.project_id=? AND task.template_id=?", projectID, templateID)
 	}
 
+	if version != nil {
+		q = q.Where("task.version=?", *version)
+	}
+
+	if filter.UserID != nil {
+		q = q.Where("task.user_id=?", *filter.UserID)
+	}
+
+	for _, tag := range filter.DisplayTags {
+		q = q.Where("task.display_tags like ? escape '!'", displayTagPattern(tag))
+	}
+
+	if len(filter.Status) > 0 {
+		q = q.Where(squirrel.Eq{"task.status": filter.Status})
+	}
+
+	if filter.StartedAfter != nil {
+		q = q.Where("task.start>=?", *filter.StartedAfter)
+	}
+
+	if filter.StartedBefore != nil {
+		q = q.Where("task.start<?", *filter.StartedBefore)
+	}
+
+	return q
+}
+
+func (d *SqlDb) getTasks(projectID int, templateID *int, version *string, filter db.TaskFilter, params db.RetrieveQueryParams, tasks *[]db.TaskWithTpl) (err error) {
+	q := d.getTasksQuery(projectID, templateID, version, filter)
+
 	if params.Count > 0 {
 		q = q.Limit(uint64(params.Count))
 	}
 
+	if params.Offset > 0 {
+		q = q.Offset(uint64(params.Offset))
+	}
+
 	query, args, _ := q.ToSql()
 
 	_, err = d.selectAll(tasks, query, args...)
@@ -91,19 +217,145 @@ func (d *SqlDb) GetTask(projectID int, taskID int) (task db.Task, err error) {
 		return
 	}
 
+	err = task.FillDisplayTags()
 	return
 }
 
 func (d *SqlDb) GetTemplateTasks(projectID int, templateID int, params db.RetrieveQueryParams) (tasks []db.TaskWithTpl, err error) {
-	err = d.getTasks(projectID, &templateID, params, &tasks)
+	err = d.getTasks(projectID, &templateID, nil, db.TaskFilter{}, params, &tasks)
 	return
 }
 
-func (d *SqlDb) GetProjectTasks(projectID int, params db.RetrieveQueryParams) (tasks []db.TaskWithTpl, err error) {
-	err = d.getTasks(projectID, nil, params, &tasks)
+func (d *SqlDb) GetTasksByStatus(statuses []db.TaskStatus) (tasks []db.Task, err error) {
+	tasks = make([]db.Task, 0)
+
+	if len(statuses) == 0 {
+		return
+	}
+
+	query, args, err := squirrel.Select("*").
+		From("task").
+		Where(squirrel.Eq{"status": statuses}).
+		OrderBy("id").
+		ToSql()
+
+	if err != nil {
+		return
+	}
+
+	_, err = d.selectAll(&tasks, query, args...)
+
+	if err != nil {
+		return
+	}
+
+	for i := range tasks {
+		err = tasks[i].FillDisplayTags()
+		if err != nil {
+			return
+		}
+	}
+
 	return
 }
 
+func (d *SqlDb) GetTaskByVersion(projectID int, templateID int, version string) (task db.TaskWithTpl, err error) {
+	var tasks []db.TaskWithTpl
+
+	err = d.getTasks(projectID, &templateID, &version, db.TaskFilter{}, db.RetrieveQueryParams{Count: 1}, &tasks)
+	if err != nil {
+		return
+	}
+
+	if len(tasks) == 0 {
+		err = db.ErrNotFound
+		return
+	}
+
+	task = tasks[0]
+	return
+}
+
+func (d *SqlDb) GetProjectTasks(projectID int, filter db.TaskFilter, params db.RetrieveQueryParams) (tasks []db.TaskWithTpl, err error) {
+	err = d.getTasks(projectID, nil, nil, filter, params, &tasks)
+	return
+}
+
+func (d *SqlDb) GetProjectTasksFiltered(projectID int, filter db.TaskFilter, params db.RetrieveQueryParams) (tasks []db.TaskWithTpl, err error) {
+	err = d.getTasks(projectID, filter.TemplateID, nil, filter, params, &tasks)
+	return
+}
+
+// taskScanBatchSize is a number of tasks read by one query in GetProjectTasksContext.
+const taskScanBatchSize = 100
+
+func (d *SqlDb) GetProjectTasksContext(ctx context.Context, projectID int, filter db.TaskFilter, params db.RetrieveQueryParams) (tasks []db.TaskWithTpl, truncated bool, err error) {
+	tasks = make([]db.TaskWithTpl, 0)
+
+	// tasks are read by batches, so the tasks which were read before
+	// the context is done can be returned. Batches after the first one
+	// continue from the last read task, so tasks created while reading
+	// don't shift the next batch.
+	for {
+		limit := uint64(taskScanBatchSize)
+		if params.Count > 0 {
+			rest := params.Count - len(tasks)
+			if rest <= 0 {
+				return
+			}
+			if uint64(rest) < limit {
+				limit = uint64(rest)
+			}
+		}
+
+		q := d.getTasksQuery(projectID, nil, nil, filter).Limit(limit)
+
+		if len(tasks) == 0 {
+			if params.Offset > 0 {
+				q = q.Offset(uint64(params.Offset))
+			}
+		} else {
+			last := tasks[len(tasks)-1]
+			q = q.Where("(task.created<? or (task.created=? and task.id<?))", last.Created, last.Created, last.ID)
+		}
+
+		var query string
+		var args []interface{}
+		query, args, err = q.ToSql()
+		if err != nil {
+			return
+		}
+
+		var batch []db.TaskWithTpl
+		_, err = d.sql.WithContext(ctx).Select(&batch, d.PrepareQuery(query), args...)
+
+		if ctx.Err() != nil {
+			return tasks, true, nil
+		}
+
+		if err != nil {
+			return
+		}
+
+		for i := range batch {
+			if ctx.Err() != nil {
+				return tasks, true, nil
+			}
+
+			err = batch[i].Fill(d)
+			if err != nil {
+				return
+			}
+
+			tasks = append(tasks, batch[i])
+		}
+
+		if uint64(len(batch)) < limit {
+			return
+		}
+	}
+}
+
 func (d *SqlDb) DeleteTaskWithOutputs(projectID int, taskID int) (err error) {
 	// check if task exists in the project
 	_, err = d.GetTask(projectID, taskID)
@@ -122,7 +374,130 @@ func (d *SqlDb) DeleteTaskWithOutputs(projectID int, taskID int) (err error) {
 	return
 }
 
+func (d *SqlDb) DeleteTaskOutputs(projectID int, taskID int) (err error) {
+	// check if task exists in the project
+	_, err = d.GetTask(projectID, taskID)
+
+	if err != nil {
+		return
+	}
+
+	_, err = d.exec("delete from task__output where task_id=?", taskID)
+	return
+}
+
+func (d *SqlDb) DeleteTaskOutputsBefore(projectID int, before time.Time) (count int, err error) {
+	res, err := d.exec(
+		"delete from task__output where time<? and task_id in (select id from task where project_id=?)",
+		before,
+		projectID)
+
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	count = int(affected)
+	return
+}
+
+func (d *SqlDb) PruneTaskOutputs(projectID int, olderThan time.Time, options ...db.TaskPruneOption) (outputs int, tasks int, err error) {
+	outputs, err = d.DeleteTaskOutputsBefore(projectID, olderThan)
+	if err != nil || !db.HasTaskPruneOption(options, db.PruneFinishedTasks) {
+		return
+	}
+
+	tasks, err = d.deleteTasksBefore(projectID, olderThan)
+	return
+}
+
+// deleteTasksBefore deletes finished tasks of the project which ended before the time
+// together with their output. It returns number of deleted tasks.
+func (d *SqlDb) deleteTasksBefore(projectID int, before time.Time) (count int, err error) {
+	query, args, err := squirrel.Select("id").
+		From("task").
+		Where("project_id=?", projectID).
+		Where(squirrel.Eq{"status": db.TaskFinishedStatuses}).
+		Where("coalesce(`end`, created)<?", before).
+		ToSql()
+
+	if err != nil {
+		return
+	}
+
+	var ids []int
+	_, err = d.selectAll(&ids, query, args...)
+	if err != nil || len(ids) == 0 {
+		return
+	}
+
+	query, args, err = squirrel.Delete("task__output").Where(squirrel.Eq{"task_id": ids}).ToSql()
+	if err != nil {
+		return
+	}
+
+	if _, err = d.exec(query, args...); err != nil {
+		return
+	}
+
+	query, args, err = squirrel.Delete("task").Where(squirrel.Eq{"id": ids}).ToSql()
+	if err != nil {
+		return
+	}
+
+	res, err := d.exec(query, args...)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	count = int(affected)
+	return
+}
+
 func (d *SqlDb) GetTaskOutputs(projectID int, taskID int) (output []db.TaskOutput, err error) {
+	output, _, err = d.GetTaskOutputsPaged(projectID, taskID, db.RetrieveQueryParams{})
+	return
+}
+
+func (d *SqlDb) GetTaskOutputsPaged(projectID int, taskID int, params db.RetrieveQueryParams) (output []db.TaskOutput, total int, err error) {
+	// check if task exists in the project
+	_, err = d.GetTask(projectID, taskID)
+
+	if err != nil {
+		return
+	}
+
+	count, err := d.sql.SelectInt(d.PrepareQuery("select count(*) from task__output where task_id=?"), taskID)
+	if err != nil {
+		return
+	}
+	total = int(count)
+
+	q := squirrel.Select("id, task_id, seq, task, time, output, level").
+		From("task__output").
+		Where("task_id=?", taskID).
+		OrderBy("time asc", "seq asc")
+
+	if params.Count > 0 {
+		q = q.Limit(uint64(params.Count))
+	}
+
+	if params.Offset > 0 {
+		q = q.Offset(uint64(params.Offset))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return
+	}
+
+	output = make([]db.TaskOutput, 0)
+	_, err = d.selectAll(&output, query, args...)
+	return
+}
+
+func (d *SqlDb) GetTaskOutputsSince(projectID int, taskID int, afterOutputID int) (output []db.TaskOutput, err error) {
 	// check if task exists in the project
 	_, err = d.GetTask(projectID, taskID)
 
@@ -131,7 +506,8 @@ func (d *SqlDb) GetTaskOutputs(projectID int, taskID int) (output []db.TaskOutpu
 	}
 
 	_, err = d.selectAll(&output,
-		"select task_id, task, time, output from task__output where task_id=? order by time asc",
-		taskID)
+		"select id, task_id, seq, task, time, output, level from task__output where task_id=? and id>? order by seq asc",
+		taskID,
+		afterOutputID)
 	return
 }
@@ -0,0 +1,203 @@
+package sql
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+// createTestStore connects to the MySQL or Postgres database set by config
+// in SEMAPHORE_TEST_DB_CONFIG. The test is skipped if the config is not set.
+func createTestStore(t *testing.T) *SqlDb {
+	configPath := os.Getenv("SEMAPHORE_TEST_DB_CONFIG")
+	if configPath == "" {
+		t.Skip("SEMAPHORE_TEST_DB_CONFIG is not set")
+	}
+
+	util.ConfigInit(configPath)
+
+	store := &SqlDb{}
+	store.Connect("")
+
+	if err := db.Migrate(store); err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestCreateBuildTaskConcurrently(t *testing.T) {
+	store := createTestStore(t)
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		Name:      "None",
+		ProjectID: &proj.ID,
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		SSHKeyID:  key.ID,
+		Name:      "Test",
+		GitURL:    "git@example.com:test/test",
+		GitBranch: "master",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+		Name:      "Test",
+		Type:      db.InventoryStatic,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startVersion := "1.0"
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:         "Build",
+		Playbook:     "build.yml",
+		Type:         db.TemplateBuild,
+		StartVersion: &startVersion,
+		ProjectID:    proj.ID,
+		RepositoryID: repo.ID,
+		InventoryID:  &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const builds = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, builds)
+
+	for i := 0; i < builds; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err2 := store.CreateBuildTask(db.Task{
+				ProjectID:  proj.ID,
+				TemplateID: tpl.ID,
+				Status:     db.TaskWaitingStatus,
+			}, tpl.StartVersion)
+			errs <- err2
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err = range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tasks []db.Task
+	_, err = store.selectAll(&tasks, "select * from task where template_id=? order by id", tpl.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != builds {
+		t.Fatalf("expected %d builds, got %d", builds, len(tasks))
+	}
+
+	for i, task := range tasks {
+		expected := "1." + strconv.Itoa(i)
+		if task.Version == nil || *task.Version != expected {
+			t.Fatalf("build %d must have version %s, got %v", task.ID, expected, task.Version)
+		}
+	}
+}
+
+func TestPruneTaskOutputs(t *testing.T) {
+	store := createTestStore(t)
+
+	proj, err := store.CreateProject(db.Project{Name: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -30)
+
+	oldTask, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskSuccessStatus,
+		Created:   old,
+		End:       &old,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTask, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskSuccessStatus,
+		Created:   now,
+		End:       &now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range []db.Task{oldTask, newTask} {
+		for _, outputTime := range []time.Time{old, now} {
+			_, err = store.CreateTaskOutput(db.TaskOutput{TaskID: task.ID, Time: outputTime, Output: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	olderThan := now.AddDate(0, 0, -7)
+
+	count, tasksCount, err := store.PruneTaskOutputs(proj.ID, olderThan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 || tasksCount != 0 {
+		t.Fatalf("old output of 2 tasks must be deleted, %d records deleted", count)
+	}
+
+	count, tasksCount, err = store.PruneTaskOutputs(proj.ID, olderThan, db.PruneFinishedTasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 || tasksCount != 1 {
+		t.Fatal("only the old finished task must be deleted")
+	}
+
+	if _, err = store.GetTask(proj.ID, oldTask.ID); err != db.ErrNotFound {
+		t.Fatal("old finished task must be deleted")
+	}
+
+	outputs, err := store.GetTaskOutputs(proj.ID, newTask.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 1 {
+		t.Fatal("recent output of the kept task must be kept")
+	}
+}
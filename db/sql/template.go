@@ -17,8 +17,10 @@ func (d *SqlDb) CreateTemplate(template db.Template) (newTemplate db.Template, e
 		"id",
 		"insert into project__template (project_id, inventory_id, repository_id, environment_id, "+
 			"name, playbook, arguments, allow_override_args_in_task, description, vault_key_id, `type`, start_version,"+
-			"build_template_id, view_id, autorun, survey_vars, suppress_success_alerts)"+
-			"values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			"build_template_id, view_id, autorun, survey_vars, suppress_success_alerts, json_events, disabled, vaults, "+
+			"pre_hook, post_hook, approval_required, runner_tag, changed_paths_filter, allowed_roles, verbosity, notification_target_ids, "+
+			"additional_repository_ids, galaxy_requirements, working_dir, allowed_window, syntax_check)"+
+			"values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		template.ProjectID,
 		template.InventoryID,
 		template.RepositoryID,
@@ -35,7 +37,23 @@ func (d *SqlDb) CreateTemplate(template db.Template) (newTemplate db.Template, e
 		template.ViewID,
 		template.Autorun,
 		db.ObjectToJSON(template.SurveyVars),
-		template.SuppressSuccessAlerts)
+		template.SuppressSuccessAlerts,
+		template.JSONEvents,
+		template.Disabled,
+		db.ObjectToJSON(template.Vaults),
+		template.PreHook,
+		template.PostHook,
+		template.ApprovalRequired,
+		template.RunnerTag,
+		db.ObjectToJSON(template.ChangedPathsFilter),
+		db.ObjectToJSON(template.AllowedRoles),
+		template.Verbosity,
+		db.ObjectToJSON(template.NotificationTargetIDs),
+		db.ObjectToJSON(template.AdditionalRepositoryIDs),
+		template.GalaxyRequirements,
+		template.WorkingDir,
+		db.ObjectToJSON(template.AllowedWindow),
+		template.SyntaxCheck)
 
 	if err != nil {
 		return
@@ -49,6 +67,7 @@ func (d *SqlDb) CreateTemplate(template db.Template) (newTemplate db.Template, e
 
 	newTemplate = template
 	newTemplate.ID = insertID
+	newTemplate.Archived = false
 
 	return
 }
@@ -60,6 +79,11 @@ func (d *SqlDb) UpdateTemplate(template db.Template) error {
 		return err
 	}
 
+	oldTemplate, err := d.GetTemplate(template.ProjectID, template.ID)
+	if err != nil {
+		return err
+	}
+
 	_, err = d.exec("update project__template set "+
 		"inventory_id=?, "+
 		"repository_id=?, "+
@@ -76,7 +100,23 @@ func (d *SqlDb) UpdateTemplate(template db.Template) error {
 		"view_id=?, "+
 		"autorun=?, "+
 		"survey_vars=?, "+
-		"suppress_success_alerts=? "+
+		"suppress_success_alerts=?, "+
+		"json_events=?, "+
+		"disabled=?, "+
+		"vaults=?, "+
+		"pre_hook=?, "+
+		"post_hook=?, "+
+		"approval_required=?, "+
+		"runner_tag=?, "+
+		"changed_paths_filter=?, "+
+		"allowed_roles=?, "+
+		"verbosity=?, "+
+		"notification_target_ids=?, "+
+		"additional_repository_ids=?, "+
+		"galaxy_requirements=?, "+
+		"working_dir=?, "+
+		"allowed_window=?, "+
+		"syntax_check=? "+
 		"where id=? and project_id=?",
 		template.InventoryID,
 		template.RepositoryID,
@@ -94,12 +134,84 @@ func (d *SqlDb) UpdateTemplate(template db.Template) error {
 		template.Autorun,
 		db.ObjectToJSON(template.SurveyVars),
 		template.SuppressSuccessAlerts,
+		template.JSONEvents,
+		template.Disabled,
+		db.ObjectToJSON(template.Vaults),
+		template.PreHook,
+		template.PostHook,
+		template.ApprovalRequired,
+		template.RunnerTag,
+		db.ObjectToJSON(template.ChangedPathsFilter),
+		db.ObjectToJSON(template.AllowedRoles),
+		template.Verbosity,
+		db.ObjectToJSON(template.NotificationTargetIDs),
+		db.ObjectToJSON(template.AdditionalRepositoryIDs),
+		template.GalaxyRequirements,
+		template.WorkingDir,
+		db.ObjectToJSON(template.AllowedWindow),
+		template.SyntaxCheck,
 		template.ID,
 		template.ProjectID,
 	)
+
+	if err != nil {
+		return err
+	}
+
+	version, err := db.NewTemplateVersion(oldTemplate)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec(
+		"insert into project__template_version (project_id, template_id, created, template) values (?, ?, ?, ?)",
+		version.ProjectID,
+		version.TemplateID,
+		version.Created,
+		version.TemplateJSON)
+
 	return err
 }
 
+func (d *SqlDb) GetTemplateVersions(projectID int, templateID int) (versions []db.TemplateVersion, err error) {
+	versions = make([]db.TemplateVersion, 0)
+
+	_, err = d.selectAll(&versions,
+		"select * from project__template_version where project_id=? and template_id=? order by created desc, id desc",
+		projectID,
+		templateID)
+
+	if err != nil {
+		return
+	}
+
+	err = db.FillTemplateVersions(versions)
+	return
+}
+
+func (d *SqlDb) GetTemplateVersion(projectID int, templateID int, versionID int) (version db.TemplateVersion, err error) {
+	err = d.selectOne(&version,
+		"select * from project__template_version where project_id=? and template_id=? and id=?",
+		projectID,
+		templateID,
+		versionID)
+
+	if err == sql.ErrNoRows {
+		err = db.ErrNotFound
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = version.FillTemplate()
+	return
+}
+
+func (d *SqlDb) RollbackTemplate(projectID int, templateID int, versionID int) error {
+	return db.RollbackTemplate(d, projectID, templateID, versionID)
+}
+
 func (d *SqlDb) GetTemplates(projectID int, filter db.TemplateFilter, params db.RetrieveQueryParams) (templates []db.Template, err error) {
 	q := squirrel.Select("pt.id",
 		"pt.project_id",
@@ -112,9 +224,15 @@ func (d *SqlDb) GetTemplates(projectID int, filter db.TemplateFilter, params db.
 		"pt.allow_override_args_in_task",
 		"pt.vault_key_id",
 		"pt.view_id",
-		"pt.`type`").
+		"pt.`type`",
+		"pt.allowed_roles",
+		"pt.archived").
 		From("project__template pt")
 
+	if !filter.IncludeArchived {
+		q = q.Where(squirrel.Eq{"pt.archived": false})
+	}
+
 	if filter.ViewID != nil {
 		q = q.Where("pt.view_id=?", *filter.ViewID)
 	}
@@ -193,6 +311,37 @@ func (d *SqlDb) DeleteTemplate(projectID int, templateID int) error {
 	return err
 }
 
-func (d *SqlDb) GetTemplateRefs(projectID int, templateID int) (db.ObjectReferrers, error) {
-	return d.getObjectRefs(projectID, db.TemplateProps, templateID)
+func (d *SqlDb) ArchiveTemplate(projectID int, templateID int) error {
+	// check if template exists in the project
+	_, err := d.GetTemplate(projectID, templateID)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec("update project__template set archived=? where project_id=? and id=?", true, projectID, templateID)
+	return err
+}
+
+func (d *SqlDb) GetTemplateRefs(projectID int, templateID int) (refs db.ObjectReferrers, err error) {
+	refs, err = d.getObjectRefs(projectID, db.TemplateProps, templateID)
+	if err != nil {
+		return
+	}
+
+	// schedules refer to the template itself, they are reported separately
+	templates := make([]db.ObjectReferrer, 0, len(refs.Templates))
+	for _, tpl := range refs.Templates {
+		if tpl.ID != templateID {
+			templates = append(templates, tpl)
+		}
+	}
+	refs.Templates = templates
+
+	schedules, err := d.GetTemplateSchedules(projectID, templateID)
+	if err != nil {
+		return
+	}
+
+	refs.Schedules = db.GetScheduleReferrers(schedules)
+	return
 }
@@ -0,0 +1,65 @@
+package sql
+
+import "github.com/ansible-semaphore/semaphore/db"
+
+func (d *SqlDb) GetTemplatePipelines(projectID int) (pipelines []db.TemplatePipeline, err error) {
+	err = d.getObjects(projectID, db.TemplatePipelineProps, db.RetrieveQueryParams{}, &pipelines)
+	if err != nil {
+		return
+	}
+
+	err = db.FillTemplatePipelines(pipelines)
+	return
+}
+
+func (d *SqlDb) GetTemplatePipeline(projectID int, pipelineID int) (pipeline db.TemplatePipeline, err error) {
+	err = d.getObject(projectID, db.TemplatePipelineProps, pipelineID, &pipeline)
+	if err != nil {
+		return
+	}
+
+	err = pipeline.FillStages()
+	return
+}
+
+func (d *SqlDb) CreateTemplatePipeline(pipeline db.TemplatePipeline) (newPipeline db.TemplatePipeline, err error) {
+	err = pipeline.SerializeStages()
+	if err != nil {
+		return
+	}
+
+	insertID, err := d.insert(
+		"id",
+		"insert into project__template_pipeline (project_id, name, stages) values (?, ?, ?)",
+		pipeline.ProjectID,
+		pipeline.Name,
+		pipeline.StagesJSON)
+
+	if err != nil {
+		return
+	}
+
+	newPipeline = pipeline
+	newPipeline.ID = insertID
+	return
+}
+
+func (d *SqlDb) UpdateTemplatePipeline(pipeline db.TemplatePipeline) error {
+	err := pipeline.SerializeStages()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.exec(
+		"update project__template_pipeline set name=?, stages=? where project_id=? and id=?",
+		pipeline.Name,
+		pipeline.StagesJSON,
+		pipeline.ProjectID,
+		pipeline.ID)
+
+	return err
+}
+
+func (d *SqlDb) DeleteTemplatePipeline(projectID int, pipelineID int) error {
+	return d.deleteObject(projectID, db.TemplatePipelineProps, pipelineID)
+}
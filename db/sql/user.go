@@ -59,6 +59,73 @@ func (d *SqlDb) DeleteUser(userID int) error {
 	return validateMutationResult(res, err)
 }
 
+func (d *SqlDb) DeleteUserReassigning(userID int, reassignToUserID int, reassignProjects bool) error {
+	err := db.ValidateUserReassignment(userID, reassignToUserID)
+	if err != nil {
+		return err
+	}
+
+	if _, err = d.GetUser(userID); err != nil {
+		return err
+	}
+
+	if _, err = d.GetUser(reassignToUserID); err != nil {
+		return err
+	}
+
+	var projectUsers []db.ProjectUser
+
+	if reassignProjects {
+		_, err = d.selectAll(&projectUsers,
+			"select * from project__user where user_id=? "+
+				"and project_id not in (select project_id from project__user where user_id=?)",
+			userID,
+			reassignToUserID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(d.PrepareQuery("update task set user_id=? where user_id=?"), reassignToUserID, userID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return err
+	}
+
+	for _, projectUser := range projectUsers {
+		_, err = tx.Exec(
+			d.PrepareQuery("insert into project__user (project_id, user_id, `role`) values (?, ?, ?)"),
+			projectUser.ProjectID,
+			reassignToUserID,
+			projectUser.Role)
+
+		if err != nil {
+			handleRollbackError(tx.Rollback())
+			return err
+		}
+	}
+
+	_, err = tx.Exec(d.PrepareQuery("delete from project__user where user_id=?"), userID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return err
+	}
+
+	_, err = tx.Exec(d.PrepareQuery("delete from `user` where id=?"), userID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (d *SqlDb) UpdateUser(user db.UserWithPwd) error {
 	var err error
 
@@ -56,3 +56,33 @@ func (d *SqlDb) SetViewPositions(projectID int, positions map[int]int) error {
 	}
 	return nil
 }
+
+func (d *SqlDb) MoveView(projectID int, viewID int, position int) error {
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return err
+	}
+
+	var views []db.View
+	_, err = tx.Select(&views, d.PrepareQuery("select * from project__view where project_id=?"), projectID)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return err
+	}
+
+	changed, err := db.ReorderViews(views, viewID, position)
+	if err != nil {
+		handleRollbackError(tx.Rollback())
+		return err
+	}
+
+	for _, view := range changed {
+		_, err = tx.Exec(d.PrepareQuery("update project__view set position=? where id=?"), view.Position, view.ID)
+		if err != nil {
+			handleRollbackError(tx.Rollback())
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
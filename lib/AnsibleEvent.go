@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// AnsibleJSONCallback is the ansible stdout callback which prints
+// every event as a separate JSON line.
+const AnsibleJSONCallback = "ansible.posix.jsonl"
+
+type AnsibleEventStatus string
+
+const (
+	AnsibleEventOk          AnsibleEventStatus = "ok"
+	AnsibleEventChanged     AnsibleEventStatus = "changed"
+	AnsibleEventFailed      AnsibleEventStatus = "failed"
+	AnsibleEventSkipped     AnsibleEventStatus = "skipped"
+	AnsibleEventUnreachable AnsibleEventStatus = "unreachable"
+)
+
+// AnsibleEvent is a structured representation of the event
+// printed by the ansible JSON callback.
+type AnsibleEvent struct {
+	Type   string             `json:"type"`
+	Host   string             `json:"host,omitempty"`
+	Play   string             `json:"play,omitempty"`
+	Task   string             `json:"task,omitempty"`
+	Status AnsibleEventStatus `json:"status,omitempty"`
+}
+
+type ansibleCallbackHostResult struct {
+	Changed     bool `json:"changed"`
+	Failed      bool `json:"failed"`
+	Skipped     bool `json:"skipped"`
+	Unreachable bool `json:"unreachable"`
+}
+
+type ansibleCallbackLine struct {
+	Event string `json:"_event"`
+	Play  *struct {
+		Name string `json:"name"`
+	} `json:"play"`
+	Task *struct {
+		Name string `json:"name"`
+	} `json:"task"`
+	Hosts map[string]ansibleCallbackHostResult `json:"hosts"`
+}
+
+// ParseAnsibleEvent parses line printed by the ansible JSON callback.
+// It returns nil if the line is not a JSON event.
+func ParseAnsibleEvent(line string) *AnsibleEvent {
+	line = strings.TrimSpace(line)
+
+	if !strings.HasPrefix(line, "{") {
+		return nil
+	}
+
+	var raw ansibleCallbackLine
+
+	if err := json.Unmarshal([]byte(line), &raw); err != nil || raw.Event == "" {
+		return nil
+	}
+
+	event := AnsibleEvent{
+		Type: raw.Event,
+	}
+
+	if raw.Play != nil {
+		event.Play = raw.Play.Name
+	}
+
+	if raw.Task != nil {
+		event.Task = raw.Task.Name
+	}
+
+	for host, result := range raw.Hosts {
+		event.Host = host
+		event.Status = getAnsibleEventStatus(raw.Event, result)
+		break
+	}
+
+	return &event
+}
+
+func getAnsibleEventStatus(eventType string, result ansibleCallbackHostResult) AnsibleEventStatus {
+	switch {
+	case strings.HasSuffix(eventType, "_on_unreachable") || result.Unreachable:
+		return AnsibleEventUnreachable
+	case strings.HasSuffix(eventType, "_on_failed") || result.Failed:
+		return AnsibleEventFailed
+	case strings.HasSuffix(eventType, "_on_skipped") || result.Skipped:
+		return AnsibleEventSkipped
+	case result.Changed:
+		return AnsibleEventChanged
+	default:
+		return AnsibleEventOk
+	}
+}
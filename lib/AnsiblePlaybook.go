@@ -1,11 +1,14 @@
 package lib
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/util"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
 )
 
@@ -13,11 +16,14 @@ type AnsiblePlaybook struct {
 	TemplateID int
 	Repository db.Repository
 	Logger     Logger
+
+	// WorkingDir is a directory relative to the repository root which commands run in.
+	WorkingDir string
 }
 
 func (p AnsiblePlaybook) makeCmd(command string, args []string, environmentVars *[]string) *exec.Cmd {
 	cmd := exec.Command(command, args...) //nolint: gas
-	cmd.Dir = p.GetFullPath()
+	cmd.Dir = p.GetWorkingDir()
 
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, fmt.Sprintf("HOME=%s", util.Config.TmpPath))
@@ -64,11 +70,47 @@ func (p AnsiblePlaybook) RunPlaybook(args []string, environmentVars *[]string, c
 	return cmd.Wait()
 }
 
-func (p AnsiblePlaybook) RunGalaxy(args []string) error {
-	return p.runCmd("ansible-galaxy", args)
+// RunHook runs the shell command in the repository directory
+// and writes its output to the log line by line.
+func (p AnsiblePlaybook) RunHook(command string, environmentVars *[]string) error {
+	cmd := p.makeCmd("/bin/sh", []string{"-c", command}, environmentVars)
+	cmd.Stdin = strings.NewReader("")
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			p.Logger.Log(scanner.Text())
+		}
+		// drain the rest of the output if the scanner stopped on a too long line
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	_ = writer.Close()
+	<-done
+
+	return err
+}
+
+func (p AnsiblePlaybook) RunGalaxy(args []string, environmentVars *[]string) error {
+	cmd := p.makeCmd("ansible-galaxy", args, environmentVars)
+	p.Logger.LogCmd(cmd)
+	return cmd.Run()
 }
 
 func (p AnsiblePlaybook) GetFullPath() (path string) {
 	path = p.Repository.GetFullPath(p.TemplateID)
 	return
 }
+
+// GetWorkingDir returns the full path of the directory which commands run in.
+func (p AnsiblePlaybook) GetWorkingDir() string {
+	return path.Join(p.GetFullPath(), p.WorkingDir)
+}
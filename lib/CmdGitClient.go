@@ -49,7 +49,10 @@ func (c CmdGitClient) run(r GitRepository, targetDir GitRepositoryDirType, args
 
 	cmd := c.makeCmd(r, targetDir, args...)
 
-	r.Logger.LogCmd(cmd)
+	// git may print the remote URL with the embedded credentials
+	logger := NewMaskingLogger(r.Logger, r.Repository.GetSecrets()...)
+	logger.LogCmd(cmd)
+	defer logger.Flush()
 
 	return cmd.Run()
 }
@@ -127,6 +130,23 @@ func (c CmdGitClient) GetLastCommitHash(r GitRepository) (hash string, err error
 	return
 }
 
+func (c CmdGitClient) GetChangedFiles(r GitRepository, fromCommit string) (files []string, err error) {
+	r.Logger.Log("Get files changed since commit " + fromCommit)
+
+	out, err := c.output(r, GitRepositoryRepoDir, "diff", "--name-only", fromCommit, "HEAD")
+	if err != nil {
+		return
+	}
+
+	files = make([]string, 0)
+	for _, file := range strings.Split(out, "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return
+}
+
 func (c CmdGitClient) GetLastRemoteCommitHash(r GitRepository) (hash string, err error) {
 	out, err := c.output(r, GitRepositoryTmpDir, "ls-remote", r.Repository.GetGitURL(), r.Repository.GitBranch)
 	if err != nil {
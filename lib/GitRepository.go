@@ -21,6 +21,8 @@ type GitClient interface {
 	GetLastCommitMessage(r GitRepository) (msg string, err error)
 	GetLastCommitHash(r GitRepository) (hash string, err error)
 	GetLastRemoteCommitHash(r GitRepository) (hash string, err error)
+	// GetChangedFiles returns paths of files changed between the commit and HEAD.
+	GetChangedFiles(r GitRepository, fromCommit string) (files []string, err error)
 }
 
 type GitRepository struct {
@@ -67,3 +69,7 @@ func (r GitRepository) GetLastCommitHash() (hash string, err error) {
 func (r GitRepository) GetLastRemoteCommitHash() (hash string, err error) {
 	return r.Client.GetLastRemoteCommitHash(r)
 }
+
+func (r GitRepository) GetChangedFiles(fromCommit string) (files []string, err error) {
+	return r.Client.GetChangedFiles(r, fromCommit)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
@@ -46,6 +47,13 @@ func getAuthMethod(r GitRepository) (transport.AuthMethod, error) {
 		}
 
 		return password, nil
+	} else if r.Repository.SSHKey.Type == db.AccessKeyToken {
+		token := &http.BasicAuth{
+			Username: db.AccessKeyTokenLogin,
+			Password: r.Repository.SSHKey.Token,
+		}
+
+		return token, nil
 	} else if r.Repository.SSHKey.Type == db.AccessKeyNone {
 		return nil, nil
 	} else {
@@ -78,9 +86,11 @@ func (c GoGitClient) Clone(r GitRepository) error {
 		return authErr
 	}
 
+	logger := NewMaskingLogger(r.Logger, r.Repository.GetSecrets()...)
+
 	cloneOpt := &git.CloneOptions{
 		URL:               r.Repository.GetGitURL(),
-		Progress:          ProgressWrapper{r.Logger},
+		Progress:          ProgressWrapper{logger},
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 		ReferenceName:     plumbing.NewBranchReferenceName(r.Repository.GitBranch),
 		Auth:              authMethod,
@@ -88,7 +98,7 @@ func (c GoGitClient) Clone(r GitRepository) error {
 
 	_, err := git.PlainClone(r.GetFullPath(), false, cloneOpt)
 	if err != nil {
-		r.Logger.Log("Unable to clone repository: " + err.Error())
+		logger.Log("Unable to clone repository: " + err.Error())
 	}
 
 	return err
@@ -230,6 +240,51 @@ func (c GoGitClient) GetLastCommitHash(r GitRepository) (hash string, err error)
 	return
 }
 
+func (c GoGitClient) GetChangedFiles(r GitRepository, fromCommit string) (files []string, err error) {
+	r.Logger.Log("Get files changed since commit " + fromCommit)
+
+	rep, err := openRepository(r, GitRepositoryRepoDir)
+	if err != nil {
+		return
+	}
+
+	headRef, err := rep.Head()
+	if err != nil {
+		return
+	}
+
+	headCommit, err := rep.CommitObject(headRef.Hash())
+	if err != nil {
+		return
+	}
+
+	prevCommit, err := rep.CommitObject(plumbing.NewHash(fromCommit))
+	if err != nil {
+		return
+	}
+
+	patch, err := prevCommit.Patch(headCommit)
+	if err != nil {
+		return
+	}
+
+	files = make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, filePatch := range patch.FilePatches() {
+		from, to := filePatch.Files()
+		for _, f := range []diff.File{from, to} {
+			if f == nil || seen[f.Path()] {
+				continue
+			}
+			seen[f.Path()] = true
+			files = append(files, f.Path())
+		}
+	}
+
+	return
+}
+
 func (c GoGitClient) GetLastRemoteCommitHash(r GitRepository) (hash string, err error) {
 
 	rem := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
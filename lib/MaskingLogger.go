@@ -0,0 +1,93 @@
+package lib
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+const secretMask = "********"
+
+// MaskingLogger replaces the secrets in every message before passing it
+// to the wrapped logger.
+type MaskingLogger struct {
+	Logger  Logger
+	Secrets []string
+
+	mu     sync.Mutex
+	buffer []byte
+}
+
+func NewMaskingLogger(logger Logger, secrets ...string) *MaskingLogger {
+	return &MaskingLogger{
+		Logger:  logger,
+		Secrets: secrets,
+	}
+}
+
+func (l *MaskingLogger) Mask(msg string) string {
+	return MaskSecrets(msg, l.Secrets...)
+}
+
+// MaskSecrets replaces the secrets in the message.
+func MaskSecrets(msg string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		msg = strings.ReplaceAll(msg, secret, secretMask)
+	}
+	return msg
+}
+
+func (l *MaskingLogger) Log(msg string) {
+	l.Logger.Log(l.Mask(msg))
+}
+
+func (l *MaskingLogger) Log2(msg string, now time.Time) {
+	l.Logger.Log2(l.Mask(msg), now)
+}
+
+// LogCmd writes the output of the command to the log line by line.
+// Unlike the pipes used by task runners the output is copied by the command
+// itself, so it is completely logged once cmd.Wait returns. Call Flush after
+// that to log the last line if it isn't terminated by a newline.
+func (l *MaskingLogger) LogCmd(cmd *exec.Cmd) {
+	cmd.Stdout = l
+	cmd.Stderr = l
+}
+
+func (l *MaskingLogger) SetStatus(status db.TaskStatus) {
+	l.Logger.SetStatus(status)
+}
+
+func (l *MaskingLogger) Write(p []byte) (n int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buffer = append(l.buffer, p...)
+
+	for {
+		i := strings.IndexByte(string(l.buffer), '\n')
+		if i < 0 {
+			break
+		}
+		l.Log(strings.TrimRight(string(l.buffer[:i]), "\r"))
+		l.buffer = l.buffer[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (l *MaskingLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buffer) > 0 {
+		l.Log(string(l.buffer))
+		l.buffer = nil
+	}
+}
@@ -6,7 +6,6 @@
 package runners
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -16,10 +15,13 @@ import (
 	"github.com/ansible-semaphore/semaphore/services/tasks"
 	"github.com/ansible-semaphore/semaphore/util"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -58,6 +60,12 @@ type JobData struct {
 	Inventory       db.Inventory   `json:"inventory" binding:"required"`
 	Repository      db.Repository  `json:"repository" binding:"required"`
 	Environment     db.Environment `json:"environment" binding:"required"`
+
+	AdditionalRepositories []db.Repository `json:"additional_repositories"`
+
+	Project  db.Project   `json:"project"`
+	Schedule *db.Schedule `json:"schedule"`
+	User     *db.User     `json:"user"`
 }
 
 type RunnerState struct {
@@ -74,6 +82,8 @@ type JobState struct {
 type LogRecord struct {
 	Time    time.Time `json:"time" binding:"required"`
 	Message string    `json:"message" binding:"required"`
+	// Event is filled if the message is an event printed by the ansible JSON callback.
+	Event *lib.AnsibleEvent `json:"event,omitempty"`
 }
 
 type RunnerProgress struct {
@@ -84,12 +94,31 @@ type JobProgress struct {
 	ID         int
 	Status     db.TaskStatus
 	LogRecords []LogRecord
+	ExitCode   *int
 }
 
 type runningJob struct {
-	status     db.TaskStatus
-	logRecords []LogRecord
-	job        *tasks.LocalJob
+	status db.TaskStatus
+	job    *tasks.LocalJob
+
+	// logRecords contains output which is not sent to the server yet.
+	// Stdout and stderr of the job are written concurrently, so use logRecordsLock to access it.
+	logRecords     []LogRecord
+	logRecordsLock sync.Mutex
+
+	// maxLogLineLength is a max length of the output line, longer lines are truncated.
+	// Zero disables truncation.
+	maxLogLineLength int
+}
+
+// takeLogRecords returns the collected log records and starts a new batch.
+func (p *runningJob) takeLogRecords() []LogRecord {
+	p.logRecordsLock.Lock()
+	defer p.logRecordsLock.Unlock()
+
+	records := p.logRecords
+	p.logRecords = make([]LogRecord, 0)
+	return records
 }
 
 type JobPool struct {
@@ -106,14 +135,137 @@ type JobPool struct {
 	queue []*job
 
 	config *RunnerConfig
+
+	// fingerprint of the host, the server rejects requests of the registered
+	// runner if the fingerprint is changed.
+	fingerprint string
+
+	// settings of the pool, they are used instead of util.Config.Runner
+	// to allow running several pools in one process.
+	settings util.RunnerSettings
+
+	drainLock sync.Mutex
+	// draining is set by Drain. Draining pool does not take new jobs from the server.
+	draining bool
+	// drained is closed when draining pool has no queued and running jobs.
+	drained       chan struct{}
+	drainedClosed bool
+
+	// sleep pauses the pool, it is replaced in tests. time.Sleep is used if it is nil.
+	sleep func(time.Duration)
+
+	stopLock sync.Mutex
+	// stop is closed by Stop to make Run return.
+	stop       chan struct{}
+	stopClosed bool
+}
+
+// NewJobPool creates a job pool which works with the server described by settings.
+// The config may be empty, in this case the pool reads it from settings.ConfigFile
+// or registers a new runner on the server.
+func NewJobPool(config RunnerConfig, settings util.RunnerSettings) *JobPool {
+	p := &JobPool{
+		settings: settings,
+		sleep:    time.Sleep,
+	}
+
+	if config.RunnerID != 0 {
+		p.config = &config
+	}
+
+	fingerprint, err := RunnerFingerprint()
+	if err != nil {
+		log.Warn("Cannot calculate fingerprint of the runner host: " + err.Error())
+	}
+	p.fingerprint = fingerprint
+
+	return p
+}
+
+// Drain stops taking new jobs from the server. Queued and running jobs are
+// completed and their progress is still sent to the server.
+// Returned channel is closed when the pool becomes idle.
+func (p *JobPool) Drain() <-chan struct{} {
+	p.drainLock.Lock()
+	defer p.drainLock.Unlock()
+
+	if !p.draining {
+		p.draining = true
+		p.drained = make(chan struct{})
+	}
+
+	return p.drained
+}
+
+func (p *JobPool) isDraining() bool {
+	p.drainLock.Lock()
+	defer p.drainLock.Unlock()
+	return p.draining
+}
+
+// tryFinishDrain sends final progress and closes drained channel
+// if the draining pool has no queued and running jobs.
+func (p *JobPool) tryFinishDrain() bool {
+	if !p.isDraining() || len(p.queue) > 0 || p.hasRunningJobs() {
+		return false
+	}
+
+	// statuses of the finished jobs must reach the server before the pool reported as idle
+	p.sendProgress()
+
+	p.drainLock.Lock()
+	defer p.drainLock.Unlock()
+
+	if !p.drainedClosed {
+		close(p.drained)
+		p.drainedClosed = true
+	}
+
+	return true
+}
+
+// getStop returns the channel which is closed when the pool is stopped.
+func (p *JobPool) getStop() chan struct{} {
+	p.stopLock.Lock()
+	defer p.stopLock.Unlock()
+
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+	}
+
+	return p.stop
+}
+
+// Stop makes Run return. Running jobs are not interrupted.
+func (p *JobPool) Stop() {
+	stop := p.getStop()
+
+	p.stopLock.Lock()
+	defer p.stopLock.Unlock()
+
+	if !p.stopClosed {
+		close(stop)
+		p.stopClosed = true
+	}
 }
 
 type RunnerRegistration struct {
 	RegistrationToken string `json:"registration_token" binding:"required"`
+	// Fingerprint of the runner host, see RunnerFingerprint.
+	Fingerprint string `json:"fingerprint"`
 }
 
 func (p *runningJob) Log2(msg string, now time.Time) {
-	p.logRecords = append(p.logRecords, LogRecord{Time: now, Message: msg})
+	record := LogRecord{
+		Time:    now,
+		Message: msg,
+		Event:   lib.ParseAnsibleEvent(msg),
+	}
+
+	p.logRecordsLock.Lock()
+	defer p.logRecordsLock.Unlock()
+
+	p.logRecords = append(p.logRecords, record)
 }
 
 func (p *JobPool) hasRunningJobs() bool {
@@ -134,40 +286,118 @@ func (p *runningJob) SetStatus(status db.TaskStatus) {
 	p.status = status
 }
 
+// LogCmd logs stdout and stderr of the command line by line.
+// The output is written by the command itself, so all lines are logged
+// when cmd.Wait returns. Pipes read by separate goroutines could lose the tail of the output.
 func (p *runningJob) LogCmd(cmd *exec.Cmd) {
-	stderr, _ := cmd.StderrPipe()
-	stdout, _ := cmd.StdoutPipe()
+	cmd.Stdout = &jobOutputWriter{job: p, maxLength: p.maxLogLineLength}
+	cmd.Stderr = &jobOutputWriter{job: p, maxLength: p.maxLogLineLength}
+}
 
-	go p.logPipe(bufio.NewReader(stderr))
-	go p.logPipe(bufio.NewReader(stdout))
+// jobOutputWriter splits the output stream of the job into log lines.
+// Lines longer than maxLength are truncated.
+type jobOutputWriter struct {
+	job       *runningJob
+	maxLength int
+	line      []byte
+	truncated bool
 }
 
-func (p *runningJob) logPipe(reader *bufio.Reader) {
+func (w *jobOutputWriter) Write(data []byte) (int, error) {
+	for _, b := range data {
+		if b == '\n' {
+			w.flush()
+			continue
+		}
 
-	line, err := tasks.Readln(reader)
-	for err == nil {
-		p.Log(line)
-		line, err = tasks.Readln(reader)
+		if w.maxLength > 0 && len(w.line) >= w.maxLength {
+			w.truncated = true
+			continue
+		}
+
+		w.line = append(w.line, b)
+	}
+
+	return len(data), nil
+}
+
+func (w *jobOutputWriter) flush() {
+	line := strings.TrimSuffix(string(w.line), "\r")
+	if w.truncated {
+		line += tasks.TruncatedLineMarker
+	}
+
+	w.job.Log(line)
+
+	w.line = w.line[:0]
+	w.truncated = false
+}
+
+// getEnvironmentLogFields returns runner environment variables
+// with values of secret-looking variables redacted.
+func (p *JobPool) getEnvironmentLogFields() log.Fields {
+	fields := log.Fields{}
+
+	for key, val := range p.settings.Environment {
+		if db.IsSecretKey(key) {
+			fields[key] = db.MaskedValue
+		} else {
+			fields[key] = val
+		}
+	}
+
+	return fields
+}
+
+// getStartupJitter returns random delay before the first request to the server.
+func (p *JobPool) getStartupJitter() time.Duration {
+	min := p.settings.MinStartupJitter
+	max := p.settings.MaxStartupJitter
+
+	if max < 0 {
+		return 0
 	}
 
-	if err != nil && err.Error() != "EOF" {
-		//don't panic on these errors, sometimes it throws not dangerous "read |0: file already closed" error
-		util.LogWarningWithFields(err, log.Fields{"error": "Failed to read TaskRunner output"})
+	if min < 0 {
+		min = 0
 	}
 
+	delay := min
+	if max > min {
+		delay += rand.Intn(max - min)
+	}
+
+	return time.Duration(delay) * time.Millisecond
 }
 
 func (p *JobPool) Run() {
+	if len(p.settings.Environment) > 0 {
+		log.WithFields(p.getEnvironmentLogFields()).Info("Runner environment")
+	}
+
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	sleep(p.getStartupJitter())
+
+	stop := p.getStop()
+
 	queueTicker := time.NewTicker(5 * time.Second)
 	requestTimer := time.NewTicker(1 * time.Second)
 	p.runningJobs = make(map[int]*runningJob)
 
 	defer func() {
 		queueTicker.Stop()
+		requestTimer.Stop()
 	}()
 
 	for {
 		select {
+		case <-stop:
+			return
+
 		//case j := <-p.register: // new task created by API or schedule
 		//	p.queue = append(p.queue, j)
 
@@ -188,7 +418,8 @@ func (p *JobPool) Run() {
 			//p.resourceLocker <- &resourceLock{lock: true, holder: t}
 
 			p.runningJobs[t.job.Task.ID] = &runningJob{
-				job: t.job,
+				job:              t.job,
+				maxLogLineLength: p.settings.MaxLogLineLength,
 			}
 			t.job.Logger = p.runningJobs[t.job.Task.ID]
 			t.job.Playbook.Logger = t.job.Logger
@@ -218,9 +449,13 @@ func (p *JobPool) Run() {
 
 		case <-requestTimer.C:
 
+			if p.tryFinishDrain() {
+				break
+			}
+
 			go p.sendProgress()
 
-			if util.Config.Runner.OneOff && len(p.runningJobs) > 0 && !p.hasRunningJobs() {
+			if p.settings.OneOff && len(p.runningJobs) > 0 && !p.hasRunningJobs() {
 				os.Exit(0)
 			}
 
@@ -238,7 +473,7 @@ func (p *JobPool) sendProgress() {
 
 	client := &http.Client{}
 
-	url := util.Config.Runner.ApiURL + "/runners/" + strconv.Itoa(p.config.RunnerID)
+	url := p.settings.ApiURL + "/runners/" + strconv.Itoa(p.config.RunnerID)
 
 	body := RunnerProgress{
 		Jobs: nil,
@@ -247,11 +482,10 @@ func (p *JobPool) sendProgress() {
 	for id, j := range p.runningJobs {
 		body.Jobs = append(body.Jobs, JobProgress{
 			ID:         id,
-			LogRecords: j.logRecords,
+			LogRecords: j.takeLogRecords(),
 			Status:     j.status,
+			ExitCode:   j.job.ExitCode,
 		})
-
-		j.logRecords = make([]LogRecord, 0)
 	}
 
 	jsonBytes, err := json.Marshal(body)
@@ -262,6 +496,8 @@ func (p *JobPool) sendProgress() {
 		return
 	}
 
+	req.Header.Set(FingerprintHeader, p.fingerprint)
+
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Println("Error making request:", err)
@@ -276,10 +512,10 @@ func (p *JobPool) tryRegisterRunner() bool {
 		return true
 	}
 
-	_, err := os.Stat(util.Config.Runner.ConfigFile)
+	_, err := os.Stat(p.settings.ConfigFile)
 
 	if err == nil {
-		configBytes, err2 := os.ReadFile(util.Config.Runner.ConfigFile)
+		configBytes, err2 := os.ReadFile(p.settings.ConfigFile)
 
 		if err2 != nil {
 			panic(err2)
@@ -302,16 +538,17 @@ func (p *JobPool) tryRegisterRunner() bool {
 		panic(err)
 	}
 
-	if util.Config.Runner.RegistrationToken == "" {
+	if p.settings.RegistrationToken == "" {
 		panic("registration token cannot be empty")
 	}
 
 	client := &http.Client{}
 
-	url := util.Config.Runner.ApiURL + "/runners"
+	url := p.settings.ApiURL + "/runners"
 
 	jsonBytes, err := json.Marshal(RunnerRegistration{
-		RegistrationToken: util.Config.Runner.RegistrationToken,
+		RegistrationToken: p.settings.RegistrationToken,
+		Fingerprint:       p.fingerprint,
 	})
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBytes))
@@ -345,7 +582,7 @@ func (p *JobPool) tryRegisterRunner() bool {
 		panic("cannot save runner config")
 	}
 
-	err = os.WriteFile(util.Config.Runner.ConfigFile, configBytes, 0644)
+	err = os.WriteFile(p.settings.ConfigFile, configBytes, 0644)
 
 	p.config = &config
 
@@ -363,7 +600,7 @@ func (p *JobPool) checkNewJobs() {
 
 	client := &http.Client{}
 
-	url := util.Config.Runner.ApiURL + "/runners/" + strconv.Itoa(p.config.RunnerID)
+	url := p.settings.ApiURL + "/runners/" + strconv.Itoa(p.config.RunnerID)
 
 	req, err := http.NewRequest("GET", url, nil)
 
@@ -372,6 +609,8 @@ func (p *JobPool) checkNewJobs() {
 		return
 	}
 
+	req.Header.Set(FingerprintHeader, p.fingerprint)
+
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Println("Error making request:", err)
@@ -406,12 +645,16 @@ func (p *JobPool) checkNewJobs() {
 		}
 	}
 
-	if util.Config.Runner.OneOff {
+	if p.settings.OneOff {
 		if len(p.queue) > 0 || len(p.runningJobs) > 0 {
 			return
 		}
 	}
 
+	if p.isDraining() {
+		return
+	}
+
 	for _, newJob := range response.NewJobs {
 		if _, exists := p.runningJobs[newJob.Task.ID]; exists {
 			continue
@@ -422,32 +665,65 @@ func (p *JobPool) checkNewJobs() {
 			incomingVersion: newJob.IncomingVersion,
 
 			job: &tasks.LocalJob{
-				Task:        newJob.Task,
-				Template:    newJob.Template,
-				Inventory:   newJob.Inventory,
-				Repository:  newJob.Repository,
-				Environment: newJob.Environment,
+				Task:              newJob.Task,
+				Template:          newJob.Template,
+				Inventory:         newJob.Inventory,
+				Repository:        newJob.Repository,
+				Environment:       newJob.Environment,
+				RunnerEnvironment: p.settings.Environment,
+
+				AdditionalRepositories: newJob.AdditionalRepositories,
+
+				Project:  newJob.Project,
+				Schedule: newJob.Schedule,
+				User:     newJob.User,
+
 				Playbook: &lib.AnsiblePlaybook{
 					TemplateID: newJob.Template.ID,
 					Repository: newJob.Repository,
+					WorkingDir: newJob.Template.GetWorkingDir(),
 				},
 			},
 		}
 
-		taskRunner.job.Repository.SSHKey = response.AccessKeys[taskRunner.job.Repository.SSHKeyID]
+		resolveAccessKeys(taskRunner.job, response.AccessKeys)
 
-		if taskRunner.job.Inventory.SSHKeyID != nil {
-			taskRunner.job.Inventory.SSHKey = response.AccessKeys[*taskRunner.job.Inventory.SSHKeyID]
-		}
+		p.queue = append(p.queue, &taskRunner)
+	}
+}
 
-		if taskRunner.job.Inventory.BecomeKeyID != nil {
-			taskRunner.job.Inventory.BecomeKey = response.AccessKeys[*taskRunner.job.Inventory.BecomeKeyID]
-		}
+// resolveAccessKeys sets access keys of the job from the keys sent by the server.
+// Keys are sent separately, because they are not included in JSON of objects which use them.
+// Token keys of HTTPS repositories are used by GetGitURL of the repositories.
+func resolveAccessKeys(job *tasks.LocalJob, keys map[int]db.AccessKey) {
+	job.Repository.SSHKey = keys[job.Repository.SSHKeyID]
 
-		if taskRunner.job.Template.VaultKeyID != nil {
-			taskRunner.job.Template.VaultKey = response.AccessKeys[*taskRunner.job.Template.VaultKeyID]
-		}
+	for i := range job.AdditionalRepositories {
+		repo := &job.AdditionalRepositories[i]
+		repo.SSHKey = keys[repo.SSHKeyID]
+	}
 
-		p.queue = append(p.queue, &taskRunner)
+	if job.Inventory.SSHKeyID != nil {
+		job.Inventory.SSHKey = keys[*job.Inventory.SSHKeyID]
+	}
+
+	if job.Inventory.BecomeKeyID != nil {
+		job.Inventory.BecomeKey = keys[*job.Inventory.BecomeKeyID]
 	}
+
+	if job.Inventory.AuthKeyID != nil {
+		job.Inventory.AuthKey = keys[*job.Inventory.AuthKeyID]
+	}
+
+	if job.Template.VaultKeyID != nil {
+		job.Template.VaultKey = keys[*job.Template.VaultKeyID]
+	}
+
+	for i := range job.Template.Vaults {
+		vault := &job.Template.Vaults[i]
+		vault.VaultKey = keys[vault.VaultKeyID]
+	}
+
+	// the playbook got a copy of the repository before the key was set
+	job.Playbook.Repository = job.Repository
 }
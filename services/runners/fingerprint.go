@@ -0,0 +1,41 @@
+package runners
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// FingerprintHeader is the HTTP header used by runners to send the fingerprint
+// of their host with every request.
+const FingerprintHeader = "X-Runner-Fingerprint"
+
+// machineIDFiles contains the locations of the machine ID on different systems.
+var machineIDFiles = []string{
+	"/etc/machine-id",
+	"/var/lib/dbus/machine-id",
+}
+
+// RunnerFingerprint returns a hash of the host name and the machine ID.
+// The server binds the registered runner to it, so the runner token
+// cannot be reused on another host.
+func RunnerFingerprint() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	var machineID string
+
+	for _, f := range machineIDFiles {
+		data, err := os.ReadFile(f)
+		if err == nil {
+			machineID = strings.TrimSpace(string(data))
+			break
+		}
+	}
+
+	hash := sha256.Sum256([]byte(hostname + "\n" + machineID))
+	return hex.EncodeToString(hash[:]), nil
+}
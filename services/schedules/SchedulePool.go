@@ -1,7 +1,9 @@
 package schedules
 
 import (
+	"strconv"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ansible-semaphore/semaphore/db"
@@ -51,6 +53,48 @@ func (r ScheduleRunner) tryUpdateScheduleCommitHash(schedule db.Schedule) (updat
 	return
 }
 
+// getActiveTemplateTask returns the unfinished task of the schedule's template.
+// Stopping tasks are active too because they can still be running playbooks.
+func (r ScheduleRunner) getActiveTemplateTask(schedule db.Schedule) (task *db.Task, err error) {
+	tasks, err := r.pool.store.GetTasksByStatus([]db.TaskStatus{
+		db.TaskWaitingStatus,
+		db.TaskStartingStatus,
+		db.TaskRunningStatus,
+		db.TaskStoppingStatus,
+	})
+	if err != nil {
+		return
+	}
+
+	for i := range tasks {
+		if tasks[i].ProjectID == schedule.ProjectID && tasks[i].TemplateID == schedule.TemplateID {
+			task = &tasks[i]
+			return
+		}
+	}
+
+	return
+}
+
+// logSkippedRun creates the event about the fire skipped because of the active task.
+func (r ScheduleRunner) logSkippedRun(schedule db.Schedule, activeTask db.Task) {
+	objType := db.EventSchedule
+	desc := "Schedule ID " + strconv.Itoa(schedule.ID) + " skipped, task " +
+		strconv.Itoa(activeTask.ID) + " of the template is still active"
+
+	_, err := r.pool.store.CreateEvent(db.Event{
+		ProjectID:   &schedule.ProjectID,
+		ObjectType:  &objType,
+		ObjectID:    &schedule.ID,
+		Description: &desc,
+	})
+	if err != nil {
+		log.Error(err)
+	}
+
+	log.Info(desc)
+}
+
 func (r ScheduleRunner) Run() {
 	if !r.pool.store.PermanentConnection() {
 		r.pool.store.Connect("schedule")
@@ -63,6 +107,47 @@ func (r ScheduleRunner) Run() {
 		return
 	}
 
+	project, err := r.pool.store.GetProject(schedule.ProjectID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if project.Archived {
+		log.Info("Schedule " + strconv.Itoa(schedule.ID) + " skipped, project " + strconv.Itoa(project.ID) + " is archived")
+		return
+	}
+
+	tpl, err := r.pool.store.GetTemplate(schedule.ProjectID, schedule.TemplateID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if tpl.Disabled {
+		log.Info("Schedule " + strconv.Itoa(schedule.ID) + " skipped, template " + strconv.Itoa(tpl.ID) + " is disabled")
+		return
+	}
+
+	if tpl.Archived {
+		log.Info("Schedule " + strconv.Itoa(schedule.ID) + " skipped, template " + strconv.Itoa(tpl.ID) + " is archived")
+		return
+	}
+
+	// the check goes before the commit hash update, so the skipped commit is run by the next fire
+	if schedule.ConcurrencyMode == db.ScheduleConcurrencySkip {
+		var activeTask *db.Task
+		activeTask, err = r.getActiveTemplateTask(schedule)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if activeTask != nil {
+			r.logSkippedRun(schedule, *activeTask)
+			return
+		}
+	}
+
 	if schedule.RepositoryID != nil {
 		var updated bool
 		updated, err = r.tryUpdateScheduleCommitHash(schedule)
@@ -75,11 +160,24 @@ func (r ScheduleRunner) Run() {
 		}
 	}
 
-	_, err = r.pool.taskPool.AddTask(db.Task{
+	run := db.ScheduleRun{
+		ProjectID:  schedule.ProjectID,
+		ScheduleID: schedule.ID,
+	}
+
+	task, err := r.pool.taskPool.AddTask(db.Task{
 		TemplateID: schedule.TemplateID,
 		ProjectID:  schedule.ProjectID,
+		ScheduleID: &schedule.ID,
 	}, nil, schedule.ProjectID)
 
+	if err != nil {
+		log.Error(err)
+	} else {
+		run.TaskID = &task.ID
+	}
+
+	_, err = r.pool.store.CreateScheduleRun(run)
 	if err != nil {
 		log.Error(err)
 	}
@@ -164,3 +262,57 @@ func ValidateCronFormat(cronFormat string) error {
 	_, err := cron.ParseStandard(cronFormat)
 	return err
 }
+
+// GetNextRun returns the first fire time of the cron expression after the given time.
+func GetNextRun(cronFormat string, after time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(cronFormat)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(after), nil
+}
+
+// GetScheduleDetail returns the schedule with its next run, last fire and active status.
+func (p *SchedulePool) GetScheduleDetail(projectID int, scheduleID int) (detail db.ScheduleDetail, err error) {
+	schedule, err := p.store.GetSchedule(projectID, scheduleID)
+	if err != nil {
+		return
+	}
+
+	detail.Schedule = schedule
+
+	runs, err := p.store.GetScheduleHistory(projectID, scheduleID, db.RetrieveQueryParams{Count: 1})
+	if err != nil {
+		return
+	}
+
+	if len(runs) > 0 {
+		detail.LastRun = &runs[0].Created
+		detail.LastTaskID = runs[0].TaskID
+	}
+
+	project, err := p.store.GetProject(projectID)
+	if err != nil {
+		return
+	}
+
+	tpl, err := p.store.GetTemplate(projectID, schedule.TemplateID)
+	if err != nil {
+		return
+	}
+
+	if project.Archived || tpl.Disabled || tpl.Archived {
+		return
+	}
+
+	nextRun, cronErr := GetNextRun(schedule.CronFormat, time.Now())
+	if cronErr != nil {
+		// schedules with invalid cron expression never fire
+		return
+	}
+
+	detail.NextRun = &nextRun
+	detail.Active = true
+
+	return
+}
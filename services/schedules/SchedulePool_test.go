@@ -1,6 +1,16 @@
 package schedules
 
-import "testing"
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/db/bolt"
+	"github.com/ansible-semaphore/semaphore/services/tasks"
+	"github.com/ansible-semaphore/semaphore/util"
+)
 
 func TestValidateCronFormat(t *testing.T) {
 	err := ValidateCronFormat("* * * *")
@@ -12,4 +22,327 @@ func TestValidateCronFormat(t *testing.T) {
 	if err != nil {
 		t.Fatal(err.Error())
 	}
-}
\ No newline at end of file
+}
+
+func TestScheduleRunnerSkipsDisabledTemplate(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
+	store := &bolt.BoltDb{
+		Filename: "/tmp/test_semaphore_db_" + strconv.Itoa(r.Int()),
+	}
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Test",
+		Playbook:  "test.yml",
+		Disabled:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: tpl.ID,
+		CronFormat: "* * * * *",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskPool := tasks.CreateTaskPool(store)
+	pool := SchedulePool{
+		store:    store,
+		taskPool: &taskPool,
+	}
+
+	ScheduleRunner{
+		projectID:  proj.ID,
+		scheduleID: schedule.ID,
+		pool:       &pool,
+	}.Run()
+
+	templateTasks, err := store.GetTemplateTasks(proj.ID, tpl.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templateTasks) != 0 {
+		t.Fatal("task must not be created for disabled template")
+	}
+
+	runs, err := store.GetScheduleHistory(proj.ID, schedule.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 0 {
+		t.Fatal("schedule must not fire for disabled template")
+	}
+}
+
+func TestScheduleRunnerRecordsRun(t *testing.T) {
+	// MaxParallelTasks isn't set, so queued tasks never start
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
+	store := &bolt.BoltDb{
+		Filename: "/tmp/test_semaphore_db_" + strconv.Itoa(r.Int()),
+	}
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		ProjectID: &proj.ID,
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		SSHKeyID:  key.ID,
+		Name:      "Test",
+		GitURL:    "git@example.com:test/test",
+		GitBranch: "master",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID:    proj.ID,
+		Name:         "Test",
+		Playbook:     "test.yml",
+		RepositoryID: repo.ID,
+		InventoryID:  &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: tpl.ID,
+		CronFormat: "* * * * *",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskPool := tasks.CreateTaskPool(store)
+	go taskPool.Run()
+
+	pool := SchedulePool{
+		store:    store,
+		taskPool: &taskPool,
+	}
+
+	ScheduleRunner{
+		projectID:  proj.ID,
+		scheduleID: schedule.ID,
+		pool:       &pool,
+	}.Run()
+
+	templateTasks, err := store.GetTemplateTasks(proj.ID, tpl.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templateTasks) != 1 {
+		t.Fatal("fire must create the task of the template")
+	}
+
+	runs, err := store.GetScheduleHistory(proj.ID, schedule.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 1 || runs[0].TaskID == nil || *runs[0].TaskID != templateTasks[0].ID {
+		t.Fatal("fire must be saved to the history with the created task")
+	}
+}
+
+func TestScheduleRunnerSkipsActiveTemplateTask(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
+	store := &bolt.BoltDb{
+		Filename: "/tmp/test_semaphore_db_" + strconv.Itoa(r.Int()),
+	}
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Test",
+		Playbook:  "test.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:       proj.ID,
+		TemplateID:      tpl.ID,
+		CronFormat:      "* * * * *",
+		ConcurrencyMode: db.ScheduleConcurrencySkip,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateTask(db.Task{
+		ProjectID:  proj.ID,
+		TemplateID: tpl.ID,
+		Status:     db.TaskStoppingStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskPool := tasks.CreateTaskPool(store)
+	pool := SchedulePool{
+		store:    store,
+		taskPool: &taskPool,
+	}
+
+	ScheduleRunner{
+		projectID:  proj.ID,
+		scheduleID: schedule.ID,
+		pool:       &pool,
+	}.Run()
+
+	templateTasks, err := store.GetTemplateTasks(proj.ID, tpl.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(templateTasks) != 1 {
+		t.Fatal("task must not be created while the stopping task is active")
+	}
+
+	runs, err := store.GetScheduleHistory(proj.ID, schedule.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 0 {
+		t.Fatal("skipped fire must not be saved to the history")
+	}
+
+	events, err := store.GetEvents(proj.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].ObjectID == nil || *events[0].ObjectID != schedule.ID {
+		t.Fatal("skipped fire must be logged")
+	}
+}
+
+func TestGetScheduleDetail(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
+	store := &bolt.BoltDb{
+		Filename: "/tmp/test_semaphore_db_" + strconv.Itoa(r.Int()),
+	}
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Test",
+		Playbook:  "test.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := store.CreateSchedule(db.Schedule{
+		ProjectID:  proj.ID,
+		TemplateID: tpl.ID,
+		CronFormat: "0 * * * *",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskID := 12
+	_, err = store.CreateScheduleRun(db.ScheduleRun{
+		ProjectID:  proj.ID,
+		ScheduleID: schedule.ID,
+		TaskID:     &taskID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := SchedulePool{
+		store: store,
+	}
+
+	detail, err := pool.GetScheduleDetail(proj.ID, schedule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if detail.ID != schedule.ID || detail.CronFormat != "0 * * * *" {
+		t.Fatal("detail must contain the schedule")
+	}
+
+	if !detail.Active {
+		t.Fatal("schedule must be active")
+	}
+
+	if detail.NextRun == nil || !detail.NextRun.After(time.Now()) || detail.NextRun.Minute() != 0 {
+		t.Fatal("invalid next run", detail.NextRun)
+	}
+
+	if detail.LastRun == nil || detail.LastRun.IsZero() {
+		t.Fatal("last run must be filled")
+	}
+
+	if detail.LastTaskID == nil || *detail.LastTaskID != taskID {
+		t.Fatal("last task must be filled")
+	}
+
+	tpl.Disabled = true
+	err = store.UpdateTemplate(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detail, err = pool.GetScheduleDetail(proj.ID, schedule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if detail.Active || detail.NextRun != nil {
+		t.Fatal("schedule of disabled template must not be active")
+	}
+}
@@ -2,13 +2,17 @@ package tasks
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/lib"
 	"github.com/ansible-semaphore/semaphore/util"
 	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 type LocalJob struct {
@@ -21,8 +25,42 @@ type LocalJob struct {
 	Playbook    *lib.AnsiblePlaybook
 	Logger      lib.Logger
 
+	// AdditionalRepositories are checked out into sibling directories of Repository.
+	AdditionalRepositories []db.Repository
+
+	// Project, Schedule and User are passed to the playbook in semaphore_vars.
+	// Schedule and User are nil if the task is not started by them.
+	Project  db.Project
+	Schedule *db.Schedule
+	User     *db.User
+
+	// RunnerEnvironment contains environment variables of the runner which runs the job.
+	// Variables of the task environment take precedence over them.
+	RunnerEnvironment map[string]string
+
 	// Internal field
 	Process *os.Process
+
+	// ExitCode is an exit code of ansible-playbook process, it is nil if the process was killed.
+	ExitCode *int
+
+	// FailureReason is set by Run when the job fails at a known stage.
+	FailureReason db.TaskFailureReason
+
+	// PreviousCommitHash is a commit of the last successful task of the template.
+	// Files changed since it are checked against ChangedPathsFilter of the template.
+	PreviousCommitHash *string
+
+	// secretVars and secretEnv contain values of environment file and command secrets.
+	// They are read by installFileSecrets and installCommandSecrets.
+	secretVars map[string]string
+	secretEnv  map[string]string
+
+	// urlInventoryPath is the file which the inventory fetched from URL is written to.
+	urlInventoryPath string
+
+	// sshAgent serves the inventory SSH key protected by a passphrase, see usesSSHAgent.
+	sshAgent *sshAgent
 }
 
 func (t *LocalJob) Kill() {
@@ -53,6 +91,10 @@ func (t *LocalJob) getEnvironmentExtraVars(username string, incomingVersion *str
 		}
 	}
 
+	for name, value := range t.secretVars {
+		extraVars[name] = value
+	}
+
 	taskDetails := make(map[string]interface{})
 
 	taskDetails["id"] = t.Task.ID
@@ -73,6 +115,37 @@ func (t *LocalJob) getEnvironmentExtraVars(username string, incomingVersion *str
 		}
 	}
 
+	// context of the task is nested, so fields above keep their places
+	if t.Template.ID != 0 {
+		taskDetails["template"] = map[string]interface{}{
+			"id":   t.Template.ID,
+			"name": t.Template.Name,
+		}
+	}
+
+	if t.Project.ID != 0 {
+		taskDetails["project"] = map[string]interface{}{
+			"id":   t.Project.ID,
+			"name": t.Project.Name,
+		}
+	}
+
+	if t.Schedule != nil {
+		taskDetails["schedule"] = map[string]interface{}{
+			"id":          t.Schedule.ID,
+			"cron_format": t.Schedule.CronFormat,
+		}
+	}
+
+	if t.User != nil {
+		taskDetails["user"] = map[string]interface{}{
+			"id":       t.User.ID,
+			"username": t.User.Username,
+			"name":     t.User.Name,
+			"email":    t.User.Email,
+		}
+	}
+
 	vars := make(map[string]interface{})
 	vars["task_details"] = taskDetails
 	extraVars["semaphore_vars"] = vars
@@ -90,6 +163,10 @@ func (t *LocalJob) getEnvironmentExtraVars(username string, incomingVersion *str
 func (t *LocalJob) getEnvironmentENV() (arr []string, err error) {
 	environmentVars := make(map[string]string)
 
+	for key, val := range t.RunnerEnvironment {
+		environmentVars[key] = val
+	}
+
 	if t.Environment.ENV != nil {
 		err = json.Unmarshal([]byte(*t.Environment.ENV), &environmentVars)
 		if err != nil {
@@ -97,6 +174,18 @@ func (t *LocalJob) getEnvironmentENV() (arr []string, err error) {
 		}
 	}
 
+	for key, val := range t.secretEnv {
+		environmentVars[key] = val
+	}
+
+	if t.Template.JSONEvents {
+		environmentVars["ANSIBLE_STDOUT_CALLBACK"] = lib.AnsibleJSONCallback
+	}
+
+	if t.usesSSHAgent() {
+		environmentVars["SSH_AUTH_SOCK"] = t.getSSHAgentSocketPath()
+	}
+
 	for key, val := range environmentVars {
 		arr = append(arr, fmt.Sprintf("%s=%s", key, val))
 	}
@@ -104,6 +193,102 @@ func (t *LocalJob) getEnvironmentENV() (arr []string, err error) {
 	return
 }
 
+// getFileSecretPath returns path to the secret file and checks that
+// it is inside the directory allowed by util.Config.FileSecretsPath.
+// Relative paths are relative to the allowed directory. Symbolic links are resolved
+// before the check, so a link inside the directory can not point to a file outside of it.
+func getFileSecretPath(secretPath string) (string, error) {
+	if util.Config.FileSecretsPath == "" {
+		return "", fmt.Errorf("file secrets are not allowed, file_secrets_path is not configured")
+	}
+
+	allowedPath, err := filepath.Abs(util.Config.FileSecretsPath)
+	if err != nil {
+		return "", err
+	}
+
+	allowedPath, err = filepath.EvalSymlinks(allowedPath)
+	if err != nil {
+		return "", err
+	}
+
+	fullPath := secretPath
+	if !filepath.IsAbs(fullPath) {
+		fullPath = filepath.Join(allowedPath, fullPath)
+	}
+
+	fullPath, err = filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return "", err
+	}
+
+	relPath, err := filepath.Rel(allowedPath, fullPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file secret %s is outside of %s", secretPath, util.Config.FileSecretsPath)
+	}
+
+	return fullPath, nil
+}
+
+// installFileSecrets reads values of the environment file secrets.
+func (t *LocalJob) installFileSecrets() error {
+	secrets, err := t.Environment.GetFileSecrets()
+	if err != nil {
+		return err
+	}
+
+	t.secretVars = make(map[string]string)
+	t.secretEnv = make(map[string]string)
+
+	for _, secret := range secrets {
+		secretPath, err := getFileSecretPath(secret.Path)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(secretPath)
+		if err != nil {
+			return err
+		}
+
+		value := strings.TrimRight(string(content), "\r\n")
+
+		switch secret.Type {
+		case db.EnvironmentSecretEnv:
+			t.secretEnv[secret.Name] = value
+		default:
+			t.secretVars[secret.Name] = value
+		}
+	}
+
+	return nil
+}
+
+// installCommandSecrets runs commands of the environment command secrets and saves their output.
+// It must be called after installFileSecrets.
+func (t *LocalJob) installCommandSecrets() error {
+	secrets, err := t.Environment.GetCommandSecrets()
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
+		value, err := db.SecretCommand{Name: secret.Command}.Resolve()
+		if err != nil {
+			return fmt.Errorf("cannot resolve secret %s: %v", secret.Name, err)
+		}
+
+		switch secret.Type {
+		case db.EnvironmentSecretEnv:
+			t.secretEnv[secret.Name] = value
+		default:
+			t.secretVars[secret.Name] = value
+		}
+	}
+
+	return nil
+}
+
 // nolint: gocyclo
 func (t *LocalJob) getPlaybookArgs(username string, incomingVersion *string) (args []string, err error) {
 	playbookName := t.Task.Playbook
@@ -115,11 +300,17 @@ func (t *LocalJob) getPlaybookArgs(username string, incomingVersion *string) (ar
 	switch t.Inventory.Type {
 	case db.InventoryFile:
 		inventory = t.Inventory.Inventory
+		// the inventory path is relative to the repository root, but the playbook runs in the working dir
+		if t.Template.GetWorkingDir() != "" && !path.IsAbs(inventory) {
+			inventory = path.Join(t.getRepoPath(), inventory)
+		}
 	case db.InventoryStatic, db.InventoryStaticYaml:
 		inventory = util.Config.TmpPath + "/inventory_" + strconv.Itoa(t.Task.ID)
 		if t.Inventory.Type == db.InventoryStaticYaml {
 			inventory += ".yml"
 		}
+	case db.InventoryURL:
+		inventory = t.urlInventoryPath
 	default:
 		err = fmt.Errorf("invalid invetory type")
 		return
@@ -132,7 +323,10 @@ func (t *LocalJob) getPlaybookArgs(username string, incomingVersion *string) (ar
 	if t.Inventory.SSHKeyID != nil {
 		switch t.Inventory.SSHKey.Type {
 		case db.AccessKeySSH:
-			args = append(args, "--private-key="+t.Inventory.SSHKey.GetPath())
+			// the key protected by a passphrase is served by ssh agent, see getEnvironmentENV
+			if !t.usesSSHAgent() {
+				args = append(args, "--private-key="+t.Inventory.SSHKey.GetPath())
+			}
 			//args = append(args, "--extra-vars={\"ansible_ssh_private_key_file\": \""+t.inventory.SSHKey.GetPath()+"\"}")
 			if t.Inventory.SSHKey.SshKey.Login != "" {
 				args = append(args, "--extra-vars={\"ansible_user\": \""+t.Inventory.SSHKey.SshKey.Login+"\"}")
@@ -149,7 +343,17 @@ func (t *LocalJob) getPlaybookArgs(username string, incomingVersion *string) (ar
 	if t.Inventory.BecomeKeyID != nil {
 		switch t.Inventory.BecomeKey.Type {
 		case db.AccessKeyLoginPassword:
-			args = append(args, "--extra-vars=@"+t.Inventory.BecomeKey.GetPath())
+			if t.Inventory.BecomePasswordFile {
+				if t.Inventory.BecomeKey.LoginPassword.Login != "" {
+					args = append(args, "--become-user="+t.Inventory.BecomeKey.LoginPassword.Login)
+				}
+				args = append(args, "--become-password-file="+t.Inventory.BecomeKey.GetPath())
+			} else {
+				args = append(args, "--extra-vars=@"+t.Inventory.BecomeKey.GetPath())
+			}
+		case db.AccessKeyCommand:
+			// the key is installed only as the password file, see installInventory
+			args = append(args, "--become-password-file="+t.Inventory.BecomeKey.GetPath())
 		case db.AccessKeyNone:
 		default:
 			err = fmt.Errorf("access key does not suite for inventory's sudo user credentials")
@@ -157,8 +361,13 @@ func (t *LocalJob) getPlaybookArgs(username string, incomingVersion *string) (ar
 		}
 	}
 
+	verbosity := t.Task.Verbosity
 	if t.Task.Debug {
-		args = append(args, "-vvvv")
+		verbosity = db.MaxVerbosity
+	}
+
+	if verbosity > 0 {
+		args = append(args, "-"+strings.Repeat("v", verbosity))
 	}
 
 	if t.Task.Diff {
@@ -173,6 +382,10 @@ func (t *LocalJob) getPlaybookArgs(username string, incomingVersion *string) (ar
 		args = append(args, "--vault-password-file", t.Template.VaultKey.GetPath())
 	}
 
+	for _, vault := range t.Template.Vaults {
+		args = append(args, "--vault-id", vault.Label+"@"+vault.VaultKey.GetPath())
+	}
+
 	extraVars, err := t.getEnvironmentExtraVars(username, incomingVersion)
 	if err != nil {
 		t.Log(err.Error())
@@ -217,6 +430,14 @@ func (t *LocalJob) destroyKeys() {
 		t.Log("Can't destroy inventory user key, error: " + err.Error())
 	}
 
+	if t.sshAgent != nil {
+		err = t.sshAgent.Close()
+		if err != nil {
+			t.Log("Can't stop ssh agent, error: " + err.Error())
+		}
+		t.sshAgent = nil
+	}
+
 	err = t.Inventory.BecomeKey.Destroy()
 	if err != nil {
 		t.Log("Can't destroy inventory become user key, error: " + err.Error())
@@ -226,6 +447,13 @@ func (t *LocalJob) destroyKeys() {
 	if err != nil {
 		t.Log("Can't destroy inventory vault password file, error: " + err.Error())
 	}
+
+	for _, vault := range t.Template.Vaults {
+		err = vault.VaultKey.Destroy()
+		if err != nil {
+			t.Log("Can't destroy vault password file " + vault.Label + ", error: " + err.Error())
+		}
+	}
 }
 
 func (t *LocalJob) Run(username string, incomingVersion *string) (err error) {
@@ -241,6 +469,23 @@ func (t *LocalJob) Run(username string, incomingVersion *string) (err error) {
 		t.destroyKeys()
 	}()
 
+	if t.isUnchanged() {
+		t.SetStatus(db.TaskSkippedStatus)
+		return
+	}
+
+	err = t.installFileSecrets()
+	if err != nil {
+		t.Log("Failed to read file secrets: " + err.Error())
+		return
+	}
+
+	err = t.installCommandSecrets()
+	if err != nil {
+		t.Log("Failed to run secret commands: " + err.Error())
+		return
+	}
+
 	args, err := t.getPlaybookArgs(username, incomingVersion)
 	if err != nil {
 		return
@@ -251,10 +496,146 @@ func (t *LocalJob) Run(username string, incomingVersion *string) (err error) {
 		return
 	}
 
-	return t.Playbook.RunPlaybook(args, &environmentVariables, func(p *os.Process) {
+	// post-hook cleans up after the pre-hook too, so it runs even if the pre-hook failed
+	defer t.runHook("Post-hook", t.Template.PostHook, &environmentVariables)
+
+	err = t.runHook("Pre-hook", t.Template.PreHook, &environmentVariables)
+	if err != nil {
+		return
+	}
+
+	err = t.runPlaybook(args, &environmentVariables)
+
+	return
+}
+
+// runPlaybook runs the playbook, it checks syntax of the playbook first if it is enabled
+// for the template or globally.
+func (t *LocalJob) runPlaybook(args []string, environmentVariables *[]string) error {
+	if t.Template.SyntaxCheck || util.Config.PlaybookSyntaxCheck {
+		t.Log("Checking playbook syntax")
+
+		err := t.Playbook.RunPlaybook(append([]string{"--syntax-check"}, args...), environmentVariables, func(p *os.Process) {
+			t.Process = p
+		})
+
+		if err != nil {
+			t.Log("Playbook syntax check failed, the playbook is not run")
+			t.FailureReason = db.TaskFailurePlaybook
+			return err
+		}
+	}
+
+	err := t.Playbook.RunPlaybook(args, environmentVariables, func(p *os.Process) {
 		t.Process = p
 	})
 
+	t.ExitCode = getExitCode(err)
+
+	if t.ExitCode != nil && *t.ExitCode != 0 {
+		t.FailureReason = db.TaskFailurePlaybook
+	} else if _, ok := err.(*exec.ExitError); ok {
+		// the process was terminated by a signal
+		t.FailureReason = db.TaskFailureKilled
+	}
+
+	return err
+}
+
+// isUnchanged checks whether the task must be skipped because none of the files matching
+// ChangedPathsFilter of the template changed since the previous successful task.
+// It also records the commit of the task, so the next task can compare with it.
+// The task is not skipped if changes can not be detected.
+func (t *LocalJob) isUnchanged() bool {
+	if len(t.Template.ChangedPathsFilter) == 0 {
+		return false
+	}
+
+	repo := lib.GitRepository{
+		Logger:     t.Logger,
+		TemplateID: t.Template.ID,
+		Repository: t.Repository,
+		Client:     lib.CreateDefaultGitClient(),
+	}
+
+	hash, err := repo.GetLastCommitHash()
+	if err != nil {
+		t.Log("Failed to get commit hash, changed paths filter is ignored: " + err.Error())
+		return false
+	}
+
+	if t.Task.CommitHash == nil {
+		t.Task.CommitHash = &hash
+	}
+
+	if t.PreviousCommitHash == nil {
+		return false
+	}
+
+	files, err := repo.GetChangedFiles(*t.PreviousCommitHash)
+	if err != nil {
+		t.Log("Failed to get changed files, changed paths filter is ignored: " + err.Error())
+		return false
+	}
+
+	for _, file := range files {
+		for _, pattern := range t.Template.ChangedPathsFilter {
+			if matchChangedPath(pattern, file) {
+				return false
+			}
+		}
+	}
+
+	t.Log("No files matching changed paths filter changed since commit " + *t.PreviousCommitHash + ", task skipped")
+
+	return true
+}
+
+// matchChangedPath checks if the file path matches the glob pattern.
+// Pattern ending with "/**" matches all files inside the directory.
+func matchChangedPath(pattern string, file string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		return strings.HasPrefix(file, strings.TrimSuffix(pattern, "**"))
+	}
+
+	matched, _ := path.Match(pattern, file)
+	return matched
+}
+
+// runHook runs the hook command if it is set. Failure of the hook is logged and returned.
+func (t *LocalJob) runHook(name string, command *string, environmentVariables *[]string) error {
+	if command == nil || strings.TrimSpace(*command) == "" {
+		return nil
+	}
+
+	t.Log("Running " + name + ": " + *command)
+
+	err := t.Playbook.RunHook(*command, environmentVariables)
+	if err != nil {
+		t.Log(name + " failed: " + err.Error())
+	}
+
+	return err
+}
+
+// getExitCode returns exit code of the finished process by error returned by exec.Cmd.
+// It returns nil if the process was killed by signal or not started.
+func getExitCode(err error) *int {
+	code := 0
+
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil
+		}
+
+		code = exitErr.ExitCode()
+		if code < 0 {
+			return nil
+		}
+	}
+
+	return &code
 }
 
 func (t *LocalJob) prepareRun() error {
@@ -270,6 +651,13 @@ func (t *LocalJob) prepareRun() error {
 		if err != nil {
 			t.Log("Can't destroy repository access key, error: " + err.Error())
 		}
+
+		for _, repo := range t.AdditionalRepositories {
+			err = repo.SSHKey.Destroy()
+			if err != nil {
+				t.Log("Can't destroy access key of repository " + repo.Name + ", error: " + err.Error())
+			}
+		}
 	}()
 
 	t.Log("Preparing: " + strconv.Itoa(t.Task.ID))
@@ -282,19 +670,16 @@ func (t *LocalJob) prepareRun() error {
 	if t.Repository.GetType() == db.RepositoryLocal {
 		if _, err := os.Stat(t.Repository.GitURL); err != nil {
 			t.Log("Failed in finding static repository at " + t.Repository.GitURL + ": " + err.Error())
-			return err
-		}
-	} else {
-		if err := t.updateRepository(); err != nil {
-			t.Log("Failed updating repository: " + err.Error())
-			return err
-		}
-		if err := t.checkoutRepository(); err != nil {
-			t.Log("Failed to checkout repository to required commit: " + err.Error())
+			t.FailureReason = db.TaskFailureCheckout
 			return err
 		}
 	}
 
+	if err := gitOperations.run(t.checkoutRepositories); err != nil {
+		t.FailureReason = db.TaskFailureCheckout
+		return err
+	}
+
 	if err := t.installInventory(); err != nil {
 		t.Log("Failed to install inventory: " + err.Error())
 		return err
@@ -302,6 +687,7 @@ func (t *LocalJob) prepareRun() error {
 
 	if err := t.installRequirements(); err != nil {
 		t.Log("Running galaxy failed: " + err.Error())
+		t.FailureReason = db.TaskFailureGalaxy
 		return err
 	}
 
@@ -313,15 +699,65 @@ func (t *LocalJob) prepareRun() error {
 	return nil
 }
 
-func (t *LocalJob) updateRepository() error {
+// checkoutRepositories clones or pulls the template repository and additional repositories.
+// It runs under gitOperations limit, so it must not run the playbook or other long commands.
+func (t *LocalJob) checkoutRepositories() error {
+	if t.Repository.GetType() != db.RepositoryLocal {
+		if err := t.updateRepository(t.Repository); err != nil {
+			t.Log("Failed updating repository: " + err.Error())
+			return err
+		}
+		if err := t.checkoutRepository(); err != nil {
+			t.Log("Failed to checkout repository to required commit: " + err.Error())
+			return err
+		}
+	}
+
+	return t.updateAdditionalRepositories()
+}
+
+// updateAdditionalRepositories clones or pulls additional repositories of the template.
+// They are checked out into directories next to the template repository.
+func (t *LocalJob) updateAdditionalRepositories() error {
+	for _, repository := range t.AdditionalRepositories {
+		if repository.GetType() == db.RepositoryLocal {
+			if _, err := os.Stat(repository.GitURL); err != nil {
+				t.Log("Failed in finding static repository at " + repository.GitURL + ": " + err.Error())
+				return err
+			}
+			continue
+		}
+
+		t.Log("Updating additional repository " + repository.Name)
+
+		if err := t.updateRepository(repository); err != nil {
+			t.Log("Failed updating repository " + repository.Name + ": " + err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateRepository clones or pulls the repository. Credentials of the repository
+// are masked in the returned error, because git errors can contain the repository URL.
+func (t *LocalJob) updateRepository(repository db.Repository) (err error) {
+	defer func() {
+		if err != nil {
+			if secrets := repository.GetSecrets(); len(secrets) > 0 {
+				err = errors.New(lib.MaskSecrets(err.Error(), secrets...))
+			}
+		}
+	}()
+
 	repo := lib.GitRepository{
 		Logger:     t.Logger,
 		TemplateID: t.Template.ID,
-		Repository: t.Repository,
+		Repository: repository,
 		Client:     lib.CreateDefaultGitClient(),
 	}
 
-	err := repo.ValidateRepo()
+	err = repo.ValidateRepo()
 
 	if err != nil {
 		if !os.IsNotExist(err) {
@@ -386,6 +822,10 @@ func (t *LocalJob) checkoutRepository() error {
 }
 
 func (t *LocalJob) installRequirements() error {
+	if t.Template.GalaxyRequirements != nil && *t.Template.GalaxyRequirements != "" {
+		return t.installGalaxyRequirements(*t.Template.GalaxyRequirements)
+	}
+
 	if err := t.installCollectionsRequirements(); err != nil {
 		return err
 	}
@@ -406,8 +846,13 @@ func (t *LocalJob) getRepoPath() string {
 	return repo.GetFullPath()
 }
 
+// getWorkingDir returns the full path of the directory which the playbook runs in.
+func (t *LocalJob) getWorkingDir() string {
+	return path.Join(t.getRepoPath(), t.Template.GetWorkingDir())
+}
+
 func (t *LocalJob) installRolesRequirements() error {
-	requirementsFilePath := fmt.Sprintf("%s/roles/requirements.yml", t.getRepoPath())
+	requirementsFilePath := fmt.Sprintf("%s/roles/requirements.yml", t.getWorkingDir())
 	requirementsHashFilePath := fmt.Sprintf("%s.md5", requirementsFilePath)
 
 	if _, err := os.Stat(requirementsFilePath); err != nil {
@@ -436,7 +881,7 @@ func (t *LocalJob) installRolesRequirements() error {
 }
 
 func (t *LocalJob) getPlaybookDir() string {
-	playbookPath := path.Join(t.getRepoPath(), t.Template.Playbook)
+	playbookPath := path.Join(t.getWorkingDir(), t.Template.Playbook)
 
 	return path.Dir(playbookPath)
 }
@@ -470,11 +915,43 @@ func (t *LocalJob) installCollectionsRequirements() error {
 	return nil
 }
 
+// installGalaxyRequirements installs roles and collections from the requirements file
+// of the template into roles and collections directories next to the playbook.
+// They are installed before every run, so the task doesn't use stale versions.
+func (t *LocalJob) installGalaxyRequirements(requirements string) error {
+	requirementsFilePath := path.Join(t.getRepoPath(), strings.TrimLeft(requirements, "/"))
+
+	if _, err := os.Stat(requirementsFilePath); err != nil {
+		return fmt.Errorf("galaxy requirements file %s not found", requirements)
+	}
+
+	t.Log("Installing galaxy requirements from " + requirements)
+
+	playbookDir := t.getPlaybookDir()
+
+	return t.Playbook.RunGalaxy([]string{
+		"install",
+		"-r",
+		requirementsFilePath,
+		"--force",
+	}, &[]string{
+		"ANSIBLE_ROLES_PATH=" + path.Join(playbookDir, "roles"),
+		"ANSIBLE_COLLECTIONS_PATH=" + path.Join(playbookDir, "collections"),
+	})
+}
+
 func (t *LocalJob) runGalaxy(args []string) error {
-	return t.Playbook.RunGalaxy(args)
+	return t.Playbook.RunGalaxy(args, nil)
 }
 
 func (t *LocalJob) installVaultKeyFile() error {
+	for i := range t.Template.Vaults {
+		err := t.Template.Vaults[i].VaultKey.Install(db.AccessKeyRoleAnsiblePasswordVault)
+		if err != nil {
+			return err
+		}
+	}
+
 	if t.Template.VaultKeyID == nil {
 		return nil
 	}
@@ -0,0 +1,179 @@
+package tasks
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+// OutputArchiver stores the output of finished tasks outside of the database.
+type OutputArchiver interface {
+	// Upload stores the complete output of the task.
+	Upload(task db.Task, outputs []db.TaskOutput) error
+	// Download returns the archived output of the task.
+	// It returns db.ErrNotFound if the output is not archived.
+	Download(task db.Task) ([]db.TaskOutput, error)
+}
+
+// CreateOutputArchiver returns the archiver configured by the output_archive
+// config option or nil if archiving is disabled.
+func CreateOutputArchiver(settings util.OutputArchiveSettings) OutputArchiver {
+	if settings.S3.Bucket != "" {
+		return NewS3OutputArchiver(settings.S3)
+	}
+	return nil
+}
+
+// SetOutputArchiver enables archiving of the output of finished tasks.
+// It must be called before Run.
+func (p *TaskPool) SetOutputArchiver(archiver OutputArchiver) {
+	p.archiver = archiver
+}
+
+// archiveOutput schedules uploading of the task output. The request is passed through
+// the logger channel, so it is handled after all output records of the task are saved.
+func (t *TaskRunner) archiveOutput() {
+	if t.pool.archiver == nil {
+		return
+	}
+
+	t.pool.logger <- logRecord{
+		task:    t,
+		archive: true,
+	}
+}
+
+func (p *TaskPool) archiveTaskOutput(task db.Task) {
+	db.StoreSession(p.store, "archive task output", func() {
+		outputs, err := p.store.GetTaskOutputs(task.ProjectID, task.ID)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		if len(outputs) == 0 {
+			return
+		}
+
+		err = p.archiver.Upload(task, outputs)
+		if err != nil {
+			log.Error("Cannot archive output of task " + strconv.Itoa(task.ID) + ": " + err.Error())
+			return
+		}
+
+		err = p.markOutputArchived(task)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		if !util.Config.OutputArchive.PruneOutput {
+			return
+		}
+
+		err = p.store.DeleteTaskOutputs(task.ProjectID, task.ID)
+		if err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+// markOutputArchived saves OutputArchived flag of the task. The task is read again
+// because the task passed to the archiver can be outdated.
+func (p *TaskPool) markOutputArchived(task db.Task) error {
+	stored, err := p.store.GetTask(task.ProjectID, task.ID)
+	if err != nil {
+		return err
+	}
+
+	stored.OutputArchived = true
+	return p.store.UpdateTask(stored)
+}
+
+// isOutputArchived checks if the output of the task can be read from the archive.
+func (p *TaskPool) isOutputArchived(task db.Task) bool {
+	return p.archiver != nil && task.OutputArchived && task.End != nil
+}
+
+// getArchivedTaskOutputs returns the archived output records of the task
+// or an empty list if the output is not found in the archive.
+func (p *TaskPool) getArchivedTaskOutputs(task db.Task) ([]db.TaskOutput, error) {
+	outputs, err := p.archiver.Download(task)
+	if err == db.ErrNotFound {
+		return make([]db.TaskOutput, 0), nil
+	}
+
+	return outputs, err
+}
+
+// GetTaskOutputs returns output records of the task with ID greater than afterOutputID,
+// all records are returned if afterOutputID is 0. Output of the finished task
+// is read from the archive if it is pruned from the database.
+func (p *TaskPool) GetTaskOutputs(task db.Task, afterOutputID int) (outputs []db.TaskOutput, err error) {
+	if afterOutputID > 0 {
+		outputs, err = p.store.GetTaskOutputsSince(task.ProjectID, task.ID, afterOutputID)
+	} else {
+		outputs, err = p.store.GetTaskOutputs(task.ProjectID, task.ID)
+	}
+
+	if err != nil || len(outputs) > 0 || !p.isOutputArchived(task) {
+		return
+	}
+
+	if afterOutputID > 0 {
+		// there is no new output if the database still has the output of the task,
+		// the archive is read only if the output is pruned from the database
+		var total int
+		_, total, err = p.store.GetTaskOutputsPaged(task.ProjectID, task.ID, db.RetrieveQueryParams{Count: 1})
+		if err != nil || total > 0 {
+			return
+		}
+	}
+
+	archived, err := p.getArchivedTaskOutputs(task)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs = make([]db.TaskOutput, 0)
+	for _, o := range archived {
+		if o.ID > afterOutputID {
+			outputs = append(outputs, o)
+		}
+	}
+
+	return
+}
+
+// GetTaskOutputsPaged returns the page of output records of the task, see db.Store.GetTaskOutputsPaged.
+// Output of the finished task is read from the archive if it is pruned from the database.
+func (p *TaskPool) GetTaskOutputsPaged(task db.Task, params db.RetrieveQueryParams) (outputs []db.TaskOutput, total int, err error) {
+	outputs, total, err = p.store.GetTaskOutputsPaged(task.ProjectID, task.ID, params)
+
+	if err != nil || total > 0 || !p.isOutputArchived(task) {
+		return
+	}
+
+	archived, err := p.getArchivedTaskOutputs(task)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// archived records are uploaded in the order of db.Store.GetTaskOutputs
+	total = len(archived)
+
+	if params.Offset >= total {
+		outputs = []db.TaskOutput{}
+		return
+	}
+
+	end := total
+	if params.Count > 0 && params.Offset+params.Count < end {
+		end = params.Offset + params.Count
+	}
+
+	outputs = archived[params.Offset:end]
+	return
+}
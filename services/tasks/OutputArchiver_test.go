@@ -0,0 +1,333 @@
+package tasks
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+type fakeOutputArchiver struct {
+	mu        sync.Mutex
+	outputs   map[int][]db.TaskOutput
+	downloads int
+}
+
+func (a *fakeOutputArchiver) Upload(task db.Task, outputs []db.TaskOutput) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.outputs[task.ID] = outputs
+	return nil
+}
+
+func (a *fakeOutputArchiver) Download(task db.Task) ([]db.TaskOutput, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.downloads++
+	outputs, ok := a.outputs[task.ID]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return outputs, nil
+}
+
+func (a *fakeOutputArchiver) uploaded(taskID int) []db.TaskOutput {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.outputs[taskID]
+}
+
+func TestTaskPoolArchivesOutput(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		MaxParallelTasks: 10,
+		OutputArchive: util.OutputArchiveSettings{
+			PruneOutput: true,
+		},
+	})
+
+	archiver := &fakeOutputArchiver{outputs: make(map[int][]db.TaskOutput)}
+	pool.SetOutputArchiver(archiver)
+
+	tpl := createTestTemplate(t, store, db.Template{
+		Name:     "Deploy",
+		Playbook: "deploy.yml",
+	})
+
+	runner := createTestRunner(t, pool, tpl, db.Task{Status: db.TaskWaitingStatus}, &noopJob{})
+	task := runner.Task
+	pool.addTask(runner)
+
+	startTestPool(t, pool)
+
+	pool.runNextTask()
+
+	finished := waitTaskFinished(t, store, task)
+
+	var uploaded []db.TaskOutput
+	for i := 0; i < 100 && len(uploaded) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		uploaded = archiver.uploaded(task.ID)
+	}
+
+	if len(uploaded) == 0 {
+		t.Fatal("output must be uploaded when the task is finished")
+	}
+
+	found := false
+	for _, o := range uploaded {
+		if strings.HasPrefix(o.Output, "Started: ") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("uploaded output must contain the task log")
+	}
+
+	var outputs []db.TaskOutput
+	for i := 0; i < 100; i++ {
+		var err error
+		outputs, err = store.GetTaskOutputs(tpl.ProjectID, task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) == 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if len(outputs) != 0 {
+		t.Fatal("archived output must be pruned from the database")
+	}
+
+	finished, err := store.GetTask(tpl.ProjectID, finished.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !finished.OutputArchived {
+		t.Fatal("task must be marked as archived")
+	}
+
+	archived, err := pool.GetTaskOutputs(finished, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archived) != len(uploaded) {
+		t.Fatal("archived output must be returned")
+	}
+
+	archived, err = pool.GetTaskOutputs(finished, uploaded[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archived) != len(uploaded)-1 {
+		t.Fatal("archived output must be filtered by ID")
+	}
+
+	page, total, err := pool.GetTaskOutputsPaged(finished, db.RetrieveQueryParams{Offset: 1, Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != len(uploaded) || len(page) != 1 || page[0].ID != uploaded[1].ID {
+		t.Fatal("archived output must be paged")
+	}
+
+	stream, err := pool.GetTaskOutputNDJSON(tpl.ProjectID, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		lines++
+	}
+
+	if lines != len(uploaded) {
+		t.Fatal("archived output must be exported to NDJSON")
+	}
+}
+
+func TestTaskPoolReadsArchiveOnlyForArchivedTasks(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archiver := &fakeOutputArchiver{outputs: make(map[int][]db.TaskOutput)}
+	pool.SetOutputArchiver(archiver)
+
+	for _, task := range []db.Task{
+		{ProjectID: proj.ID, Status: db.TaskSuccessStatus},
+		{ProjectID: proj.ID, Status: db.TaskRunningStatus, OutputArchived: true},
+	} {
+		task, err = store.CreateTask(task)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		archiver.outputs[task.ID] = []db.TaskOutput{{ID: 1, TaskID: task.ID, Output: "archived"}}
+
+		outputs, err2 := pool.GetTaskOutputs(task, 0)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		if len(outputs) != 0 {
+			t.Fatalf("archive must not be read for the task with status %s", task.Status)
+		}
+
+		_, total, err2 := pool.GetTaskOutputsPaged(task, db.RetrieveQueryParams{})
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		if total != 0 {
+			t.Fatalf("archive must not be paged for the task with status %s", task.Status)
+		}
+	}
+}
+
+func TestTaskPoolReadsArchiveOnlyForPrunedOutput(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	archiver := &fakeOutputArchiver{outputs: make(map[int][]db.TaskOutput)}
+	pool.SetOutputArchiver(archiver)
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := time.Now()
+
+	task, err := store.CreateTask(db.Task{
+		ProjectID:      proj.ID,
+		Status:         db.TaskSuccessStatus,
+		End:            &end,
+		OutputArchived: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var outputs []db.TaskOutput
+
+	for _, line := range []string{"first", "second"} {
+		var output db.TaskOutput
+		output, err = store.CreateTaskOutput(db.TaskOutput{TaskID: task.ID, Output: line, Time: end})
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, output)
+	}
+
+	archiver.outputs[task.ID] = outputs
+
+	found, err := pool.GetTaskOutputs(task, outputs[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 0 || archiver.downloads != 0 {
+		t.Fatal("archive must not be read when the output is still in the database")
+	}
+
+	err = store.DeleteTaskOutputs(proj.ID, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err = pool.GetTaskOutputs(task, outputs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 1 || found[0].Output != "second" || archiver.downloads != 1 {
+		t.Fatal("archive must be read when the output is pruned from the database")
+	}
+}
+
+func TestS3OutputArchiver(t *testing.T) {
+	objects := make(map[string][]byte)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20231015/eu-west-1/s3/aws4_request, ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	archiver := NewS3OutputArchiver(util.S3Settings{
+		Endpoint:        server.URL,
+		Region:          "eu-west-1",
+		Bucket:          "logs",
+		Prefix:          "semaphore/",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	archiver.now = func() time.Time {
+		return time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+	}
+
+	task := db.Task{ID: 5, ProjectID: 2}
+
+	_, err := archiver.Download(task)
+	if err != db.ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	err = archiver.Upload(task, []db.TaskOutput{
+		{ID: 1, TaskID: 5, Seq: 1, Output: "PLAY [all]", Level: db.TaskOutputInfo},
+		{ID: 2, TaskID: 5, Seq: 2, Output: "fatal: [web1]", Level: db.TaskOutputError},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := objects["/logs/semaphore/project_2/task_5.json"]; !ok {
+		t.Fatal("output must be stored by the task key")
+	}
+
+	outputs, err := archiver.Download(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 2 || outputs[1].Output != "fatal: [web1]" || outputs[1].Level != db.TaskOutputError {
+		t.Fatal("downloaded output must match uploaded one")
+	}
+}
@@ -55,14 +55,25 @@ func (t *RemoteJob) Run(username string, incomingVersion *string) (err error) {
 		// TODO: call runner hook if it is provided. Used to start docker container
 	}
 
-	tsk.RunnerID = runner.ID
+	task := tsk.setRunner(runner.ID)
+
+	db.StoreSession(t.taskPool.store, "run remote job", func() {
+		err = t.taskPool.store.UpdateTask(task)
+	})
+
+	if err != nil {
+		return
+	}
+
+	var status db.TaskStatus
 
 	for {
 		time.Sleep(1_000_000_000)
 		tsk = t.taskPool.GetTask(t.Task.ID)
-		if tsk.Task.Status == db.TaskSuccessStatus ||
-			tsk.Task.Status == db.TaskStoppedStatus ||
-			tsk.Task.Status == db.TaskFailStatus {
+		status, _ = tsk.getStatus()
+		if status == db.TaskSuccessStatus ||
+			status == db.TaskStoppedStatus ||
+			status == db.TaskFailStatus {
 			break
 		}
 	}
@@ -71,7 +82,7 @@ func (t *RemoteJob) Run(username string, incomingVersion *string) (err error) {
 		// TODO: call runner hook if it is provided. Used to remove docker container
 	}
 
-	if tsk.Task.Status == db.TaskFailStatus {
+	if status == db.TaskFailStatus {
 		err = fmt.Errorf("task failed")
 	}
 
@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+func TestRemoteJobRecordsRunner(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := store.CreateRunner(db.Runner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskStartingStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := CreateTaskPool(store)
+
+	tsk := &TaskRunner{
+		Task: task,
+		pool: &pool,
+	}
+
+	pool.queue = append(pool.queue, tsk)
+
+	job := &RemoteJob{
+		Task:     task,
+		taskPool: &pool,
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- job.Run("", nil)
+	}()
+
+	for i := 0; ; i++ {
+		if tsk.GetRunnerID() != 0 {
+			break
+		}
+
+		if i == 100 {
+			t.Fatal("runner must be assigned to the task")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tsk.SetStatus(db.TaskSuccessStatus)
+
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := store.GetTask(proj.ID, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.RunnerID == nil || *saved.RunnerID != runner.ID {
+		t.Fatal("task must record the runner which executed it")
+	}
+
+	if saved.Status != db.TaskSuccessStatus {
+		t.Fatal("status of the task must be saved")
+	}
+
+	tasks, err := store.GetProjectTasks(proj.ID, db.TaskFilter{}, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 || tasks[0].RunnerID == nil || *tasks[0].RunnerID != runner.ID {
+		t.Fatal("task list must contain the runner of the task")
+	}
+}
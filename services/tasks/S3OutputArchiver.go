@@ -0,0 +1,171 @@
+package tasks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+// S3OutputArchiver stores task output as JSON objects in S3 compatible storage.
+// Objects are named <prefix>project_<project ID>/task_<task ID>.json.
+// Requests use path-style URLs and are signed with AWS Signature Version 4.
+type S3OutputArchiver struct {
+	Settings util.S3Settings
+	Client   *http.Client
+
+	// now returns current time, it is replaced in tests.
+	now func() time.Time
+}
+
+func NewS3OutputArchiver(settings util.S3Settings) *S3OutputArchiver {
+	if settings.Region == "" {
+		settings.Region = "us-east-1"
+	}
+
+	if settings.Endpoint == "" {
+		settings.Endpoint = "https://s3." + settings.Region + ".amazonaws.com"
+	}
+
+	return &S3OutputArchiver{
+		Settings: settings,
+		Client:   &http.Client{Timeout: time.Minute},
+		now:      time.Now,
+	}
+}
+
+func (a *S3OutputArchiver) objectURL(task db.Task) string {
+	key := a.Settings.Prefix +
+		"project_" + strconv.Itoa(task.ProjectID) +
+		"/task_" + strconv.Itoa(task.ID) + ".json"
+
+	segments := strings.Split(a.Settings.Bucket+"/"+key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+
+	return strings.TrimRight(a.Settings.Endpoint, "/") + "/" + strings.Join(segments, "/")
+}
+
+func (a *S3OutputArchiver) Upload(task db.Task, outputs []db.TaskOutput) error {
+	body, err := json.Marshal(outputs)
+	if err != nil {
+		return err
+	}
+
+	res, err := a.do(http.MethodPut, a.objectURL(task), body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 upload failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (a *S3OutputArchiver) Download(task db.Task) (outputs []db.TaskOutput, err error) {
+	res, err := a.do(http.MethodGet, a.objectURL(task), nil)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode == http.StatusNotFound {
+		err = db.ErrNotFound
+		return
+	}
+
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("s3 download failed with status %d", res.StatusCode)
+		return
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&outputs)
+	return
+}
+
+func (a *S3OutputArchiver) do(method string, rawURL string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	a.sign(req, body)
+
+	return a.Client.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers to the request.
+func (a *S3OutputArchiver) sign(req *http.Request, body []byte) {
+	now := a.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.Settings.Region + "/s3/aws4_request"
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+a.Settings.SecretAccessKey), date)
+	key = hmacSHA256(key, a.Settings.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 "+
+		"Credential="+a.Settings.AccessKeyID+"/"+scope+", "+
+		"SignedHeaders="+signedHeaders+", "+
+		"Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = io.WriteString(h, data)
+	return h.Sum(nil)
+}
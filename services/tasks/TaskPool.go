@@ -3,9 +3,11 @@ package tasks
 import (
 	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/lib"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -15,18 +17,52 @@ import (
 type logRecord struct {
 	task   *TaskRunner
 	output string
+	level  db.TaskOutputLevel
 	time   time.Time
+
+	// archive is set for the record which requests archiving of the task output
+	// instead of saving a line.
+	archive bool
 }
 
+const (
+	// logCoalesceThreshold is a fill level of the logger channel in percents.
+	// When the channel is filled above it, consecutive log records of the same task
+	// are combined to reduce number of database writes.
+	logCoalesceThreshold = 80
+
+	// maxCoalescedLines limits number of lines combined into a single output record.
+	maxCoalescedLines = 100
+)
+
+// defaultTaskStoppingTimeout is used if task_stopping_timeout is not configured.
+const defaultTaskStoppingTimeout = 5 * time.Minute
+
+// taskOutputPurgeInterval is how often output of tasks is purged according to
+// retention settings of projects.
+const taskOutputPurgeInterval = time.Hour
+
+// resourceLock is sent by the finished task to release resources locked by runNextTask.
 type resourceLock struct {
-	lock   bool
 	holder *TaskRunner
 }
 
 type TaskPool struct {
 	// queue contains list of tasks in status TaskWaitingStatus.
+	// Tasks are sorted by priority, tasks with the same priority are kept in the order of adding.
 	queue []*TaskRunner
 
+	// scheduled contains list of tasks which should be started later.
+	// Tasks are moved to queue when their ScheduledAt time arrives.
+	scheduled []*TaskRunner
+
+	// pausedProjects contains IDs of projects whose tasks are not started.
+	// Tasks of paused projects stay in the queue until the project is resumed.
+	pausedProjects map[int]bool
+
+	// queueLock protects queue, scheduled and pausedProjects.
+	queueLock sync.Mutex
+
 	// register channel used to put tasks to queue.
 	register chan *TaskRunner
 
@@ -35,15 +71,72 @@ type TaskPool struct {
 	// runningTasks contains tasks with status TaskRunningStatus.
 	runningTasks map[int]*TaskRunner
 
+	// runningLock protects activeProj and runningTasks. They are changed by runNextTask
+	// and by the resource locker goroutine of Run, other goroutines must read them under the lock.
+	runningLock sync.RWMutex
+
 	// logger channel used to putting log records to database.
 	logger chan logRecord
 
 	store db.Store
 
 	resourceLocker chan *resourceLock
+
+	// coalescedLogRecords is a number of log records which were combined
+	// with previous records of the same task. Use atomic operations to access it.
+	coalescedLogRecords uint64
+
+	// archiver uploads output of finished tasks, nil if archiving is disabled.
+	archiver OutputArchiver
+
+	// lastTaskOutputPurge is a time when output of tasks was purged last time.
+	lastTaskOutputPurge time.Time
+
+	// workers counts running tasks and background jobs started by Run, Stop waits for them.
+	workers sync.WaitGroup
+
+	// archives counts uploads of task output started by Run, Run waits for them when it is stopped.
+	archives sync.WaitGroup
+
+	// stop is closed by Stop, stopped is closed when Run returns.
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// queueLength and runningCount mirror sizes of queue and runningTasks for readers
+	// outside of Run goroutine. Use atomic operations to access them.
+	queueLength  int64
+	runningCount int64
+}
+
+// GetCoalescedLogRecords returns number of log records which were combined
+// with other records because the logger channel was nearly full.
+func (p *TaskPool) GetCoalescedLogRecords() uint64 {
+	return atomic.LoadUint64(&p.coalescedLogRecords)
+}
+
+// QueueLength returns number of tasks waiting in the queue. It is safe to call from any goroutine.
+// The value is refreshed by Run, so it can lag behind the queue for one iteration of the loop.
+func (p *TaskPool) QueueLength() int {
+	return int(atomic.LoadInt64(&p.queueLength))
 }
 
+// RunningCount returns number of running tasks. It is safe to call from any goroutine.
+func (p *TaskPool) RunningCount() int {
+	return int(atomic.LoadInt64(&p.runningCount))
+}
+
+// refreshQueueLength saves the current length of the queue for QueueLength.
+func (p *TaskPool) refreshQueueLength() {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	atomic.StoreInt64(&p.queueLength, int64(len(p.queue)))
+}
+
+// GetRunningTasks returns a snapshot of the running tasks. It is safe to call from any goroutine.
 func (p *TaskPool) GetRunningTasks() (res []*TaskRunner) {
+	p.runningLock.RLock()
+	defer p.runningLock.RUnlock()
+
 	for _, task := range p.runningTasks {
 		res = append(res, task)
 	}
@@ -51,6 +144,8 @@ func (p *TaskPool) GetRunningTasks() (res []*TaskRunner) {
 }
 
 func (p *TaskPool) GetTask(id int) (task *TaskRunner) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
 
 	for _, t := range p.queue {
 		if t.Task.ID == id {
@@ -60,7 +155,7 @@ func (p *TaskPool) GetTask(id int) (task *TaskRunner) {
 	}
 
 	if task == nil {
-		for _, t := range p.runningTasks {
+		for _, t := range p.scheduled {
 			if t.Task.ID == id {
 				task = t
 				break
@@ -68,120 +163,720 @@ func (p *TaskPool) GetTask(id int) (task *TaskRunner) {
 		}
 	}
 
+	if task == nil {
+		p.runningLock.RLock()
+		task = p.runningTasks[id]
+		p.runningLock.RUnlock()
+	}
+
 	return
 }
 
+// isRunning checks whether the task is running in the pool. It is safe to call from any goroutine.
+func (p *TaskPool) isRunning(taskID int) bool {
+	p.runningLock.RLock()
+	defer p.runningLock.RUnlock()
+
+	_, ok := p.runningTasks[taskID]
+	return ok
+}
+
+// reconcileZombieTasks fails tasks which are marked as active in the database
+// but are not in the pool. They are left by the server which crashed or was killed
+// while running them, so nobody will ever finish them.
+func (p *TaskPool) reconcileZombieTasks() {
+	tasks, err := p.store.GetTasksByStatus([]db.TaskStatus{
+		db.TaskStartingStatus,
+		db.TaskRunningStatus,
+		db.TaskStoppingStatus,
+	})
+
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, task := range tasks {
+		if p.isRunning(task.ID) {
+			continue
+		}
+
+		msg := "Task was interrupted by the server restart"
+
+		if task.Status == db.TaskStoppingStatus {
+			task.Status = db.TaskStoppedStatus
+		} else {
+			task.Status = db.TaskFailStatus
+			task.FailureReason = db.TaskFailureKilled
+		}
+
+		now := time.Now()
+		task.End = &now
+
+		err = p.store.UpdateTask(task)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		_, err = p.store.CreateTaskOutput(db.TaskOutput{
+			TaskID: task.ID,
+			Output: msg,
+			Level:  db.TaskOutputWarning,
+			Time:   now,
+		})
+		if err != nil {
+			log.Error(err)
+		}
+
+		log.Warn("Task " + strconv.Itoa(task.ID) + " marked as " + string(task.Status) + ": " + strings.ToLower(msg))
+	}
+}
+
+// restoreQueuedTasks puts waiting tasks from the database back to the queue.
+// They are lost from memory when the server restarts, but still wait for running.
+// Tasks are queued in order of creation, tasks which can't be restored are failed.
+func (p *TaskPool) restoreQueuedTasks() {
+	tasks, err := p.store.GetTasksByStatus([]db.TaskStatus{db.TaskWaitingStatus})
+
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].Created.Equal(tasks[j].Created) {
+			return tasks[i].ID < tasks[j].ID
+		}
+		return tasks[i].Created.Before(tasks[j].Created)
+	})
+
+	for _, task := range tasks {
+		if p.GetTask(task.ID) != nil {
+			continue
+		}
+
+		taskRunner, err := p.createTaskRunner(task)
+		if err != nil {
+			taskRunner.Log("Error: " + err.Error())
+			taskRunner.fail(db.TaskFailureOther)
+			continue
+		}
+
+		p.queueLock.Lock()
+		if task.ScheduledAt != nil && task.ScheduledAt.After(time.Now()) {
+			p.scheduled = append(p.scheduled, taskRunner)
+		} else {
+			p.enqueue(taskRunner)
+		}
+		p.queueLock.Unlock()
+
+		log.Info("Task " + strconv.Itoa(task.ID) + " restored to queue")
+	}
+}
+
 // nolint: gocyclo
 func (p *TaskPool) Run() {
 	ticker := time.NewTicker(5 * time.Second)
 
+	lockerStopped := make(chan struct{})
+
 	defer func() {
 		close(p.resourceLocker)
 		ticker.Stop()
+		<-lockerStopped
+		close(p.stopped)
 	}()
 
-	// Lock or unlock resources when running a TaskRunner
+	// Unlock resources when a TaskRunner is finished
 	go func(locker <-chan *resourceLock) {
+		defer close(lockerStopped)
 		for l := range locker {
-			t := l.holder
-
-			if l.lock {
-				if p.blocks(t) {
-					panic("Trying to lock an already locked resource!")
-				}
-
-				projTasks, ok := p.activeProj[t.Task.ProjectID]
-				if !ok {
-					projTasks = make(map[int]*TaskRunner)
-					p.activeProj[t.Task.ProjectID] = projTasks
-				}
-				projTasks[t.Task.ID] = t
-				p.runningTasks[t.Task.ID] = t
-				continue
-			}
-
-			if p.activeProj[t.Task.ProjectID] != nil && p.activeProj[t.Task.ProjectID][t.Task.ID] != nil {
-				delete(p.activeProj[t.Task.ProjectID], t.Task.ID)
-				if len(p.activeProj[t.Task.ProjectID]) == 0 {
-					delete(p.activeProj, t.Task.ProjectID)
-				}
-			}
-
-			delete(p.runningTasks, t.Task.ID)
+			p.unlockResources(l.holder)
 		}
 	}(p.resourceLocker)
 
+	db.StoreSession(p.store, "reconcile tasks", func() {
+		p.reconcileZombieTasks()
+		p.restoreQueuedTasks()
+	})
+
+	p.refreshQueueLength()
+
+	stop := p.stop
+
+	// workersStopped is closed when running tasks are finished after Stop is called
+	var workersStopped chan struct{}
+
 	for {
 		select {
 		case record := <-p.logger: // new log message which should be put to database
-			db.StoreSession(p.store, "logger", func() {
-				_, err := p.store.CreateTaskOutput(db.TaskOutput{
-					TaskID: record.task.Task.ID,
-					Output: record.output,
-					Time:   record.time,
-				})
-				if err != nil {
-					log.Error(err)
-				}
-			})
+			p.writeLogRecords(p.coalesceLogRecords(record))
 
 		case task := <-p.register: // new task created by API or schedule
 
 			db.StoreSession(p.store, "new task", func() {
-				p.queue = append(p.queue, task)
-				log.Debug(task)
-				msg := "Task " + strconv.Itoa(task.Task.ID) + " added to queue"
-				task.Log(msg)
-				log.Info(msg)
-				task.saveStatus()
+				p.addTask(task)
 			})
 
+			p.refreshQueueLength()
+
 		case <-ticker.C: // timer 5 seconds
-			if len(p.queue) == 0 {
-				break
+			p.dispatchScheduledTasks(time.Now())
+			p.forceStopStuckTasks(time.Now())
+			p.runNextTask()
+			p.refreshQueueLength()
+
+			if time.Since(p.lastTaskOutputPurge) >= taskOutputPurgeInterval {
+				p.lastTaskOutputPurge = time.Now()
+				p.workers.Add(1)
+				go func() {
+					defer p.workers.Done()
+					db.StoreSession(p.store, "purge task outputs", func() {
+						p.purgeTaskOutputs(time.Now())
+					})
+				}()
 			}
 
-			//get TaskRunner from top of queue
-			t := p.queue[0]
-			if t.Task.Status == db.TaskFailStatus {
-				//delete failed TaskRunner from queue
-				p.queue = p.queue[1:]
-				log.Info("Task " + strconv.Itoa(t.Task.ID) + " removed from queue")
-				break
+		case <-stop: // new tasks are not started, logs of running tasks are still written
+			stop = nil
+			ticker.Stop()
+
+			workersStopped = make(chan struct{})
+			go func() {
+				p.workers.Wait()
+				close(workersStopped)
+			}()
+
+		case <-workersStopped:
+			for len(p.logger) > 0 {
+				p.writeLogRecords([]logRecord{<-p.logger})
 			}
+			p.archives.Wait()
+			return
+		}
+	}
+}
 
-			if p.blocks(t) {
-				//move blocked TaskRunner to end of queue
-				p.queue = append(p.queue[1:], t)
-				break
+// Stop stops starting queued tasks and returns when running tasks are finished and Run is stopped.
+// Queued tasks stay waiting in the database, they are restored when the pool is started again.
+func (p *TaskPool) Stop() {
+	close(p.stop)
+	<-p.stopped
+}
+
+// writeLogRecords saves the log records to the database and starts uploads of task output
+// requested by the records. It must be called from Run.
+func (p *TaskPool) writeLogRecords(records []logRecord) {
+	db.StoreSession(p.store, "logger", func() {
+		for _, r := range records {
+			if r.archive {
+				task := r.task.Task
+				p.archives.Add(1)
+				go func() {
+					defer p.archives.Done()
+					p.archiveTaskOutput(task)
+				}()
+				continue
+			}
+
+			_, err := p.store.CreateTaskOutput(db.TaskOutput{
+				TaskID: r.task.Task.ID,
+				Output: r.output,
+				Level:  r.level,
+				Time:   r.time,
+			})
+			if err != nil {
+				log.Error(err)
+			}
+		}
+	})
+}
+
+// forceStopStuckTasks force stops running tasks which are in stopping state
+// longer than the configured timeout, for example because their process ignores the kill.
+func (p *TaskPool) forceStopStuckTasks(now time.Time) {
+	timeout := defaultTaskStoppingTimeout
+	if util.Config.TaskStoppingTimeout > 0 {
+		timeout = time.Duration(util.Config.TaskStoppingTimeout) * time.Second
+	}
+
+	for _, t := range p.GetRunningTasks() {
+		status, stoppingSince := t.getStatus()
+
+		if status != db.TaskStoppingStatus || stoppingSince == nil {
+			continue
+		}
+
+		if now.Sub(*stoppingSince) < timeout {
+			continue
+		}
+
+		log.Warn("Task " + strconv.Itoa(t.Task.ID) + " is stopping longer than " + timeout.String() + ", force stopping it")
+
+		db.StoreSession(p.store, "force stop task", func() {
+			t.forceStop(timeout)
+		})
+	}
+}
+
+// purgeTaskOutputs deletes output of tasks which is older than TaskOutputRetentionDays
+// of the project and finished tasks which are older than TaskRetentionDays of the project.
+func (p *TaskPool) purgeTaskOutputs(now time.Time) {
+	projects, err := p.store.GetAllProjects()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, project := range projects {
+		if project.TaskOutputRetentionDays > 0 {
+			p.pruneProjectTasks(project, now.AddDate(0, 0, -project.TaskOutputRetentionDays))
+		}
+
+		if project.TaskRetentionDays > 0 {
+			p.pruneProjectTasks(project, now.AddDate(0, 0, -project.TaskRetentionDays), db.PruneFinishedTasks)
+		}
+	}
+}
+
+func (p *TaskPool) pruneProjectTasks(project db.Project, olderThan time.Time, options ...db.TaskPruneOption) {
+	outputs, tasks, err := p.store.PruneTaskOutputs(project.ID, olderThan, options...)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if outputs > 0 {
+		log.Info("Purged " + strconv.Itoa(outputs) + " task output records of project " + strconv.Itoa(project.ID))
+	}
+
+	if tasks > 0 {
+		log.Info("Purged " + strconv.Itoa(tasks) + " tasks of project " + strconv.Itoa(project.ID))
+	}
+}
+
+// coalesceLogRecords returns the record as is if the logger channel has enough free space.
+// Otherwise it reads records buffered in the channel and combines consecutive records
+// of the same task into multiline records, so the channel is drained with fewer database writes.
+func (p *TaskPool) coalesceLogRecords(first logRecord) []logRecord {
+	buffered := len(p.logger)
+
+	if buffered*100 < cap(p.logger)*logCoalesceThreshold {
+		return []logRecord{first}
+	}
+
+	records := []logRecord{first}
+	lines := 1
+
+	// only this goroutine reads the channel, so reading buffered records doesn't block
+	for i := 0; i < buffered; i++ {
+		r := <-p.logger
+		last := &records[len(records)-1]
+
+		if r.task == last.task && !r.archive && !last.archive && lines < maxCoalescedLines {
+			last.output += "\n" + r.output
+			if r.level.Severity() > last.level.Severity() {
+				last.level = r.level
 			}
+			lines++
+			atomic.AddUint64(&p.coalescedLogRecords, 1)
+			continue
+		}
+
+		records = append(records, r)
+		lines = 1
+	}
 
-			log.Info("Set resource locker with TaskRunner " + strconv.Itoa(t.Task.ID))
-			p.resourceLocker <- &resourceLock{lock: true, holder: t}
+	return records
+}
 
-			go t.run()
+// runNextTask starts the first runnable task of the queue. The queue is sorted by priority,
+// so tasks with higher priority are started first and tasks with the same priority
+// are started in the order of the queue. Blocked tasks are moved to the end of their priority.
+func (p *TaskPool) runNextTask() {
+	var next *TaskRunner
+	var blocked []*TaskRunner
+
+	// blocks reads the project from the database, so queueLock is not held while checking
+	for _, t := range p.getRunnableTasks() {
+		if p.blocks(t) {
+			blocked = append(blocked, t)
+			continue
+		}
+
+		next = t
+		break
+	}
 
-			p.queue = p.queue[1:]
+	p.queueLock.Lock()
+
+	for _, t := range blocked {
+		if p.removeFromQueue(t) {
+			p.enqueue(t)
+		}
+	}
+
+	// the task can be cancelled while its resources are checked
+	if next != nil && p.removeFromQueue(next) {
+		log.Info("Set resource locker with TaskRunner " + strconv.Itoa(next.Task.ID))
+		p.lockResources(next)
+	} else {
+		next = nil
+	}
+
+	p.queueLock.Unlock()
+
+	if next == nil {
+		return
+	}
+
+	p.workers.Add(1)
+	go func() {
+		defer p.workers.Done()
+		next.run()
+	}()
+
+	log.Info("Task " + strconv.Itoa(next.Task.ID) + " removed from queue")
+}
+
+// getRunnableTasks returns queued tasks which can be started if their resources are not locked.
+// Failed tasks are removed from the queue, paused and not approved tasks are moved to the end of their priority.
+func (p *TaskPool) getRunnableTasks() (res []*TaskRunner) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	queue := make([]*TaskRunner, len(p.queue))
+	copy(queue, p.queue)
+
+	for _, t := range queue {
+		if t.Task.Status == db.TaskFailStatus {
+			//delete failed TaskRunner from queue
+			p.removeFromQueue(t)
 			log.Info("Task " + strconv.Itoa(t.Task.ID) + " removed from queue")
+			continue
+		}
+
+		if t.Task.ApprovalStatus == db.TaskApprovalPending || p.pausedProjects[t.Task.ProjectID] {
+			p.removeFromQueue(t)
+			p.enqueue(t)
+			continue
 		}
+
+		res = append(res, t)
 	}
+
+	return
 }
 
-func (p *TaskPool) blocks(t *TaskRunner) bool {
+// lockResources marks the task as running, so the pool counts it in limits of running tasks.
+func (p *TaskPool) lockResources(t *TaskRunner) {
+	p.runningLock.Lock()
+	defer p.runningLock.Unlock()
 
-	if len(p.runningTasks) >= util.Config.MaxParallelTasks {
-		return true
+	projTasks, ok := p.activeProj[t.Task.ProjectID]
+	if !ok {
+		projTasks = make(map[int]*TaskRunner)
+		p.activeProj[t.Task.ProjectID] = projTasks
 	}
+	projTasks[t.Task.ID] = t
+	p.runningTasks[t.Task.ID] = t
+	atomic.StoreInt64(&p.runningCount, int64(len(p.runningTasks)))
+}
 
-	if p.activeProj[t.Task.ProjectID] == nil || len(p.activeProj[t.Task.ProjectID]) == 0 {
-		return false
+// unlockResources removes the finished task from running tasks.
+func (p *TaskPool) unlockResources(t *TaskRunner) {
+	p.runningLock.Lock()
+	defer p.runningLock.Unlock()
+
+	if p.activeProj[t.Task.ProjectID] != nil && p.activeProj[t.Task.ProjectID][t.Task.ID] != nil {
+		delete(p.activeProj[t.Task.ProjectID], t.Task.ID)
+		if len(p.activeProj[t.Task.ProjectID]) == 0 {
+			delete(p.activeProj, t.Task.ProjectID)
+		}
 	}
 
-	for _, r := range p.activeProj[t.Task.ProjectID] {
-		if r.Template.ID == t.Task.TemplateID {
+	delete(p.runningTasks, t.Task.ID)
+	atomic.StoreInt64(&p.runningCount, int64(len(p.runningTasks)))
+}
+
+// enqueue puts the task after the queued tasks with the same or higher priority, queueLock must be held.
+func (p *TaskPool) enqueue(t *TaskRunner) {
+	i := len(p.queue)
+	for i > 0 && p.queue[i-1].Task.Priority < t.Task.Priority {
+		i--
+	}
+
+	p.queue = append(p.queue, nil)
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = t
+}
+
+// removeFromQueue removes the task from the queue, queueLock must be held.
+// It returns false if the task is not in the queue.
+func (p *TaskPool) removeFromQueue(t *TaskRunner) bool {
+	for i, queued := range p.queue {
+		if queued == t {
+			p.queue = append(p.queue[:i:i], p.queue[i+1:]...)
 			return true
 		}
 	}
+	return false
+}
+
+// PauseProject stops starting tasks of the project. New tasks of the project
+// are queued and wait until the project is resumed, running tasks continue.
+func (p *TaskPool) PauseProject(projectID int) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	p.pausedProjects[projectID] = true
+	log.Info("Task processing of project " + strconv.Itoa(projectID) + " paused")
+}
+
+// ResumeProject allows starting tasks of the project paused by PauseProject.
+func (p *TaskPool) ResumeProject(projectID int) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	delete(p.pausedProjects, projectID)
+	log.Info("Task processing of project " + strconv.Itoa(projectID) + " resumed")
+}
+
+// IsProjectPaused returns true if task processing of the project is paused.
+func (p *TaskPool) IsProjectPaused(projectID int) bool {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	return p.pausedProjects[projectID]
+}
+
+// MoveTaskInQueue moves the waiting task to the position in the queue, 0 is the top of the queue.
+// Tasks with higher priority always stay before tasks with lower priority,
+// so the position is clamped to the positions of the tasks with the same priority.
+func (p *TaskPool) MoveTaskInQueue(taskID int, position int) error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	index := -1
+	for i, t := range p.queue {
+		if t.Task.ID == taskID {
+			index = i
+			break
+		}
+	}
+
+	if index < 0 {
+		return db.ErrNotFound
+	}
+
+	t := p.queue[index]
+
+	first := index
+	for first > 0 && p.queue[first-1].Task.Priority == t.Task.Priority {
+		first--
+	}
+
+	last := index
+	for last < len(p.queue)-1 && p.queue[last+1].Task.Priority == t.Task.Priority {
+		last++
+	}
+
+	if position < first {
+		position = first
+	}
+
+	if position > last {
+		position = last
+	}
+
+	queue := make([]*TaskRunner, 0, len(p.queue))
+	queue = append(queue, p.queue[:index]...)
+	queue = append(queue, p.queue[index+1:]...)
+
+	queue = append(queue[:position], append([]*TaskRunner{t}, queue[position:]...)...)
+
+	p.queue = queue
+
+	return nil
+}
+
+// ApproveTask allows the task waiting for approval to run.
+// The task can not be approved by the user who created it.
+func (p *TaskPool) ApproveTask(taskID int, approverUserID int) error {
+	p.queueLock.Lock()
+
+	var task *TaskRunner
+
+	for _, tasks := range [][]*TaskRunner{p.queue, p.scheduled} {
+		for _, t := range tasks {
+			if t.Task.ID == taskID {
+				task = t
+				break
+			}
+		}
+	}
+
+	if task == nil {
+		p.queueLock.Unlock()
+		return db.ErrNotFound
+	}
+
+	if task.Task.ApprovalStatus != db.TaskApprovalPending {
+		p.queueLock.Unlock()
+		return &db.ValidationError{Message: "Task is not waiting for approval"}
+	}
+
+	if task.Task.UserID != nil && *task.Task.UserID == approverUserID {
+		p.queueLock.Unlock()
+		return &db.ValidationError{Message: "Task can not be approved by the user who created it"}
+	}
+
+	task.Task.ApprovalStatus = db.TaskApprovalApproved
+	task.Task.ApprovedBy = &approverUserID
+
+	p.queueLock.Unlock()
+
+	msg := "Task " + strconv.Itoa(taskID) + " approved by user " + strconv.Itoa(approverUserID)
+	task.Log(msg)
+	log.Info(msg)
+	task.saveStatus()
+
+	return nil
+}
+
+// ResolveTaskEnvironment returns the variables which the task gets when it runs.
+// See TaskRunner.ResolveTaskEnvironment for the order of sources.
+func (p *TaskPool) ResolveTaskEnvironment(task db.Task) (map[string]interface{}, error) {
+	runner := p.GetTask(task.ID)
+	if runner == nil {
+		runner = &TaskRunner{pool: p}
+	}
+	return runner.ResolveTaskEnvironment(task)
+}
+
+// removeQueuedTask removes the waiting task from the queue or from the scheduled tasks.
+// It returns nil if the task is not waiting in the pool.
+func (p *TaskPool) removeQueuedTask(taskID int) *TaskRunner {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	for i, t := range p.queue {
+		if t.Task.ID == taskID && t.Task.Status == db.TaskWaitingStatus {
+			p.queue = append(p.queue[:i:i], p.queue[i+1:]...)
+			return t
+		}
+	}
+
+	for i, t := range p.scheduled {
+		if t.Task.ID == taskID && t.Task.Status == db.TaskWaitingStatus {
+			p.scheduled = append(p.scheduled[:i:i], p.scheduled[i+1:]...)
+			return t
+		}
+	}
+
+	return nil
+}
+
+// ClearQueue cancels all tasks of the project waiting in the queue and returns their number.
+// Running tasks and tasks scheduled for later are not affected.
+func (p *TaskPool) ClearQueue(projectID int) (int, error) {
+	p.queueLock.Lock()
+
+	cleared := make([]*TaskRunner, 0)
+	queue := make([]*TaskRunner, 0, len(p.queue))
+
+	for _, t := range p.queue {
+		if t.Task.ProjectID == projectID && t.Task.Status == db.TaskWaitingStatus {
+			cleared = append(cleared, t)
+			continue
+		}
+		queue = append(queue, t)
+	}
+
+	p.queue = queue
+
+	p.queueLock.Unlock()
+
+	for _, t := range cleared {
+		t.cancel()
+	}
+
+	if len(cleared) > 0 {
+		log.Info("Queue of project " + strconv.Itoa(projectID) + " cleared, " + strconv.Itoa(len(cleared)) + " tasks cancelled")
+	}
+
+	return len(cleared), nil
+}
+
+// addTask puts the task to the queue or holds it
+// until the ScheduledAt time if it is in the future.
+func (p *TaskPool) addTask(task *TaskRunner) {
+	var msg string
+
+	// the task created while the pool was starting can be already restored from the database
+	if p.GetTask(task.Task.ID) != nil {
+		return
+	}
+
+	p.queueLock.Lock()
+	if task.Task.ScheduledAt != nil && task.Task.ScheduledAt.After(time.Now()) {
+		p.scheduled = append(p.scheduled, task)
+		msg = "Task " + strconv.Itoa(task.Task.ID) + " scheduled at " + task.Task.ScheduledAt.Format(time.RFC3339)
+	} else {
+		p.enqueue(task)
+		msg = "Task " + strconv.Itoa(task.Task.ID) + " added to queue"
+	}
+	if task.Task.ApprovalStatus == db.TaskApprovalPending {
+		msg += ", waiting for approval"
+	}
+	p.queueLock.Unlock()
+
+	log.Debug(task)
+	task.Log(msg)
+	log.Info(msg)
+	task.saveStatus()
+}
+
+// dispatchScheduledTasks moves scheduled tasks which time arrived to the queue.
+// Tasks stopped while waiting are dropped.
+func (p *TaskPool) dispatchScheduledTasks(now time.Time) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	scheduled := make([]*TaskRunner, 0)
+
+	for _, t := range p.scheduled {
+		if t.Task.Status.IsFinished() {
+			continue
+		}
+
+		if t.Task.ScheduledAt.After(now) {
+			scheduled = append(scheduled, t)
+			continue
+		}
+
+		p.enqueue(t)
+		msg := "Task " + strconv.Itoa(t.Task.ID) + " added to queue"
+		t.Log(msg)
+		log.Info(msg)
+	}
+
+	p.scheduled = scheduled
+}
+
+func (p *TaskPool) blocks(t *TaskRunner) bool {
+	p.runningLock.RLock()
+	blocked, projectRunning := p.blocksByRunningTasks(t)
+	p.runningLock.RUnlock()
+
+	if blocked {
+		return true
+	}
+
+	if projectRunning == 0 {
+		return false
+	}
 
 	proj, err := p.store.GetProject(t.Task.ProjectID)
 
@@ -190,7 +885,64 @@ func (p *TaskPool) blocks(t *TaskRunner) bool {
 		return false
 	}
 
-	return proj.MaxParallelTasks > 0 && len(p.activeProj[t.Task.ProjectID]) >= proj.MaxParallelTasks
+	return proj.MaxParallelTasks > 0 && projectRunning >= proj.MaxParallelTasks
+}
+
+// blocksByRunningTasks checks the global, runner tag and template limits of running tasks.
+// It also returns number of running tasks of the project of the task. runningLock must be held.
+func (p *TaskPool) blocksByRunningTasks(t *TaskRunner) (bool, int) {
+	if len(p.runningTasks) >= util.Config.MaxParallelTasks {
+		return true, 0
+	}
+
+	if p.blocksByRunnerTag(t) {
+		return true, 0
+	}
+
+	projTasks := p.activeProj[t.Task.ProjectID]
+
+	for _, r := range projTasks {
+		if r.Template.ID == t.Task.TemplateID {
+			return true, 0
+		}
+	}
+
+	return false, len(projTasks)
+}
+
+// blocksByRunnerTag checks whether the limit of running tasks
+// with the same runner tag as the task template is reached. runningLock must be held.
+func (p *TaskPool) blocksByRunnerTag(t *TaskRunner) bool {
+	if t.Template.RunnerTag == nil || *t.Template.RunnerTag == "" {
+		return false
+	}
+
+	limit := util.Config.RunnerTagMaxParallelTasks[*t.Template.RunnerTag]
+	if limit < 1 {
+		return false
+	}
+
+	running := 0
+	for _, r := range p.runningTasks {
+		if r.Template.RunnerTag != nil && *r.Template.RunnerTag == *t.Template.RunnerTag {
+			running++
+		}
+	}
+
+	return running >= limit
+}
+
+// isQueueFull checks whether the number of waiting tasks reached MaxQueueLength.
+// Running tasks are not counted.
+func (p *TaskPool) isQueueFull() bool {
+	if util.Config.MaxQueueLength < 1 {
+		return false
+	}
+
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+
+	return len(p.queue)+len(p.scheduled) >= util.Config.MaxQueueLength
 }
 
 func CreateTaskPool(store db.Store) TaskPool {
@@ -198,14 +950,22 @@ func CreateTaskPool(store db.Store) TaskPool {
 		queue:          make([]*TaskRunner, 0), // queue of waiting tasks
 		register:       make(chan *TaskRunner), // add TaskRunner to queue
 		activeProj:     make(map[int]map[int]*TaskRunner),
+		pausedProjects: make(map[int]bool),
 		runningTasks:   make(map[int]*TaskRunner),   // working tasks
 		logger:         make(chan logRecord, 10000), // store log records to database
 		store:          store,
 		resourceLocker: make(chan *resourceLock),
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
 	}
 }
 
 func (p *TaskPool) StopTask(targetTask db.Task, forceStop bool) error {
+	if tsk := p.removeQueuedTask(targetTask.ID); tsk != nil {
+		tsk.cancel()
+		return nil
+	}
+
 	tsk := p.GetTask(targetTask.ID)
 	if tsk == nil { // task not active, but exists in database
 		tsk = &TaskRunner{
@@ -235,58 +995,73 @@ func (p *TaskPool) StopTask(targetTask db.Task, forceStop bool) error {
 	return nil
 }
 
-func getNextBuildVersion(startVersion string, currentVersion string) string {
-	re := regexp.MustCompile(`^(.*[^\d])?(\d+)([^\d].*)?$`)
-	m := re.FindStringSubmatch(startVersion)
-
-	if m == nil {
-		return startVersion
+// createTask saves the new task. Tasks of build templates get the next version,
+// it is reserved by the store, so builds created at the same time never get the same version.
+func (p *TaskPool) createTask(taskObj db.Task, tpl db.Template) (db.Task, error) {
+	if tpl.Type != db.TemplateBuild {
+		return p.store.CreateTask(taskObj)
 	}
 
-	var prefix, suffix, body string
-
-	switch len(m) - 1 {
-	case 3:
-		prefix = m[1]
-		body = m[2]
-		suffix = m[3]
-	case 2:
-		if _, err := strconv.Atoi(m[1]); err == nil {
-			body = m[1]
-			suffix = m[2]
-		} else {
-			prefix = m[1]
-			body = m[2]
-		}
-	case 1:
-		body = m[1]
-	default:
-		return startVersion
-	}
+	return p.store.CreateBuildTask(taskObj, tpl.StartVersion)
+}
 
-	if !strings.HasPrefix(currentVersion, prefix) ||
-		!strings.HasSuffix(currentVersion, suffix) {
-		return startVersion
+// createTaskRunner loads details of the task and creates the job which runs it.
+// The runner is returned even on error, so the error can be logged to the task.
+func (p *TaskPool) createTaskRunner(task db.Task) (*TaskRunner, error) {
+	taskRunner := &TaskRunner{
+		Task: task,
+		pool: p,
 	}
 
-	curr, err := strconv.Atoi(currentVersion[len(prefix) : len(currentVersion)-len(suffix)])
+	err := taskRunner.populateDetails()
 	if err != nil {
-		return startVersion
+		return taskRunner, err
 	}
 
-	start, err := strconv.Atoi(body)
-	if err != nil {
-		panic(err)
-	}
+	var job Job
 
-	var newVer int
-	if start > curr {
-		newVer = start
+	if util.Config.UseRemoteRunner {
+		job = &RemoteJob{
+			Task:        taskRunner.Task,
+			Template:    taskRunner.Template,
+			Inventory:   taskRunner.Inventory,
+			Repository:  taskRunner.Repository,
+			Environment: taskRunner.Environment,
+			Logger:      taskRunner,
+			Playbook: &lib.AnsiblePlaybook{
+				Logger:     taskRunner,
+				TemplateID: taskRunner.Template.ID,
+				Repository: taskRunner.Repository,
+				WorkingDir: taskRunner.Template.GetWorkingDir(),
+			},
+			taskPool: p,
+		}
 	} else {
-		newVer = curr + 1
+		job = &LocalJob{
+			Task:        taskRunner.Task,
+			Template:    taskRunner.Template,
+			Inventory:   taskRunner.Inventory,
+			Repository:  taskRunner.Repository,
+			Environment: taskRunner.Environment,
+			Logger:      taskRunner,
+			Playbook: &lib.AnsiblePlaybook{
+				Logger:     taskRunner,
+				TemplateID: taskRunner.Template.ID,
+				Repository: taskRunner.Repository,
+				WorkingDir: taskRunner.Template.GetWorkingDir(),
+			},
+
+			AdditionalRepositories: taskRunner.AdditionalRepositories,
+
+			Project:  taskRunner.Project,
+			Schedule: taskRunner.Schedule,
+			User:     taskRunner.User,
+		}
 	}
 
-	return prefix + strconv.Itoa(newVer) + suffix
+	taskRunner.job = job
+
+	return taskRunner, nil
 }
 
 func (p *TaskPool) AddTask(taskObj db.Task, userID *int, projectID int) (newTask db.Task, err error) {
@@ -295,96 +1070,96 @@ func (p *TaskPool) AddTask(taskObj db.Task, userID *int, projectID int) (newTask
 	taskObj.UserID = userID
 	taskObj.ProjectID = projectID
 
-	tpl, err := p.store.GetTemplate(projectID, taskObj.TemplateID)
+	project, err := p.store.GetProject(projectID)
 	if err != nil {
 		return
 	}
 
-	err = taskObj.ValidateNewTask(tpl)
+	if project.Archived {
+		err = &db.ValidationError{Message: "Project is archived"}
+		return
+	}
+
+	tpl, err := p.store.GetTemplate(projectID, taskObj.TemplateID)
 	if err != nil {
 		return
 	}
 
-	if tpl.Type == db.TemplateBuild { // get next version for TaskRunner if it is a Build
-		var builds []db.TaskWithTpl
-		builds, err = p.store.GetTemplateTasks(tpl.ProjectID, tpl.ID, db.RetrieveQueryParams{Count: 1})
-		if err != nil {
-			return
-		}
-		if len(builds) == 0 || builds[0].Version == nil {
-			taskObj.Version = tpl.StartVersion
-		} else {
-			v := getNextBuildVersion(*tpl.StartVersion, *builds[0].Version)
-			taskObj.Version = &v
-		}
+	if tpl.Archived {
+		err = db.ErrInvalidOperation
+		return
 	}
 
-	newTask, err = p.store.CreateTask(taskObj)
+	err = taskObj.ValidateNewTask(tpl)
 	if err != nil {
 		return
 	}
 
-	taskRunner := TaskRunner{
-		Task: newTask,
-		pool: p,
+	err = p.preparePipelineTask(&taskObj)
+	if err != nil {
+		return
 	}
 
-	err = taskRunner.populateDetails()
+	err = p.prepareInventorySnapshot(&taskObj, tpl)
 	if err != nil {
-		taskRunner.Log("Error: " + err.Error())
-		taskRunner.SetStatus(db.TaskFailStatus)
 		return
 	}
 
-	var job Job
+	if taskObj.Verbosity == 0 {
+		taskObj.Verbosity = tpl.Verbosity
+	}
 
-	if util.Config.UseRemoteRunner {
-		job = &RemoteJob{
-			Task:        taskRunner.Task,
-			Template:    taskRunner.Template,
-			Inventory:   taskRunner.Inventory,
-			Repository:  taskRunner.Repository,
-			Environment: taskRunner.Environment,
-			Logger:      &taskRunner,
-			Playbook: &lib.AnsiblePlaybook{
-				Logger:     &taskRunner,
-				TemplateID: taskRunner.Template.ID,
-				Repository: taskRunner.Repository,
-			},
-			taskPool: p,
+	if tpl.AllowedWindow != nil {
+		startAt := taskObj.Created
+		if taskObj.ScheduledAt != nil && taskObj.ScheduledAt.After(startAt) {
+			startAt = *taskObj.ScheduledAt
 		}
-	} else {
-		job = &LocalJob{
-			Task:        taskRunner.Task,
-			Template:    taskRunner.Template,
-			Inventory:   taskRunner.Inventory,
-			Repository:  taskRunner.Repository,
-			Environment: taskRunner.Environment,
-			Logger:      &taskRunner,
-			Playbook: &lib.AnsiblePlaybook{
-				Logger:     &taskRunner,
-				TemplateID: taskRunner.Template.ID,
-				Repository: taskRunner.Repository,
-			},
+
+		if !tpl.AllowedWindow.Contains(startAt) {
+			if !tpl.AllowedWindow.Hold {
+				err = &db.ValidationError{Message: "Template can run only in its allowed time window"}
+				return
+			}
+
+			openAt := tpl.AllowedWindow.NextOpen(startAt)
+			taskObj.ScheduledAt = &openAt
 		}
 	}
 
+	if p.isQueueFull() {
+		err = &db.ValidationError{Message: "Task queue is full, try again later"}
+		return
+	}
+
+	taskObj.ApprovalStatus = ""
+	taskObj.ApprovedBy = nil
+	if tpl.ApprovalRequired {
+		taskObj.ApprovalStatus = db.TaskApprovalPending
+	}
+
+	newTask, err = p.createTask(taskObj, tpl)
 	if err != nil {
 		return
 	}
 
-	taskRunner.job = job
+	taskRunner, err := p.createTaskRunner(newTask)
+	if err != nil {
+		taskRunner.Log("Error: " + err.Error())
+		taskRunner.fail(db.TaskFailureOther)
+		return
+	}
 
-	p.register <- &taskRunner
+	p.register <- taskRunner
 
 	objType := db.EventTask
 	desc := "Task ID " + strconv.Itoa(newTask.ID) + " queued for running"
 	_, err = p.store.CreateEvent(db.Event{
-		UserID:      userID,
-		ProjectID:   &projectID,
-		ObjectType:  &objType,
-		ObjectID:    &newTask.ID,
-		Description: &desc,
+		UserID:        userID,
+		ProjectID:     &projectID,
+		ObjectType:    &objType,
+		ObjectID:      &newTask.ID,
+		Description:   &desc,
+		CorrelationID: db.TaskCorrelationID(newTask.ID),
 	})
 
 	return
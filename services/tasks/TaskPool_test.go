@@ -0,0 +1,1301 @@
+package tasks
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+type noopJob struct{}
+
+func (j *noopJob) Run(username string, incomingVersion *string) error {
+	return nil
+}
+
+func (j *noopJob) Kill() {}
+
+// stuckJob simulates the process which ignores kill.
+type stuckJob struct {
+	kills int
+}
+
+func (j *stuckJob) Run(username string, incomingVersion *string) error {
+	return nil
+}
+
+func (j *stuckJob) Kill() {
+	j.kills++
+}
+
+// createTestPool sets the config for the test and creates the pool with an empty store.
+// The pool is not started, the previous config is restored when the test is finished.
+func createTestPool(t *testing.T, config util.ConfigType) (*TaskPool, db.Store) {
+	previous := util.Config
+	util.Config = &config
+	t.Cleanup(func() {
+		util.Config = previous
+	})
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	pool := CreateTaskPool(store)
+
+	return &pool, store
+}
+
+// startTestPool starts the pool and stops it when the test is finished,
+// so tasks of the pool don't outlive the test and don't read config of other tests.
+func startTestPool(t *testing.T, pool *TaskPool) {
+	go pool.Run()
+	t.Cleanup(pool.Stop)
+}
+
+// createTestTemplate creates the template in a new project if ProjectID of the template is not set.
+// The template gets a repository and an inventory, so its tasks can be added with TaskPool.AddTask.
+func createTestTemplate(t *testing.T, store db.Store, tpl db.Template) db.Template {
+	if tpl.ProjectID == 0 {
+		proj, err := store.CreateProject(db.Project{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl.ProjectID = proj.ID
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		ProjectID: &tpl.ProjectID,
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.CreateRepository(db.Repository{
+		ProjectID: tpl.ProjectID,
+		SSHKeyID:  key.ID,
+		Name:      "Test",
+		GitURL:    "git@example.com:test/test",
+		GitBranch: "master",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: tpl.ProjectID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tpl.Name == "" {
+		tpl.Name = "Test"
+	}
+
+	if tpl.Playbook == "" {
+		tpl.Playbook = "test.yml"
+	}
+
+	tpl.RepositoryID = repo.ID
+	tpl.InventoryID = &inv.ID
+
+	tpl, err = store.CreateTemplate(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tpl
+}
+
+// createTestRunner saves the task of the template and returns the runner of the task with the job.
+// The runner is not added to the pool.
+func createTestRunner(t *testing.T, pool *TaskPool, tpl db.Template, task db.Task, job Job) *TaskRunner {
+	task.ProjectID = tpl.ProjectID
+	task.TemplateID = tpl.ID
+
+	task, err := pool.store.CreateTask(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &TaskRunner{
+		Task:     task,
+		Template: tpl,
+		pool:     pool,
+		job:      job,
+	}
+}
+
+// waitTaskFinished waits until the end time of the task is saved to the database.
+func waitTaskFinished(t *testing.T, store db.Store, task db.Task) db.Task {
+	for i := 0; i < 100; i++ {
+		found, err := store.GetTask(task.ProjectID, task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.End != nil {
+			return found
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("task %d must be finished", task.ID)
+	return task
+}
+
+// waitRunnerFinished waits until the task of the runner is finished. The task of the runner is changed
+// by the goroutine which runs it, so only IDs of the task are read.
+func waitRunnerFinished(t *testing.T, store db.Store, runner *TaskRunner) db.Task {
+	return waitTaskFinished(t, store, db.Task{ID: runner.Task.ID, ProjectID: runner.Task.ProjectID})
+}
+
+func TestTaskPoolScheduledTask(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	task, err := store.CreateTask(db.Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduledAt := time.Now().Add(time.Hour)
+	task.ScheduledAt = &scheduledAt
+
+	pool.addTask(&TaskRunner{
+		Task: task,
+		pool: pool,
+	})
+
+	if len(pool.queue) != 0 || len(pool.scheduled) != 1 {
+		t.Fatal("task scheduled in the future must not be queued")
+	}
+
+	pool.dispatchScheduledTasks(time.Now())
+
+	if len(pool.queue) != 0 {
+		t.Fatal("task must not be queued before its time")
+	}
+
+	pool.dispatchScheduledTasks(scheduledAt.Add(time.Second))
+
+	if len(pool.queue) != 1 || len(pool.scheduled) != 0 {
+		t.Fatal("task must be queued when its time arrives")
+	}
+
+	if pool.queue[0].Task.ID != task.ID {
+		t.Fatal("invalid task queued")
+	}
+}
+
+func TestTaskPoolMoveTaskInQueue(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	var ids []int
+
+	for i := 0; i < 3; i++ {
+		task, err := store.CreateTask(db.Task{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, task.ID)
+		pool.addTask(&TaskRunner{
+			Task: task,
+			pool: pool,
+		})
+	}
+
+	err := pool.MoveTaskInQueue(ids[2], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.queue[0].Task.ID != ids[2] || pool.queue[1].Task.ID != ids[0] || pool.queue[2].Task.ID != ids[1] {
+		t.Fatal("last task must be moved to the front")
+	}
+
+	err = pool.MoveTaskInQueue(ids[2], 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.queue[2].Task.ID != ids[2] || len(pool.queue) != 3 {
+		t.Fatal("position must be clamped to the end of the queue")
+	}
+
+	err = pool.MoveTaskInQueue(12345, 0)
+	if err != db.ErrNotFound {
+		t.Fatal("moving task which is not in queue must fail")
+	}
+}
+
+func TestTaskPoolCancelQueuedTask(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	tpl := createTestTemplate(t, store, db.Template{})
+
+	var runners []*TaskRunner
+
+	for i := 0; i < 2; i++ {
+		runner := createTestRunner(t, pool, tpl, db.Task{Status: db.TaskWaitingStatus}, nil)
+		runners = append(runners, runner)
+		pool.addTask(runner)
+	}
+
+	err := pool.StopTask(runners[0].Task, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pool.queue) != 1 || pool.queue[0] != runners[1] {
+		t.Fatal("cancelled task must be removed from the queue")
+	}
+
+	cancelled, err := store.GetTask(tpl.ProjectID, runners[0].Task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cancelled.Status != db.TaskCancelledStatus {
+		t.Fatalf("expected status %s, got %s", db.TaskCancelledStatus, cancelled.Status)
+	}
+
+	if cancelled.Start != nil || cancelled.End == nil {
+		t.Fatal("cancelled task must be finished without starting")
+	}
+
+	events, err := store.GetEvents(tpl.ProjectID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].ObjectID == nil || *events[0].ObjectID != runners[0].Task.ID {
+		t.Fatal("event must be created for the cancelled task")
+	}
+}
+
+func TestTaskPoolClearQueue(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	tpl := createTestTemplate(t, store, db.Template{})
+	otherTpl := createTestTemplate(t, store, db.Template{})
+
+	runningTask := createTestRunner(t, pool, tpl, db.Task{Status: db.TaskRunningStatus}, nil)
+	pool.runningTasks[runningTask.Task.ID] = runningTask
+	pool.activeProj[tpl.ProjectID] = map[int]*TaskRunner{runningTask.Task.ID: runningTask}
+
+	var queued []*TaskRunner
+
+	for i := 0; i < 3; i++ {
+		runner := createTestRunner(t, pool, tpl, db.Task{Status: db.TaskWaitingStatus}, nil)
+		queued = append(queued, runner)
+		pool.addTask(runner)
+	}
+
+	other := createTestRunner(t, pool, otherTpl, db.Task{Status: db.TaskWaitingStatus}, nil)
+	pool.addTask(other)
+
+	count, err := pool.ClearQueue(tpl.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != len(queued) {
+		t.Fatalf("expected %d cleared tasks, got %d", len(queued), count)
+	}
+
+	if len(pool.queue) != 1 || pool.queue[0] != other {
+		t.Fatal("tasks of other projects must stay in the queue")
+	}
+
+	if pool.runningTasks[runningTask.Task.ID] == nil || runningTask.Task.Status != db.TaskRunningStatus {
+		t.Fatal("running task must not be affected")
+	}
+
+	for _, runner := range queued {
+		var cancelled db.Task
+		cancelled, err = store.GetTask(tpl.ProjectID, runner.Task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cancelled.Status != db.TaskCancelledStatus {
+			t.Fatalf("expected status %s, got %s", db.TaskCancelledStatus, cancelled.Status)
+		}
+	}
+
+	stillRunning, err := store.GetTask(tpl.ProjectID, runningTask.Task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stillRunning.Status != db.TaskRunningStatus {
+		t.Fatal("running task must not be cancelled")
+	}
+}
+
+func TestTaskPoolForceStopStuckTask(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TaskStoppingTimeout: 60,
+	})
+
+	tpl := createTestTemplate(t, store, db.Template{})
+
+	job := &stuckJob{}
+	tsk := createTestRunner(t, pool, tpl, db.Task{Status: db.TaskRunningStatus}, job)
+	pool.runningTasks[tsk.Task.ID] = tsk
+
+	err := pool.StopTask(tsk.Task, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tsk.Task.Status != db.TaskStoppingStatus || job.kills != 1 {
+		t.Fatal("task must be stopping")
+	}
+
+	pool.forceStopStuckTasks(time.Now().Add(30 * time.Second))
+
+	if tsk.Task.Status != db.TaskStoppingStatus {
+		t.Fatal("task must not be force stopped before the timeout")
+	}
+
+	pool.forceStopStuckTasks(time.Now().Add(61 * time.Second))
+
+	if job.kills != 2 {
+		t.Fatal("stuck task must be killed again")
+	}
+
+	stopped, err := store.GetTask(tpl.ProjectID, tsk.Task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stopped.Status != db.TaskStoppedStatus || stopped.End == nil {
+		t.Fatalf("expected status %s, got %s", db.TaskStoppedStatus, stopped.Status)
+	}
+
+	events, err := store.GetEvents(tpl.ProjectID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].Description == nil || !strings.Contains(*events[0].Description, "force stopped") {
+		t.Fatal("event must be created for the forced stop")
+	}
+}
+
+func TestTaskPoolPurgeTaskOutputs(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	now := time.Now()
+
+	var tasks []db.Task
+
+	for _, retention := range []int{7, 0} {
+		proj, err := store.CreateProject(db.Project{TaskOutputRetentionDays: retention})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task, err := store.CreateTask(db.Task{
+			ProjectID: proj.ID,
+			Status:    db.TaskSuccessStatus,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks = append(tasks, task)
+
+		for _, age := range []int{30, 8, 1} {
+			_, err = store.CreateTaskOutput(db.TaskOutput{
+				TaskID: task.ID,
+				Time:   now.AddDate(0, 0, -age),
+				Output: strconv.Itoa(age) + " days ago",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	pool.purgeTaskOutputs(now)
+
+	outputs, err := store.GetTaskOutputs(tasks[0].ProjectID, tasks[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 1 || outputs[0].Output != "1 days ago" {
+		t.Fatalf("output older than retention must be purged, got %v", outputs)
+	}
+
+	if _, err = store.GetTask(tasks[0].ProjectID, tasks[0].ID); err != nil {
+		t.Fatal("task must be kept: " + err.Error())
+	}
+
+	outputs, err = store.GetTaskOutputs(tasks[1].ProjectID, tasks[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 3 {
+		t.Fatal("output of the project without retention must be kept forever")
+	}
+}
+
+func TestTaskPoolPurgeTasks(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -30)
+
+	proj, err := store.CreateProject(db.Project{TaskRetentionDays: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldTask, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskSuccessStatus,
+		End:       &old,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTask, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskSuccessStatus,
+		End:       &now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateTaskOutput(db.TaskOutput{TaskID: oldTask.ID, Time: old, Output: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateTaskOutput(db.TaskOutput{TaskID: newTask.ID, Time: now, Output: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.purgeTaskOutputs(now)
+
+	if _, err = store.GetTask(proj.ID, oldTask.ID); err != db.ErrNotFound {
+		t.Fatal("task older than retention must be deleted")
+	}
+
+	outputs, err := store.GetTaskOutputs(proj.ID, newTask.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 1 {
+		t.Fatal("recent task must be kept with its output")
+	}
+}
+
+func TestTaskPoolAddTaskDisabledTemplate(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	tpl := createTestTemplate(t, store, db.Template{Disabled: true})
+
+	_, err := pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	tasks, err := store.GetTemplateTasks(tpl.ProjectID, tpl.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 0 {
+		t.Fatal("task must not be created for disabled template")
+	}
+}
+
+func TestTaskPoolAddTaskArchivedTemplate(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	tpl := createTestTemplate(t, store, db.Template{})
+
+	if err := store.ArchiveTemplate(tpl.ProjectID, tpl.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+
+	if err != db.ErrInvalidOperation {
+		t.Fatalf("expected invalid operation error, got %v", err)
+	}
+
+	tasks, err := store.GetTemplateTasks(tpl.ProjectID, tpl.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 0 {
+		t.Fatal("task must not be created for archived template")
+	}
+}
+
+func TestTaskPoolAddTaskArchivedProject(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	tpl := createTestTemplate(t, store, db.Template{})
+
+	err := store.SetProjectArchived(tpl.ProjectID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestTaskPoolApproveTask(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	tpl := createTestTemplate(t, store, db.Template{
+		Name:             "Deploy",
+		Playbook:         "deploy.yml",
+		ApprovalRequired: true,
+	})
+
+	authorID := 1
+	approverID := 2
+
+	runner := createTestRunner(t, pool, tpl, db.Task{
+		Status:         db.TaskWaitingStatus,
+		UserID:         &authorID,
+		ApprovalStatus: db.TaskApprovalPending,
+	}, &noopJob{})
+	task := runner.Task
+
+	pool.addTask(runner)
+
+	pool.runNextTask()
+
+	if len(pool.queue) != 1 || len(pool.runningTasks) != 0 {
+		t.Fatal("task waiting for approval must not run")
+	}
+
+	err := pool.ApproveTask(task.ID, authorID)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatalf("self-approval must be rejected, got %v", err)
+	}
+
+	err = pool.ApproveTask(task.ID, approverID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	approved, err := store.GetTask(tpl.ProjectID, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if approved.ApprovalStatus != db.TaskApprovalApproved || approved.ApprovedBy == nil || *approved.ApprovedBy != approverID {
+		t.Fatal("approval must be saved")
+	}
+
+	err = pool.ApproveTask(task.ID, approverID)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatalf("approved task can not be approved again, got %v", err)
+	}
+
+	startTestPool(t, pool)
+
+	pool.runNextTask()
+
+	if len(pool.queue) != 0 {
+		t.Fatal("approved task must leave the queue")
+	}
+
+	waitTaskFinished(t, store, task)
+}
+
+func TestTaskPoolLogBurst(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{})
+
+	task, err := store.CreateTask(db.Task{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &TaskRunner{
+		Task: task,
+		pool: pool,
+	}
+
+	lineCount := cap(pool.logger) * 2
+
+	// fill the channel before the pool starts to simulate a burst
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < lineCount; i++ {
+			runner.Log("line " + strconv.Itoa(i))
+		}
+		close(done)
+	}()
+
+	for len(pool.logger) < cap(pool.logger) {
+		time.Sleep(time.Millisecond)
+	}
+
+	startTestPool(t, pool)
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("task is blocked by logging")
+	}
+
+	var outputs []db.TaskOutput
+
+	for i := 0; i < 100; i++ {
+		outputs, err = store.GetTaskOutputs(0, task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(outputs) > 0 && strings.HasSuffix(outputs[len(outputs)-1].Output, "line "+strconv.Itoa(lineCount-1)) {
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	var lines []string
+	for _, output := range outputs {
+		lines = append(lines, strings.Split(output.Output, "\n")...)
+	}
+
+	if len(lines) != lineCount {
+		t.Fatalf("expected %d lines, got %d", lineCount, len(lines))
+	}
+
+	for i, line := range lines {
+		if line != "line "+strconv.Itoa(i) {
+			t.Fatalf("line %d is lost or reordered: %s", i, line)
+		}
+	}
+
+	if len(outputs) >= lineCount || pool.GetCoalescedLogRecords() == 0 {
+		t.Fatal("log records must be coalesced")
+	}
+
+	if int(pool.GetCoalescedLogRecords()) != lineCount-len(outputs) {
+		t.Fatal("invalid number of coalesced records")
+	}
+}
+
+func TestTaskPoolRunnerTagConcurrency(t *testing.T) {
+	pool, _ := createTestPool(t, util.ConfigType{
+		MaxParallelTasks: 10,
+		RunnerTagMaxParallelTasks: map[string]int{
+			"prod": 3,
+		},
+	})
+
+	prod := "prod"
+	staging := "staging"
+
+	newRunner := func(taskID int, tag *string) *TaskRunner {
+		return &TaskRunner{
+			Task: db.Task{
+				ID:         taskID,
+				ProjectID:  taskID,
+				TemplateID: taskID,
+			},
+			Template: db.Template{
+				ID:        taskID,
+				ProjectID: taskID,
+				RunnerTag: tag,
+			},
+			pool: pool,
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		pool.runningTasks[i] = newRunner(i, &prod)
+	}
+
+	fourth := newRunner(4, &prod)
+
+	if !pool.blocks(fourth) {
+		t.Fatal("fourth prod task must wait")
+	}
+
+	if pool.blocks(newRunner(5, &staging)) || pool.blocks(newRunner(6, nil)) {
+		t.Fatal("tasks with other or without runner tag must not wait")
+	}
+
+	delete(pool.runningTasks, 2)
+
+	if pool.blocks(fourth) {
+		t.Fatal("fourth prod task must run when one of three finished")
+	}
+}
+
+func TestTaskPoolReconcilesZombieTasks(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		MaxParallelTasks: 10,
+	})
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskRunningStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopping, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskStoppingStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finished, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskSuccessStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTestPool(t, pool)
+
+	if task := waitTaskFinished(t, store, running); task.Status != db.TaskFailStatus {
+		t.Fatalf("running task must be failed, got %s", task.Status)
+	}
+
+	if task := waitTaskFinished(t, store, stopping); task.Status != db.TaskStoppedStatus {
+		t.Fatalf("stopping task must be stopped, got %s", task.Status)
+	}
+
+	outputs, err := store.GetTaskOutputs(proj.ID, running.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputs) != 1 || !strings.Contains(outputs[0].Output, "interrupted") {
+		t.Fatal("reconciled task must have a note in its output")
+	}
+
+	task, err := store.GetTask(proj.ID, finished.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Status != db.TaskSuccessStatus || task.End != nil {
+		t.Fatal("finished task must not be changed")
+	}
+}
+
+func TestTaskPoolRestoresQueuedTasks(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		MaxParallelTasks: 10,
+	})
+
+	tpl := createTestTemplate(t, store, db.Template{})
+
+	newer := createTestRunner(t, pool, tpl, db.Task{Status: db.TaskWaitingStatus}, nil).Task
+	older := createTestRunner(t, pool, tpl, db.Task{Status: db.TaskWaitingStatus}, nil).Task
+
+	// the store sets creation time itself
+	older.Created = newer.Created.Add(-time.Minute)
+	err := store.UpdateTask(older)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken, err := store.CreateTask(db.Task{
+		ProjectID:  tpl.ProjectID,
+		TemplateID: tpl.ID + 100,
+		Status:     db.TaskWaitingStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createTestRunner(t, pool, tpl, db.Task{Status: db.TaskSuccessStatus}, nil)
+
+	pool.restoreQueuedTasks()
+
+	if len(pool.queue) != 2 {
+		t.Fatalf("expected 2 tasks in queue, got %d", len(pool.queue))
+	}
+
+	if pool.queue[0].Task.ID != older.ID || pool.queue[1].Task.ID != newer.ID {
+		t.Fatal("restored tasks must be queued in order of creation")
+	}
+
+	for _, r := range pool.queue {
+		if r.job == nil || r.Template.ID != tpl.ID || r.Inventory.ID != *tpl.InventoryID {
+			t.Fatal("restored task must have its details populated")
+		}
+	}
+
+	task, err := store.GetTask(tpl.ProjectID, broken.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Status != db.TaskFailStatus {
+		t.Fatalf("task which can not be restored must be failed, got %s", task.Status)
+	}
+
+	pool.restoreQueuedTasks()
+
+	if len(pool.queue) != 2 {
+		t.Fatal("tasks already in queue must not be restored twice")
+	}
+}
+
+func TestTaskPoolMaxQueueLength(t *testing.T) {
+	// MaxParallelTasks isn't set, so queued tasks never start
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:        "/tmp",
+		MaxQueueLength: 2,
+	})
+
+	tpl := createTestTemplate(t, store, db.Template{})
+
+	startTestPool(t, pool)
+
+	queueLength := func() int {
+		pool.queueLock.Lock()
+		defer pool.queueLock.Unlock()
+		return len(pool.queue)
+	}
+
+	waitQueueLength := func(n int) {
+		for i := 0; i < 100 && queueLength() != n; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if queueLength() != n {
+			t.Fatalf("expected %d tasks in queue, got %d", n, queueLength())
+		}
+	}
+
+	first, err := pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitQueueLength(1)
+
+	_, err = pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitQueueLength(2)
+
+	_, err = pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatalf("task must be rejected when the queue is full, got %v", err)
+	}
+
+	tasks, err := store.GetTemplateTasks(tpl.ProjectID, tpl.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 2 {
+		t.Fatal("rejected task must not be created")
+	}
+
+	err = pool.StopTask(first, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitQueueLength(1)
+
+	_, err = pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+	if err != nil {
+		t.Fatalf("task must be accepted when the queue has free space, got %v", err)
+	}
+	waitQueueLength(2)
+}
+
+func TestTaskPoolAddTaskAllowedWindow(t *testing.T) {
+	// MaxParallelTasks isn't set, so queued tasks never start
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath: "/tmp",
+	})
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	createTemplate := func(from time.Duration, to time.Duration, hold bool) db.Template {
+		return createTestTemplate(t, store, db.Template{
+			ProjectID: proj.ID,
+			AllowedWindow: &db.TimeWindow{
+				From: now.Add(from).Format("15:04"),
+				To:   now.Add(to).Format("15:04"),
+				Hold: hold,
+			},
+		})
+	}
+
+	startTestPool(t, pool)
+
+	inside := createTemplate(-time.Hour, time.Hour, false)
+
+	task, err := pool.AddTask(db.Task{TemplateID: inside.ID}, nil, proj.ID)
+	if err != nil {
+		t.Fatalf("task inside the window must be accepted, got %v", err)
+	}
+
+	if task.ScheduledAt != nil {
+		t.Fatal("task inside the window must not be held")
+	}
+
+	outside := createTemplate(2*time.Hour, 3*time.Hour, false)
+
+	_, err = pool.AddTask(db.Task{TemplateID: outside.ID}, nil, proj.ID)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatalf("task outside the window must be rejected, got %v", err)
+	}
+
+	tasks, err := store.GetTemplateTasks(proj.ID, outside.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 0 {
+		t.Fatal("rejected task must not be created")
+	}
+
+	held := createTemplate(2*time.Hour, 3*time.Hour, true)
+
+	task, err = pool.AddTask(db.Task{TemplateID: held.ID}, nil, proj.ID)
+	if err != nil {
+		t.Fatalf("task outside the window must be held, got %v", err)
+	}
+
+	openAt := held.AllowedWindow.NextOpen(now)
+
+	if task.ScheduledAt == nil || !task.ScheduledAt.Equal(openAt) {
+		t.Fatalf("task must be held until %s, got %v", openAt, task.ScheduledAt)
+	}
+
+	for i := 0; i < 100 && pool.GetTask(task.ID) == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pool.queueLock.Lock()
+	defer pool.queueLock.Unlock()
+
+	if len(pool.scheduled) != 1 || pool.scheduled[0].Task.ID != task.ID {
+		t.Fatal("held task must wait in the scheduled tasks")
+	}
+}
+
+func TestTaskPoolConcurrentBuildVersions(t *testing.T) {
+	// MaxParallelTasks isn't set, so queued tasks never start
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath: "/tmp",
+	})
+
+	startVersion := "1.0"
+
+	tpl := createTestTemplate(t, store, db.Template{
+		Name:         "Build",
+		Playbook:     "build.yml",
+		Type:         db.TemplateBuild,
+		StartVersion: &startVersion,
+	})
+
+	startTestPool(t, pool)
+
+	const builds = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, builds)
+
+	for i := 0; i < builds; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err2 := pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, tpl.ProjectID)
+			errs <- err2
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tasks, err := store.GetTemplateTasks(tpl.ProjectID, tpl.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != builds {
+		t.Fatalf("expected %d builds, got %d", builds, len(tasks))
+	}
+
+	// tasks are sorted from the newest to the oldest
+	for i, task := range tasks {
+		expected := "1." + strconv.Itoa(builds-1-i)
+		if task.Version == nil || *task.Version != expected {
+			t.Fatalf("build %d must have version %s, got %v", task.ID, expected, task.Version)
+		}
+	}
+}
+
+func TestTaskPoolPauseProject(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	startTestPool(t, pool)
+
+	var runners []*TaskRunner
+
+	for i := 0; i < 2; i++ {
+		tpl := createTestTemplate(t, store, db.Template{})
+
+		// tasks are not saved as waiting, so the pool doesn't restore them on start
+		runners = append(runners, createTestRunner(t, pool, tpl, db.Task{}, &noopJob{}))
+	}
+
+	paused := runners[0]
+	active := runners[1]
+
+	pool.PauseProject(paused.Task.ProjectID)
+
+	if !pool.IsProjectPaused(paused.Task.ProjectID) || pool.IsProjectPaused(active.Task.ProjectID) {
+		t.Fatal("only the paused project must be reported as paused")
+	}
+
+	pool.addTask(paused)
+	pool.addTask(active)
+
+	pool.runNextTask()
+	pool.runNextTask()
+
+	if len(pool.queue) != 1 || pool.queue[0] != paused {
+		t.Fatal("task of the paused project must stay in the queue")
+	}
+
+	waitRunnerFinished(t, store, active)
+
+	pool.runNextTask()
+
+	if len(pool.queue) != 1 {
+		t.Fatal("task of the paused project must not be started")
+	}
+
+	pool.ResumeProject(paused.Task.ProjectID)
+	pool.runNextTask()
+
+	if len(pool.queue) != 0 {
+		t.Fatal("task of the resumed project must be started")
+	}
+
+	waitRunnerFinished(t, store, paused)
+}
+
+func TestTaskPoolQueueLength(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	startTestPool(t, pool)
+
+	const taskCount = 5
+
+	done := make(chan struct{})
+	readerFinished := make(chan struct{})
+
+	// metrics are read concurrently with registering, run with -race to check it
+	go func() {
+		defer close(readerFinished)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if pool.QueueLength() < 0 || pool.RunningCount() < 0 {
+					t.Error("counters must not be negative")
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < taskCount; i++ {
+		task, err := store.CreateTask(db.Task{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pool.register <- &TaskRunner{
+			Task: task,
+			pool: pool,
+			job:  &noopJob{},
+		}
+	}
+
+	for i := 0; i < 50 && pool.QueueLength() != taskCount; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(done)
+	<-readerFinished
+
+	if pool.QueueLength() != taskCount {
+		t.Fatalf("expected %d queued tasks, got %d", taskCount, pool.QueueLength())
+	}
+
+	if pool.RunningCount() != 0 {
+		t.Fatal("tasks must not run before the next tick")
+	}
+}
+
+// createTestPriorityRunners adds to the pool tasks with the priorities, every task belongs to its own project.
+func createTestPriorityRunners(t *testing.T, pool *TaskPool, priorities ...int) (runners []*TaskRunner) {
+	for _, priority := range priorities {
+		tpl := createTestTemplate(t, pool.store, db.Template{})
+
+		// tasks are not saved as waiting, so the pool doesn't restore them on start
+		runner := createTestRunner(t, pool, tpl, db.Task{Priority: priority}, &noopJob{})
+		runners = append(runners, runner)
+		pool.addTask(runner)
+	}
+	return
+}
+
+func TestTaskPoolRunNextTaskPriority(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	startTestPool(t, pool)
+
+	runners := createTestPriorityRunners(t, pool, 0, 0, 0, 5)
+
+	urgent := runners[3]
+
+	pool.runNextTask()
+
+	if len(pool.queue) != 3 || pool.queue[0] != runners[0] || pool.queue[2] != runners[2] {
+		t.Fatal("task with high priority must be started before waiting normal tasks")
+	}
+
+	waitRunnerFinished(t, store, urgent)
+
+	pool.runNextTask()
+
+	if len(pool.queue) != 2 || pool.queue[0] != runners[1] || pool.queue[1] != runners[2] {
+		t.Fatal("tasks with the same priority must be started in the order of the queue")
+	}
+
+	waitRunnerFinished(t, store, runners[0])
+}
+
+func TestTaskPoolRunNextTaskBlockedPriority(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	startTestPool(t, pool)
+
+	runners := createTestPriorityRunners(t, pool, 5, 0)
+
+	urgent := runners[0]
+	normal := runners[1]
+
+	pool.PauseProject(urgent.Task.ProjectID)
+
+	pool.runNextTask()
+
+	if len(pool.queue) != 1 || pool.queue[0] != urgent {
+		t.Fatal("blocked task with high priority must not hold normal tasks")
+	}
+
+	waitRunnerFinished(t, store, normal)
+}
+
+func TestTaskPoolMoveTaskInQueuePriority(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	startTestPool(t, pool)
+
+	runners := createTestPriorityRunners(t, pool, 0, 0, 5)
+
+	urgent := runners[2]
+
+	if pool.queue[0] != urgent || pool.queue[1] != runners[0] || pool.queue[2] != runners[1] {
+		t.Fatal("task with high priority must be queued before normal tasks")
+	}
+
+	err := pool.MoveTaskInQueue(runners[1].Task.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.queue[0] != urgent || pool.queue[1] != runners[1] || pool.queue[2] != runners[0] {
+		t.Fatal("normal task must be moved to the top of normal tasks")
+	}
+
+	err = pool.MoveTaskInQueue(urgent.Task.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.queue[0] != urgent {
+		t.Fatal("task with high priority must not be moved after normal tasks")
+	}
+
+	pool.runNextTask()
+	waitRunnerFinished(t, store, urgent)
+
+	pool.runNextTask()
+
+	if len(pool.queue) != 1 || pool.queue[0] != runners[0] {
+		t.Fatal("moved task must be started before other tasks with the same priority")
+	}
+
+	waitRunnerFinished(t, store, runners[1])
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -29,6 +30,17 @@ type TaskRunner struct {
 	Repository  db.Repository
 	Environment db.Environment
 
+	// AdditionalRepositories are checked out in addition to Repository,
+	// see Template.AdditionalRepositoryIDs.
+	AdditionalRepositories []db.Repository
+
+	// Project, Schedule and User describe context of the task for the playbook.
+	// Schedule is nil if the task is not created by a schedule,
+	// User is nil if the task is not started by a user.
+	Project  db.Project
+	Schedule *db.Schedule
+	User     *db.User
+
 	users     []int
 	alert     bool
 	alertChat *string
@@ -40,6 +52,18 @@ type TaskRunner struct {
 	RunnerID        int
 	Username        string
 	IncomingVersion *string
+
+	// stoppingSince is a time when the task got TaskStoppingStatus.
+	stoppingSince *time.Time
+
+	// statusLock protects Task.Status, stoppingSince and the runner of the task.
+	// They are changed from different goroutines and read by the pool.
+	statusLock sync.RWMutex
+
+	// logPipes counts goroutines which read output of commands started with LogCmd.
+	logPipes sync.WaitGroup
+
+	progress taskProgress
 }
 
 func getMD5Hash(filepath string) (string, error) {
@@ -57,28 +81,51 @@ func getMD5Hash(filepath string) (string, error) {
 }
 
 func (t *TaskRunner) SetStatus(status db.TaskStatus) {
-	if status == t.Task.Status {
+	if !t.updateStatus(status) {
 		return
 	}
 
+	t.saveStatus()
+
+	if status == db.TaskFailStatus {
+		t.sendMailAlert()
+	}
+
+	if status == db.TaskSuccessStatus || status == db.TaskFailStatus {
+		t.sendTelegramAlert()
+		t.sendSlackAlert()
+		t.sendTargetAlerts()
+	}
+}
+
+// updateStatus changes the status of the task if the task can get it from the current status.
+// It returns false if the status is not changed.
+func (t *TaskRunner) updateStatus(status db.TaskStatus) bool {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+
+	if status == t.Task.Status {
+		return false
+	}
+
 	switch t.Task.Status { // check old status
 	case db.TaskRunningStatus:
 		if status == db.TaskWaitingStatus {
 			//panic("running TaskRunner cannot be " + status)
-			return
+			return false
 		}
 		break
 	case db.TaskStoppingStatus:
 		if status == db.TaskWaitingStatus || status == db.TaskRunningStatus {
 			//panic("stopping TaskRunner cannot be " + status)
-			return
+			return false
 		}
 		break
 	case db.TaskSuccessStatus:
 	case db.TaskFailStatus:
-	case db.TaskStoppedStatus:
+	case db.TaskStoppedStatus, db.TaskCancelledStatus, db.TaskSkippedStatus:
 		//panic("stopped TaskRunner cannot be " + status)
-		return
+		return false
 	}
 
 	t.Task.Status = status
@@ -88,29 +135,70 @@ func (t *TaskRunner) SetStatus(status db.TaskStatus) {
 		t.Task.Start = &now
 	}
 
-	t.saveStatus()
-
-	if status == db.TaskFailStatus {
-		t.sendMailAlert()
+	if status == db.TaskStoppingStatus {
+		now := time.Now()
+		t.stoppingSince = &now
 	}
 
-	if status == db.TaskSuccessStatus || status == db.TaskFailStatus {
-		t.sendTelegramAlert()
-		t.sendSlackAlert()
+	return true
+}
+
+// getStatus returns the status of the task and the time when the task got TaskStoppingStatus.
+// It is safe to call from any goroutine.
+func (t *TaskRunner) getStatus() (db.TaskStatus, *time.Time) {
+	t.statusLock.RLock()
+	defer t.statusLock.RUnlock()
+	return t.Task.Status, t.stoppingSince
+}
+
+// setRunner assigns the task to the runner which executes it and returns the updated task.
+func (t *TaskRunner) setRunner(runnerID int) db.Task {
+	t.statusLock.Lock()
+	defer t.statusLock.Unlock()
+
+	t.RunnerID = runnerID
+	t.Task.RunnerID = &runnerID
+
+	return t.Task
+}
+
+// GetRunnerID returns ID of the runner which executes the task, 0 if the task is not assigned to a runner.
+// It is safe to call from any goroutine.
+func (t *TaskRunner) GetRunnerID() int {
+	t.statusLock.RLock()
+	defer t.statusLock.RUnlock()
+	return t.RunnerID
+}
+
+// fail marks the task as failed for the reason. The reason is saved together with the status.
+func (t *TaskRunner) fail(reason db.TaskFailureReason) {
+	previous := t.Task.FailureReason
+	t.Task.FailureReason = reason
+	t.SetStatus(db.TaskFailStatus)
+
+	if t.Task.Status != db.TaskFailStatus {
+		// the status can't be changed, for example the task is already stopped
+		t.Task.FailureReason = previous
 	}
 }
 
 func (t *TaskRunner) saveStatus() {
+	t.statusLock.RLock()
+	task := t.Task
+	t.statusLock.RUnlock()
+
 	for _, user := range t.users {
 		b, err := json.Marshal(&map[string]interface{}{
-			"type":        "update",
-			"start":       t.Task.Start,
-			"end":         t.Task.End,
-			"status":      t.Task.Status,
-			"task_id":     t.Task.ID,
-			"template_id": t.Task.TemplateID,
-			"project_id":  t.Task.ProjectID,
-			"version":     t.Task.Version,
+			"type":            "update",
+			"start":           task.Start,
+			"end":             task.End,
+			"status":          task.Status,
+			"task_id":         task.ID,
+			"template_id":     task.TemplateID,
+			"project_id":      task.ProjectID,
+			"version":         task.Version,
+			"approval_status": task.ApprovalStatus,
+			"failure_reason":  task.FailureReason,
 		})
 
 		util.LogPanic(err)
@@ -118,25 +206,64 @@ func (t *TaskRunner) saveStatus() {
 		sockets.Message(user, b)
 	}
 
-	if err := t.pool.store.UpdateTask(t.Task); err != nil {
+	if err := t.pool.store.UpdateTask(task); err != nil {
 		t.panicOnError(err, "Failed to update TaskRunner status")
 	}
 }
 
+// cancel finishes the task which was removed from the queue before running.
+func (t *TaskRunner) cancel() {
+	now := time.Now()
+	t.Task.End = &now
+	t.Log("Task " + strconv.Itoa(t.Task.ID) + " cancelled")
+	t.SetStatus(db.TaskCancelledStatus)
+	t.createTaskEvent()
+}
+
 func (t *TaskRunner) kill() {
 	t.job.Kill()
 }
 
+// forceStop kills the task which doesn't stop in time and marks it as stopped.
+func (t *TaskRunner) forceStop(timeout time.Duration) {
+	if t.job != nil {
+		t.job.Kill()
+	}
+
+	now := time.Now()
+	t.Task.End = &now
+	t.Log("Task " + strconv.Itoa(t.Task.ID) + " force stopped after " + timeout.String() + " of stopping")
+	t.Task.FailureReason = db.TaskFailureTimeout
+	t.SetStatus(db.TaskStoppedStatus)
+
+	objType := db.EventTask
+	desc := "Task ID " + strconv.Itoa(t.Task.ID) + " (" + t.Template.Name + ")" + " force stopped, it was stopping longer than " + timeout.String()
+
+	_, err := t.pool.store.CreateEvent(db.Event{
+		UserID:        t.Task.UserID,
+		ProjectID:     &t.Task.ProjectID,
+		ObjectType:    &objType,
+		ObjectID:      &t.Task.ID,
+		Description:   &desc,
+		CorrelationID: db.TaskCorrelationID(t.Task.ID),
+	})
+
+	if err != nil {
+		log.Error(err)
+	}
+}
+
 func (t *TaskRunner) createTaskEvent() {
 	objType := db.EventTask
 	desc := "Task ID " + strconv.Itoa(t.Task.ID) + " (" + t.Template.Name + ")" + " finished - " + strings.ToUpper(string(t.Task.Status))
 
 	_, err := t.pool.store.CreateEvent(db.Event{
-		UserID:      t.Task.UserID,
-		ProjectID:   &t.Task.ProjectID,
-		ObjectType:  &objType,
-		ObjectID:    &t.Task.ID,
-		Description: &desc,
+		UserID:        t.Task.UserID,
+		ProjectID:     &t.Task.ProjectID,
+		ObjectType:    &objType,
+		ObjectID:      &t.Task.ID,
+		Description:   &desc,
+		CorrelationID: db.TaskCorrelationID(t.Task.ID),
 	})
 
 	if err != nil {
@@ -151,14 +278,28 @@ func (t *TaskRunner) run() {
 	}
 
 	defer func() {
+		// Panic of the task must not crash the server and keep resources locked.
+		r := recover()
+
+		// output of commands is read until they exit, the task is finished when it is logged
+		t.logPipes.Wait()
+
 		log.Info("Stopped running TaskRunner " + strconv.Itoa(t.Task.ID))
 		log.Info("Release resource locker with TaskRunner " + strconv.Itoa(t.Task.ID))
-		t.pool.resourceLocker <- &resourceLock{lock: false, holder: t}
+		t.pool.resourceLocker <- &resourceLock{holder: t}
+
+		if r != nil {
+			log.Error("Task " + strconv.Itoa(t.Task.ID) + " panicked: " + fmt.Sprint(r))
+			t.Log("Running playbook failed: internal error")
+			t.fail(db.TaskFailureOther)
+		}
 
 		now := time.Now()
 		t.Task.End = &now
 		t.saveStatus()
 		t.createTaskEvent()
+		t.startNextPipelineStage()
+		t.archiveOutput()
 	}()
 
 	// Mark task as stopped if user stopped task during preparation (before task run).
@@ -173,11 +314,12 @@ func (t *TaskRunner) run() {
 	desc := "Task ID " + strconv.Itoa(t.Task.ID) + " (" + t.Template.Name + ")" + " is running"
 
 	_, err := t.pool.store.CreateEvent(db.Event{
-		UserID:      t.Task.UserID,
-		ProjectID:   &t.Task.ProjectID,
-		ObjectType:  &objType,
-		ObjectID:    &t.Task.ID,
-		Description: &desc,
+		UserID:        t.Task.UserID,
+		ProjectID:     &t.Task.ProjectID,
+		ObjectType:    &objType,
+		ObjectID:      &t.Task.ID,
+		Description:   &desc,
+		CorrelationID: db.TaskCorrelationID(t.Task.ID),
 	})
 
 	if err != nil {
@@ -204,11 +346,33 @@ func (t *TaskRunner) run() {
 
 	}
 
+	t.progress.setExpectedTasks(t.getExpectedTaskCount())
+
+	if localJob, ok := t.job.(*LocalJob); ok && len(t.Template.ChangedPathsFilter) > 0 {
+		localJob.PreviousCommitHash = t.getPreviousCommitHash()
+	}
+
 	err = t.job.Run(username, incomingVersion)
 
+	failureReason := db.TaskFailureOther
+
+	if localJob, ok := t.job.(*LocalJob); ok {
+		t.Task.ExitCode = localJob.ExitCode
+		if localJob.FailureReason != "" {
+			failureReason = localJob.FailureReason
+		}
+		if t.Task.CommitHash == nil {
+			t.Task.CommitHash = localJob.Task.CommitHash
+		}
+	}
+
 	if err != nil {
+		if t.Task.Status == db.TaskStoppingStatus {
+			t.SetStatus(db.TaskStoppedStatus)
+			return
+		}
 		t.Log("Running playbook failed: " + err.Error())
-		t.SetStatus(db.TaskFailStatus)
+		t.fail(failureReason)
 		return
 	}
 
@@ -238,6 +402,23 @@ func (t *TaskRunner) run() {
 	}
 }
 
+// getPreviousCommitHash returns the commit of the last successful task of the template.
+func (t *TaskRunner) getPreviousCommitHash() *string {
+	tasks, err := t.pool.store.GetTemplateTasks(t.Template.ProjectID, t.Template.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+
+	for _, task := range tasks {
+		if task.ID != t.Task.ID && task.Status == db.TaskSuccessStatus && task.CommitHash != nil {
+			return task.CommitHash
+		}
+	}
+
+	return nil
+}
+
 func (t *TaskRunner) prepareError(err error, errMsg string) error {
 	if err == db.ErrNotFound {
 		t.Log(errMsg)
@@ -245,7 +426,7 @@ func (t *TaskRunner) prepareError(err error, errMsg string) error {
 	}
 
 	if err != nil {
-		t.SetStatus(db.TaskFailStatus)
+		t.fail(db.TaskFailureOther)
 		panic(err)
 	}
 
@@ -268,9 +449,28 @@ func (t *TaskRunner) populateDetails() error {
 		return t.prepareError(err, "Project not found!")
 	}
 
+	t.Project = project
 	t.alert = project.Alert
 	t.alertChat = project.AlertChat
 
+	if t.Task.ScheduleID != nil {
+		schedule, err := t.pool.store.GetSchedule(t.Task.ProjectID, *t.Task.ScheduleID)
+		if err == nil {
+			t.Schedule = &schedule
+		} else if err != db.ErrNotFound {
+			return err
+		}
+	}
+
+	if t.Task.UserID != nil {
+		user, err := t.pool.store.GetUser(*t.Task.UserID)
+		if err == nil {
+			t.User = &user
+		} else if err != db.ErrNotFound {
+			return err
+		}
+	}
+
 	// get project users
 	users, err := t.pool.store.GetProjectUsers(t.Template.ProjectID, db.RetrieveQueryParams{})
 	if err != nil {
@@ -283,11 +483,17 @@ func (t *TaskRunner) populateDetails() error {
 	}
 
 	// get inventory
-	t.Inventory, err = t.pool.store.GetInventory(t.Template.ProjectID, t.Template.InventoryID)
+	if t.Template.InventoryID == nil {
+		return t.prepareError(db.ErrNotFound, "Template Inventory not found!")
+	}
+
+	t.Inventory, err = t.pool.store.GetInventory(t.Template.ProjectID, *t.Template.InventoryID)
 	if err != nil {
 		return t.prepareError(err, "Template Inventory not found!")
 	}
 
+	t.applyInventorySnapshot()
+
 	// get repository
 	t.Repository, err = t.pool.store.GetRepository(t.Template.ProjectID, t.Template.RepositoryID)
 
@@ -300,6 +506,24 @@ func (t *TaskRunner) populateDetails() error {
 		return err
 	}
 
+	t.AdditionalRepositories = []db.Repository{}
+
+	for _, id := range t.Template.AdditionalRepositoryIDs {
+		var repo db.Repository
+
+		repo, err = t.pool.store.GetRepository(t.Template.ProjectID, id)
+		if err != nil {
+			return t.prepareError(err, "Additional repository "+strconv.Itoa(id)+" not found!")
+		}
+
+		err = repo.SSHKey.DeserializeSecret()
+		if err != nil {
+			return err
+		}
+
+		t.AdditionalRepositories = append(t.AdditionalRepositories, repo)
+	}
+
 	// get environment
 	if t.Template.EnvironmentID != nil {
 		t.Environment, err = t.pool.store.GetEnvironment(t.Template.ProjectID, *t.Template.EnvironmentID)
@@ -308,35 +532,166 @@ func (t *TaskRunner) populateDetails() error {
 		}
 	}
 
-	if t.Task.Environment != "" {
-		environment := make(map[string]interface{})
-		if t.Environment.JSON != "" {
-			err = json.Unmarshal([]byte(t.Task.Environment), &environment)
-			if err != nil {
-				return err
-			}
+	t.Environment.JSON, err = mergeTaskEnvironment(t.Environment.JSON, t.Task.Environment)
+	if err != nil {
+		return err
+	}
+
+	return t.interpolateFields()
+}
+
+// mergeTaskEnvironment returns extra vars of the environment merged with
+// the environment override of the task. Variables of the environment take precedence.
+func mergeTaskEnvironment(environmentJSON string, taskEnvironment string) (string, error) {
+	if taskEnvironment == "" {
+		return environmentJSON, nil
+	}
+
+	environment := make(map[string]interface{})
+	err := json.Unmarshal([]byte(taskEnvironment), &environment)
+	if err != nil {
+		return "", err
+	}
+
+	templateEnvironment := make(map[string]interface{})
+	if environmentJSON != "" {
+		err = json.Unmarshal([]byte(environmentJSON), &templateEnvironment)
+		if err != nil {
+			return "", err
 		}
+	}
+
+	for k, v := range templateEnvironment {
+		environment[k] = v
+	}
+
+	ev, err := json.Marshal(environment)
+	if err != nil {
+		return "", err
+	}
 
-		taskEnvironment := make(map[string]interface{})
-		err = json.Unmarshal([]byte(t.Environment.JSON), &taskEnvironment)
+	return string(ev), nil
+}
+
+// ResolveTaskEnvironment returns the variables which the task gets when it runs,
+// so users can check which source a value comes from. Secret values are masked.
+//
+// The result contains extra vars under the "extra_vars" key and environment variables
+// under the "env" key. Sources are applied in the following order, each one overrides the previous:
+//
+//	extra_vars: task environment, template environment, file and command secrets of type "var", semaphore_vars;
+//	env: runner environment, template environment ENV, file and command secrets of type "env",
+//	ANSIBLE_STDOUT_CALLBACK if the template uses JSON events.
+//
+// The runner environment is taken from the job of the task runner.
+// Values of file and command secrets are not read, they are always masked.
+func (t *TaskRunner) ResolveTaskEnvironment(task db.Task) (res map[string]interface{}, err error) {
+	tpl, err := t.pool.store.GetTemplate(task.ProjectID, task.TemplateID)
+	if err != nil {
+		return
+	}
+
+	var environment db.Environment
+
+	if tpl.EnvironmentID != nil {
+		environment, err = t.pool.store.GetEnvironment(task.ProjectID, *tpl.EnvironmentID)
 		if err != nil {
-			return err
+			return
+		}
+	}
+
+	environment.JSON, err = mergeTaskEnvironment(environment.JSON, task.Environment)
+	if err != nil {
+		return
+	}
+
+	secrets, err := environment.GetFileSecrets()
+	if err != nil {
+		return
+	}
+
+	commandSecrets, err := environment.GetCommandSecrets()
+	if err != nil {
+		return
+	}
+
+	job := LocalJob{
+		Task:        task,
+		Template:    tpl,
+		Environment: environment,
+		secretVars:  make(map[string]string),
+		secretEnv:   make(map[string]string),
+	}
+
+	if localJob, ok := t.job.(*LocalJob); ok {
+		job.RunnerEnvironment = localJob.RunnerEnvironment
+	}
+
+	for _, secret := range secrets {
+		switch secret.Type {
+		case db.EnvironmentSecretEnv:
+			job.secretEnv[secret.Name] = db.MaskedValue
+		default:
+			job.secretVars[secret.Name] = db.MaskedValue
 		}
+	}
 
-		for k, v := range taskEnvironment {
-			environment[k] = v
+	for _, secret := range commandSecrets {
+		switch secret.Type {
+		case db.EnvironmentSecretEnv:
+			job.secretEnv[secret.Name] = db.MaskedValue
+		default:
+			job.secretVars[secret.Name] = db.MaskedValue
 		}
+	}
 
-		var ev []byte
-		ev, err = json.Marshal(environment)
-		if err != nil {
-			return err
+	var username string
+	var incomingVersion *string
+
+	if task.UserID != nil {
+		var user db.User
+		user, err = t.pool.store.GetUser(*task.UserID)
+		if err == nil {
+			username = user.Username
 		}
+	}
 
-		t.Environment.JSON = string(ev)
+	if tpl.Type != db.TemplateTask {
+		incomingVersion = task.GetIncomingVersion(t.pool.store)
 	}
 
-	return nil
+	extraVarsJSON, err := job.getEnvironmentExtraVars(username, incomingVersion)
+	if err != nil {
+		return
+	}
+
+	extraVars := make(map[string]interface{})
+	err = json.Unmarshal([]byte(extraVarsJSON), &extraVars)
+	if err != nil {
+		return
+	}
+
+	envArr, err := job.getEnvironmentENV()
+	if err != nil {
+		return
+	}
+
+	env := make(map[string]interface{})
+	for _, v := range envArr {
+		kv := strings.SplitN(v, "=", 2)
+		if db.IsSecretKey(kv[0]) {
+			env[kv[0]] = db.MaskedValue
+		} else {
+			env[kv[0]] = kv[1]
+		}
+	}
+
+	res = map[string]interface{}{
+		"extra_vars": db.MaskSecretValues(extraVars),
+		"env":        env,
+	}
+
+	return
 }
 
 func hasRequirementsChanges(requirementsFilePath string, requirementsHashFilePath string) bool {
@@ -1,12 +1,19 @@
 package tasks
 
 import (
+	"bufio"
+	"encoding/json"
 	"github.com/ansible-semaphore/semaphore/lib"
+	"io"
 	"math/rand"
 	"os"
+	"os/exec"
 	"path"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,31 +32,20 @@ func CreateBoltDB() db.Store {
 }
 
 func TestTaskRunnerRun(t *testing.T) {
-	util.Config = &util.ConfigType{
+	pool, store := createTestPool(t, util.ConfigType{
 		TmpPath: "/tmp",
-	}
-
-	store := CreateBoltDB()
-
-	pool := CreateTaskPool(store)
-
-	go pool.Run()
-
-	var task db.Task
-
-	var err error
-
-	db.StoreSession(store, "", func() {
-		task, err = store.CreateTask(db.Task{})
 	})
 
+	startTestPool(t, pool)
+
+	task, err := store.CreateTask(db.Task{})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	taskRunner := TaskRunner{
 		Task: task,
-		pool: &pool,
+		pool: pool,
 	}
 	taskRunner.job = &LocalJob{
 		Task:        taskRunner.Task,
@@ -198,7 +194,7 @@ func TestPopulateDetails(t *testing.T) {
 		Playbook:      "test.yml",
 		ProjectID:     proj.ID,
 		RepositoryID:  repo.ID,
-		InventoryID:   inv.ID,
+		InventoryID:   &inv.ID,
 		EnvironmentID: &env.ID,
 	})
 
@@ -239,6 +235,34 @@ func TestPopulateDetails(t *testing.T) {
 	}
 }
 
+func TestMergeTaskEnvironment(t *testing.T) {
+	for _, c := range []struct {
+		environment     string
+		taskEnvironment string
+		expected        string
+	}{
+		{`{"author":"Denis"}`, "", `{"author":"Denis"}`},
+		{"", "", ""},
+		// the task environment is kept if the template has no environment
+		{"", `{"comment":"Just do it!"}`, `{"comment":"Just do it!"}`},
+		{`{"comment":"Hello"}`, `{"comment":"Just do it!","time":"2021-11-02"}`, `{"comment":"Hello","time":"2021-11-02"}`},
+	} {
+		res, err := mergeTaskEnvironment(c.environment, c.taskEnvironment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res != c.expected {
+			t.Fatalf("expected %s, got %s", c.expected, res)
+		}
+	}
+
+	_, err := mergeTaskEnvironment("", "{")
+	if err == nil {
+		t.Fatal("invalid task environment must be rejected")
+	}
+}
+
 func TestTaskGetPlaybookArgs(t *testing.T) {
 	util.Config = &util.ConfigType{
 		TmpPath: "/tmp",
@@ -286,6 +310,105 @@ func TestTaskGetPlaybookArgs(t *testing.T) {
 	}
 }
 
+func TestLocalJobSemaphoreVars(t *testing.T) {
+	job := LocalJob{
+		Task: db.Task{
+			ID:      5,
+			Message: "hotfix",
+		},
+		Template: db.Template{
+			ID:   3,
+			Name: "Deploy",
+		},
+		Project: db.Project{
+			ID:   2,
+			Name: "Shop",
+		},
+		Schedule: &db.Schedule{
+			ID:         7,
+			CronFormat: "0 2 * * *",
+		},
+		User: &db.User{
+			ID:       9,
+			Username: "jdoe",
+			Name:     "John Doe",
+			Email:    "jdoe@example.com",
+		},
+		Logger: &testLogger{},
+	}
+
+	str, err := job.getEnvironmentExtraVars("jdoe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var extraVars struct {
+		SemaphoreVars struct {
+			TaskDetails struct {
+				ID       int    `json:"id"`
+				Message  string `json:"message"`
+				Username string `json:"username"`
+				Template struct {
+					ID   int    `json:"id"`
+					Name string `json:"name"`
+				} `json:"template"`
+				Project struct {
+					ID   int    `json:"id"`
+					Name string `json:"name"`
+				} `json:"project"`
+				Schedule struct {
+					ID         int    `json:"id"`
+					CronFormat string `json:"cron_format"`
+				} `json:"schedule"`
+				User struct {
+					ID       int    `json:"id"`
+					Username string `json:"username"`
+					Name     string `json:"name"`
+					Email    string `json:"email"`
+				} `json:"user"`
+			} `json:"task_details"`
+		} `json:"semaphore_vars"`
+	}
+
+	err = json.Unmarshal([]byte(str), &extraVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details := extraVars.SemaphoreVars.TaskDetails
+
+	if details.ID != 5 || details.Message != "hotfix" || details.Username != "jdoe" {
+		t.Fatal("existing task details must be kept: " + str)
+	}
+
+	if details.Template.ID != 3 || details.Template.Name != "Deploy" {
+		t.Fatal("task details must contain the template: " + str)
+	}
+
+	if details.Project.ID != 2 || details.Project.Name != "Shop" {
+		t.Fatal("task details must contain the project: " + str)
+	}
+
+	if details.Schedule.ID != 7 || details.Schedule.CronFormat != "0 2 * * *" {
+		t.Fatal("task details must contain the schedule: " + str)
+	}
+
+	if details.User.ID != 9 || details.User.Name != "John Doe" || details.User.Email != "jdoe@example.com" {
+		t.Fatal("task details must contain the user: " + str)
+	}
+
+	job.Schedule = nil
+
+	str, err = job.getEnvironmentExtraVars("jdoe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(str, "schedule") {
+		t.Fatal("task which is not created by schedule must not have schedule details: " + str)
+	}
+}
+
 func TestTaskGetPlaybookArgs2(t *testing.T) {
 	util.Config = &util.ConfigType{
 		TmpPath: "/tmp",
@@ -388,6 +511,51 @@ func TestTaskGetPlaybookArgs3(t *testing.T) {
 	}
 }
 
+func TestTaskGetPlaybookArgs_vaults(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	tsk := TaskRunner{
+		Task: db.Task{},
+		Inventory: db.Inventory{
+			Type: db.InventoryStatic,
+		},
+		Template: db.Template{
+			Playbook: "test.yml",
+			Vaults: []db.TemplateVault{
+				{Label: "dev", VaultKeyID: 1, VaultKey: db.AccessKey{ID: 1, InstallationKey: 11}},
+				{Label: "stage", VaultKeyID: 2, VaultKey: db.AccessKey{ID: 2, InstallationKey: 22}},
+				{Label: "prod", VaultKeyID: 3, VaultKey: db.AccessKey{ID: 3, InstallationKey: 33}},
+			},
+		},
+	}
+	tsk.job = &LocalJob{
+		Task:        tsk.Task,
+		Template:    tsk.Template,
+		Inventory:   tsk.Inventory,
+		Repository:  tsk.Repository,
+		Environment: tsk.Environment,
+		Logger:      &tsk,
+		Playbook: &lib.AnsiblePlaybook{
+			Logger:     &tsk,
+			TemplateID: tsk.Template.ID,
+			Repository: tsk.Repository,
+		},
+	}
+
+	args, err := tsk.job.(*LocalJob).getPlaybookArgs("", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := strings.Join(args, " ")
+	if !strings.Contains(res, "--vault-id dev@/tmp/access_key_11 --vault-id stage@/tmp/access_key_22 --vault-id prod@/tmp/access_key_33 ") {
+		t.Fatal("incorrect result: " + res)
+	}
+}
+
 func TestCheckTmpDir(t *testing.T) {
 	//It should be able to create a random dir in /tmp
 	dirName := path.Join(os.TempDir(), util.RandString(rand.Intn(10-4)+4))
@@ -424,3 +592,1540 @@ func TestCheckTmpDir(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestTaskRunnerUsesUnmaskedEnvironment(t *testing.T) {
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		ProjectID: &proj.ID,
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		SSHKeyID:  key.ID,
+		Name:      "Test",
+		GitURL:    "git@example.com:test/test",
+		GitBranch: "master",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:         "Test",
+		Playbook:     "test.yml",
+		ProjectID:    proj.ID,
+		RepositoryID: repo.ID,
+		InventoryID:  &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := store.CreateTask(db.Task{
+		TemplateID:  tpl.ID,
+		ProjectID:   proj.ID,
+		Environment: `{"db_password": "qwerty"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	masked := task
+	masked.MaskEnvironment()
+	if strings.Contains(masked.Environment, "qwerty") {
+		t.Fatal("masked task must not contain secret")
+	}
+
+	pool := TaskPool{store: store}
+
+	tsk := TaskRunner{
+		pool: &pool,
+		Task: task,
+	}
+	tsk.job = &LocalJob{
+		Task:   tsk.Task,
+		Logger: &tsk,
+		Playbook: &lib.AnsiblePlaybook{
+			Logger: &tsk,
+		},
+	}
+
+	err = tsk.populateDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := tsk.job.(*LocalJob)
+	job.Environment = tsk.Environment
+
+	extraVars, err := job.getEnvironmentExtraVars("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(extraVars, `"db_password":"qwerty"`) {
+		t.Fatal("runner must receive real secret value: " + extraVars)
+	}
+}
+
+func TestTaskRunnerInventorySnapshot(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		ProjectID: &proj.ID,
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		SSHKeyID:  key.ID,
+		Name:      "Test",
+		GitURL:    "git@example.com:test/test",
+		GitBranch: "master",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+		Type:      db.InventoryStatic,
+		Inventory: "[web]\nweb1.example.com\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:         "Test",
+		Playbook:     "test.yml",
+		ProjectID:    proj.ID,
+		RepositoryID: repo.ID,
+		InventoryID:  &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := CreateTaskPool(store)
+
+	task := db.Task{
+		TemplateID:        tpl.ID,
+		ProjectID:         proj.ID,
+		SnapshotInventory: true,
+	}
+
+	if err = pool.prepareInventorySnapshot(&task, tpl); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err = store.CreateTask(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the inventory changes after the task is created
+	inv.Inventory = "[web]\nweb2.example.com\n"
+	if err = store.UpdateInventory(inv); err != nil {
+		t.Fatal(err)
+	}
+
+	tsk := TaskRunner{
+		pool: &pool,
+		Task: task,
+	}
+	tsk.job = &LocalJob{
+		Task:   tsk.Task,
+		Logger: &tsk,
+		Playbook: &lib.AnsiblePlaybook{
+			Logger: &tsk,
+		},
+	}
+
+	if err = tsk.populateDetails(); err != nil {
+		t.Fatal(err)
+	}
+
+	job := tsk.job.(*LocalJob)
+	job.Inventory = tsk.Inventory
+
+	if err = job.installInventory(); err != nil {
+		t.Fatal(err)
+	}
+
+	inventoryPath := util.Config.TmpPath + "/inventory_" + strconv.Itoa(task.ID)
+	defer os.Remove(inventoryPath) //nolint: errcheck
+
+	content, err := os.ReadFile(inventoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "[web]\nweb1.example.com\n" {
+		t.Fatal("task must run with the inventory saved when it was created, got " + string(content))
+	}
+
+	fileInv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+		Type:      db.InventoryFile,
+		Inventory: "hosts.ini",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl.InventoryID = &fileInv.ID
+	task = db.Task{TemplateID: tpl.ID, ProjectID: proj.ID, SnapshotInventory: true}
+
+	if _, ok := pool.prepareInventorySnapshot(&task, tpl).(*db.ValidationError); !ok {
+		t.Fatal("only static inventory can be saved with the task")
+	}
+}
+
+func TestTaskGetPlaybookArgs_becomePasswordFile(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	inventoryID := 1
+
+	tsk := TaskRunner{
+		Task: db.Task{},
+		Inventory: db.Inventory{
+			Type:               db.InventoryStatic,
+			BecomeKeyID:        &inventoryID,
+			BecomePasswordFile: true,
+			BecomeKey: db.AccessKey{
+				ID:   12345,
+				Type: db.AccessKeyLoginPassword,
+				LoginPassword: db.LoginPassword{
+					Password: "123456",
+					Login:    "root",
+				},
+			},
+		},
+		Template: db.Template{
+			Playbook: "test.yml",
+		},
+	}
+	tsk.job = &LocalJob{
+		Task:        tsk.Task,
+		Template:    tsk.Template,
+		Inventory:   tsk.Inventory,
+		Repository:  tsk.Repository,
+		Environment: tsk.Environment,
+		Logger:      &tsk,
+		Playbook: &lib.AnsiblePlaybook{
+			Logger:     &tsk,
+			TemplateID: tsk.Template.ID,
+			Repository: tsk.Repository,
+		},
+	}
+
+	args, err := tsk.job.(*LocalJob).getPlaybookArgs("", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := strings.Join(args, " ")
+	if res != "-i /tmp/inventory_0 --become-user=root --become-password-file=/tmp/access_key_0 --extra-vars {\"semaphore_vars\":{\"task_details\":{\"id\":0,\"username\":\"\"}}} test.yml" {
+		t.Fatal("incorrect result: " + res)
+	}
+}
+
+func TestTaskGetPlaybookArgs_verbosity(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	for verbosity, expected := range map[int]string{
+		0: "-i /tmp/inventory_0 --extra-vars {\"semaphore_vars\":{\"task_details\":{\"id\":0,\"username\":\"\"}}} test.yml",
+		3: "-i /tmp/inventory_0 -vvv --extra-vars {\"semaphore_vars\":{\"task_details\":{\"id\":0,\"username\":\"\"}}} test.yml",
+	} {
+		job := LocalJob{
+			Task: db.Task{
+				Verbosity: verbosity,
+			},
+			Inventory: db.Inventory{
+				Type: db.InventoryStatic,
+			},
+			Template: db.Template{
+				Playbook: "test.yml",
+			},
+		}
+
+		args, err := job.getPlaybookArgs("", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := strings.Join(args, " ")
+		if res != expected {
+			t.Fatalf("incorrect result for verbosity %d: %s", verbosity, res)
+		}
+	}
+}
+
+func TestGetExitCode(t *testing.T) {
+	code := getExitCode(exec.Command("sh", "-c", "exit 3").Run())
+	if code == nil || *code != 3 {
+		t.Fatal("failed command must record its exit code")
+	}
+
+	code = getExitCode(exec.Command("sh", "-c", "exit 0").Run())
+	if code == nil || *code != 0 {
+		t.Fatal("successful command must record zero exit code")
+	}
+
+	cmd := exec.Command("sleep", "10")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Process.Kill()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = getExitCode(cmd.Wait())
+	if code != nil {
+		t.Fatal("killed command must not have exit code")
+	}
+}
+
+type panicJob struct{}
+
+func (j *panicJob) Run(username string, incomingVersion *string) error {
+	panic("test panic")
+}
+
+func (j *panicJob) Kill() {}
+
+func TestTaskRunnerPanicReleasesLock(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Test",
+		Playbook:  "test.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTestPool(t, pool)
+
+	var runners []*TaskRunner
+
+	for _, job := range []Job{&panicJob{}, &noopJob{}} {
+		// tasks are not saved as waiting, so the pool doesn't restore them on start
+		var task db.Task
+		task, err = store.CreateTask(db.Task{
+			ProjectID:  proj.ID,
+			TemplateID: tpl.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		runners = append(runners, &TaskRunner{
+			Task:     task,
+			Template: tpl,
+			pool:     pool,
+			job:      job,
+		})
+	}
+
+	pool.addTask(runners[0])
+	pool.runNextTask()
+
+	if waitRunnerFinished(t, store, runners[0]).Status != db.TaskFailStatus {
+		t.Fatal("panicked task must be marked as failed")
+	}
+
+	// the lock is released before the task is saved, wait for the locker to process it
+	time.Sleep(50 * time.Millisecond)
+
+	pool.addTask(runners[1])
+	pool.runNextTask()
+
+	if len(pool.queue) != 0 {
+		t.Fatal("next task of the template must not be blocked")
+	}
+
+	waitRunnerFinished(t, store, runners[1])
+}
+
+func TestLocalJobRunnerEnvironment(t *testing.T) {
+	env := `{"LEVEL": "task"}`
+
+	job := LocalJob{
+		Environment: db.Environment{
+			ENV: &env,
+		},
+		RunnerEnvironment: map[string]string{
+			"REGION": "eu-west-1",
+			"LEVEL":  "runner",
+		},
+	}
+
+	arr, err := job.getEnvironmentENV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(arr)
+
+	if len(arr) != 2 || arr[0] != "LEVEL=task" || arr[1] != "REGION=eu-west-1" {
+		t.Fatalf("unexpected environment: %v", arr)
+	}
+}
+
+func TestLocalJobFileSecrets(t *testing.T) {
+	secretsPath := t.TempDir()
+
+	util.Config = &util.ConfigType{
+		TmpPath:         "/tmp",
+		FileSecretsPath: secretsPath,
+	}
+
+	err := os.WriteFile(path.Join(secretsPath, "db_password"), []byte("qwerty\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path.Join(secretsPath, "api_token"), []byte("abc123"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := `[
+		{"name": "db_password", "path": "` + path.Join(secretsPath, "db_password") + `", "type": "var"},
+		{"name": "API_TOKEN", "path": "` + path.Join(secretsPath, "api_token") + `", "type": "env"}
+	]`
+
+	tsk := TaskRunner{}
+	job := &LocalJob{
+		Environment: db.Environment{
+			JSON:        `{"host": "example.com"}`,
+			FileSecrets: &secrets,
+		},
+		Logger: &tsk,
+	}
+
+	err = job.installFileSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extraVars, err := job.getEnvironmentExtraVars("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(extraVars, `"db_password":"qwerty"`) || !strings.Contains(extraVars, `"host":"example.com"`) {
+		t.Fatal("file secret must be injected to extra vars: " + extraVars)
+	}
+
+	env, err := job.getEnvironmentENV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(env) != 1 || env[0] != "API_TOKEN=abc123" {
+		t.Fatal("file secret must be injected to environment variables")
+	}
+
+	outside := `[{"name": "passwd", "path": "` + path.Join(secretsPath, "../passwd") + `", "type": "var"}]`
+	job.Environment.FileSecrets = &outside
+
+	err = job.installFileSecrets()
+	if err == nil {
+		t.Fatal("file secret outside of allowed directory must be rejected")
+	}
+
+	outsidePath := path.Join(t.TempDir(), "passwd")
+	err = os.WriteFile(outsidePath, []byte("root"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Symlink(outsidePath, path.Join(secretsPath, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := `[{"name": "passwd", "path": "` + path.Join(secretsPath, "link") + `", "type": "var"}]`
+	job.Environment.FileSecrets = &link
+
+	err = job.installFileSecrets()
+	if err == nil {
+		t.Fatal("link to the file outside of allowed directory must be rejected")
+	}
+
+	// relative paths are resolved against the allowed directory, not the working directory
+	relative := `[{"name": "db_password", "path": "db_password", "type": "var"}]`
+	job.Environment.FileSecrets = &relative
+
+	err = job.installFileSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.secretVars["db_password"] != "qwerty" {
+		t.Fatal("relative path must be resolved against the allowed directory")
+	}
+
+	relativeOutside := `[{"name": "passwd", "path": "../passwd", "type": "var"}]`
+	job.Environment.FileSecrets = &relativeOutside
+
+	err = job.installFileSecrets()
+	if err == nil {
+		t.Fatal("relative path outside of allowed directory must be rejected")
+	}
+}
+
+func TestLocalJobCommandSecrets(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+		SecretCommands: map[string][]string{
+			"db-password": {"echo", "qwerty"},
+			"api-token":   {"sh", "-c", "printf abc123"},
+		},
+	}
+
+	secrets := `[
+		{"name": "db_password", "command": "db-password", "type": "var"},
+		{"name": "API_TOKEN", "command": "api-token", "type": "env"}
+	]`
+
+	env := db.Environment{
+		Name:           "Test",
+		JSON:           `{"host": "example.com"}`,
+		CommandSecrets: &secrets,
+	}
+
+	if err := env.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tsk := TaskRunner{}
+	job := &LocalJob{
+		Environment: env,
+		Logger:      &tsk,
+	}
+
+	err := job.installFileSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = job.installCommandSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extraVars, err := job.getEnvironmentExtraVars("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(extraVars, `"db_password":"qwerty"`) || !strings.Contains(extraVars, `"host":"example.com"`) {
+		t.Fatal("command secret must be injected to extra vars: " + extraVars)
+	}
+
+	envVars, err := job.getEnvironmentENV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(envVars) != 1 || envVars[0] != "API_TOKEN=abc123" {
+		t.Fatal("command secret must be injected to environment variables")
+	}
+
+	notAllowed := `[{"name": "passwd", "command": "cat", "type": "var"}]`
+	env.CommandSecrets = &notAllowed
+
+	if err = env.Validate(); err == nil {
+		t.Fatal("command which is not in secret_commands must be rejected")
+	}
+}
+
+// longLineReader produces a line of the given size followed by a short line
+// without keeping the long line in memory.
+type longLineReader struct {
+	size int
+	tail []byte
+}
+
+func (r *longLineReader) Read(p []byte) (int, error) {
+	if r.size > 0 {
+		n := len(p)
+		if n > r.size {
+			n = r.size
+		}
+		for i := 0; i < n; i++ {
+			p[i] = 'a'
+		}
+		r.size -= n
+		return n, nil
+	}
+
+	if len(r.tail) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.tail)
+	r.tail = r.tail[n:]
+	return n, nil
+}
+
+func TestReadlnLimited(t *testing.T) {
+	reader := bufio.NewReader(&longLineReader{
+		size: 10 * 1024 * 1024,
+		tail: []byte("\nnext line\n"),
+	})
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	line, err := ReadlnLimited(reader, 1000)
+
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != strings.Repeat("a", 1000)+TruncatedLineMarker {
+		t.Fatalf("line must be truncated to 1000 bytes, got %d bytes", len(line))
+	}
+
+	if after.TotalAlloc-before.TotalAlloc > 1024*1024 {
+		t.Fatalf("too much memory allocated: %d bytes", after.TotalAlloc-before.TotalAlloc)
+	}
+
+	line, err = ReadlnLimited(reader, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "next line" {
+		t.Fatal("next line must be read completely, got: " + line)
+	}
+}
+
+func TestGetOutputLevel(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	lines := map[string]db.TaskOutputLevel{
+		"TASK [Gathering Facts] *********************************************************": db.TaskOutputInfo,
+		"ok: [localhost]": db.TaskOutputInfo,
+		"fatal: [web1]: FAILED! => {\"changed\": false, \"msg\": \"No package matching 'nginx'\"}":  db.TaskOutputError,
+		"ERROR! the playbook: deploy.yml could not be found":                                        db.TaskOutputError,
+		"web1                       : ok=3    changed=1    unreachable=0    failed=1    skipped=0":  db.TaskOutputError,
+		"web2                       : ok=4    changed=0    unreachable=1    failed=0    skipped=0":  db.TaskOutputError,
+		"web3                       : ok=4    changed=0    unreachable=0    failed=0    skipped=0":  db.TaskOutputInfo,
+		"[WARNING]: provided hosts list is empty, only localhost is available":                      db.TaskOutputWarning,
+		"[DEPRECATION WARNING]: Distribution Ubuntu 22.04 on host web1 should use /usr/bin/python3": db.TaskOutputWarning,
+		"...ignoring": db.TaskOutputWarning,
+	}
+
+	for line, level := range lines {
+		if res := GetOutputLevel(line); res != level {
+			t.Fatalf("line %q must be %s, got %s", line, level, res)
+		}
+	}
+
+	util.Config = &util.ConfigType{
+		OutputLevelPatterns: util.OutputLevelPatterns{
+			Error:   []string{`^Traceback`, `(invalid`},
+			Warning: []string{`(?i)retrying`},
+		},
+	}
+
+	lines = map[string]db.TaskOutputLevel{
+		"Traceback (most recent call last):":                   db.TaskOutputError,
+		"FAILED - RETRYING: Wait for service (3 retries left)": db.TaskOutputWarning,
+		"fatal: [web1]: FAILED!":                               db.TaskOutputInfo,
+	}
+
+	for line, level := range lines {
+		if res := GetOutputLevel(line); res != level {
+			t.Fatalf("line %q must be %s with custom patterns, got %s", line, level, res)
+		}
+	}
+}
+
+// testLogger collects log lines of the job.
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Log(msg string) {
+	l.Log2(msg, time.Now())
+}
+
+func (l *testLogger) Log2(msg string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, msg)
+}
+
+func (l *testLogger) LogCmd(cmd *exec.Cmd) {}
+
+func (l *testLogger) SetStatus(status db.TaskStatus) {}
+
+func (l *testLogger) indexOf(line string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, s := range l.lines {
+		if s == line {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestLocalJobHooks(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	preHook := "echo setup done"
+	postHook := "echo cleanup done >&2"
+
+	logger := &testLogger{}
+	repo := db.Repository{GitURL: t.TempDir()}
+
+	job := &LocalJob{
+		Task: db.Task{ID: 1},
+		Template: db.Template{
+			Playbook: "missing.yml",
+			PreHook:  &preHook,
+			PostHook: &postHook,
+		},
+		Inventory: db.Inventory{
+			Type:      db.InventoryStatic,
+			Inventory: "localhost",
+		},
+		Repository: repo,
+		Playbook: &lib.AnsiblePlaybook{
+			Repository: repo,
+			Logger:     logger,
+		},
+		Logger: logger,
+	}
+
+	// the playbook can not succeed, but the post-hook must run anyway
+	err := job.Run("", nil)
+	if err == nil {
+		t.Fatal("playbook must fail")
+	}
+
+	pre := logger.indexOf("setup done")
+	post := logger.indexOf("cleanup done")
+
+	if pre < 0 || post < 0 {
+		t.Fatalf("hooks output must be logged: %v", logger.lines)
+	}
+
+	if pre > post {
+		t.Fatal("pre-hook must run before post-hook")
+	}
+}
+
+func TestLocalJobPreHookFailure(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	preHook := "echo no secrets; exit 3"
+
+	logger := &testLogger{}
+
+	job := &LocalJob{
+		Template: db.Template{
+			PreHook: &preHook,
+		},
+		Playbook: &lib.AnsiblePlaybook{
+			Repository: db.Repository{GitURL: t.TempDir()},
+			Logger:     logger,
+		},
+		Logger: logger,
+	}
+
+	environmentVariables := []string{}
+
+	err := job.runHook("Pre-hook", job.Template.PreHook, &environmentVariables)
+	if getExitCode(err) == nil || *getExitCode(err) != 3 {
+		t.Fatal("pre-hook failure must be returned, got", err)
+	}
+
+	if logger.indexOf("no secrets") < 0 {
+		t.Fatalf("pre-hook output must be logged: %v", logger.lines)
+	}
+}
+
+func TestTaskRunnerResolveTaskEnvironment(t *testing.T) {
+	util.Config = &util.ConfigType{
+		MaxParallelTasks: 10,
+	}
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envVars := `{"REGION": "eu", "SHARED": "template", "DB_PASSWORD": "qwerty"}`
+	fileSecrets := `[{"name": "vault_token", "path": "/run/secrets/token", "type": "var"}, {"name": "CERT", "path": "/run/secrets/cert", "type": "env"}]`
+
+	env, err := store.CreateEnvironment(db.Environment{
+		ProjectID:   proj.ID,
+		Name:        "prod",
+		JSON:        `{"app_version": "2.0", "shared": "template", "api_key": "12345"}`,
+		ENV:         &envVars,
+		FileSecrets: &fileSecrets,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID:     proj.ID,
+		Name:          "Deploy",
+		Playbook:      "deploy.yml",
+		EnvironmentID: &env.ID,
+		JSONEvents:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := store.CreateTask(db.Task{
+		ProjectID:   proj.ID,
+		TemplateID:  tpl.ID,
+		Environment: `{"shared": "task", "hosts": "web", "nested": {"token": "abc", "name": "x"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := CreateTaskPool(store)
+
+	runner := &TaskRunner{
+		pool: &pool,
+		job: &LocalJob{
+			RunnerEnvironment: map[string]string{
+				"SHARED":  "runner",
+				"PROXY":   "http://proxy",
+				"A_TOKEN": "runner-secret",
+			},
+		},
+	}
+
+	res, err := runner.ResolveTaskEnvironment(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extraVars := res["extra_vars"].(map[string]interface{})
+
+	expectedVars := map[string]interface{}{
+		"app_version": "2.0",          // template environment
+		"hosts":       "web",          // task environment
+		"shared":      "template",     // template environment overrides task environment
+		"api_key":     db.MaskedValue, // secret
+		"vault_token": db.MaskedValue, // file secret
+	}
+
+	for k, v := range expectedVars {
+		if extraVars[k] != v {
+			t.Fatalf("extra var %s must be %v, got %v", k, v, extraVars[k])
+		}
+	}
+
+	nested := extraVars["nested"].(map[string]interface{})
+	if nested["token"] != db.MaskedValue || nested["name"] != "x" {
+		t.Fatal("nested secrets must be masked")
+	}
+
+	if _, ok := extraVars["semaphore_vars"]; !ok {
+		t.Fatal("semaphore_vars must be resolved")
+	}
+
+	envs := res["env"].(map[string]interface{})
+
+	expectedEnv := map[string]interface{}{
+		"PROXY":                   "http://proxy", // runner environment
+		"REGION":                  "eu",           // template environment ENV
+		"SHARED":                  "template",     // template environment ENV overrides runner environment
+		"DB_PASSWORD":             db.MaskedValue, // secret
+		"A_TOKEN":                 db.MaskedValue, // secret of the runner
+		"CERT":                    db.MaskedValue, // file secret
+		"ANSIBLE_STDOUT_CALLBACK": lib.AnsibleJSONCallback,
+	}
+
+	for k, v := range expectedEnv {
+		if envs[k] != v {
+			t.Fatalf("env var %s must be %v, got %v", k, v, envs[k])
+		}
+	}
+}
+
+func createTestGitRepo(t *testing.T) (dir string, commits []string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir = t.TempDir()
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s", args, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	write := func(name string, content string) {
+		err := os.MkdirAll(path.Dir(path.Join(dir, name)), 0755)
+		if err == nil {
+			err = os.WriteFile(path.Join(dir, name), []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+
+	write("docs/readme.md", "v1")
+	write("roles/web/tasks/main.yml", "---")
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+	commits = append(commits, git("rev-parse", "HEAD"))
+
+	write("docs/readme.md", "v2")
+	git("commit", "-q", "-am", "update docs")
+	commits = append(commits, git("rev-parse", "HEAD"))
+
+	return
+}
+
+func TestLocalJobChangedPathsFilter(t *testing.T) {
+	dir, commits := createTestGitRepo(t)
+
+	for _, clientID := range []util.GitClientId{util.CmdGitClientId, util.GoGitClientId} {
+		util.Config = &util.ConfigType{
+			TmpPath:     t.TempDir(),
+			GitClientId: clientID,
+		}
+
+		createJob := func(filter []string, logger *testLogger) *LocalJob {
+			repo := db.Repository{GitURL: dir}
+			return &LocalJob{
+				Task: db.Task{ID: 1},
+				Template: db.Template{
+					Playbook:           "missing.yml",
+					ChangedPathsFilter: filter,
+				},
+				Inventory: db.Inventory{
+					Type:      db.InventoryStatic,
+					Inventory: "localhost",
+				},
+				Repository: repo,
+				Playbook: &lib.AnsiblePlaybook{
+					Repository: repo,
+					Logger:     logger,
+				},
+				Logger:             logger,
+				PreviousCommitHash: &commits[0],
+			}
+		}
+
+		logger := &testLogger{}
+		job := createJob([]string{"roles/**", "*.yml"}, logger)
+
+		err := job.Run("", nil)
+		if err != nil {
+			t.Fatalf("%s: task without relevant changes must be skipped, got %v", clientID, err)
+		}
+
+		if logger.indexOf("No files matching changed paths filter changed since commit "+commits[0]+", task skipped") < 0 {
+			t.Fatalf("%s: skip must be logged: %v", clientID, logger.lines)
+		}
+
+		if job.Task.CommitHash == nil || *job.Task.CommitHash != commits[1] {
+			t.Fatalf("%s: commit of the task must be recorded", clientID)
+		}
+
+		logger = &testLogger{}
+		job = createJob([]string{"roles/**", "docs/*.md"}, logger)
+
+		// the playbook can not succeed, so the error means that it was started
+		err = job.Run("", nil)
+		if err == nil {
+			t.Fatalf("%s: task with relevant changes must run", clientID)
+		}
+
+		if logger.indexOf("No files matching changed paths filter changed since commit "+commits[0]+", task skipped") >= 0 {
+			t.Fatalf("%s: task with relevant changes must not be skipped", clientID)
+		}
+	}
+}
+
+func TestMatchChangedPath(t *testing.T) {
+	cases := []struct {
+		pattern string
+		file    string
+		match   bool
+	}{
+		{"roles/**", "roles/web/tasks/main.yml", true},
+		{"roles/**", "rolesx/main.yml", false},
+		{"*.yml", "site.yml", true},
+		{"*.yml", "roles/site.yml", false},
+		{"docs/*.md", "docs/readme.md", true},
+	}
+
+	for _, c := range cases {
+		if matchChangedPath(c.pattern, c.file) != c.match {
+			t.Errorf("pattern %s and file %s: expected %v", c.pattern, c.file, c.match)
+		}
+	}
+}
+
+func TestTaskRunnerAdditionalRepositories(t *testing.T) {
+	playbooksDir, _ := createTestGitRepo(t)
+	rolesDir, _ := createTestGitRepo(t)
+
+	out, err := exec.Command("git", "-C", playbooksDir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := strings.TrimSpace(string(out))
+
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		ProjectID: &proj.ID,
+		Name:      "None",
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	playbooks, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		Name:      "Playbooks",
+		GitURL:    "file://" + playbooksDir,
+		GitBranch: branch,
+		SSHKeyID:  key.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		Name:      "Roles",
+		GitURL:    "file://" + rolesDir,
+		GitBranch: branch,
+		SSHKeyID:  key.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+		Name:      "Hosts",
+		Type:      db.InventoryStatic,
+		Inventory: "localhost",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID:               proj.ID,
+		Name:                    "Deploy",
+		Playbook:                "site.yml",
+		RepositoryID:            playbooks.ID,
+		InventoryID:             &inv.ID,
+		AdditionalRepositoryIDs: []int{roles.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := store.CreateTask(db.Task{
+		ProjectID:  proj.ID,
+		TemplateID: tpl.ID,
+		Status:     db.TaskWaitingStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := CreateTaskPool(store)
+
+	tsk, err := pool.createTaskRunner(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tsk.AdditionalRepositories) != 1 || tsk.AdditionalRepositories[0].ID != roles.ID {
+		t.Fatal("additional repositories must be resolved")
+	}
+
+	job := tsk.job.(*LocalJob)
+	job.Logger = &testLogger{}
+
+	err = job.prepareRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{
+		path.Join(playbooks.GetFullPath(tpl.ID), "docs/readme.md"),
+		path.Join(roles.GetFullPath(tpl.ID), "roles/web/tasks/main.yml"),
+	} {
+		if _, err = os.Stat(file); err != nil {
+			t.Fatal("both repositories must be cloned: " + err.Error())
+		}
+	}
+
+	if path.Dir(playbooks.GetFullPath(tpl.ID)) != path.Dir(roles.GetFullPath(tpl.ID)) {
+		t.Fatal("repositories must be cloned into sibling directories")
+	}
+}
+
+func TestLocalJobGalaxyRequirements(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported")
+	}
+
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	// fake ansible-galaxy writes its arguments and environment to the file
+	binDir := t.TempDir()
+	argsFile := path.Join(binDir, "args")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > " + argsFile + "\n" +
+		"echo \"$ANSIBLE_ROLES_PATH\" >> " + argsFile + "\n" +
+		"test -z \"$GALAXY_FAIL\"\n"
+	err := os.WriteFile(path.Join(binDir, "ansible-galaxy"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+":"+os.Getenv("PATH"))
+
+	repoDir := t.TempDir()
+	err = os.WriteFile(path.Join(repoDir, "requirements.yml"), []byte("---"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requirements := "requirements.yml"
+
+	createJob := func() *LocalJob {
+		repo := db.Repository{GitURL: repoDir}
+		logger := &testLogger{}
+		return &LocalJob{
+			Template: db.Template{
+				Playbook:           "playbooks/site.yml",
+				GalaxyRequirements: &requirements,
+			},
+			Repository: repo,
+			Playbook: &lib.AnsiblePlaybook{
+				Repository: repo,
+				Logger:     logger,
+			},
+			Logger: logger,
+		}
+	}
+
+	err = createJob().installRequirements()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal("ansible-galaxy must be run: " + err.Error())
+	}
+
+	expected := "install -r " + path.Join(repoDir, "requirements.yml") + " --force\n" +
+		path.Join(repoDir, "playbooks", "roles") + "\n"
+
+	if string(out) != expected {
+		t.Fatalf("unexpected ansible-galaxy call: %s", out)
+	}
+
+	t.Setenv("GALAXY_FAIL", "1")
+
+	if err = createJob().installRequirements(); err == nil {
+		t.Fatal("failed galaxy install must fail the job")
+	}
+
+	t.Setenv("GALAXY_FAIL", "")
+	requirements = "missing.yml"
+
+	if err = createJob().installRequirements(); err == nil {
+		t.Fatal("missing requirements file must fail the job")
+	}
+}
+
+func TestLocalJobSyntaxCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported")
+	}
+
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	// fake ansible-playbook writes its arguments to the file and fails the syntax check
+	// of the broken playbook
+	binDir := t.TempDir()
+	argsFile := path.Join(binDir, "args")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" >> " + argsFile + "\n" +
+		"if [ \"$1\" = \"--syntax-check\" ] && [ \"$2\" = \"broken.yml\" ]; then\n" +
+		"  echo \"ERROR! We were unable to read either as JSON nor YAML\"\n" +
+		"  exit 4\n" +
+		"fi\n"
+	err := os.WriteFile(path.Join(binDir, "ansible-playbook"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+":"+os.Getenv("PATH"))
+
+	repo := db.Repository{GitURL: t.TempDir()}
+	logger := &testLogger{}
+
+	job := LocalJob{
+		Template: db.Template{
+			SyntaxCheck: true,
+		},
+		Repository: repo,
+		Playbook: &lib.AnsiblePlaybook{
+			Repository: repo,
+			Logger:     logger,
+		},
+		Logger: logger,
+	}
+
+	readCalls := func() string {
+		out, err := os.ReadFile(argsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Remove(argsFile)
+		return string(out)
+	}
+
+	if err = job.runPlaybook([]string{"broken.yml"}, &[]string{}); err == nil {
+		t.Fatal("broken playbook must fail at the syntax check")
+	}
+
+	if calls := readCalls(); calls != "--syntax-check broken.yml\n" {
+		t.Fatalf("broken playbook must not be run, got calls: %s", calls)
+	}
+
+	if logger.indexOf("Playbook syntax check failed, the playbook is not run") < 0 {
+		t.Fatal("syntax check failure must be logged")
+	}
+
+	if job.ExitCode != nil {
+		t.Fatal("exit code must be set only by the playbook run")
+	}
+
+	if err = job.runPlaybook([]string{"site.yml"}, &[]string{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := readCalls(); calls != "--syntax-check site.yml\nsite.yml\n" {
+		t.Fatalf("valid playbook must be run after the syntax check, got calls: %s", calls)
+	}
+
+	job.Template.SyntaxCheck = false
+
+	if err = job.runPlaybook([]string{"broken.yml"}, &[]string{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := readCalls(); calls != "broken.yml\n" {
+		t.Fatalf("syntax check must be skipped when it is disabled, got calls: %s", calls)
+	}
+}
+
+func TestTaskRunnerFailureReason(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported")
+	}
+
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath: t.TempDir(),
+	})
+
+	// fake ansible-playbook fails like a playbook with failed hosts
+	binDir := t.TempDir()
+	err := os.WriteFile(path.Join(binDir, "ansible-playbook"), []byte("#!/bin/sh\nexit 2\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+":"+os.Getenv("PATH"))
+
+	startTestPool(t, pool)
+
+	runTask := func(repo db.Repository) db.Task {
+		task, err2 := store.CreateTask(db.Task{})
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		taskRunner := TaskRunner{
+			Task: task,
+			pool: pool,
+		}
+		taskRunner.job = &LocalJob{
+			Task:       taskRunner.Task,
+			Template:   db.Template{Playbook: "site.yml"},
+			Repository: repo,
+			Inventory: db.Inventory{
+				Type:      db.InventoryStatic,
+				Inventory: "localhost",
+			},
+			Logger: &taskRunner,
+			Playbook: &lib.AnsiblePlaybook{
+				Logger:     &taskRunner,
+				Repository: repo,
+			},
+		}
+		taskRunner.run()
+
+		task, err2 = store.GetTask(task.ProjectID, task.ID)
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		return task
+	}
+
+	checkoutFailed := runTask(db.Repository{GitURL: path.Join(t.TempDir(), "missing")})
+
+	if checkoutFailed.Status != db.TaskFailStatus || checkoutFailed.FailureReason != db.TaskFailureCheckout {
+		t.Fatalf("missing repository must fail the task at checkout, got %s %s", checkoutFailed.Status, checkoutFailed.FailureReason)
+	}
+
+	playbookFailed := runTask(db.Repository{GitURL: t.TempDir()})
+
+	if playbookFailed.Status != db.TaskFailStatus || playbookFailed.FailureReason != db.TaskFailurePlaybook {
+		t.Fatalf("non-zero exit code must fail the task at playbook, got %s %s", playbookFailed.Status, playbookFailed.FailureReason)
+	}
+
+	if playbookFailed.ExitCode == nil || *playbookFailed.ExitCode != 2 {
+		t.Fatal("exit code of the playbook must be saved")
+	}
+}
+
+func TestLocalJobWorkingDir(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	repoDir := t.TempDir()
+	workingDir := "/services/web/"
+
+	repo := db.Repository{GitURL: repoDir}
+
+	job := LocalJob{
+		Task: db.Task{ID: 1},
+		Template: db.Template{
+			Playbook:   "playbooks/site.yml",
+			WorkingDir: &workingDir,
+		},
+		Inventory: db.Inventory{
+			Type:      db.InventoryFile,
+			Inventory: "inventories/prod.ini",
+		},
+		Repository: repo,
+		Playbook: &lib.AnsiblePlaybook{
+			Repository: repo,
+			WorkingDir: "services/web",
+		},
+		Logger: &testLogger{},
+	}
+
+	if job.getPlaybookDir() != path.Join(repoDir, "services/web/playbooks") {
+		t.Fatal("playbook must be resolved relative to the working dir, got " + job.getPlaybookDir())
+	}
+
+	if job.Playbook.GetWorkingDir() != path.Join(repoDir, "services/web") {
+		t.Fatal("commands must run in the working dir, got " + job.Playbook.GetWorkingDir())
+	}
+
+	args, err := job.getPlaybookArgs("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if args[1] != path.Join(repoDir, "inventories/prod.ini") {
+		t.Fatal("file inventory must stay relative to the repository root, got " + args[1])
+	}
+
+	if args[len(args)-1] != "playbooks/site.yml" {
+		t.Fatal("playbook must be passed relative to the working dir, got " + args[len(args)-1])
+	}
+}
+
+func TestTaskEventsCorrelation(t *testing.T) {
+	// MaxParallelTasks isn't set, so queued tasks never start
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath: "/tmp",
+	})
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		ProjectID: &proj.ID,
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		SSHKeyID:  key.ID,
+		Name:      "Test",
+		GitURL:    "git@example.com:test/test",
+		GitBranch: "master",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		Name:         "Test",
+		Playbook:     "test.yml",
+		ProjectID:    proj.ID,
+		RepositoryID: repo.ID,
+		InventoryID:  &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTestPool(t, pool)
+
+	task1, err := pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, proj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task2, err := pool.AddTask(db.Task{TemplateID: tpl.ID}, nil, proj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := pool.GetTask(task1.ID)
+	if runner == nil {
+		t.Fatal("task must be in the queue")
+	}
+
+	runner.Task.Status = db.TaskSuccessStatus
+	runner.createTaskEvent()
+
+	events, err := store.GetTaskEvents(proj.ID, task1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected queued and finished events, got %d", len(events))
+	}
+
+	if !strings.Contains(*events[0].Description, "queued") || !strings.Contains(*events[1].Description, "finished") {
+		t.Fatal("events must be ordered from the oldest to the newest")
+	}
+
+	events, err = store.GetTaskEvents(proj.ID, task2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("events of other tasks must not be returned, got %d", len(events))
+	}
+}
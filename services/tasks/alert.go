@@ -2,6 +2,10 @@ package tasks
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/util"
 	"html/template"
@@ -160,8 +164,18 @@ func (t *TaskRunner) sendSlackAlert() {
 		return
 	}
 
-	slackUrl := util.Config.SlackUrl
+	slackBuffer := t.createSlackAlert()
 
+	resp, err := http.Post(util.Config.SlackUrl, "application/json", &slackBuffer)
+
+	if err != nil {
+		t.Log("Can't send slack alert! Error: " + err.Error())
+	} else if resp.StatusCode != 200 {
+		t.Log("Can't send slack alert! Response code: " + strconv.Itoa(resp.StatusCode))
+	}
+}
+
+func (t *TaskRunner) createSlackAlert() bytes.Buffer {
 	var slackBuffer bytes.Buffer
 
 	var version string
@@ -178,14 +192,7 @@ func (t *TaskRunner) sendSlackAlert() {
 		message = "- " + t.Task.Message
 	}
 
-	var author string
-	if t.Task.UserID != nil {
-		user, err := t.pool.store.GetUser(*t.Task.UserID)
-		if err != nil {
-			panic(err)
-		}
-		author = user.Name
-	}
+	author := t.getAlertAuthor()
 
 	var color string
 	if t.Task.Status == db.TaskSuccessStatus {
@@ -204,7 +211,7 @@ func (t *TaskRunner) sendSlackAlert() {
 	alert := Alert{
 		TaskID:          strconv.Itoa(t.Task.ID),
 		Name:            t.Template.Name,
-		TaskURL:         util.Config.WebHost + "/project/" + strconv.Itoa(t.Template.ProjectID) + "/templates/" + strconv.Itoa(t.Template.ID) + "?t=" + strconv.Itoa(t.Task.ID),
+		TaskURL:         t.getTaskURL(),
 		TaskResult:      strings.ToUpper(string(t.Task.Status)),
 		TaskVersion:     version,
 		TaskDescription: message,
@@ -225,11 +232,120 @@ func (t *TaskRunner) sendSlackAlert() {
 		t.Log("Can't generate alert template!")
 		panic(err)
 	}
-	resp, err := http.Post(slackUrl, "application/json", &slackBuffer)
 
+	return slackBuffer
+}
+
+func (t *TaskRunner) getTaskURL() string {
+	return util.Config.WebHost + "/project/" + strconv.Itoa(t.Template.ProjectID) + "/templates/" + strconv.Itoa(t.Template.ID) + "?t=" + strconv.Itoa(t.Task.ID)
+}
+
+// getAlertAuthor returns the name of the user who started the task.
+// The alert is sent without the author if the user can not be read.
+func (t *TaskRunner) getAlertAuthor() string {
+	if t.Task.UserID == nil {
+		return ""
+	}
+
+	user, err := t.pool.store.GetUser(*t.Task.UserID)
 	if err != nil {
-		t.Log("Can't send slack alert! Error: " + err.Error())
-	} else if resp.StatusCode != 200 {
-		t.Log("Can't send slack alert! Response code: " + strconv.Itoa(resp.StatusCode))
+		t.Log("Can't get author of the task! Error: " + err.Error())
+		return ""
+	}
+
+	return user.Name
+}
+
+// webhookAlert is the body sent to the notification targets of webhook type.
+type webhookAlert struct {
+	TaskID     int           `json:"task_id"`
+	TemplateID int           `json:"template_id"`
+	ProjectID  int           `json:"project_id"`
+	Name       string        `json:"name"`
+	Status     db.TaskStatus `json:"status"`
+	Version    *string       `json:"version"`
+	Message    string        `json:"message"`
+	Author     string        `json:"author"`
+	TaskURL    string        `json:"task_url"`
+}
+
+// WebhookSignatureHeader contains HMAC-SHA256 of the webhook body signed
+// with the secret of the notification target, in the form "sha256=<hex>".
+const WebhookSignatureHeader = "X-Semaphore-Signature"
+
+// signWebhookBody returns the value of WebhookSignatureHeader for the body.
+func signWebhookBody(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// sendTargetAlerts notifies the notification targets of the template,
+// or the project default targets if the template has no targets.
+func (t *TaskRunner) sendTargetAlerts() {
+	if !t.alert {
+		return
+	}
+
+	if t.Template.SuppressSuccessAlerts && t.Task.Status == db.TaskSuccessStatus {
+		return
+	}
+
+	targets, err := db.GetTemplateNotificationTargets(t.pool.store, t.Template)
+	if err != nil {
+		t.Log("Can't get notification targets! Error: " + err.Error())
+		return
+	}
+
+	for _, target := range targets {
+		var body bytes.Buffer
+
+		switch target.Type {
+		case db.NotificationTargetSlack:
+			body = t.createSlackAlert()
+		case db.NotificationTargetWebhook:
+			err = json.NewEncoder(&body).Encode(webhookAlert{
+				TaskID:     t.Task.ID,
+				TemplateID: t.Template.ID,
+				ProjectID:  t.Template.ProjectID,
+				Name:       t.Template.Name,
+				Status:     t.Task.Status,
+				Version:    t.Task.Version,
+				Message:    t.Task.Message,
+				Author:     t.getAlertAuthor(),
+				TaskURL:    t.getTaskURL(),
+			})
+			if err != nil {
+				t.Log("Can't generate alert for " + target.Name + "! Error: " + err.Error())
+				continue
+			}
+		default:
+			continue
+		}
+
+		req, err := http.NewRequest("POST", target.URL, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			t.Log("Can't send alert to " + target.Name + "! Error: " + err.Error())
+			continue
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		if target.Type == db.NotificationTargetWebhook && target.Secret != "" {
+			req.Header.Set(WebhookSignatureHeader, signWebhookBody(target.Secret, body.Bytes()))
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Log("Can't send alert to " + target.Name + "! Error: " + err.Error())
+			continue
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			t.Log("Can't send alert to " + target.Name + "! Response code: " + strconv.Itoa(resp.StatusCode))
+		}
 	}
 }
@@ -0,0 +1,311 @@
+package tasks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+type alertRecorder struct {
+	mu     sync.Mutex
+	alerts []webhookAlert
+	// secret is used to verify signatures of the alerts, unsigned alerts are rejected.
+	secret string
+}
+
+func (r *alertRecorder) setSecret(secret string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secret = secret
+}
+
+func (r *alertRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var alert webhookAlert
+	if err = json.Unmarshal(body, &alert); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.Header.Get(WebhookSignatureHeader) != signWebhookBody(r.secret, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.alerts = append(r.alerts, alert)
+}
+
+func (r *alertRecorder) received() []webhookAlert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.alerts
+}
+
+func TestTaskRunnerNotificationTargets(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{Alert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaultHook := &alertRecorder{}
+	defaultServer := httptest.NewServer(defaultHook)
+	defer defaultServer.Close()
+
+	deployHook := &alertRecorder{}
+	deployServer := httptest.NewServer(deployHook)
+	defer deployServer.Close()
+
+	defaultTarget, err := store.CreateNotificationTarget(db.NotificationTarget{
+		ProjectID:      proj.ID,
+		Name:           "All tasks",
+		Type:           db.NotificationTargetWebhook,
+		URL:            defaultServer.URL,
+		ProjectDefault: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultHook.setSecret(defaultTarget.Secret)
+
+	deployTarget, err := store.CreateNotificationTarget(db.NotificationTarget{
+		ProjectID: proj.ID,
+		Name:      "Deploys",
+		Type:      db.NotificationTargetWebhook,
+		URL:       deployServer.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployHook.setSecret(deployTarget.Secret)
+
+	if deployTarget.Secret == "" || deployTarget.Secret == defaultTarget.Secret {
+		t.Fatal("each target must get its own secret")
+	}
+
+	deployTpl, err := store.CreateTemplate(db.Template{
+		ProjectID:             proj.ID,
+		Name:                  "Deploy",
+		Playbook:              "deploy.yml",
+		NotificationTargetIDs: []int{deployTarget.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buildTpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Build",
+		Playbook:  "build.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := CreateTaskPool(store)
+
+	finish := func(tpl db.Template) db.Task {
+		task, err := store.CreateTask(db.Task{
+			ProjectID:  proj.ID,
+			TemplateID: tpl.ID,
+			Status:     db.TaskRunningStatus,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tpl, err = store.GetTemplate(proj.ID, tpl.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tsk := TaskRunner{
+			Task:     task,
+			Template: tpl,
+			pool:     &pool,
+			alert:    proj.Alert,
+		}
+
+		tsk.SetStatus(db.TaskSuccessStatus)
+
+		return task
+	}
+
+	deployTask := finish(deployTpl)
+
+	if len(defaultHook.received()) != 0 {
+		t.Fatal("project default target must not be notified about template with own targets")
+	}
+
+	alerts := deployHook.received()
+	if len(alerts) != 1 || alerts[0].TaskID != deployTask.ID || alerts[0].Status != db.TaskSuccessStatus {
+		t.Fatal("template target must be notified with signed alert")
+	}
+
+	buildTask := finish(buildTpl)
+
+	if len(deployHook.received()) != 1 {
+		t.Fatal("template target must not be notified about other templates")
+	}
+
+	alerts = defaultHook.received()
+	if len(alerts) != 1 || alerts[0].TaskID != buildTask.ID {
+		t.Fatal("project default target must be notified about template without own targets")
+	}
+}
+
+func TestTaskRunnerAlertAuthorOfDeletedUser(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	pool := CreateTaskPool(store)
+
+	userID := 100
+	tsk := TaskRunner{
+		Task: db.Task{UserID: &userID},
+		pool: &pool,
+	}
+
+	if author := tsk.getAlertAuthor(); author != "" {
+		t.Fatal("alert must be sent without author, got " + author)
+	}
+}
+
+func TestTaskRunnerSignsAlertsWithRotatedSecret(t *testing.T) {
+	util.Config = &util.ConfigType{}
+
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{Alert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &alertRecorder{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	target, err := store.CreateNotificationTarget(db.NotificationTarget{
+		ProjectID:      proj.ID,
+		Name:           "All tasks",
+		Type:           db.NotificationTargetWebhook,
+		URL:            server.URL,
+		ProjectDefault: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Deploy",
+		Playbook:  "deploy.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := CreateTaskPool(store)
+
+	finish := func() {
+		task, err := store.CreateTask(db.Task{
+			ProjectID:  proj.ID,
+			TemplateID: tpl.ID,
+			Status:     db.TaskRunningStatus,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tsk := TaskRunner{
+			Task:     task,
+			Template: tpl,
+			pool:     &pool,
+			alert:    proj.Alert,
+		}
+
+		tsk.SetStatus(db.TaskSuccessStatus)
+	}
+
+	secret, err := store.RotateWebhookSecret(proj.ID, target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret == "" || secret == target.Secret {
+		t.Fatal("rotation must generate a new secret")
+	}
+
+	// the receiver still expects the old secret
+	hook.setSecret(target.Secret)
+	finish()
+
+	if len(hook.received()) != 0 {
+		t.Fatal("alert must not be signed with the old secret")
+	}
+
+	hook.setSecret(secret)
+	finish()
+
+	if len(hook.received()) != 1 {
+		t.Fatal("alert must be signed with the new secret")
+	}
+
+	// the secret is not changed by updates of the target
+	target.Name = "Renamed"
+	if err = store.UpdateNotificationTarget(target); err != nil {
+		t.Fatal(err)
+	}
+
+	finish()
+
+	if len(hook.received()) != 2 {
+		t.Fatal("update of the target must keep the rotated secret")
+	}
+}
+
+func TestRotateSecretOfSlackTarget(t *testing.T) {
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := store.CreateNotificationTarget(db.NotificationTarget{
+		ProjectID: proj.ID,
+		Name:      "Slack",
+		Type:      db.NotificationTargetSlack,
+		URL:       "https://hooks.slack.com/services/T000/B000/XXX",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.RotateWebhookSecret(proj.ID, target.ID)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("secret of slack target must not be rotated")
+	}
+}
@@ -0,0 +1,113 @@
+package tasks
+
+import (
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+// ConcurrencyLevel is a level which limits number of running tasks.
+type ConcurrencyLevel string
+
+const (
+	ConcurrencyGlobal    ConcurrencyLevel = "global"
+	ConcurrencyRunnerTag ConcurrencyLevel = "runner_tag"
+	ConcurrencyProject   ConcurrencyLevel = "project"
+	ConcurrencyTemplate  ConcurrencyLevel = "template"
+)
+
+// ConcurrencyLimit describes the limit of running tasks at one level.
+type ConcurrencyLimit struct {
+	// Limit is a max number of running tasks, 0 means no limit.
+	Limit int `json:"limit"`
+	// Running is a number of currently running tasks counted by the limit.
+	Running int `json:"running"`
+}
+
+// Free returns number of tasks which can be started before the limit is reached,
+// -1 means no limit.
+func (l ConcurrencyLimit) Free() int {
+	if l.Limit < 1 {
+		return -1
+	}
+
+	if l.Running >= l.Limit {
+		return 0
+	}
+
+	return l.Limit - l.Running
+}
+
+// ConcurrencyLimits describes limits which apply to tasks of the template.
+type ConcurrencyLimits struct {
+	Global    ConcurrencyLimit `json:"global"`
+	RunnerTag ConcurrencyLimit `json:"runner_tag"`
+	Project   ConcurrencyLimit `json:"project"`
+	// Template is always limited by one task, tasks of the same template don't run in parallel.
+	Template ConcurrencyLimit `json:"template"`
+
+	// Binding is the level with the least free slots, it is the narrowest level on tie.
+	Binding ConcurrencyLevel `json:"binding"`
+	// Free is number of tasks of the template which can be started now.
+	Free int `json:"free"`
+}
+
+// GetEffectiveConcurrency returns limits of running tasks which apply to tasks of the template
+// and the level which limits them the most.
+func (p *TaskPool) GetEffectiveConcurrency(projectID int, templateID int) (res ConcurrencyLimits, err error) {
+	project, err := p.store.GetProject(projectID)
+	if err != nil {
+		return
+	}
+
+	tpl, err := p.store.GetTemplate(projectID, templateID)
+	if err != nil {
+		return
+	}
+
+	res.Global.Limit = util.Config.MaxParallelTasks
+	res.Project.Limit = project.MaxParallelTasks
+	res.Template.Limit = 1
+
+	if tpl.RunnerTag != nil && *tpl.RunnerTag != "" {
+		res.RunnerTag.Limit = util.Config.RunnerTagMaxParallelTasks[*tpl.RunnerTag]
+	}
+
+	for _, t := range p.GetRunningTasks() {
+		res.Global.Running++
+
+		if tpl.RunnerTag != nil && *tpl.RunnerTag != "" &&
+			t.Template.RunnerTag != nil && *t.Template.RunnerTag == *tpl.RunnerTag {
+			res.RunnerTag.Running++
+		}
+
+		if t.Task.ProjectID != projectID {
+			continue
+		}
+
+		res.Project.Running++
+
+		if t.Template.ID == templateID {
+			res.Template.Running++
+		}
+	}
+
+	res.Binding = ConcurrencyTemplate
+	res.Free = res.Template.Free()
+
+	// levels from the broadest, so the narrower level wins on tie
+	for _, level := range []struct {
+		name  ConcurrencyLevel
+		limit ConcurrencyLimit
+	}{
+		{ConcurrencyGlobal, res.Global},
+		{ConcurrencyRunnerTag, res.RunnerTag},
+		{ConcurrencyProject, res.Project},
+	} {
+		free := level.limit.Free()
+		if free >= 0 && free < res.Free {
+			res.Binding = level.name
+			res.Free = free
+		}
+	}
+
+	return
+}
@@ -0,0 +1,135 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+func TestTaskPoolGetEffectiveConcurrency(t *testing.T) {
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{MaxParallelTasks: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherProj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := "gpu"
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Deploy",
+		Playbook:  "deploy.yml",
+		RunnerTag: &tag,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(pool *TaskPool, projectID int, template db.Template) {
+		task, err := store.CreateTask(db.Task{
+			ProjectID:  projectID,
+			TemplateID: template.ID,
+			Status:     db.TaskRunningStatus,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pool.runningTasks[task.ID] = &TaskRunner{
+			Task:     task,
+			Template: template,
+			pool:     pool,
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		global   int
+		tagLimit int
+		prepare  func(pool *TaskPool)
+		binding  ConcurrencyLevel
+		free     int
+	}{
+		{
+			name:    "nothing running",
+			global:  10,
+			prepare: func(pool *TaskPool) {},
+			binding: ConcurrencyTemplate,
+			free:    1,
+		},
+		{
+			name:   "global limit reached",
+			global: 2,
+			prepare: func(pool *TaskPool) {
+				run(pool, otherProj.ID, db.Template{ID: 1000})
+				run(pool, otherProj.ID, db.Template{ID: 1001})
+			},
+			binding: ConcurrencyGlobal,
+			free:    0,
+		},
+		{
+			name:     "runner tag limit reached",
+			global:   10,
+			tagLimit: 1,
+			prepare: func(pool *TaskPool) {
+				run(pool, otherProj.ID, db.Template{ID: 1000, RunnerTag: &tag})
+			},
+			binding: ConcurrencyRunnerTag,
+			free:    0,
+		},
+		{
+			name:   "project limit reached",
+			global: 10,
+			prepare: func(pool *TaskPool) {
+				run(pool, proj.ID, db.Template{ID: 1000})
+				run(pool, proj.ID, db.Template{ID: 1001})
+				run(pool, proj.ID, db.Template{ID: 1002})
+			},
+			binding: ConcurrencyProject,
+			free:    0,
+		},
+		{
+			name:   "template is running",
+			global: 10,
+			prepare: func(pool *TaskPool) {
+				run(pool, proj.ID, tpl)
+				run(pool, proj.ID, db.Template{ID: 1000})
+				run(pool, proj.ID, db.Template{ID: 1001})
+			},
+			binding: ConcurrencyTemplate,
+			free:    0,
+		},
+	} {
+		util.Config = &util.ConfigType{
+			MaxParallelTasks: test.global,
+			RunnerTagMaxParallelTasks: map[string]int{
+				tag: test.tagLimit,
+			},
+		}
+
+		pool := CreateTaskPool(store)
+		test.prepare(&pool)
+
+		limits, err := pool.GetEffectiveConcurrency(proj.ID, tpl.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if limits.Binding != test.binding || limits.Free != test.free {
+			t.Fatalf("%s: expected %s limit with %d free, got %s with %d free",
+				test.name, test.binding, test.free, limits.Binding, limits.Free)
+		}
+
+		if limits.Global.Limit != test.global || limits.Project.Limit != 3 || limits.Template.Limit != 1 {
+			t.Fatalf("%s: unexpected limits %+v", test.name, limits)
+		}
+	}
+}
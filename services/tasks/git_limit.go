@@ -0,0 +1,58 @@
+package tasks
+
+import (
+	"sync"
+
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+// gitOperations limits repository clones and fetches of all jobs of the process.
+var gitOperations = newGitOperationLimiter(func() int {
+	return util.Config.MaxParallelGitOperations
+})
+
+// gitOperationLimiter is a semaphore which allows only limited number of git operations
+// to run at the same time. The limit is read on every acquire, so config changes apply
+// to operations started after them. Limit less than 1 means no limit.
+type gitOperationLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	active int
+	limit  func() int
+}
+
+func newGitOperationLimiter(limit func() int) *gitOperationLimiter {
+	l := &gitOperationLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *gitOperationLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for {
+		limit := l.limit()
+		if limit < 1 || l.active < limit {
+			break
+		}
+		l.cond.Wait()
+	}
+
+	l.active++
+}
+
+func (l *gitOperationLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.cond.Broadcast()
+}
+
+// run waits until the limit allows one more operation and runs it.
+func (l *gitOperationLimiter) run(operation func() error) error {
+	l.acquire()
+	defer l.release()
+	return operation()
+}
@@ -0,0 +1,90 @@
+package tasks
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGitOperationLimiter(t *testing.T) {
+	const limit = 2
+
+	limiter := newGitOperationLimiter(func() int { return limit })
+
+	var running int32
+	var maxRunning int32
+
+	// stubbed checkout tracks how many checkouts run at the same time
+	checkout := func() error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			observed := atomic.LoadInt32(&maxRunning)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.run(checkout); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if maxRunning > limit {
+		t.Fatalf("no more than %d checkouts must run at the same time, got %d", limit, maxRunning)
+	}
+
+	if maxRunning < limit {
+		t.Fatalf("checkouts must run in parallel up to the limit, got %d", maxRunning)
+	}
+
+	if limiter.active != 0 {
+		t.Fatal("all operations must be released")
+	}
+}
+
+func TestGitOperationLimiterUnlimited(t *testing.T) {
+	limiter := newGitOperationLimiter(func() int { return 0 })
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = limiter.run(func() error {
+				started <- struct{}{}
+				<-finish
+				return nil
+			})
+		}()
+	}
+
+	// all operations must start without waiting for each other
+	for i := 0; i < 5; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("operations must not be limited")
+		}
+	}
+
+	close(finish)
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+// envReferenceRegexp matches references to environment variables in template fields.
+// A reference is written as ${NAME}, $${NAME} is an escaped reference which
+// is replaced with the literal text ${NAME}.
+var envReferenceRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateEnvironment replaces references to environment variables in the string
+// with their values. It returns *db.ValidationError if a variable is not defined.
+func interpolateEnvironment(str string, vars map[string]string) (string, error) {
+	var err error
+
+	res := envReferenceRegexp.ReplaceAllStringFunc(str, func(ref string) string {
+		if ref[1] == '$' {
+			return ref[1:]
+		}
+
+		name := envReferenceRegexp.FindStringSubmatch(ref)[1]
+
+		val, ok := vars[name]
+		if !ok {
+			if err == nil {
+				err = &db.ValidationError{Message: "Environment variable " + name + " is not defined"}
+			}
+			return ref
+		}
+
+		return val
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return res, nil
+}
+
+// interpolateFields substitutes environment variables of the task environment
+// into the playbook path and the limit of the task. Playbook paths are validated again
+// after the substitution, because values of variables can lead them out of the repository.
+func (t *TaskRunner) interpolateFields() error {
+	vars := make(map[string]string)
+
+	if t.Environment.ENV != nil && *t.Environment.ENV != "" {
+		err := json.Unmarshal([]byte(*t.Environment.ENV), &vars)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range []*string{&t.Template.Playbook, &t.Task.Playbook, &t.Task.Limit} {
+		val, err := interpolateEnvironment(*field, vars)
+		if err != nil {
+			return err
+		}
+		*field = val
+	}
+
+	if !db.IsValidPlaybookPath(t.Template.Playbook) {
+		return &db.ValidationError{Message: "template playbook must be inside the repository"}
+	}
+
+	if !db.IsValidPlaybookPath(t.Task.Playbook) {
+		return &db.ValidationError{Message: "task playbook must be inside the repository"}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+func TestInterpolateEnvironment(t *testing.T) {
+	vars := map[string]string{
+		"ENV":    "prod",
+		"REGION": "eu",
+	}
+
+	for _, c := range []struct {
+		str      string
+		expected string
+	}{
+		{"deploy.yml", "deploy.yml"},
+		{"${ENV}/deploy.yml", "prod/deploy.yml"},
+		{"web-${ENV}-${REGION}", "web-prod-eu"},
+		{"$${ENV}/deploy.yml", "${ENV}/deploy.yml"},
+		{"$ENV/deploy.yml", "$ENV/deploy.yml"},
+	} {
+		res, err := interpolateEnvironment(c.str, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != c.expected {
+			t.Fatalf("%s: expected %s, got %s", c.str, c.expected, res)
+		}
+	}
+
+	_, err := interpolateEnvironment("${STAGE}/deploy.yml", vars)
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("undefined variable must cause validation error")
+	}
+}
+
+func TestTaskRunnerInterpolateFields(t *testing.T) {
+	env := `{"ENV": "staging"}`
+
+	tsk := TaskRunner{
+		Task: db.Task{
+			Limit: "web-${ENV}",
+		},
+		Template: db.Template{
+			Playbook: "${ENV}/deploy.yml",
+		},
+		Environment: db.Environment{
+			ENV: &env,
+		},
+	}
+
+	err := tsk.interpolateFields()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tsk.Template.Playbook != "staging/deploy.yml" || tsk.Task.Limit != "web-staging" {
+		t.Fatal("fields must be interpolated")
+	}
+
+	tsk.Task.Playbook = "${UNKNOWN}.yml"
+
+	err = tsk.interpolateFields()
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("undefined variable must cause validation error")
+	}
+}
+
+func TestTaskRunnerInterpolateFieldsLeavingRepository(t *testing.T) {
+	env := `{"ENV": "../../../etc"}`
+
+	tsk := TaskRunner{
+		Template: db.Template{
+			Playbook: "${ENV}/deploy.yml",
+		},
+		Environment: db.Environment{
+			ENV: &env,
+		},
+	}
+
+	err := tsk.interpolateFields()
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("template playbook leaving the repository must cause validation error")
+	}
+
+	tsk = TaskRunner{
+		Task: db.Task{
+			Playbook: "${ENV}/deploy.yml",
+		},
+		Template: db.Template{
+			Playbook: "deploy.yml",
+		},
+		Environment: db.Environment{
+			ENV: &env,
+		},
+	}
+
+	err = tsk.interpolateFields()
+	if _, ok := err.(*db.ValidationError); !ok {
+		t.Fatal("task playbook leaving the repository must cause validation error")
+	}
+}
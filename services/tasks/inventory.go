@@ -1,13 +1,42 @@
 package tasks
 
 import (
-	"github.com/ansible-semaphore/semaphore/db"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/util"
 )
 
+// urlInventoryCacheTTL is the time during which the content of URL inventory
+// is reused by the tasks instead of fetching it again.
+const urlInventoryCacheTTL = 30 * time.Second
+
+// maxURLInventorySize limits the size of the response of URL inventory.
+const maxURLInventorySize = 10 << 20
+
+type urlInventory struct {
+	content []byte
+	ext     string
+	fetched time.Time
+}
+
+var urlInventoryCache = struct {
+	sync.Mutex
+	items map[string]urlInventory
+}{items: make(map[string]urlInventory)}
+
+var urlInventoryClient = &http.Client{Timeout: time.Minute}
+
 func (t *LocalJob) installInventory() (err error) {
 	if t.Inventory.SSHKeyID != nil {
 		err = t.Inventory.SSHKey.Install(db.AccessKeyRoleAnsibleUser)
@@ -16,15 +45,30 @@ func (t *LocalJob) installInventory() (err error) {
 		}
 	}
 
+	if t.usesSSHAgent() {
+		t.Log("starting ssh agent for the key protected by passphrase")
+		t.sshAgent, err = startSSHAgent(t.Inventory.SSHKey.SshKey, t.getSSHAgentSocketPath())
+		if err != nil {
+			return
+		}
+	}
+
 	if t.Inventory.BecomeKeyID != nil {
-		err = t.Inventory.BecomeKey.Install(db.AccessKeyRoleAnsibleBecomeUser)
+		var role db.AccessKeyRole = db.AccessKeyRoleAnsibleBecomeUser
+		if t.Inventory.BecomePasswordFile {
+			role = db.AccessKeyRoleAnsibleBecomePasswordFile
+		}
+		err = t.Inventory.BecomeKey.Install(role)
 		if err != nil {
 			return
 		}
 	}
 
-	if t.Inventory.Type == db.InventoryStatic || t.Inventory.Type == db.InventoryStaticYaml {
+	switch t.Inventory.Type {
+	case db.InventoryStatic, db.InventoryStaticYaml:
 		err = t.installStaticInventory()
+	case db.InventoryURL:
+		err = t.installURLInventory()
 	}
 
 	return
@@ -41,3 +85,181 @@ func (t *LocalJob) installStaticInventory() error {
 	// create inventory file
 	return ioutil.WriteFile(path, []byte(t.Inventory.Inventory), 0664)
 }
+
+func (t *LocalJob) installURLInventory() error {
+	t.Log("fetching inventory from " + t.Inventory.Inventory)
+
+	inv, err := getURLInventory(t.Inventory)
+	if err != nil {
+		return err
+	}
+
+	t.urlInventoryPath = util.Config.TmpPath + "/inventory_" + strconv.Itoa(t.Task.ID) + inv.ext
+
+	return ioutil.WriteFile(t.urlInventoryPath, inv.content, 0664)
+}
+
+// getURLInventory returns content of the URL inventory.
+// The content is cached for urlInventoryCacheTTL.
+func getURLInventory(inventory db.Inventory) (urlInventory, error) {
+	cacheKey := strconv.Itoa(inventory.ID) + " " + inventory.Inventory
+	if inventory.AuthKeyID != nil {
+		cacheKey += " " + strconv.Itoa(*inventory.AuthKeyID)
+	}
+
+	urlInventoryCache.Lock()
+	defer urlInventoryCache.Unlock()
+
+	if inv, ok := urlInventoryCache.items[cacheKey]; ok && time.Since(inv.fetched) < urlInventoryCacheTTL {
+		return inv, nil
+	}
+
+	inv, err := fetchURLInventory(inventory)
+	if err != nil {
+		return inv, err
+	}
+
+	urlInventoryCache.items[cacheKey] = inv
+
+	return inv, nil
+}
+
+func fetchURLInventory(inventory db.Inventory) (inv urlInventory, err error) {
+	req, err := http.NewRequest(http.MethodGet, inventory.Inventory, nil)
+	if err != nil {
+		return
+	}
+
+	if inventory.AuthKeyID != nil {
+		err = setURLInventoryAuth(req, &inventory.AuthKey)
+		if err != nil {
+			return
+		}
+	}
+
+	res, err := urlInventoryClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("inventory request failed with status %d", res.StatusCode)
+		return
+	}
+
+	content, err := io.ReadAll(io.LimitReader(res.Body, maxURLInventorySize+1))
+	if err != nil {
+		return
+	}
+
+	if len(content) > maxURLInventorySize {
+		err = fmt.Errorf("inventory is larger than %d bytes", maxURLInventorySize)
+		return
+	}
+
+	inv.ext, err = getURLInventoryExt(inventory.Inventory, res.Header.Get("Content-Type"), content)
+	if err != nil {
+		return
+	}
+
+	inv.content = content
+	inv.fetched = time.Now()
+
+	return
+}
+
+func setURLInventoryAuth(req *http.Request, key *db.AccessKey) error {
+	err := key.DeserializeSecret()
+	if err != nil {
+		return err
+	}
+
+	switch key.Type {
+	case db.AccessKeyNone:
+	case db.AccessKeyLoginPassword:
+		req.SetBasicAuth(key.LoginPassword.Login, key.LoginPassword.Password)
+	case db.AccessKeyToken:
+		req.Header.Set("Authorization", "Bearer "+key.Token)
+	default:
+		return fmt.Errorf("access key type not supported for inventory URL")
+	}
+
+	return nil
+}
+
+// getURLInventoryExt validates the fetched inventory and returns extension of the inventory file,
+// so ansible parses it by the appropriate plugin: .json for JSON, .yml for YAML and no extension for INI.
+func getURLInventoryExt(rawURL string, contentType string, content []byte) (string, error) {
+	trimmed := bytes.TrimSpace(content)
+
+	if len(trimmed) == 0 {
+		return "", fmt.Errorf("inventory is empty")
+	}
+
+	if strings.Contains(contentType, "html") || bytes.HasPrefix(bytes.ToLower(trimmed), []byte("<")) {
+		return "", fmt.Errorf("inventory URL returned HTML instead of inventory")
+	}
+
+	path := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		path = strings.ToLower(u.Path)
+	}
+
+	if strings.Contains(contentType, "json") || strings.HasSuffix(path, ".json") || trimmed[0] == '{' {
+		if !json.Valid(trimmed) {
+			return "", fmt.Errorf("inventory is not valid JSON")
+		}
+		return ".json", nil
+	}
+
+	if strings.Contains(contentType, "yaml") || strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml") {
+		return ".yml", nil
+	}
+
+	return "", nil
+}
+
+// prepareInventorySnapshot saves the content of the template inventory with the task
+// if the snapshot is requested. The snapshot uploaded with the task is kept as is.
+func (p *TaskPool) prepareInventorySnapshot(task *db.Task, tpl db.Template) error {
+	if task.InventorySnapshot != nil {
+		if task.InventorySnapshotType == "" {
+			task.InventorySnapshotType = db.InventoryStatic
+		}
+		return nil
+	}
+
+	task.InventorySnapshotType = ""
+
+	if !task.SnapshotInventory {
+		return nil
+	}
+
+	if tpl.InventoryID == nil {
+		return &db.ValidationError{Message: "Template has no inventory to save with the task"}
+	}
+
+	inventory, err := p.store.GetInventory(tpl.ProjectID, *tpl.InventoryID)
+	if err != nil {
+		return err
+	}
+
+	return task.SetInventorySnapshot(inventory)
+}
+
+// applyInventorySnapshot replaces the content of the template inventory with
+// the snapshot saved with the task. Access keys of the inventory are kept.
+func (t *TaskRunner) applyInventorySnapshot() {
+	if t.Task.InventorySnapshot == nil {
+		return
+	}
+
+	t.Inventory.Inventory = *t.Task.InventorySnapshot
+	t.Inventory.Type = t.Task.InventorySnapshotType
+	if t.Inventory.Type == "" {
+		t.Inventory.Type = db.InventoryStatic
+	}
+
+	t.Log("Using inventory saved with the task")
+}
@@ -0,0 +1,138 @@
+package tasks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+func TestLocalJobURLInventory(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	content := `{"web": {"hosts": ["web1.example.com"]}}`
+
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	authKeyID := 3
+
+	job := LocalJob{
+		Task: db.Task{ID: 7},
+		Template: db.Template{
+			Playbook: "test.yml",
+		},
+		Inventory: db.Inventory{
+			ID:        101,
+			Type:      db.InventoryURL,
+			Inventory: server.URL + "/inventory",
+			AuthKeyID: &authKeyID,
+			AuthKey: db.AccessKey{
+				ID:    authKeyID,
+				Type:  db.AccessKeyToken,
+				Token: "secret",
+			},
+		},
+		Logger: &testLogger{},
+	}
+
+	err := job.installInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := job.getPlaybookArgs("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(args) < 2 || args[0] != "-i" || args[1] != util.Config.TmpPath+"/inventory_7.json" {
+		t.Fatalf("unexpected inventory args: %v", args)
+	}
+
+	written, err := os.ReadFile(args[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(written) != content {
+		t.Fatal("fetched inventory must be written to the inventory file")
+	}
+
+	err = job.installInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatal("inventory must be cached")
+	}
+}
+
+func TestLocalJobURLInventoryValidation(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: t.TempDir(),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html><body>Sign in</body></html>"))
+		case "/broken.json":
+			_, _ = w.Write([]byte(`{"web": `))
+		case "/hosts.ini":
+			_, _ = w.Write([]byte("[web]\nweb1.example.com\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for i, test := range []struct {
+		path  string
+		valid bool
+	}{
+		{"/login", false},
+		{"/broken.json", false},
+		{"/missing", false},
+		{"/hosts.ini", true},
+	} {
+		job := LocalJob{
+			Task: db.Task{ID: i},
+			Inventory: db.Inventory{
+				ID:        200 + i,
+				Type:      db.InventoryURL,
+				Inventory: server.URL + test.path,
+			},
+			Logger: &testLogger{},
+		}
+
+		err := job.installInventory()
+		if test.valid && err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Fatalf("%s: invalid inventory must be rejected", test.path)
+		}
+	}
+}
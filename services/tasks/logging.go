@@ -5,16 +5,112 @@ import (
 	"encoding/json"
 	log "github.com/Sirupsen/logrus"
 	"github.com/ansible-semaphore/semaphore/api/sockets"
+	"github.com/ansible-semaphore/semaphore/db"
 	"github.com/ansible-semaphore/semaphore/util"
 	"os/exec"
+	"regexp"
+	"sync"
 	"time"
 )
 
+// defaultOutputLevelPatterns match ansible output. They are used
+// if output_level_patterns config option doesn't set patterns of the level.
+var defaultOutputLevelPatterns = util.OutputLevelPatterns{
+	Error: []string{
+		`fatal:`,
+		`ERROR!`,
+		`failed=[1-9]`,
+		`unreachable=[1-9]`,
+	},
+	Warning: []string{
+		`\[WARNING\]`,
+		`\[DEPRECATION WARNING\]`,
+		`\.\.\.ignoring$`,
+	},
+}
+
+type outputLevelMatcher struct {
+	config  *util.ConfigType
+	error   []*regexp.Regexp
+	warning []*regexp.Regexp
+}
+
+var (
+	outputLevelMatcherLock    sync.Mutex
+	currentOutputLevelMatcher *outputLevelMatcher
+)
+
+func compileOutputLevelPatterns(patterns []string, defaults []string) []*regexp.Regexp {
+	if len(patterns) == 0 {
+		patterns = defaults
+	}
+
+	res := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			log.Error("Invalid output level pattern " + p + ": " + err.Error())
+			continue
+		}
+		res = append(res, re)
+	}
+
+	return res
+}
+
+// getOutputLevelMatcher returns patterns compiled from the current config.
+// They are compiled again only if the config is replaced.
+func getOutputLevelMatcher() *outputLevelMatcher {
+	outputLevelMatcherLock.Lock()
+	defer outputLevelMatcherLock.Unlock()
+
+	if currentOutputLevelMatcher != nil && currentOutputLevelMatcher.config == util.Config {
+		return currentOutputLevelMatcher
+	}
+
+	patterns := util.OutputLevelPatterns{}
+	if util.Config != nil {
+		patterns = util.Config.OutputLevelPatterns
+	}
+
+	currentOutputLevelMatcher = &outputLevelMatcher{
+		config:  util.Config,
+		error:   compileOutputLevelPatterns(patterns.Error, defaultOutputLevelPatterns.Error),
+		warning: compileOutputLevelPatterns(patterns.Warning, defaultOutputLevelPatterns.Warning),
+	}
+
+	return currentOutputLevelMatcher
+}
+
+// GetOutputLevel classifies the task output line by output_level_patterns.
+func GetOutputLevel(line string) db.TaskOutputLevel {
+	m := getOutputLevelMatcher()
+
+	for _, re := range m.error {
+		if re.MatchString(line) {
+			return db.TaskOutputError
+		}
+	}
+
+	for _, re := range m.warning {
+		if re.MatchString(line) {
+			return db.TaskOutputWarning
+		}
+	}
+
+	return db.TaskOutputInfo
+}
+
 func (t *TaskRunner) Log2(msg string, now time.Time) {
+	level := GetOutputLevel(msg)
+	t.progress.feed(msg)
+
 	for _, user := range t.users {
 		b, err := json.Marshal(&map[string]interface{}{
 			"type":       "log",
 			"output":     msg,
+			"level":      level,
 			"time":       now,
 			"task_id":    t.Task.ID,
 			"project_id": t.Task.ProjectID,
@@ -28,6 +124,7 @@ func (t *TaskRunner) Log2(msg string, now time.Time) {
 	t.pool.logger <- logRecord{
 		task:   t,
 		output: msg,
+		level:  level,
 		time:   now,
 	}
 }
@@ -36,21 +133,49 @@ func (t *TaskRunner) Log(msg string) {
 	t.Log2(msg, time.Now())
 }
 
-// Readln reads from the pipe
+// TruncatedLineMarker is appended to the output line truncated by ReadlnLimited.
+const TruncatedLineMarker = " ...[truncated]"
+
+// Readln reads from the pipe.
+// Lines longer than util.Config.MaxLogLineLength are truncated.
 func Readln(r *bufio.Reader) (string, error) {
+	maxLength := 0
+	if util.Config != nil {
+		maxLength = util.Config.MaxLogLineLength
+	}
+	return ReadlnLimited(r, maxLength)
+}
+
+// ReadlnLimited reads line from the pipe and truncates it to maxLength bytes.
+// The rest of the line is read and dropped, so memory usage doesn't depend on line length.
+// Zero or negative maxLength disables the limit.
+func ReadlnLimited(r *bufio.Reader, maxLength int) (string, error) {
 	var (
-		isPrefix = true
-		err      error
-		line, ln []byte
+		isPrefix  = true
+		truncated = false
+		err       error
+		line, ln  []byte
 	)
 	for isPrefix && err == nil {
 		line, isPrefix, err = r.ReadLine()
+
+		if maxLength > 0 && len(ln)+len(line) > maxLength {
+			line = line[:maxLength-len(ln)]
+			truncated = true
+		}
+
 		ln = append(ln, line...)
 	}
+
+	if truncated {
+		return string(ln) + TruncatedLineMarker, err
+	}
+
 	return string(ln), err
 }
 
 func (t *TaskRunner) logPipe(reader *bufio.Reader) {
+	defer t.logPipes.Done()
 
 	line, err := Readln(reader)
 	for err == nil {
@@ -69,6 +194,7 @@ func (t *TaskRunner) LogCmd(cmd *exec.Cmd) {
 	stderr, _ := cmd.StderrPipe()
 	stdout, _ := cmd.StdoutPipe()
 
+	t.logPipes.Add(2)
 	go t.logPipe(bufio.NewReader(stderr))
 	go t.logPipe(bufio.NewReader(stdout))
 }
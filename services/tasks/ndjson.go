@@ -0,0 +1,67 @@
+package tasks
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+// ndjsonOutputRecord is a task output record in the format which is
+// convenient for log systems: one JSON object per line.
+type ndjsonOutputRecord struct {
+	ProjectID int                `json:"project_id"`
+	TaskID    int                `json:"task_id"`
+	Time      time.Time          `json:"time"`
+	Seq       int                `json:"seq"`
+	Level     db.TaskOutputLevel `json:"level"`
+	Message   string             `json:"message"`
+}
+
+// GetTaskOutputNDJSON returns output of the task in NDJSON format, one JSON object per
+// output record. Archived output is used if the output is pruned from the database, see GetTaskOutputs.
+// The caller must close the returned reader.
+func (p *TaskPool) GetTaskOutputNDJSON(projectID int, taskID int) (io.ReadCloser, error) {
+	task, err := p.store.GetTask(projectID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := p.GetTaskOutputs(task, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+
+	go func() {
+		enc := json.NewEncoder(w)
+
+		for _, o := range outputs {
+			level := o.Level
+			if level == "" {
+				level = db.TaskOutputInfo
+			}
+
+			err := enc.Encode(ndjsonOutputRecord{
+				ProjectID: projectID,
+				TaskID:    taskID,
+				Time:      o.Time,
+				Seq:       o.Seq,
+				Level:     level,
+				Message:   o.Output,
+			})
+
+			if err != nil {
+				// the reader is closed, nobody needs the rest of the output
+				_ = w.CloseWithError(err)
+				return
+			}
+		}
+
+		_ = w.Close()
+	}()
+
+	return r, nil
+}
@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"bufio"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+func TestTaskPoolGetTaskOutputNDJSON(t *testing.T) {
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := store.CreateTask(db.Task{
+		ProjectID: proj.ID,
+		Status:    db.TaskSuccessStatus,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	outputs := []db.TaskOutput{
+		{TaskID: task.ID, Time: now, Output: "PLAY [all]"},
+		{TaskID: task.ID, Time: now.Add(time.Second), Output: "fatal: unreachable", Level: db.TaskOutputError},
+	}
+
+	for _, o := range outputs {
+		if _, err = store.CreateTaskOutput(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pool := CreateTaskPool(store)
+
+	stream, err := pool.GetTaskOutputNDJSON(proj.ID, task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var records []map[string]interface{}
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q is not valid JSON: %s", scanner.Text(), err.Error())
+		}
+		records = append(records, rec)
+	}
+
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != len(outputs) {
+		t.Fatalf("expected %d records, got %d", len(outputs), len(records))
+	}
+
+	for i, rec := range records {
+		for _, field := range []string{"project_id", "task_id", "time", "seq", "level", "message"} {
+			if _, ok := rec[field]; !ok {
+				t.Fatalf("record %d has no field %s", i, field)
+			}
+		}
+
+		if rec["message"] != outputs[i].Output {
+			t.Fatalf("expected message %q, got %v", outputs[i].Output, rec["message"])
+		}
+
+		if int(rec["task_id"].(float64)) != task.ID {
+			t.Fatalf("expected task_id %d, got %v", task.ID, rec["task_id"])
+		}
+
+		recTime, err := time.Parse(time.RFC3339Nano, rec["time"].(string))
+		if err != nil || !recTime.Equal(outputs[i].Time) {
+			t.Fatalf("unexpected time %v", rec["time"])
+		}
+	}
+
+	if records[0]["level"] != string(db.TaskOutputInfo) || records[1]["level"] != string(db.TaskOutputError) {
+		t.Fatalf("unexpected levels %v, %v", records[0]["level"], records[1]["level"])
+	}
+
+	if records[0]["seq"].(float64) >= records[1]["seq"].(float64) {
+		t.Fatal("records must be ordered by sequence")
+	}
+}
+
+func TestTaskPoolGetTaskOutputNDJSON_notFound(t *testing.T) {
+	store := CreateBoltDB()
+	store.Connect("")
+
+	pool := CreateTaskPool(store)
+
+	if _, err := pool.GetTaskOutputNDJSON(1, 100); err != db.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package tasks
+
+import (
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+// preparePipelineTask checks that the task can run the stage of its pipeline.
+// The task without stage starts the pipeline from the first stage.
+func (p *TaskPool) preparePipelineTask(task *db.Task) error {
+	if task.PipelineID == nil {
+		task.PipelineStage = nil
+		return nil
+	}
+
+	pipeline, err := p.store.GetTemplatePipeline(task.ProjectID, *task.PipelineID)
+	if err == db.ErrNotFound {
+		return &db.ValidationError{Message: "Pipeline not found"}
+	}
+	if err != nil {
+		return err
+	}
+
+	if task.PipelineStage == nil {
+		stage := 0
+		task.PipelineStage = &stage
+	}
+
+	if *task.PipelineStage < 0 || *task.PipelineStage >= len(pipeline.Stages) {
+		return &db.ValidationError{Message: "Invalid pipeline stage"}
+	}
+
+	if pipeline.Stages[*task.PipelineStage].TemplateID != task.TemplateID {
+		return &db.ValidationError{Message: "Template of the task doesn't match the pipeline stage"}
+	}
+
+	return nil
+}
+
+// startNextPipelineStage queues the task of the next stage of the pipeline after the task finished.
+// The next task gets the version produced by the finished task through BuildTaskID.
+func (t *TaskRunner) startNextPipelineStage() {
+	if t.Task.PipelineID == nil || t.Task.PipelineStage == nil {
+		return
+	}
+
+	pipeline, err := t.pool.store.GetTemplatePipeline(t.Task.ProjectID, *t.Task.PipelineID)
+	if err != nil {
+		log.Error("Cannot get pipeline of task " + strconv.Itoa(t.Task.ID) + ": " + err.Error())
+		return
+	}
+
+	stage, ok := pipeline.NextStage(*t.Task.PipelineStage, t.Task.Status)
+	if !ok {
+		return
+	}
+
+	allowed, err := t.canRunPipelineStage(pipeline.Stages[stage])
+	if err != nil {
+		t.Log("Cannot check permissions for next stage of pipeline " + pipeline.Name + ": " + err.Error())
+		return
+	}
+
+	if !allowed {
+		t.Log("Next stage of pipeline " + pipeline.Name + " is not started: the user is not allowed to run its template")
+		return
+	}
+
+	newTask, err := t.pool.AddTask(db.Task{
+		TemplateID:    pipeline.Stages[stage].TemplateID,
+		Priority:      t.Task.Priority,
+		BuildTaskID:   &t.Task.ID,
+		PipelineID:    &pipeline.ID,
+		PipelineStage: &stage,
+	}, t.Task.UserID, t.Task.ProjectID)
+
+	if err != nil {
+		t.Log("Cannot start next stage of pipeline " + pipeline.Name + ": " + err.Error())
+		return
+	}
+
+	t.Log("Stage " + strconv.Itoa(stage) + " of pipeline " + pipeline.Name + " queued as task " + strconv.Itoa(newTask.ID))
+}
+
+// canRunPipelineStage checks if the user who started the finished task can run the template
+// of the next stage. Tasks started without a user, e.g. by schedules, can run all stages.
+func (t *TaskRunner) canRunPipelineStage(stage db.TemplatePipelineStage) (bool, error) {
+	if t.Task.UserID == nil {
+		return true, nil
+	}
+
+	user, err := t.pool.store.GetUser(*t.Task.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	if user.Admin {
+		return true, nil
+	}
+
+	projectUser, err := t.pool.store.GetProjectUser(t.Task.ProjectID, user.ID)
+	if err == db.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	tpl, err := t.pool.store.GetTemplate(t.Task.ProjectID, stage.TemplateID)
+	if err != nil {
+		return false, err
+	}
+
+	return tpl.CanRun(projectUser.Role), nil
+}
@@ -0,0 +1,283 @@
+package tasks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansible-semaphore/semaphore/api/sockets"
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+)
+
+// resultJob marks the task as running like real jobs do and finishes with the result.
+type resultJob struct {
+	runner  *TaskRunner
+	succeed bool
+}
+
+func (j *resultJob) Run(username string, incomingVersion *string) error {
+	j.runner.SetStatus(db.TaskRunningStatus)
+	if !j.succeed {
+		return &db.ValidationError{Message: "build failed"}
+	}
+	return nil
+}
+
+func (j *resultJob) Kill() {}
+
+// createBuildDeployPipeline creates build and deploy templates linked by the pipeline,
+// the deploy stage runs only after the successful build.
+func createBuildDeployPipeline(t *testing.T, store db.Store) (build db.Template, deploy db.Template, pipeline db.TemplatePipeline) {
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateAccessKey(db.AccessKey{
+		ProjectID: &proj.ID,
+		Type:      db.AccessKeyNone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := store.CreateRepository(db.Repository{
+		ProjectID: proj.ID,
+		SSHKeyID:  key.ID,
+		Name:      "Test",
+		GitURL:    "git@example.com:test/test",
+		GitBranch: "master",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := store.CreateInventory(db.Inventory{
+		ProjectID: proj.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startVersion := "1.0.0"
+
+	build, err = store.CreateTemplate(db.Template{
+		ProjectID:    proj.ID,
+		Name:         "Build",
+		Playbook:     "build.yml",
+		Type:         db.TemplateBuild,
+		StartVersion: &startVersion,
+		RepositoryID: repo.ID,
+		InventoryID:  &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deploy, err = store.CreateTemplate(db.Template{
+		ProjectID:       proj.ID,
+		Name:            "Deploy",
+		Playbook:        "deploy.yml",
+		Type:            db.TemplateDeploy,
+		BuildTemplateID: &build.ID,
+		RepositoryID:    repo.ID,
+		InventoryID:     &inv.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployStage := 1
+
+	pipeline, err = store.CreateTemplatePipeline(db.TemplatePipeline{
+		ProjectID: proj.ID,
+		Name:      "Nightly",
+		Stages: []db.TemplatePipelineStage{
+			{TemplateID: build.ID, OnSuccess: &deployStage},
+			{TemplateID: deploy.ID},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+// runPipelineBuild runs the first stage of the pipeline started by the user and waits until it is finished.
+func runPipelineBuild(t *testing.T, pool *TaskPool, build db.Template, pipeline db.TemplatePipeline, userID *int, succeed bool) db.Task {
+	version := "1.0.0"
+	stage := 0
+
+	// the task is not saved as waiting, so the pool doesn't restore it on start
+	task, err := pool.store.CreateTask(db.Task{
+		ProjectID:     build.ProjectID,
+		TemplateID:    build.ID,
+		UserID:        userID,
+		Version:       &version,
+		PipelineID:    &pipeline.ID,
+		PipelineStage: &stage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &TaskRunner{
+		Task:     task,
+		Template: build,
+		pool:     pool,
+	}
+	runner.job = &resultJob{runner: runner, succeed: succeed}
+
+	pool.addTask(runner)
+	pool.runNextTask()
+
+	// tasks of the next stages must stay in the queue
+	pool.PauseProject(build.ProjectID)
+
+	return waitTaskFinished(t, pool.store, task)
+}
+
+// waitTemplateTasks waits until the template has the number of tasks.
+func waitTemplateTasks(store db.Store, tpl db.Template, count int) []db.Task {
+	var tasks []db.Task
+
+	for i := 0; i < 50; i++ {
+		tplTasks, err := store.GetTemplateTasks(tpl.ProjectID, tpl.ID, db.RetrieveQueryParams{})
+		if err == nil {
+			tasks = make([]db.Task, 0, len(tplTasks))
+			for _, tsk := range tplTasks {
+				tasks = append(tasks, tsk.Task)
+			}
+		}
+		if len(tasks) >= count {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return tasks
+}
+
+func TestTaskPoolPipelineStartsNextStage(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	build, deploy, pipeline := createBuildDeployPipeline(t, store)
+
+	startTestPool(t, pool)
+
+	buildTask := runPipelineBuild(t, pool, build, pipeline, nil, true)
+
+	if buildTask.Status != db.TaskSuccessStatus {
+		t.Fatal("build must succeed")
+	}
+
+	deployTasks := waitTemplateTasks(store, deploy, 1)
+
+	if len(deployTasks) != 1 {
+		t.Fatal("successful build must start the deploy stage")
+	}
+
+	deployTask := deployTasks[0]
+
+	if deployTask.PipelineID == nil || *deployTask.PipelineID != pipeline.ID ||
+		deployTask.PipelineStage == nil || *deployTask.PipelineStage != 1 {
+		t.Fatal("deploy task must belong to the second stage of the pipeline")
+	}
+
+	version := deployTask.GetIncomingVersion(store)
+	if version == nil || *version != "1.0.0" {
+		t.Fatal("deploy task must get the version produced by the build")
+	}
+}
+
+func TestTaskPoolPipelineStopsOnFailure(t *testing.T) {
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	build, deploy, pipeline := createBuildDeployPipeline(t, store)
+
+	startTestPool(t, pool)
+
+	buildTask := runPipelineBuild(t, pool, build, pipeline, nil, false)
+
+	if buildTask.Status != db.TaskFailStatus {
+		t.Fatal("build must fail")
+	}
+
+	// the next stage is queued right after the finished task is saved
+	time.Sleep(100 * time.Millisecond)
+
+	tasks, err := store.GetTemplateTasks(deploy.ProjectID, deploy.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 0 {
+		t.Fatal("failed build must not start the deploy stage")
+	}
+}
+
+// startSocketsOnce starts the web socket hub which receives task output sent to project users.
+var startSocketsOnce sync.Once
+
+func TestTaskPoolPipelineChecksStageRoles(t *testing.T) {
+	startSocketsOnce.Do(func() {
+		go sockets.StartWS()
+	})
+
+	pool, store := createTestPool(t, util.ConfigType{
+		TmpPath:          "/tmp",
+		MaxParallelTasks: 10,
+	})
+
+	build, deploy, pipeline := createBuildDeployPipeline(t, store)
+
+	deploy.AllowedRoles = []db.ProjectUserRole{db.ProjectManager}
+	if err := store.UpdateTemplate(deploy); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := store.CreateUser(db.UserWithPwd{
+		Pwd:  "123456",
+		User: db.User{Username: "runner", Name: "Runner", Email: "runner@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.CreateProjectUser(db.ProjectUser{
+		ProjectID: build.ProjectID,
+		UserID:    user.ID,
+		Role:      db.ProjectTaskRunner,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTestPool(t, pool)
+
+	buildTask := runPipelineBuild(t, pool, build, pipeline, &user.ID, true)
+
+	if buildTask.Status != db.TaskSuccessStatus {
+		t.Fatal("build must succeed")
+	}
+
+	// the next stage is queued right after the finished task is saved
+	time.Sleep(100 * time.Millisecond)
+
+	tasks, err := store.GetTemplateTasks(deploy.ProjectID, deploy.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 0 {
+		t.Fatal("stage must not be started for the user who can not run its template")
+	}
+}
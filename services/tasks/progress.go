@@ -0,0 +1,114 @@
+package tasks
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+var (
+	ansiEscapeRegexp = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	playHeaderRegexp = regexp.MustCompile(`^PLAY \[.*\] \*+\s*$`)
+	taskHeaderRegexp = regexp.MustCompile(`^(TASK|RUNNING HANDLER) \[.*\] \*+\s*$`)
+	playRecapRegexp  = regexp.MustCompile(`^PLAY RECAP \*+\s*$`)
+)
+
+// taskProgress estimates progress of the running playbook by headers of plays
+// and tasks in its output. It is best-effort: the number of tasks which the playbook
+// runs is taken from the previous successful run of the template, so it can be wrong
+// if the playbook or the inventory changed.
+type taskProgress struct {
+	mu sync.Mutex
+	// expectedTasks is a number of task headers expected in the output, 0 if unknown.
+	expectedTasks int
+	plays         int
+	tasks         int
+	finished      bool
+}
+
+func (p *taskProgress) setExpectedTasks(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expectedTasks = n
+}
+
+// feed counts the line if it is a header of a play or a task.
+func (p *taskProgress) feed(line string) {
+	line = ansiEscapeRegexp.ReplaceAllString(line, "")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case playRecapRegexp.MatchString(line):
+		p.finished = true
+	case playHeaderRegexp.MatchString(line):
+		p.plays++
+	case taskHeaderRegexp.MatchString(line):
+		p.tasks++
+	}
+}
+
+// percent returns the estimated progress from 0 to 100 or nil if it is unknown.
+// It stays below 100 until the play recap is printed.
+func (p *taskProgress) percent() *int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var res int
+
+	switch {
+	case p.finished:
+		res = 100
+	case p.expectedTasks > 0:
+		res = p.tasks * 100 / p.expectedTasks
+		if res > 99 {
+			res = 99
+		}
+	default:
+		return nil
+	}
+
+	return &res
+}
+
+// countTaskHeaders returns number of task headers in the output of the playbook.
+func countTaskHeaders(outputs []db.TaskOutput) (n int) {
+	for _, o := range outputs {
+		if taskHeaderRegexp.MatchString(ansiEscapeRegexp.ReplaceAllString(o.Output, "")) {
+			n++
+		}
+	}
+	return
+}
+
+// GetProgress returns the estimated progress of the task in percents
+// or nil if it can't be estimated.
+func (t *TaskRunner) GetProgress() *int {
+	return t.progress.percent()
+}
+
+// getExpectedTaskCount returns number of tasks which the previous successful run
+// of the template ran, 0 if it is unknown.
+func (t *TaskRunner) getExpectedTaskCount() int {
+	tasks, err := t.pool.store.GetTemplateTasks(t.Template.ProjectID, t.Template.ID, db.RetrieveQueryParams{})
+	if err != nil {
+		return 0
+	}
+
+	for _, task := range tasks {
+		if task.ID == t.Task.ID || task.Status != db.TaskSuccessStatus {
+			continue
+		}
+
+		outputs, err := t.pool.store.GetTaskOutputs(task.ProjectID, task.ID)
+		if err != nil {
+			return 0
+		}
+
+		return countTaskHeaders(outputs)
+	}
+
+	return 0
+}
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+)
+
+const progressTestOutput = `
+PLAY [Prepare hosts] ***********************************************************
+
+TASK [Gathering Facts] *********************************************************
+ok: [web1]
+
+TASK [Install packages] ********************************************************
+changed: [web1]
+
+PLAY [Deploy application] ******************************************************
+
+TASK [Copy files] **************************************************************
+changed: [web1]
+
+TASK [Restart service] *********************************************************
+changed: [web1]
+
+RUNNING HANDLER [Reload nginx] *************************************************
+changed: [web1]
+
+PLAY RECAP *********************************************************************
+web1                       : ok=5    changed=4    unreachable=0    failed=0
+`
+
+func TestTaskProgress(t *testing.T) {
+	var outputs []db.TaskOutput
+	for _, line := range strings.Split(progressTestOutput, "\n") {
+		outputs = append(outputs, db.TaskOutput{Output: line})
+	}
+
+	expected := countTaskHeaders(outputs)
+	if expected != 5 {
+		t.Fatal("expected 5 task headers, got", expected)
+	}
+
+	var progress taskProgress
+
+	if progress.percent() != nil {
+		t.Fatal("progress must be unknown without expected number of tasks")
+	}
+
+	progress.setExpectedTasks(expected)
+
+	last := -1
+
+	for _, line := range strings.Split(progressTestOutput, "\n") {
+		progress.feed(line)
+
+		percent := progress.percent()
+		if percent == nil {
+			t.Fatal("progress must be known")
+		}
+
+		if *percent < last {
+			t.Fatalf("progress must not decrease, got %d after %d", *percent, last)
+		}
+
+		if strings.HasPrefix(line, "TASK [") && *percent <= last {
+			t.Fatalf("progress must increase after task header %q", line)
+		}
+
+		if *percent == 100 && !strings.HasPrefix(line, "PLAY RECAP") && last != 100 {
+			t.Fatal("progress must reach 100 only after the play recap")
+		}
+
+		last = *percent
+	}
+
+	if progress.plays != 2 {
+		t.Fatal("expected 2 plays, got", progress.plays)
+	}
+
+	if last != 100 {
+		t.Fatal("finished playbook must have 100 percents, got", last)
+	}
+}
+
+func TestTaskProgress_colored(t *testing.T) {
+	progress := taskProgress{expectedTasks: 2}
+
+	progress.feed("\x1b[0;32mTASK [Install packages] ****************************\x1b[0m")
+
+	if p := progress.percent(); p == nil || *p != 50 {
+		t.Fatal("colored task header must be counted")
+	}
+}
+
+func TestTaskRunnerGetExpectedTaskCount(t *testing.T) {
+	store := CreateBoltDB()
+	store.Connect("")
+
+	proj, err := store.CreateProject(db.Project{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := store.CreateTemplate(db.Template{
+		ProjectID: proj.ID,
+		Name:      "Deploy",
+		Playbook:  "deploy.yml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range []db.TaskStatus{db.TaskSuccessStatus, db.TaskFailStatus} {
+		var task db.Task
+		task, err = store.CreateTask(db.Task{
+			ProjectID:  proj.ID,
+			TemplateID: tpl.ID,
+			Status:     status,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(progressTestOutput, "\n")
+		if status == db.TaskFailStatus {
+			// failed run stops after the first task
+			lines = lines[:5]
+		}
+
+		for _, line := range lines {
+			_, err = store.CreateTaskOutput(db.TaskOutput{TaskID: task.ID, Output: line})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	pool := CreateTaskPool(store)
+
+	runner := TaskRunner{
+		Task:     db.Task{ID: 1000, ProjectID: proj.ID, TemplateID: tpl.ID},
+		Template: tpl,
+		pool:     &pool,
+	}
+
+	if n := runner.getExpectedTaskCount(); n != 5 {
+		t.Fatal("expected number of tasks must be taken from the successful run, got", n)
+	}
+}
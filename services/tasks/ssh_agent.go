@@ -0,0 +1,119 @@
+package tasks
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshAgent serves the SSH key to ansible-playbook over a unix socket.
+// It is used for keys protected by a passphrase: the key is unlocked in memory,
+// so neither the passphrase nor the decrypted key is written to disk.
+type sshAgent struct {
+	socketPath string
+	listener   net.Listener
+	keyring    agent.Agent
+
+	// conns are open connections of ssh clients, they are closed with the agent.
+	// ssh processes kept by ControlPersist can hold connections after the playbook finished.
+	conns     map[net.Conn]bool
+	connsLock sync.Mutex
+}
+
+// startSSHAgent unlocks the key with its passphrase and starts serving it on the socket.
+func startSSHAgent(key db.SshKey, socketPath string) (*sshAgent, error) {
+	privateKey, err := ssh.ParseRawPrivateKeyWithPassphrase([]byte(key.PrivateKey), []byte(key.Passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("cannot unlock ssh key: %v", err)
+	}
+
+	keyring := agent.NewKeyring()
+
+	err = keyring.Add(agent.AddedKey{PrivateKey: privateKey})
+	if err != nil {
+		return nil, err
+	}
+
+	// the socket is left by a previous run if semaphore was killed
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(socketPath, 0600)
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	a := &sshAgent{
+		socketPath: socketPath,
+		listener:   listener,
+		keyring:    keyring,
+		conns:      make(map[net.Conn]bool),
+	}
+
+	go a.serve()
+
+	return a, nil
+}
+
+func (a *sshAgent) serve() {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			// the listener is closed
+			return
+		}
+
+		a.connsLock.Lock()
+		a.conns[conn] = true
+		a.connsLock.Unlock()
+
+		go func() {
+			_ = agent.ServeAgent(a.keyring, conn)
+
+			a.connsLock.Lock()
+			delete(a.conns, conn)
+			a.connsLock.Unlock()
+
+			_ = conn.Close()
+		}()
+	}
+}
+
+// Close stops the agent and removes the key from memory.
+func (a *sshAgent) Close() error {
+	err := a.listener.Close()
+	_ = a.keyring.RemoveAll()
+
+	a.connsLock.Lock()
+	for conn := range a.conns {
+		_ = conn.Close()
+	}
+	a.connsLock.Unlock()
+
+	_ = os.Remove(a.socketPath)
+	return err
+}
+
+// usesSSHAgent checks whether the inventory SSH key is protected by a passphrase
+// and must be passed to ansible by ssh agent instead of a key file.
+func (t *LocalJob) usesSSHAgent() bool {
+	return t.Inventory.SSHKeyID != nil &&
+		t.Inventory.SSHKey.Type == db.AccessKeySSH &&
+		t.Inventory.SSHKey.SshKey.Passphrase != ""
+}
+
+func (t *LocalJob) getSSHAgentSocketPath() string {
+	return util.Config.TmpPath + "/ssh_agent_" + strconv.Itoa(t.Task.ID)
+}
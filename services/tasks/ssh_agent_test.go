@@ -0,0 +1,166 @@
+package tasks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ansible-semaphore/semaphore/db"
+	"github.com/ansible-semaphore/semaphore/util"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func createEncryptedSSHKey(t *testing.T, passphrase string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//nolint: staticcheck
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte(passphrase), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(block))
+}
+
+func TestLocalJobSSHKeyPassphrase(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	keyID := 1
+
+	job := LocalJob{
+		Task: db.Task{ID: 123456},
+		Inventory: db.Inventory{
+			SSHKeyID: &keyID,
+			SSHKey: db.AccessKey{
+				ID:   keyID,
+				Type: db.AccessKeySSH,
+				SshKey: db.SshKey{
+					Login:      "deploy",
+					Passphrase: "secret",
+					PrivateKey: createEncryptedSSHKey(t, "secret"),
+				},
+			},
+			Type: db.InventoryStatic,
+		},
+		Template: db.Template{
+			Playbook: "test.yml",
+		},
+		Logger: &testLogger{},
+	}
+
+	defer os.Remove(util.Config.TmpPath + "/inventory_" + strconv.Itoa(job.Task.ID)) //nolint: errcheck
+
+	if err := job.installInventory(); err != nil {
+		t.Fatal(err)
+	}
+	defer job.destroyKeys()
+
+	if _, err := os.Stat(job.Inventory.SSHKey.GetPath()); !os.IsNotExist(err) {
+		t.Fatal("key protected by passphrase must not be written to disk")
+	}
+
+	args, err := job.getPlaybookArgs("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(strings.Join(args, " "), "--private-key") {
+		t.Fatal("key protected by passphrase must be passed by ssh agent")
+	}
+
+	env, err := job.getEnvironmentENV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socketPath := job.getSSHAgentSocketPath()
+
+	found := false
+	for _, v := range env {
+		if v == "SSH_AUTH_SOCK="+socketPath {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("ansible must get the socket of ssh agent")
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := agent.NewClient(conn).List()
+	conn.Close() //nolint: errcheck
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 {
+		t.Fatal("ssh agent must serve the unlocked key")
+	}
+
+	job.destroyKeys()
+
+	if _, err = os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Fatal("socket of ssh agent must be removed")
+	}
+}
+
+func TestLocalJobSSHKeyWrongPassphrase(t *testing.T) {
+	util.Config = &util.ConfigType{
+		TmpPath: "/tmp",
+	}
+
+	keyID := 1
+
+	job := LocalJob{
+		Inventory: db.Inventory{
+			SSHKeyID: &keyID,
+			SSHKey: db.AccessKey{
+				ID:   keyID,
+				Type: db.AccessKeySSH,
+				SshKey: db.SshKey{
+					Passphrase: "wrong",
+					PrivateKey: createEncryptedSSHKey(t, "secret"),
+				},
+			},
+		},
+		Logger: &testLogger{},
+	}
+
+	if err := job.installInventory(); err == nil {
+		job.destroyKeys()
+		t.Fatal("key must not be unlocked with wrong passphrase")
+	}
+}
+
+func TestLocalJobSSHKeyWithoutPassphrase(t *testing.T) {
+	keyID := 1
+
+	job := LocalJob{
+		Inventory: db.Inventory{
+			SSHKeyID: &keyID,
+			SSHKey: db.AccessKey{
+				Type:   db.AccessKeySSH,
+				SshKey: db.SshKey{PrivateKey: "key"},
+			},
+		},
+	}
+
+	if job.usesSSHAgent() {
+		t.Fatal("key without passphrase must be passed as a file")
+	}
+}
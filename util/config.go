@@ -88,6 +88,21 @@ type RunnerSettings struct {
 	ConfigFile        string `json:"config_file"`
 	// OneOff indicates than runner runs only one job and exit
 	OneOff bool `json:"one_off"`
+
+	// MinStartupJitter and MaxStartupJitter set bounds of random delay
+	// in milliseconds before the first registration and poll of the server.
+	// It prevents a fleet of runners started simultaneously from hitting the server at once.
+	// Negative MaxStartupJitter disables the delay.
+	MinStartupJitter int `json:"min_startup_jitter"`
+	MaxStartupJitter int `json:"max_startup_jitter"`
+
+	// Environment contains environment variables which are passed to every task
+	// process run by the runner. Variables of the task environment override them.
+	Environment map[string]string `json:"environment"`
+
+	// MaxLogLineLength is a max length of the task output line in bytes.
+	// Longer lines are truncated. Defaults to max_log_line_length of the config.
+	MaxLogLineLength int `json:"max_log_line_length"`
 }
 
 // ConfigType mapping between Config and the json file that sets it
@@ -109,6 +124,10 @@ type ConfigType struct {
 	// semaphore stores ephemeral projects here
 	TmpPath string `json:"tmp_path"`
 
+	// FileSecretsPath is a directory on the host running tasks which contains
+	// files with secrets referenced by environments. File secrets are disabled if it is empty.
+	FileSecretsPath string `json:"file_secrets_path"`
+
 	// SshConfigPath is a path to the custom SSH config file.
 	// Default path is ~/.ssh/config.
 	SshConfigPath string `json:"ssh_config_path"`
@@ -158,6 +177,45 @@ type ConfigType struct {
 	// task concurrency
 	MaxParallelTasks int `json:"max_parallel_tasks"`
 
+	// RunnerTagMaxParallelTasks limits number of running tasks of templates
+	// with the runner tag, across all projects.
+	RunnerTagMaxParallelTasks map[string]int `json:"runner_tag_max_parallel_tasks"`
+
+	// MaxParallelGitOperations limits number of repository clones and fetches
+	// running at the same time on the server or the runner. 0 means no limit.
+	MaxParallelGitOperations int `json:"max_parallel_git_operations"`
+
+	// MaxQueueLength limits number of tasks waiting in the queue,
+	// new tasks are rejected when it is reached. 0 means no limit.
+	MaxQueueLength int `json:"max_queue_length"`
+
+	// OutputLevelPatterns are regular expressions which classify task output lines.
+	// Default patterns matching ansible output are used for empty lists.
+	OutputLevelPatterns OutputLevelPatterns `json:"output_level_patterns"`
+
+	// OutputArchive configures uploading of finished tasks output to external storage.
+	OutputArchive OutputArchiveSettings `json:"output_archive"`
+
+	// TaskStoppingTimeout is a time in seconds which a task can stay in stopping state.
+	// The task is force stopped when it expires.
+	TaskStoppingTimeout int `json:"task_stopping_timeout"`
+
+	// PlaybookSyntaxCheck enables ansible-playbook --syntax-check before the run
+	// for all templates. It can be enabled for single templates too.
+	PlaybookSyntaxCheck bool `json:"playbook_syntax_check"`
+
+	// MaxLogLineLength is a max length of the task output line in bytes.
+	// Longer lines are truncated.
+	MaxLogLineLength int `json:"max_log_line_length"`
+
+	// SecretCommands maps names to the command lines (program and its arguments)
+	// which access keys of type command and environment command secrets run to get secrets.
+	// Keys and environments refer to the commands by name and can not pass other arguments.
+	SecretCommands map[string][]string `json:"secret_commands"`
+
+	// SecretCommandTimeout is a max time of the secret command execution in seconds.
+	SecretCommandTimeout int `json:"secret_command_timeout"`
+
 	RunnerRegistrationToken string `json:"runner_registration_token"`
 
 	// feature switches
@@ -167,6 +225,37 @@ type ConfigType struct {
 	UseRemoteRunner bool `json:"use_remote_runner"`
 
 	Runner RunnerSettings `json:"runner"`
+
+	// Runners allows to run several job pools in one runner process,
+	// for example one pool per server. Runner is used if it is empty.
+	Runners []RunnerSettings `json:"runners"`
+}
+
+// OutputArchiveSettings configure the storage of task output archives.
+// Archiving is disabled if no storage is configured.
+type OutputArchiveSettings struct {
+	S3 S3Settings `json:"s3"`
+
+	// PruneOutput deletes the task output from the database once it is archived.
+	PruneOutput bool `json:"prune_output"`
+}
+
+// S3Settings describe a bucket of S3 compatible storage.
+// Endpoint is the storage URL, e.g. https://s3.eu-west-1.amazonaws.com.
+type S3Settings struct {
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	Prefix          string `json:"prefix"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// OutputLevelPatterns are regular expressions matched against task output lines.
+// Error patterns are checked before warning ones, unmatched lines are info.
+type OutputLevelPatterns struct {
+	Error   []string `json:"error"`
+	Warning []string `json:"warning"`
 }
 
 // Config exposes the application configuration storage for use in the application
@@ -254,6 +343,25 @@ func validateConfig() {
 	if Config.MaxParallelTasks < 1 {
 		Config.MaxParallelTasks = 10
 	}
+
+	if Config.MaxLogLineLength < 1 {
+		Config.MaxLogLineLength = 64 * 1024
+	}
+
+	validateRunnerSettings(&Config.Runner)
+	for i := range Config.Runners {
+		validateRunnerSettings(&Config.Runners[i])
+	}
+}
+
+func validateRunnerSettings(settings *RunnerSettings) {
+	if settings.MaxStartupJitter == 0 {
+		settings.MaxStartupJitter = 5000
+	}
+
+	if settings.MaxLogLineLength < 1 {
+		settings.MaxLogLineLength = Config.MaxLogLineLength
+	}
 }
 
 func validatePort() {
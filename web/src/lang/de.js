@@ -84,6 +84,7 @@ export default {
   keyName: 'Schlüsselname',
   loginOptional: 'Login (Optional)',
   usernameOptional: 'Benutzername (Optional)',
+  passphraseOptional: 'Passphrase (Optional)',
   privateKey: 'Privater Schlüssel',
   override: 'Überschreiben',
   useThisTypeOfKeyForHttpsRepositoriesAndForPlaybook: 'Verwenden Sie diesen Schlüsseltyp für HTTPS-Repositories und für Playbooks, die nicht-SSH-Verbindungen verwenden.',
@@ -166,6 +167,39 @@ export default {
   readThe: 'Lesen Sie die',
   toLearnMoreAboutCron: 'um mehr über Cron zu erfahren.',
   suppressSuccessAlerts: 'Erfolgsalarme unterdrücken',
+  syntaxCheck: 'Playbook-Syntax vor der Ausführung prüfen',
+  allowedWindow: 'Ausführungen auf ein Zeitfenster beschränken',
+  allowedWindowDays: 'Tage',
+  allowedWindowDaysHint: 'Alle Tage, wenn leer',
+  allowedWindowFrom: 'Von',
+  allowedWindowTo: 'Bis',
+  allowedWindowTimeFormat: 'Zeit im Format HH:MM',
+  allowedWindowTimezone: 'Zeitzone',
+  allowedWindowHold: 'Aufgaben bis zur Öffnung des Fensters zurückhalten',
+  favorite: 'Favorite',
+  taskOutputRetentionDays: 'Keep task output, days (Optional)',
+  taskOutputRetentionDaysHint: 'Older output of tasks is deleted, tasks are kept. 0 - keep forever.',
+  taskRetentionDays: 'Keep finished tasks, days (Optional)',
+  taskRetentionDaysHint: 'Older finished tasks are deleted with their output. 0 - keep forever.',
+  workingDirectory: 'Working directory',
+  workingDirectoryHint: 'Directory in the repository which the playbook runs in, the playbook path is relative to it',
+  galaxyRequirements: 'Galaxy requirements file',
+  galaxyRequirementsHint: 'Roles and collections from this file are installed before every run',
+  additionalRepositories: 'Additional repositories',
+  additionalRepositoriesHint: 'Checked out next to the template repository before the run',
+  notifications: 'Notifications',
+  notificationTargets: 'Notification targets',
+  notificationTargetsHint: 'Project default targets are notified if none are selected',
+  newNotificationTarget: 'New Notification Target',
+  editNotificationTarget: 'Edit Notification Target',
+  deleteNotificationTarget: 'Delete notification target',
+  askDeleteNotificationTarget: 'Do you really want to delete this notification target?',
+  notifyAboutAllTemplates: 'Notify about templates without own notification targets',
+  projectDefault: 'Project default',
+  url: 'URL',
+  target_url_required: 'URL is required',
+  verbosity: 'Verbosity',
+  allowedRoles: 'Roles allowed to run (owners always can)',
   cliArgsJsonArrayExampleIMyinventoryshPrivatekeythe2: 'CLI-Argumente (JSON array). Beispiel: [ "-i", "@myinventory.sh", "--private-key=/there/id_rsa", "-vvvv" ]',
   allowCliArgsInTask: 'CLI-Argumente in der Aufgabe zulassen',
   docs: 'Dokumentation',
@@ -210,6 +244,9 @@ export default {
   user_credentials_required: 'Benutzeranmeldeinformationen sind erforderlich',
   type_required: 'Typ ist erforderlich',
   path_required: 'Pfad zur Inventar-Datei ist erforderlich',
+  url_required: 'Inventory URL is required',
+  inventoryUrl: 'Inventory URL',
+  inventoryUrlCredentialsOptional: 'URL Credentials (Optional)',
   private_key_required: 'Privater Schlüssel ist erforderlich',
   project_name_required: 'Projektname ist erforderlich',
   repository_required: 'Repository ist erforderlich',
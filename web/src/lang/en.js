@@ -2,6 +2,7 @@ export default {
   incorrectUsrPwd: 'Incorrect login or password',
   askDeleteUser: 'Do you really want to delete this user?',
   askDeleteTemp: 'Do you really want to delete this template?',
+  askDeleteTempWithSchedules: 'This template has {count} schedule(s) which will be deleted with it. Do you really want to delete this template?',
   askDeleteEnv: 'Do you really want to delete this environment?',
   askDeleteInv: 'Do you really want to delete this inventor?',
   askDeleteKey: 'Do you really want to delete this key?',
@@ -84,6 +85,7 @@ export default {
   keyName: 'Key Name',
   loginOptional: 'Login (Optional)',
   usernameOptional: 'Username (Optional)',
+  passphraseOptional: 'Passphrase (Optional)',
   privateKey: 'Private Key',
   override: 'Override',
   useThisTypeOfKeyForHttpsRepositoriesAndForPlaybook: 'Use this type of key for HTTPS repositories and for playbooks which use non-SSH connections.',
@@ -167,6 +169,39 @@ export default {
   readThe: 'Read the',
   toLearnMoreAboutCron: 'to learn more about Cron.',
   suppressSuccessAlerts: 'Suppress success alerts',
+  syntaxCheck: 'Check playbook syntax before the run',
+  allowedWindow: 'Restrict runs to a time window',
+  allowedWindowDays: 'Days',
+  allowedWindowDaysHint: 'All days if empty',
+  allowedWindowFrom: 'From',
+  allowedWindowTo: 'To',
+  allowedWindowTimeFormat: 'Time in format HH:MM',
+  allowedWindowTimezone: 'Timezone',
+  allowedWindowHold: 'Hold tasks until the window opens',
+  favorite: 'Favorite',
+  taskOutputRetentionDays: 'Keep task output, days (Optional)',
+  taskOutputRetentionDaysHint: 'Older output of tasks is deleted, tasks are kept. 0 - keep forever.',
+  taskRetentionDays: 'Keep finished tasks, days (Optional)',
+  taskRetentionDaysHint: 'Older finished tasks are deleted with their output. 0 - keep forever.',
+  workingDirectory: 'Working directory',
+  workingDirectoryHint: 'Directory in the repository which the playbook runs in, the playbook path is relative to it',
+  galaxyRequirements: 'Galaxy requirements file',
+  galaxyRequirementsHint: 'Roles and collections from this file are installed before every run',
+  additionalRepositories: 'Additional repositories',
+  additionalRepositoriesHint: 'Checked out next to the template repository before the run',
+  notifications: 'Notifications',
+  notificationTargets: 'Notification targets',
+  notificationTargetsHint: 'Project default targets are notified if none are selected',
+  newNotificationTarget: 'New Notification Target',
+  editNotificationTarget: 'Edit Notification Target',
+  deleteNotificationTarget: 'Delete notification target',
+  askDeleteNotificationTarget: 'Do you really want to delete this notification target?',
+  notifyAboutAllTemplates: 'Notify about templates without own notification targets',
+  projectDefault: 'Project default',
+  url: 'URL',
+  target_url_required: 'URL is required',
+  verbosity: 'Verbosity',
+  allowedRoles: 'Roles allowed to run (owners always can)',
   cliArgsJsonArrayExampleIMyinventoryshPrivatekeythe2: 'CLI Args (JSON array). Example: [ "-i", "@myinventory.sh", "--private-key=/there/id_rsa", "-vvvv" ]',
   allowCliArgsInTask: 'Allow CLI args in Task',
   docs: 'docs',
@@ -211,6 +246,9 @@ export default {
   user_credentials_required: 'User credentials are required',
   type_required: 'Type is required',
   path_required: 'Path to Inventory file is required',
+  url_required: 'Inventory URL is required',
+  inventoryUrl: 'Inventory URL',
+  inventoryUrlCredentialsOptional: 'URL Credentials (Optional)',
   private_key_required: 'Private key is required',
   project_name_required: 'Project name is required',
   repository_required: 'Repository is required',
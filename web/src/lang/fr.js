@@ -84,6 +84,7 @@ export default {
   keyName: 'Nom de la clé',
   loginOptional: 'Connexion (facultatif)',
   usernameOptional: 'Nom d\'utilisateur (facultatif)',
+  passphraseOptional: 'Phrase secrète (facultatif)',
   privateKey: 'Clé privée',
   override: 'Remplacer',
   useThisTypeOfKeyForHttpsRepositoriesAndForPlaybook: 'Utilisez ce type de clé pour les référentiels HTTPS et pour les playbooks qui utilisent des connexions non-SSH.',
@@ -166,6 +167,39 @@ export default {
   readThe: 'Lire la',
   toLearnMoreAboutCron: 'pour en savoir plus sur Cron.',
   suppressSuccessAlerts: 'Supprimer les alertes de réussite',
+  syntaxCheck: 'Vérifier la syntaxe du playbook avant l\'exécution',
+  allowedWindow: 'Limiter les exécutions à une plage horaire',
+  allowedWindowDays: 'Jours',
+  allowedWindowDaysHint: 'Tous les jours si vide',
+  allowedWindowFrom: 'De',
+  allowedWindowTo: 'À',
+  allowedWindowTimeFormat: 'Heure au format HH:MM',
+  allowedWindowTimezone: 'Fuseau horaire',
+  allowedWindowHold: 'Retenir les tâches jusqu\'à l\'ouverture de la plage',
+  favorite: 'Favorite',
+  taskOutputRetentionDays: 'Keep task output, days (Optional)',
+  taskOutputRetentionDaysHint: 'Older output of tasks is deleted, tasks are kept. 0 - keep forever.',
+  taskRetentionDays: 'Keep finished tasks, days (Optional)',
+  taskRetentionDaysHint: 'Older finished tasks are deleted with their output. 0 - keep forever.',
+  workingDirectory: 'Working directory',
+  workingDirectoryHint: 'Directory in the repository which the playbook runs in, the playbook path is relative to it',
+  galaxyRequirements: 'Galaxy requirements file',
+  galaxyRequirementsHint: 'Roles and collections from this file are installed before every run',
+  additionalRepositories: 'Additional repositories',
+  additionalRepositoriesHint: 'Checked out next to the template repository before the run',
+  notifications: 'Notifications',
+  notificationTargets: 'Notification targets',
+  notificationTargetsHint: 'Project default targets are notified if none are selected',
+  newNotificationTarget: 'New Notification Target',
+  editNotificationTarget: 'Edit Notification Target',
+  deleteNotificationTarget: 'Delete notification target',
+  askDeleteNotificationTarget: 'Do you really want to delete this notification target?',
+  notifyAboutAllTemplates: 'Notify about templates without own notification targets',
+  projectDefault: 'Project default',
+  url: 'URL',
+  target_url_required: 'URL is required',
+  verbosity: 'Verbosity',
+  allowedRoles: 'Roles allowed to run (owners always can)',
   cliArgsJsonArrayExampleIMyinventoryshPrivatekeythe2: 'Arguments CLI (tableau JSON). Exemple: [ "-i", "@myinventory.sh", "--private-key=/there/id_rsa", "-vvvv" ]',
   allowCliArgsInTask: 'Autoriser les arguments CLI dans la tâche',
   docs: 'docs',
@@ -207,6 +241,9 @@ export default {
   user_credentials_required: 'Les informations d\'identification de l\'utilisateur sont requises',
   type_required: 'Le type est requis',
   path_required: 'Le chemin vers le fichier d\'inventaire est requis',
+  url_required: 'Inventory URL is required',
+  inventoryUrl: 'Inventory URL',
+  inventoryUrlCredentialsOptional: 'URL Credentials (Optional)',
   private_key_required: 'La clé privée est requise',
   project_name_required: 'Le nom du projet est requis',
   repository_required: 'Le dépôt est requis',
@@ -84,6 +84,7 @@ export default {
   keyName: 'Nome da Chave',
   loginOptional: 'Início de sessão (Opcional)',
   usernameOptional: 'Nome de utilizador (Opcional)',
+  passphraseOptional: 'Frase secreta (Opcional)',
   privateKey: 'Chave Privada',
   override: 'Substituir',
   useThisTypeOfKeyForHttpsRepositoriesAndForPlaybook: 'Utilize este tipo de chave para repositórios HTTPS e para playbooks que utilizem ligações não SSH.',
@@ -166,6 +167,39 @@ export default {
   readThe: 'Leia o',
   toLearnMoreAboutCron: 'para saber mais sobre o Cron.',
   suppressSuccessAlerts: 'Suprimir alertas de sucesso',
+  syntaxCheck: 'Verificar a sintaxe do playbook antes da execução',
+  allowedWindow: 'Restringir execuções a uma janela de tempo',
+  allowedWindowDays: 'Dias',
+  allowedWindowDaysHint: 'Todos os dias se vazio',
+  allowedWindowFrom: 'De',
+  allowedWindowTo: 'Até',
+  allowedWindowTimeFormat: 'Hora no formato HH:MM',
+  allowedWindowTimezone: 'Fuso horário',
+  allowedWindowHold: 'Reter tarefas até a janela abrir',
+  favorite: 'Favorite',
+  taskOutputRetentionDays: 'Keep task output, days (Optional)',
+  taskOutputRetentionDaysHint: 'Older output of tasks is deleted, tasks are kept. 0 - keep forever.',
+  taskRetentionDays: 'Keep finished tasks, days (Optional)',
+  taskRetentionDaysHint: 'Older finished tasks are deleted with their output. 0 - keep forever.',
+  workingDirectory: 'Working directory',
+  workingDirectoryHint: 'Directory in the repository which the playbook runs in, the playbook path is relative to it',
+  galaxyRequirements: 'Galaxy requirements file',
+  galaxyRequirementsHint: 'Roles and collections from this file are installed before every run',
+  additionalRepositories: 'Additional repositories',
+  additionalRepositoriesHint: 'Checked out next to the template repository before the run',
+  notifications: 'Notifications',
+  notificationTargets: 'Notification targets',
+  notificationTargetsHint: 'Project default targets are notified if none are selected',
+  newNotificationTarget: 'New Notification Target',
+  editNotificationTarget: 'Edit Notification Target',
+  deleteNotificationTarget: 'Delete notification target',
+  askDeleteNotificationTarget: 'Do you really want to delete this notification target?',
+  notifyAboutAllTemplates: 'Notify about templates without own notification targets',
+  projectDefault: 'Project default',
+  url: 'URL',
+  target_url_required: 'URL is required',
+  verbosity: 'Verbosity',
+  allowedRoles: 'Roles allowed to run (owners always can)',
   cliArgsJsonArrayExampleIMyinventoryshPrivatekeythe2: 'Argumentos CLI (matriz JSON). Exemplo: [ "-i", "@myinventory.sh", "--private-key=/there/id_rsa", "-vvvv" ]',
   allowCliArgsInTask: 'Permitir argumentos CLI na Tarefa',
   docs: 'documentação',
@@ -210,6 +244,9 @@ export default {
   user_credentials_required: 'Credenciais de utilizador obrigatórias',
   type_required: 'Tipo obrigatório',
   path_required: 'Caminho para o ficheiro de Inventário obrigatório',
+  url_required: 'Inventory URL is required',
+  inventoryUrl: 'Inventory URL',
+  inventoryUrlCredentialsOptional: 'URL Credentials (Optional)',
   private_key_required: 'Chave privada obrigatória',
   project_name_required: 'Nome do projeto obrigatório',
   repository_required: 'Repositório obrigatório',
@@ -84,6 +84,7 @@ export default {
   keyName: 'Имя ключа',
   loginOptional: 'Логин (дополнительно)',
   usernameOptional: 'Имя пользователя (дополнительно)',
+  passphraseOptional: 'Парольная фраза (дополнительно)',
   privateKey: 'Закрытый ключ',
   override: 'Переопределить',
   useThisTypeOfKeyForHttpsRepositoriesAndForPlaybook: 'Используйте этот тип ключа для HTTPS-репозиториев и для плейбуков, использующих не-SSH-соединения.',
@@ -166,6 +167,39 @@ export default {
   readThe: 'Читать',
   toLearnMoreAboutCron: 'чтобы узнать больше о Крон.',
   suppressSuccessAlerts: 'Скрыть оповещения об успехе',
+  syntaxCheck: 'Проверять синтаксис плейбука перед запуском',
+  allowedWindow: 'Ограничить запуск временным окном',
+  allowedWindowDays: 'Дни',
+  allowedWindowDaysHint: 'Все дни, если пусто',
+  allowedWindowFrom: 'С',
+  allowedWindowTo: 'До',
+  allowedWindowTimeFormat: 'Время в формате ЧЧ:ММ',
+  allowedWindowTimezone: 'Часовой пояс',
+  allowedWindowHold: 'Откладывать задачи до открытия окна',
+  favorite: 'Favorite',
+  taskOutputRetentionDays: 'Keep task output, days (Optional)',
+  taskOutputRetentionDaysHint: 'Older output of tasks is deleted, tasks are kept. 0 - keep forever.',
+  taskRetentionDays: 'Keep finished tasks, days (Optional)',
+  taskRetentionDaysHint: 'Older finished tasks are deleted with their output. 0 - keep forever.',
+  workingDirectory: 'Working directory',
+  workingDirectoryHint: 'Directory in the repository which the playbook runs in, the playbook path is relative to it',
+  galaxyRequirements: 'Galaxy requirements file',
+  galaxyRequirementsHint: 'Roles and collections from this file are installed before every run',
+  additionalRepositories: 'Additional repositories',
+  additionalRepositoriesHint: 'Checked out next to the template repository before the run',
+  notifications: 'Notifications',
+  notificationTargets: 'Notification targets',
+  notificationTargetsHint: 'Project default targets are notified if none are selected',
+  newNotificationTarget: 'New Notification Target',
+  editNotificationTarget: 'Edit Notification Target',
+  deleteNotificationTarget: 'Delete notification target',
+  askDeleteNotificationTarget: 'Do you really want to delete this notification target?',
+  notifyAboutAllTemplates: 'Notify about templates without own notification targets',
+  projectDefault: 'Project default',
+  url: 'URL',
+  target_url_required: 'URL is required',
+  verbosity: 'Verbosity',
+  allowedRoles: 'Roles allowed to run (owners always can)',
   cliArgsJsonArrayExampleIMyinventoryshPrivatekeythe2: 'Аргументы CLI (массив JSON). Например: [ "-i", "@myinventory.sh", "--private-key=/there/id_rsa", "-vvvv" ]',
   allowCliArgsInTask: 'Разрешить рагументы CLI в задаче',
   docs: 'Документация',
@@ -210,6 +244,9 @@ export default {
   user_credentials_required: 'Требуются учетные данные пользователя',
   type_required: 'Требуется тип',
   path_required: 'Требуется путь до файла инвенторя',
+  url_required: 'Inventory URL is required',
+  inventoryUrl: 'Inventory URL',
+  inventoryUrlCredentialsOptional: 'URL Credentials (Optional)',
   private_key_required: 'Требуется приватный ключ',
   project_name_required: 'Требуется имя проекта',
   репозиторий_required: 'Требуется репозиторий',
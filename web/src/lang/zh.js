@@ -84,6 +84,7 @@ export default {
   keyName: '凭据名称',
   loginOptional: '登录名 (可选)',
   usernameOptional: '用户名 (可选)',
+  passphraseOptional: '密码短语 (可选)',
   privateKey: '私钥',
   override: '覆盖',
   useThisTypeOfKeyForHttpsRepositoriesAndForPlaybook: '对于 HTTPS 存储库和使用非 SSH 连接的 playbook，请使用此类密钥。',
@@ -166,6 +167,39 @@ export default {
   readThe: '阅读',
   toLearnMoreAboutCron: '了解有关 Cron 的更多信息。',
   suppressSuccessAlerts: 'Suppress success alerts',
+  syntaxCheck: '运行前检查 Playbook 语法',
+  allowedWindow: '限制在时间窗口内运行',
+  allowedWindowDays: '日期',
+  allowedWindowDaysHint: '为空表示每天',
+  allowedWindowFrom: '从',
+  allowedWindowTo: '到',
+  allowedWindowTimeFormat: '时间格式为 HH:MM',
+  allowedWindowTimezone: '时区',
+  allowedWindowHold: '将任务保留到窗口开启',
+  favorite: 'Favorite',
+  taskOutputRetentionDays: 'Keep task output, days (Optional)',
+  taskOutputRetentionDaysHint: 'Older output of tasks is deleted, tasks are kept. 0 - keep forever.',
+  taskRetentionDays: 'Keep finished tasks, days (Optional)',
+  taskRetentionDaysHint: 'Older finished tasks are deleted with their output. 0 - keep forever.',
+  workingDirectory: 'Working directory',
+  workingDirectoryHint: 'Directory in the repository which the playbook runs in, the playbook path is relative to it',
+  galaxyRequirements: 'Galaxy requirements file',
+  galaxyRequirementsHint: 'Roles and collections from this file are installed before every run',
+  additionalRepositories: 'Additional repositories',
+  additionalRepositoriesHint: 'Checked out next to the template repository before the run',
+  notifications: 'Notifications',
+  notificationTargets: 'Notification targets',
+  notificationTargetsHint: 'Project default targets are notified if none are selected',
+  newNotificationTarget: 'New Notification Target',
+  editNotificationTarget: 'Edit Notification Target',
+  deleteNotificationTarget: 'Delete notification target',
+  askDeleteNotificationTarget: 'Do you really want to delete this notification target?',
+  notifyAboutAllTemplates: 'Notify about templates without own notification targets',
+  projectDefault: 'Project default',
+  url: 'URL',
+  target_url_required: 'URL is required',
+  verbosity: 'Verbosity',
+  allowedRoles: 'Roles allowed to run (owners always can)',
   cliArgsJsonArrayExampleIMyinventoryshPrivatekeythe2: 'CLI 参数 (JSON 数组格式). 例如: [ "-i", "@myinventory.sh", "--private-key=/there/id_rsa", "-vvvv" ]',
   allowCliArgsInTask: '允许任务中自定义 CLI 参数',
   docs: '文档',
@@ -210,6 +244,9 @@ export default {
   user_credentials_required: '用户凭证是必填项',
   type_required: '类型是是必填项',
   path_required: '主机配置文件路径是必填项',
+  url_required: 'Inventory URL is required',
+  inventoryUrl: 'Inventory URL',
+  inventoryUrlCredentialsOptional: 'URL Credentials (Optional)',
   private_key_required: '私钥是是必填项',
   project_name_required: '项目名称是必填项',
   repository_required: '存储库地址是必填项',
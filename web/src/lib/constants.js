@@ -36,3 +36,8 @@ export const USER_ROLES = [{
   slug: 'guest',
   title: 'Guest',
 }];
+
+export const VERBOSITY_LEVELS = [0, 1, 2, 3, 4].map((value) => ({
+  value,
+  title: value === 0 ? 'Default' : `-${'v'.repeat(value)}`,
+}));
@@ -10,6 +10,7 @@ import Inventory from '../views/project/Inventory.vue';
 import Keys from '../views/project/Keys.vue';
 import Repositories from '../views/project/Repositories.vue';
 import Team from '../views/project/Team.vue';
+import Notifications from '../views/project/Notifications.vue';
 import Users from '../views/Users.vue';
 import Auth from '../views/Auth.vue';
 import New from '../views/project/New.vue';
@@ -77,6 +78,10 @@ const routes = [
     path: '/project/:projectId/team',
     component: Team,
   },
+  {
+    path: '/project/:projectId/notifications',
+    component: Notifications,
+  },
   {
     path: '/auth/login',
     component: Auth,